@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"log"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// 租户数据迁移命令
+//
+//	go run ./cmd/tenant export -tenant 100 -out tenant-100.zip
+//	go run ./cmd/tenant import -tenant 200 -in tenant-100.zip -on-conflict rename
+//	go run ./cmd/tenant delete -tenant 100 -confirm 100
+//	go run ./cmd/tenant verify-deletion -job 1
+//	go run ./cmd/tenant retention
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+	config.Init()
+	database.Init()
+
+	switch os.Args[1] {
+	case "export":
+		runExport(os.Args[2:])
+	case "import":
+		runImport(os.Args[2:])
+	case "delete":
+		runDelete(os.Args[2:])
+	case "verify-deletion":
+		runVerifyDeletion(os.Args[2:])
+	case "retention":
+		services.NewRetentionService().RunAllPolicies()
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法: tenant export -tenant <ID> -out <文件>")
+	fmt.Fprintln(os.Stderr, "      tenant import -tenant <ID> -in <文件> [-on-conflict fail|rename|merge] [-rename-suffix <后缀>]")
+	fmt.Fprintln(os.Stderr, "      tenant delete -tenant <ID> -confirm <ID> [-batch 500]")
+	fmt.Fprintln(os.Stderr, "      tenant verify-deletion -job <任务ID>")
+	fmt.Fprintln(os.Stderr, "      tenant retention")
+	os.Exit(2)
+}
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	tenantID := fs.Uint("tenant", 100, "要导出的租户ID")
+	out := fs.String("out", "", "输出文件路径")
+	fs.Parse(args)
+
+	if *out == "" {
+		*out = fmt.Sprintf("tenant-%d.zip", *tenantID)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("创建输出文件失败: %v", err)
+	}
+	defer f.Close()
+
+	manifest, err := services.NewTenantTransferService().Export(uint(*tenantID), f)
+	if err != nil {
+		log.Fatalf("导出租户 %d 失败: %v", *tenantID, err)
+	}
+
+	for _, entry := range manifest.Entries {
+		log.Printf("%-26s %d", entry.Model, entry.Count)
+	}
+	log.Printf("租户 %d 已导出到 %s", *tenantID, *out)
+}
+
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	tenantID := fs.Uint("tenant", 0, "导入的目标租户ID")
+	in := fs.String("in", "", "租户归档文件路径")
+	onConflict := fs.String("on-conflict", services.ConflictFail, "用户名/邮箱冲突处理策略: fail, rename, merge")
+	renameSuffix := fs.String("rename-suffix", "", "rename策略下追加的后缀")
+	fs.Parse(args)
+
+	if *tenantID == 0 || *in == "" {
+		usage()
+	}
+
+	zr, err := zip.OpenReader(*in)
+	if err != nil {
+		log.Fatalf("打开归档失败: %v", err)
+	}
+	defer zr.Close()
+
+	report, err := services.NewTenantTransferService().Import(&zr.Reader, uint(*tenantID), services.TenantImportOptions{
+		OnConflict:   *onConflict,
+		RenameSuffix: *renameSuffix,
+	})
+	if err != nil {
+		log.Fatalf("导入失败: %v", err)
+	}
+
+	for model, count := range report.Imported {
+		log.Printf("%-26s %d", model, count)
+	}
+	for oldName, newName := range report.RenamedUsers {
+		log.Printf("用户 %s 已重命名为 %s", oldName, newName)
+	}
+	log.Printf("归档（源租户 %d）已导入到租户 %d", report.SourceTenantID, report.TargetTenantID)
+}
+
+func runDelete(args []string) {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	tenantID := fs.Uint("tenant", 0, "要删除的租户ID")
+	confirm := fs.Uint("confirm", 0, "再次输入租户ID以确认删除")
+	batchSize := fs.Int("batch", 500, "每批删除的记录数")
+	fs.Parse(args)
+
+	if *tenantID == 0 || *tenantID != *confirm {
+		log.Fatal("请通过 -confirm 再次输入租户ID以确认删除")
+	}
+
+	if err := database.DB.AutoMigrate(&models.TenantDeletionJob{}); err != nil {
+		log.Fatalf("迁移删除任务表失败: %v", err)
+	}
+
+	retentionService := services.NewRetentionService()
+	job, err := retentionService.CreateDeletionJob(uint(*tenantID), "cli", *batchSize)
+	if err != nil {
+		log.Fatalf("创建删除任务失败: %v", err)
+	}
+	if err := retentionService.RunDeletionJob(job); err != nil {
+		log.Fatalf("删除任务 %d 失败: %v", job.ID, err)
+	}
+
+	fmt.Println(job.Report)
+	log.Printf("删除任务 %d 状态 %s，报告摘要 %s", job.ID, job.Status, job.ReportDigest)
+}
+
+func runVerifyDeletion(args []string) {
+	fs := flag.NewFlagSet("verify-deletion", flag.ExitOnError)
+	jobID := fs.Uint("job", 0, "删除任务ID")
+	fs.Parse(args)
+
+	var job models.TenantDeletionJob
+	if err := database.DB.First(&job, *jobID).Error; err != nil {
+		log.Fatalf("删除任务 %d 不存在", *jobID)
+	}
+
+	clean, tables, err := services.NewRetentionService().VerifyDeletionJob(&job)
+	if err != nil {
+		log.Fatalf("校验失败: %v", err)
+	}
+	for _, t := range tables {
+		log.Printf("%-26s 剩余 %d", t.Table, t.Remaining)
+	}
+	if !clean {
+		log.Fatalf("租户 %d 仍有残留数据", job.TargetTenantID)
+	}
+	log.Printf("删除任务 %d 报告摘要校验通过，租户 %d 已无残留数据", job.ID, job.TargetTenantID)
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +14,36 @@ type Config struct {
 	JWTSecret      string
 	AIAPIKey       string
 	AIURL          string
+	FrontendURL    string // 前端地址，用于生成邀请链接等
+	PublicURL      string // 后端对外地址，用于生成单点登录回调地址
+	TOTPIssuer     string // 身份验证器App中显示的发行方名称
+
+	AccessTokenTTL  time.Duration // 访问令牌有效期
+	RefreshTokenTTL time.Duration // 刷新令牌有效期
+
+	ImpersonationTTL time.Duration // 管理员模拟登录令牌的最长有效期
+
+	LegacyQuestionReview string // 审核流程上线前已发布的题目：reviewed 视为已审核，submitted 改为待审核
+
+	// 邮件配置
+	MailDriver   string // smtp、file 或 log
+	MailFrom     string
+	MailFileDir  string // file驱动下邮件保存目录
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+
+	// 附件存储配置
+	AttachmentDriver    string // local 或 s3
+	AttachmentDir       string // local驱动下附件保存目录
+	AttachmentMaxSizeMB int    // 单个附件的大小上限
+	AttachmentQuotaMB   int    // 每个租户的默认附件配额，租户可单独设置
+	S3Endpoint          string // S3兼容服务地址，如 https://s3.amazonaws.com 或 MinIO 地址
+	S3Region            string
+	S3Bucket            string
+	S3AccessKey         string
+	S3SecretKey         string
 }
 
 var config *Config
@@ -25,6 +57,34 @@ func Init() {
 		JWTSecret:      getEnv("JWT_SECRET", "online-exam-system-jwt-secret-key-2024"),
 		AIAPIKey:       getEnv("AI_API_KEY", ""),
 		AIURL:          getEnv("AI_URL", "https://api.openai.com/v1/chat/completions"),
+		FrontendURL:    getEnv("FRONTEND_URL", "http://localhost:3000"),
+		PublicURL:      getEnv("PUBLIC_URL", "http://localhost:8080"),
+		TOTPIssuer:     getEnv("TOTP_ISSUER", "OnlineExam"),
+
+		AccessTokenTTL:  getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		ImpersonationTTL: getDurationEnv("IMPERSONATION_TTL", 30*time.Minute),
+
+		LegacyQuestionReview: getEnv("LEGACY_QUESTION_REVIEW", "reviewed"),
+
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@online-exam.local"),
+		MailFileDir:  getEnv("MAIL_FILE_DIR", "./mails"),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		AttachmentDriver:    getEnv("ATTACHMENT_DRIVER", "local"),
+		AttachmentDir:       getEnv("ATTACHMENT_DIR", "./uploads"),
+		AttachmentMaxSizeMB: getIntEnv("ATTACHMENT_MAX_SIZE_MB", 20),
+		AttachmentQuotaMB:   getIntEnv("ATTACHMENT_QUOTA_MB", 1024),
+		S3Endpoint:          getEnv("S3_ENDPOINT", ""),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:            getEnv("S3_BUCKET", ""),
+		S3AccessKey:         getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:         getEnv("S3_SECRET_KEY", ""),
 	}
 	AppConfig = config
 }
@@ -65,4 +125,22 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
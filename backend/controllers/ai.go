@@ -307,6 +307,16 @@ func getQuestionTypeText(questionType models.QuestionType) string {
 		return "判断题"
 	case models.ShortAnswer:
 		return "简答题"
+	case models.FillBlank:
+		return "填空题"
+	case models.Matching:
+		return "配对题"
+	case models.Ordering:
+		return "排序题"
+	case models.Numeric:
+		return "数值题"
+	case models.Material:
+		return "材料题"
 	default:
 		return "未知类型"
 	}
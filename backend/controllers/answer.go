@@ -5,6 +5,7 @@ import (
 	"online-exam-system/database"
 	"online-exam-system/middleware"
 	"online-exam-system/models"
+	"online-exam-system/services"
 	"online-exam-system/utils"
 	"strconv"
 	"time"
@@ -85,12 +86,24 @@ func SubmitAnswer(c *gin.Context) {
 		return
 	}
 
-	// 检查题目是否存在
-	var question models.Question
-	if err := utils.WithTenant(database.DB, tenantID).First(&question, req.QuestionID).Error; err != nil {
+	// 检查题目是否在试卷中，按组卷时的版本作答
+	questions, err := examQuestions(tenantID, exam.PaperID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取试卷题目失败"})
+		return
+	}
+	question, ok := questions[req.QuestionID]
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "题目不存在"})
 		return
 	}
+	if question.Type == models.Material {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "材料题不需要作答，请作答其子题"})
+		return
+	}
+
+	// 选择题作答统一保存为所选选项的ID
+	req.Answer = normalizeExamAnswer(question, req.Answer)
 
 	// 检查或创建答案记录
 	var answer models.Answer
@@ -164,13 +177,20 @@ func SubmitExam(c *gin.Context) {
 		return
 	}
 
+	// 试卷中的题目（组卷时的版本）
+	questions, err := examQuestions(tenantID, exam.PaperID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取试卷题目失败"})
+		return
+	}
+
 	// 保存所有答案
 	for _, answerReq := range req.Answers {
-		// 检查题目是否存在
-		var question models.Question
-		if err := utils.WithTenant(database.DB, tenantID).First(&question, answerReq.QuestionID).Error; err != nil {
-			continue // 跳过不存在的题目
+		question, ok := questions[answerReq.QuestionID]
+		if !ok || question.Type == models.Material {
+			continue // 跳过不在试卷中的题目和材料题（材料题本身不作答）
 		}
+		answerReq.Answer = normalizeExamAnswer(question, answerReq.Answer)
 
 		// 检查或创建答案记录
 		var answer models.Answer
@@ -192,7 +212,7 @@ func SubmitExam(c *gin.Context) {
 	}
 
 	// 计算成绩
-	score, totalScore := calculateScore(record.ID)
+	score, totalScore := calculateScore(record.ID, questions)
 
 	// 更新考试记录
 	now := time.Now()
@@ -204,6 +224,12 @@ func SubmitExam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交试卷失败"})
 		return
 	}
+	recordAuditDetail(c, services.AuditExamGrade, "exam_record", record.ID, gin.H{
+		"exam_id":     exam.ID,
+		"student_id":  record.StudentID,
+		"score":       score,
+		"total_score": totalScore,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "试卷提交成功",
@@ -263,9 +289,9 @@ func GetExamResult(c *gin.Context) {
 		return
 	}
 
-	// 获取试卷题目
-	var questions []models.Question
-	if err := database.DB.Preload("Subject").Model(&exam.Paper).Association("Questions").Find(&questions); err != nil {
+	// 获取试卷题目，按组卷时的版本显示和评分
+	questions, err := services.LoadPaperQuestions(database.DB, tenantID, exam.PaperID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目失败"})
 		return
 	}
@@ -283,17 +309,20 @@ func GetExamResult(c *gin.Context) {
 		answerMap[answer.QuestionID] = answer.Answer
 	}
 
-	// 构建详细答案列表
+	// 构建详细答案列表，材料题排在其子题之前，仅用于展示
 	var answerDetails []AnswerDetail
-	var correctCount int
+	var correctCount, totalCount int
 	var totalScore int
 
 	for _, question := range questions {
+		if question.Type == models.Material {
+			answerDetails = append(answerDetails, AnswerDetail{Question: question})
+			continue
+		}
+		totalCount++
 		studentAnswer := answerMap[question.ID]
-		isCorrect := checkAnswer(question, studentAnswer)
-		score := 0
+		score, isCorrect := gradeAnswer(question, studentAnswer)
 		if isCorrect {
-			score = question.Score
 			correctCount++
 		}
 		totalScore += question.Score
@@ -313,7 +342,7 @@ func GetExamResult(c *gin.Context) {
 		Score:        getIntValue(record.Score),
 		TotalScore:   totalScore,
 		CorrectCount: correctCount,
-		TotalCount:   len(questions),
+		TotalCount:   totalCount,
 	})
 }
 
@@ -351,24 +380,71 @@ func GetStudentAnswers(c *gin.Context) {
 	c.JSON(http.StatusOK, answers)
 }
 
-// 计算成绩
-func calculateScore(examRecordID uint) (int, int) {
+// 计算成绩，questions 为试卷中的题目（组卷时的版本）
+func calculateScore(examRecordID uint, questions map[uint]models.Question) (int, int) {
 	var answers []models.Answer
-	database.DB.Preload("Question").Where("exam_record_id = ?", examRecordID).Find(&answers)
+	database.DB.Where("exam_record_id = ?", examRecordID).Find(&answers)
 
 	var score, totalScore int
 	for _, answer := range answers {
-		totalScore += answer.Question.Score
-		if checkAnswer(answer.Question, answer.Answer) {
-			score += answer.Question.Score
+		question, ok := questions[answer.QuestionID]
+		if !ok {
+			continue // 不在试卷中的题目不计分
 		}
+		answer.Question = question
+		if answer.Question.Type == models.Material {
+			continue // 材料题不计分，分值已包含在子题中
+		}
+		totalScore += answer.Question.Score
+		answerScore, isCorrect := gradeAnswer(answer.Question, answer.Answer)
+		score += answerScore
+		// 保存每道题的得分，结构化题型可能得部分分
+		database.DB.Model(&models.Answer{}).Where("id = ?", answer.ID).
+			Updates(map[string]interface{}{"score": answerScore, "is_correct": isCorrect})
 	}
 
 	return score, totalScore
 }
 
+// examQuestions 试卷中的题目（组卷时的版本），按题目ID索引
+func examQuestions(tenantID, paperID uint) (map[uint]models.Question, error) {
+	questions, err := services.LoadPaperQuestions(database.DB, tenantID, paperID)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]models.Question, len(questions))
+	for _, question := range questions {
+		result[question.ID] = question
+	}
+	return result, nil
+}
+
+// normalizeExamAnswer 选择题作答统一保存为所选选项的ID，其他题型原样保存
+func normalizeExamAnswer(question models.Question, answer string) string {
+	if services.IsChoiceQuestionType(question.Type) && len(question.Choices) > 0 {
+		return services.NormalizeChoiceAnswer(answer, question.Choices)
+	}
+	return answer
+}
+
+// gradeAnswer 计算一道题的得分和是否完全正确，结构化题型（填空、配对、排序、数值）按比例给分
+func gradeAnswer(question models.Question, studentAnswer string) (int, bool) {
+	if services.IsStructuredQuestionType(question.Type) {
+		fraction := services.GradeStructuredAnswer(question, studentAnswer)
+		return services.QuestionScore(question.Score, fraction), fraction >= 1
+	}
+	if checkAnswer(question, studentAnswer) {
+		return question.Score, true
+	}
+	return 0, false
+}
+
 // 检查答案是否正确
 func checkAnswer(question models.Question, studentAnswer string) bool {
+	// 选择题按所选选项判断，尚未迁移到选项表的题目按答案字符串比较
+	if services.IsChoiceQuestionType(question.Type) && len(question.Choices) > 0 {
+		return services.GradeChoiceAnswer(question.Choices, studentAnswer)
+	}
 	switch question.Type {
 	case models.SingleChoice, models.TrueFalse:
 		return question.Answer == studentAnswer
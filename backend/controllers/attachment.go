@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AttachmentResponse 附件信息，url 为临时访问地址，reference 为在题目内容中引用该附件的写法
+type AttachmentResponse struct {
+	models.Attachment
+	URL       string `json:"url"`
+	Reference string `json:"reference"`
+}
+
+func newAttachmentResponse(attachment *models.Attachment) AttachmentResponse {
+	return AttachmentResponse{
+		Attachment: *attachment,
+		URL:        services.SignedAttachmentURL(attachment),
+		Reference:  fmt.Sprintf("attachment://%d", attachment.ID),
+	}
+}
+
+// 上传附件（图片、音频、视频、PDF），租户内相同内容的文件只保存一份
+func UploadAttachment(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传附件"})
+		return
+	}
+	defer file.Close()
+
+	maxSize := services.MaxAttachmentSize()
+	if header.Size > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件大小不能超过%dMB", maxSize>>20)})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+
+	attachment, deduplicated, err := services.NewAttachmentService().Upload(currentActor(c), header.Filename, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if !deduplicated {
+		status = http.StatusCreated
+		recordAudit(c, services.AuditAttachmentUpload, "attachment", attachment.ID, nil, attachment)
+	}
+	c.JSON(status, gin.H{
+		"attachment":   newAttachmentResponse(attachment),
+		"deduplicated": deduplicated,
+	})
+}
+
+// 获取附件列表：默认为当前用户上传的附件，内容管理者可以查看租户内全部附件；unused=true 只列出未被题目引用的附件
+func GetAttachments(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	offset := (page - 1) * size
+	tenantID := middleware.GetTenantID(c)
+
+	query := utils.WithTenant(database.DB, tenantID).Model(&models.Attachment{})
+	if !permissionService.HasPermission(tenantID, middleware.GetCurrentUserRole(c), middleware.GetCurrentRoleID(c), services.PermContentManage) {
+		query = query.Where("created_by = ?", middleware.GetCurrentUserID(c))
+	}
+	if c.Query("unused") == "true" {
+		query = query.Where("id NOT IN (SELECT attachment_id FROM question_attachments WHERE tenant_id = ?)", tenantID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var attachments []models.Attachment
+	if err := query.Offset(offset).Limit(size).Order("created_at DESC").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取附件列表失败"})
+		return
+	}
+	items := make([]AttachmentResponse, len(attachments))
+	for i := range attachments {
+		items[i] = newAttachmentResponse(&attachments[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attachments": items,
+		"total":       total,
+		"page":        page,
+		"size":        size,
+	})
+}
+
+// 获取租户的附件空间使用情况
+func GetAttachmentUsage(c *gin.Context) {
+	used, quota := services.NewAttachmentService().Usage(middleware.GetTenantID(c))
+	c.JSON(http.StatusOK, gin.H{
+		"used":     used,
+		"quota":    quota,
+		"max_size": services.MaxAttachmentSize(),
+	})
+}
+
+// 删除附件，被题目引用的附件不能删除
+func DeleteAttachment(c *gin.Context) {
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+	if !accessService.CanManage(currentActor(c), attachment.CreatedBy) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限删除此附件"})
+		return
+	}
+	if err := services.NewAttachmentService().Delete(attachment); err != nil {
+		if errors.Is(err, services.ErrAttachmentInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除附件失败"})
+		return
+	}
+	recordAudit(c, services.AuditAttachmentDelete, "attachment", attachment.ID, attachment, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "附件删除成功"})
+}
+
+// 获取单个附件的信息和临时访问地址
+func GetAttachment(c *gin.Context) {
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+	if !services.NewAttachmentService().CanRead(currentActor(c), attachment) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此附件"})
+		return
+	}
+	c.JSON(http.StatusOK, newAttachmentResponse(attachment))
+}
+
+// 批量获取附件的临时访问地址，用于显示题目中引用的附件；没有权限或不存在的附件不返回
+func ResolveAttachments(c *gin.Context) {
+	var req struct {
+		IDs []uint `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多获取200个附件"})
+		return
+	}
+
+	var attachments []models.Attachment
+	utils.WithTenant(database.DB, middleware.GetTenantID(c)).Where("id IN ?", req.IDs).Find(&attachments)
+	readable := services.NewAttachmentService().Readable(currentActor(c), attachments)
+	items := make([]AttachmentResponse, 0, len(readable))
+	for i := range readable {
+		items = append(items, newAttachmentResponse(&readable[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": items})
+}
+
+// 通过临时地址读取附件内容（无需登录，由地址中的签名授权），支持按范围读取以便播放音视频
+func ServeAttachmentFile(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的附件ID"})
+		return
+	}
+	tenantID, _ := strconv.ParseUint(c.Query("tenant"), 10, 32)
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !services.VerifyAttachmentSignature(uint(tenantID), uint(id), expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "附件地址无效或已过期"})
+		return
+	}
+
+	var attachment models.Attachment
+	if err := utils.WithTenant(database.DB, uint(tenantID)).First(&attachment, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+	reader, err := services.NewAttachmentService().Open(&attachment)
+	if err != nil {
+		if errors.Is(err, services.ErrAttachmentObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取附件失败"})
+		return
+	}
+	defer reader.Close()
+
+	// 对象存储返回的内容不支持随机读取，读入内存（附件大小有上限）
+	content, ok := reader.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取附件失败"})
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Disposition", "inline; filename*=UTF-8''"+url.PathEscape(attachment.Filename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=3600")
+	http.ServeContent(c.Writer, c.Request, attachment.Filename, attachment.CreatedAt, content)
+}
+
+// findAttachment 按路径参数查找当前租户的附件，找不到时返回404
+func findAttachment(c *gin.Context) (*models.Attachment, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的附件ID"})
+		return nil, false
+	}
+	var attachment models.Attachment
+	if err := utils.WithTenant(database.DB, middleware.GetTenantID(c)).First(&attachment, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return nil, false
+	}
+	return &attachment, true
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志服务
+var auditService = services.NewAuditService()
+
+type AuditLogListResponse struct {
+	Logs  []models.AuditLog `json:"logs"`
+	Total int64             `json:"total"`
+	Page  int               `json:"page"`
+	Size  int               `json:"size"`
+}
+
+// newAuditEntry 根据当前请求生成审计日志，已登录时记录操作者（模拟登录时同时记录管理员）
+func newAuditEntry(c *gin.Context, action, resourceType string, resourceID uint) *models.AuditLog {
+	entry := &models.AuditLog{
+		TenantID:     middleware.GetTenantID(c),
+		Action:       action,
+		ResourceType: resourceType,
+		Method:       c.Request.Method,
+		Path:         c.Request.URL.Path,
+		IP:           c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+	}
+	if resourceID != 0 {
+		entry.ResourceID = strconv.FormatUint(uint64(resourceID), 10)
+	}
+	if userID, exists := c.Get("user_id"); exists {
+		entry.UserID, _ = userID.(uint)
+		entry.Username = c.GetString("username")
+		entry.ImpersonatorID = middleware.GetImpersonatorID(c)
+	}
+	return entry
+}
+
+// recordAudit 记录对资源的变更，新建时before为nil，删除时after为nil
+func recordAudit(c *gin.Context, action, resourceType string, resourceID uint, before, after interface{}) {
+	entry := newAuditEntry(c, action, resourceType, resourceID)
+	services.ApplyAuditDiff(entry, before, after)
+	auditService.Record(entry)
+}
+
+// auditRecorder 返回记录资源变更的函数（before为nil表示新建），在请求结束后（如后台导入任务中）也可使用
+func auditRecorder(c *gin.Context, action, resourceType string) func(resourceID uint, before, after interface{}) {
+	template := *newAuditEntry(c, action, resourceType, 0)
+	return func(resourceID uint, before, after interface{}) {
+		entry := template
+		entry.ResourceID = strconv.FormatUint(uint64(resourceID), 10)
+		services.ApplyAuditDiff(&entry, before, after)
+		auditService.Record(&entry)
+	}
+}
+
+// recordAuditDetail 记录不涉及资源快照的事件（登录、导入等）
+func recordAuditDetail(c *gin.Context, action, resourceType string, resourceID uint, detail interface{}) {
+	entry := newAuditEntry(c, action, resourceType, resourceID)
+	entry.Detail = services.AuditDetail(detail)
+	auditService.Record(entry)
+}
+
+// recordUserAudit 记录未登录请求中的用户事件（登录、通过邮件重置密码），操作者为该用户本人
+func recordUserAudit(c *gin.Context, tenantID uint, action string, userID uint, username string, detail interface{}) {
+	entry := newAuditEntry(c, action, "user", userID)
+	entry.TenantID = tenantID
+	entry.UserID = userID
+	entry.Username = username
+	entry.Detail = services.AuditDetail(detail)
+	auditService.Record(entry)
+}
+
+// bindAuditFilter 从查询参数解析审计日志筛选条件，时间支持RFC3339或日期（2006-01-02）
+func bindAuditFilter(c *gin.Context) (services.AuditFilter, bool) {
+	filter := services.AuditFilter{
+		Action:         c.Query("action"),
+		UserID:         c.Query("user_id"),
+		ImpersonatorID: c.Query("impersonator_id"),
+		ResourceType:   c.Query("resource_type"),
+		ResourceID:     c.Query("resource_id"),
+		IP:             c.Query("ip"),
+	}
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			date, dateErr := time.ParseInLocation("2006-01-02", value, time.Local)
+			if dateErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间参数 " + param.name})
+				return filter, false
+			}
+			// 按日期筛选时结束日期包含当天
+			if param.name == "to" {
+				date = date.AddDate(0, 0, 1)
+			}
+			t = date
+		}
+		*param.target = &t
+	}
+	return filter, true
+}
+
+// 查询审计日志
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	filter, ok := bindAuditFilter(c)
+	if !ok {
+		return
+	}
+	query := auditService.Query(middleware.GetTenantID(c), filter)
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuditLogListResponse{
+		Logs:  logs,
+		Total: total,
+		Page:  page,
+		Size:  size,
+	})
+}
+
+// 导出审计日志（CSV）
+func ExportAuditLogs(c *gin.Context) {
+	filter, ok := bindAuditFilter(c)
+	if !ok {
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	filename := fmt.Sprintf("audit-logs-%d-%s.csv", tenantID, time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	if _, err := auditService.ExportCSV(tenantID, filter, c.Writer); err != nil {
+		// 响应头可能已经发出，这里只能记录日志并中断连接
+		log.Printf("导出租户 %d 审计日志失败: %v", tenantID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,15 +1,18 @@
 package controllers
 
 import (
-	"crypto/sha256"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
+	"online-exam-system/config"
 	"online-exam-system/database"
 	"online-exam-system/middleware"
 	"online-exam-system/models"
 	"online-exam-system/services"
 	"online-exam-system/utils"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -18,22 +21,80 @@ import (
 // 全局缓存服务实例
 var cacheService = services.NewCacheService()
 
+// 全局会话服务实例
+var sessionService = services.NewSessionService()
+
+// 全局登录防护服务实例
+var loginGuard = services.NewLoginGuardService()
+
+// 全局邀请码服务实例
+var inviteService = services.NewInviteService()
+
+// 全局账号服务实例（找回密码、邮箱验证）
+var accountService = services.NewAccountService()
+
+// 全局两步验证服务实例
+var twoFactorService = services.NewTwoFactorService()
+
+// 全局认证服务实例（本地密码、LDAP）
+var authService = services.NewAuthService()
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 type RegisterRequest struct {
-	Username string          `json:"username" binding:"required"`
-	Email    string          `json:"email" binding:"required,email"`
-	Password string          `json:"password" binding:"required,min=6"`
-	Name     string          `json:"name" binding:"required"`
-	Role     models.UserRole `json:"role"`
+	Username   string          `json:"username" binding:"required"`
+	Email      string          `json:"email" binding:"required,email"`
+	Password   string          `json:"password" binding:"required"`
+	Name       string          `json:"name" binding:"required"`
+	Role       models.UserRole `json:"role"`
+	Department string          `json:"department"` // 院系，仅管理员创建或导入用户时使用
+}
+
+type InviteRegisterRequest struct {
+	InviteCode string `json:"invite_code" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	Name       string `json:"name" binding:"required"`
 }
 
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token                  string      `json:"token"`
+	RefreshToken           string      `json:"refresh_token"`
+	ExpiresIn              int64       `json:"expires_in"`                // 访问令牌剩余有效秒数
+	MustChangePassword     bool        `json:"must_change_password"`      // 为true时只能调用修改密码接口
+	TwoFactorSetupRequired bool        `json:"two_factor_setup_required"` // 为true时需先绑定两步验证
+	User                   models.User `json:"user"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // 身份验证器中的6位验证码或恢复码
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordByTokenRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"` // 同时退出该用户的所有设备
 }
 
 // 用户登录
@@ -45,31 +106,149 @@ func Login(c *gin.Context) {
 	}
 
 	tenantID := middleware.GetTenantID(c)
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	// 失败次数过多时按退避/锁定时间拒绝
+	if rejectThrottledLogin(c, tenantID, req.Username) {
+		return
+	}
+
+	// 按租户配置的认证源（LDAP、本地密码）验证身份
+	user, err := authService.Authenticate(services.Credentials{
+		TenantID: tenantID,
+		Username: req.Username,
+		Password: req.Password,
+	})
+	if err != nil {
+		var userID uint
+		if user != nil {
+			userID = user.ID
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrUserNotFound):
+			loginGuard.RecordFailure(tenantID, req.Username, userID, ip, userAgent, "invalid_credentials")
+			recordUserAudit(c, tenantID, services.AuditLoginFailed, userID, req.Username, gin.H{"reason": "invalid_credentials"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		case errors.Is(err, services.ErrAuthSourceUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "目录服务暂时不可用，请稍后再试"})
+		case errors.Is(err, services.ErrAccountDisabled), errors.Is(err, services.ErrLDAPNoRole),
+			errors.Is(err, services.ErrLDAPNotProvisioned), errors.Is(err, services.ErrUsernameTaken):
+			loginGuard.RecordFailure(tenantID, req.Username, userID, ip, userAgent, "account_denied")
+			recordUserAudit(c, tenantID, services.AuditLoginFailed, userID, req.Username, gin.H{"reason": "account_denied", "error": err.Error()})
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		}
+		return
+	}
+
+	beginLogin(c, tenantID, user)
+}
+
+// beginLogin 第一步身份验证（密码、目录或单点登录）通过后：
+// 已开启两步验证时先返回登录挑战，验证码通过后再签发令牌
+func beginLogin(c *gin.Context, tenantID uint, user *models.User) {
+	if user.TwoFactorEnabled {
+		challenge, err := twoFactorService.CreateChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成登录验证失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(services.TwoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	completeLogin(c, tenantID, user)
+}
+
+// 两步验证登录：提交登录挑战令牌和验证码（或恢复码）
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID := middleware.GetTenantID(c)
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
 
-	// 尝试从缓存获取用户信息（包含密码用于验证）
-	user, err := cacheService.GetUserByUsernameWithCache(tenantID, req.Username)
+	// 验证码同样受登录失败限制，避免并发猜测验证码或恢复码
+	challengeUser, err := twoFactorService.ChallengeUser(tenantID, req.ChallengeToken)
 	if err != nil {
-		log.Println("用户名或密码错误")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": services.ErrTwoFactorChallengeInvalid.Error()})
+		return
+	}
+	if rejectThrottledLogin(c, tenantID, challengeUser.Username) {
 		return
 	}
 
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+	user, err := twoFactorService.CompleteChallenge(tenantID, req.ChallengeToken, req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorCodeInvalid) {
+			loginGuard.RecordFailure(tenantID, user.Username, user.ID, ip, userAgent, "invalid_2fa_code")
+			recordUserAudit(c, tenantID, services.AuditLoginFailed, user.ID, user.Username, gin.H{"reason": "invalid_2fa_code"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": services.ErrTwoFactorChallengeInvalid.Error()})
 		return
 	}
 
-	// 生成token
-	token, err := middleware.GenerateToken(user)
+	completeLogin(c, tenantID, user)
+}
+
+// rejectThrottledLogin 该用户名或IP失败次数过多时按退避/锁定时间返回429
+func rejectThrottledLogin(c *gin.Context, tenantID uint, username string) bool {
+	ip := c.ClientIP()
+	wait := loginGuard.Check(tenantID, username, ip)
+	if wait <= 0 {
+		return false
+	}
+	retryAfter := int(wait.Seconds() + 0.5)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	loginGuard.RecordBlocked(tenantID, username, ip, c.Request.UserAgent())
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "登录失败次数过多，请稍后再试",
+		"retry_after": retryAfter,
+	})
+	return true
+}
+
+// completeLogin 身份验证全部通过后记录登录并签发令牌
+func completeLogin(c *gin.Context, tenantID uint, user *models.User) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	loginGuard.RecordSuccess(tenantID, user.Username, user.ID, ip, userAgent)
+	recordUserAudit(c, tenantID, services.AuditLogin, user.ID, user.Username, gin.H{
+		"auth_provider": user.AuthProvider,
+		"two_factor":    user.TwoFactorEnabled,
+	})
+
+	// 密码超过最长使用期限时要求修改
+	if !user.MustChangePassword && services.PasswordExpired(services.GetSecurityPolicy(tenantID), user) {
+		user.MustChangePassword = true
+		database.DB.Model(user).Update("must_change_password", true)
+	}
+
+	// 生成访问令牌和刷新令牌
+	pair, err := sessionService.CreateSession(tenantID, user, middleware.IssueAccessToken, ip, userAgent)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
 
 	// 缓存token信息（用于快速验证）
-	tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
-	cacheService.SetTokenCache(tenantID, tokenHash, user.ID, user.Username, user.Role)
+	cacheService.SetTokenCache(tenantID, services.HashToken(pair.AccessToken), user.ID, user.Username, user.Role, user.SessionVersion, pair.AccessExpiresAt)
 
 	// 更新用户缓存（登录成功后刷新缓存）
 	cacheService.SetUserCache(tenantID, user)
@@ -77,76 +256,251 @@ func Login(c *gin.Context) {
 	// 清除密码字段
 	user.Password = ""
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
-		User:  *user,
+	c.JSON(http.StatusOK, newLoginResponse(pair, *user))
+}
+
+// respondPasswordPolicyError 密码不符合策略时返回400及具体不满足的规则
+func respondPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      policyErr.Error(),
+		"violations": policyErr.Violations,
 	})
+	return true
 }
 
-// 用户注册（仅管理员可创建教师和学生账号）
-func Register(c *gin.Context) {
-	var req RegisterRequest
+func newLoginResponse(pair *services.TokenPair, user models.User) LoginResponse {
+	return LoginResponse{
+		Token:                  pair.AccessToken,
+		RefreshToken:           pair.RefreshToken,
+		ExpiresIn:              int64(time.Until(pair.AccessExpiresAt).Seconds()),
+		MustChangePassword:     user.MustChangePassword,
+		TwoFactorSetupRequired: services.TwoFactorSetupRequired(services.GetSecurityPolicy(user.TenantID), &user),
+		User:                   user,
+	}
+}
+
+// 刷新访问令牌（刷新令牌只能使用一次，使用后返回新的刷新令牌）
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 检查权限
-	currentRole := middleware.GetCurrentUserRole(c)
-	if currentRole != models.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以创建账号"})
+	tenantID := middleware.GetTenantID(c)
+
+	pair, user, err := sessionService.Rotate(tenantID, req.RefreshToken, middleware.IssueAccessToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			log.Printf("租户 %d 检测到刷新令牌重复使用，已撤销对应会话", tenantID)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
+	cacheService.SetTokenCache(tenantID, services.HashToken(pair.AccessToken), user.ID, user.Username, user.Role, user.SessionVersion, pair.AccessExpiresAt)
+
+	user.Password = ""
+	c.JSON(http.StatusOK, newLoginResponse(pair, *user))
+}
+
+// 退出登录：撤销当前访问令牌及其会话
+func Logout(c *gin.Context) {
+	var req LogoutRequest
+	// 请求体可选
+	_ = c.ShouldBindJSON(&req)
+
+	userID := middleware.GetCurrentUserID(c)
 	tenantID := middleware.GetTenantID(c)
+	tokenHash := c.GetString("token_hash")
 
-	// 检查用户名是否已存在
-	var existingUser models.User
-	if err := utils.WithTenant(database.DB, tenantID).Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名已存在"})
+	// 撤销当前访问令牌直到其自然过期
+	expiresAt := time.Now().Add(config.GetConfig().AccessTokenTTL)
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if claims, err := middleware.ParseToken(tokenString); err == nil {
+		expiresAt = middleware.TokenExpiresAt(claims)
+	}
+	sessionService.RevokeAccessToken(tenantID, tokenHash, expiresAt)
+
+	// 模拟登录令牌没有会话，只结束本次模拟，不影响被模拟用户自己的登录
+	if impersonatorID := middleware.GetImpersonatorID(c); impersonatorID != nil {
+		recordImpersonationEnd(c, tenantID, *impersonatorID)
+		c.JSON(http.StatusOK, gin.H{"message": "已结束模拟登录"})
 		return
 	}
 
-	// 检查邮箱是否已存在
-	if err := utils.WithTenant(database.DB, tenantID).Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已存在"})
+	if req.All {
+		count := sessionService.RevokeUserSessions(tenantID, userID)
+		c.JSON(http.StatusOK, gin.H{"message": "已退出所有设备", "revoked_sessions": count})
 		return
 	}
 
-	// 加密密码
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+	// 撤销当前会话族，优先按刷新令牌定位，其次按访问令牌定位
+	var session *models.RefreshToken
+	var err error
+	if req.RefreshToken != "" {
+		session, err = sessionService.FindSessionByRefreshToken(tenantID, req.RefreshToken)
+	} else {
+		session, err = sessionService.FindSessionByAccessToken(tenantID, tokenHash)
+	}
+	if err == nil && session.UserID == userID {
+		sessionService.RevokeFamily(tenantID, session.FamilyID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "退出登录成功"})
+}
+
+// 通过邀请码自助注册（租户、角色和班级由邀请码决定）
+func Register(c *gin.Context) {
+	var req InviteRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 创建用户
-	user := models.User{
+	user, invite, err := inviteService.Register(services.InviteRegistration{
+		Code:     req.InviteCode,
 		Username: req.Username,
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: req.Password,
 		Name:     req.Name,
-		Role:     req.Role,
-		IsActive: true,
-	}
-
-	// 设置租户ID
-	utils.SetTenantID(&user, tenantID)
-
-	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInviteInvalid), errors.Is(err, services.ErrInviteExpired), errors.Is(err, services.ErrInviteExhausted):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUsernameTaken), errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case respondPasswordPolicyError(c, err):
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+		}
 		return
 	}
 
+	// 发送邮箱验证邮件
+	accountService.SendEmailVerification(user)
+
 	// 清除密码字段
 	user.Password = ""
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "用户创建成功",
-		"user":    user,
+		"message":   "注册成功，请查收验证邮件后登录",
+		"user":      user,
+		"tenant_id": invite.TenantID, // 登录时需携带的 X-Tenant-ID
+		"class_id":  invite.ClassID,
+	})
+}
+
+// 忘记密码：向注册邮箱发送重置链接（无论邮箱是否存在都返回成功，避免泄露账号信息）
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accountService.SendPasswordReset(middleware.GetTenantID(c), req.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，重置密码邮件已发送"})
+}
+
+// 通过邮件中的链接重置密码
+func ResetPasswordByToken(c *gin.Context) {
+	var req ResetPasswordByTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := accountService.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrAccountTokenInvalid) || errors.Is(err, services.ErrAccountTokenExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码重置失败"})
+		return
+	}
+
+	// 重置成功后解除该用户名的登录锁定
+	loginGuard.ClearLockout(user.TenantID, services.LockoutKindUser, user.Username)
+	recordUserAudit(c, user.TenantID, services.AuditPasswordReset, user.ID, user.Username, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码重置成功，请使用新密码登录"})
+}
+
+// 验证邮箱
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := accountService.VerifyEmail(req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAccountTokenInvalid), errors.Is(err, services.ErrAccountTokenExpired), errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "邮箱验证失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "邮箱验证成功",
+		"email":   user.Email,
 	})
 }
 
+// 重新发送邮箱验证邮件
+func ResendEmailVerification(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	tenantID := middleware.GetTenantID(c)
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if !accountService.SendEmailVerification(&user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已验证"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "验证邮件已发送"})
+}
+
+// 查看邀请码信息（注册页面展示班级和角色）
+func GetInviteInfo(c *gin.Context) {
+	invite, err := inviteService.FindUsableInvite(database.DB, c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"code":       invite.Code,
+		"role":       invite.Role,
+		"tenant_id":  invite.TenantID,
+		"expires_at": invite.ExpiresAt,
+	}
+	if invite.Class != nil {
+		response["class_name"] = invite.Class.Name
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // 获取当前用户信息
 func GetProfile(c *gin.Context) {
 	userID := middleware.GetCurrentUserID(c)
@@ -187,16 +541,30 @@ func UpdateProfile(c *gin.Context) {
 	// 保存原用户名用于缓存失效
 	oldUsername := user.Username
 
-	// 更新用户信息
+	// 更新用户信息；邮箱变更需要先验证新邮箱，验证通过前仍使用原邮箱
 	user.Name = req.Name
-	user.Email = req.Email
 	user.Avatar = req.Avatar
+	emailChanged := req.Email != "" && req.Email != user.Email && req.Email != user.PendingEmail
+	if req.Email == user.Email {
+		user.PendingEmail = ""
+	} else if emailChanged {
+		var existingUser models.User
+		if err := database.DB.Where("email = ? AND id != ?", req.Email, user.ID).First(&existingUser).Error; err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已存在"})
+			return
+		}
+		user.PendingEmail = req.Email
+	}
 
 	if err := database.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户信息失败"})
 		return
 	}
 
+	if emailChanged {
+		accountService.SendEmailVerification(&user)
+	}
+
 	// 使旧缓存失效
 	cacheService.InvalidateUserCache(tenantID, userID, oldUsername)
 
@@ -216,7 +584,7 @@ func ChangePassword(c *gin.Context) {
 
 	var req struct {
 		OldPassword string `json:"old_password" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required,min=6"`
+		NewPassword string `json:"new_password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -230,12 +598,22 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	if services.IsExternalAccount(&user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目录或单点登录账号请在统一身份系统中修改密码"})
+		return
+	}
+
 	// 验证旧密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "旧密码错误"})
 		return
 	}
 
+	if err := services.CheckNewPassword(&user, req.NewPassword); err != nil {
+		respondPasswordPolicyError(c, err)
+		return
+	}
+
 	// 加密新密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -243,15 +621,16 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	// 更新密码
+	// 更新密码并记录到密码历史，同时解除强制修改密码状态
 	user.Password = string(hashedPassword)
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := services.RecordPasswordChange(database.DB, &user, false); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码更新失败"})
 		return
 	}
 
-	// 密码修改后，使用户缓存失效（因为密码已变更）
-	cacheService.InvalidateUserCache(tenantID, userID, user.Username)
+	// 使所有已登录会话失效，需要重新登录
+	sessionService.EndUserSessions(tenantID, &user)
+	recordAuditDetail(c, services.AuditPasswordChange, "user", user.ID, nil)
 
-	c.JSON(http.StatusOK, gin.H{"message": "密码修改成功"})
+	c.JSON(http.StatusOK, gin.H{"message": "密码修改成功，请重新登录"})
 }
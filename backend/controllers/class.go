@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ClassRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	TeacherID   uint   `json:"teacher_id"` // 仅可管理所有班级的用户可指定，否则为本人
+}
+
+type InviteCodeRequest struct {
+	ClassID        *uint           `json:"class_id"`
+	Role           models.UserRole `json:"role"`             // 默认学生，可分配教师角色的用户可生成教师邀请码
+	MaxUses        int             `json:"max_uses"`         // 0表示不限次数
+	ExpiresInHours int             `json:"expires_in_hours"` // 0表示永不过期
+}
+
+type InviteCodeResponse struct {
+	models.InviteCode
+	Link string `json:"link"`
+}
+
+// loadManagedClass 读取当前用户可管理的班级（拥有管理所有班级权限时可管理全部，否则只能管理自己的班级）
+func loadManagedClass(c *gin.Context, classID uint) (*models.Class, bool) {
+	tenantID := middleware.GetTenantID(c)
+
+	var class models.Class
+	if err := utils.WithTenant(database.DB, tenantID).First(&class, classID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "班级不存在"})
+		return nil, false
+	}
+	if !middleware.HasPermission(c, services.PermClassManageAll) && class.TeacherID != middleware.GetCurrentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该班级"})
+		return nil, false
+	}
+	return &class, true
+}
+
+// 获取班级列表
+func GetClasses(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	query := utils.WithTenant(database.DB, tenantID).Preload("Teacher")
+	if !middleware.HasPermission(c, services.PermClassManageAll) {
+		query = query.Where("teacher_id = ?", middleware.GetCurrentUserID(c))
+	}
+
+	var classes []models.Class
+	if err := query.Order("created_at DESC").Find(&classes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取班级列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classes": classes})
+}
+
+// 获取班级详情（包含成员）
+func GetClass(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的班级ID"})
+		return
+	}
+	class, ok := loadManagedClass(c, uint(id))
+	if !ok {
+		return
+	}
+
+	var members []models.ClassMember
+	if err := database.DB.Preload("User").Where("class_id = ?", class.ID).Order("created_at ASC").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取班级成员失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"class":   class,
+		"members": members,
+	})
+}
+
+// 创建班级
+func CreateClass(c *gin.Context) {
+	var req ClassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	teacherID := middleware.GetCurrentUserID(c)
+	if middleware.HasPermission(c, services.PermClassManageAll) && req.TeacherID != 0 {
+		teacherID = req.TeacherID
+	}
+
+	class := models.Class{
+		TenantID:    tenantID,
+		Name:        req.Name,
+		Description: req.Description,
+		TeacherID:   teacherID,
+	}
+
+	if err := database.DB.Create(&class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建班级失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, class)
+}
+
+// 更新班级
+func UpdateClass(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的班级ID"})
+		return
+	}
+
+	var req ClassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	class, ok := loadManagedClass(c, uint(id))
+	if !ok {
+		return
+	}
+
+	class.Name = req.Name
+	class.Description = req.Description
+	if middleware.HasPermission(c, services.PermClassManageAll) && req.TeacherID != 0 {
+		class.TeacherID = req.TeacherID
+	}
+
+	if err := database.DB.Omit("Teacher").Save(class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新班级失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, class)
+}
+
+// 删除班级（同时删除成员关系和班级邀请码，不删除学生账号）
+func DeleteClass(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的班级ID"})
+		return
+	}
+	class, ok := loadManagedClass(c, uint(id))
+	if !ok {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.InviteCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.ClassMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(class).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除班级失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "班级删除成功"})
+}
+
+// 将学生移出班级
+func RemoveClassMember(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的班级ID"})
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	class, ok := loadManagedClass(c, uint(id))
+	if !ok {
+		return
+	}
+
+	result := database.DB.Where("class_id = ? AND user_id = ?", class.ID, uint(userID)).Delete(&models.ClassMember{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除班级成员失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该用户不在班级中"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已移出班级"})
+}
+
+// 获取邀请码列表
+func GetInviteCodes(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	query := utils.WithTenant(database.DB, tenantID).Preload("Class")
+	if !middleware.HasPermission(c, services.PermClassManageAll) {
+		query = query.Where("created_by = ?", middleware.GetCurrentUserID(c))
+	}
+	if classID := c.Query("class_id"); classID != "" {
+		query = query.Where("class_id = ?", classID)
+	}
+
+	var invites []models.InviteCode
+	if err := query.Order("created_at DESC").Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请码列表失败"})
+		return
+	}
+
+	response := make([]InviteCodeResponse, 0, len(invites))
+	for _, invite := range invites {
+		response = append(response, InviteCodeResponse{InviteCode: invite, Link: services.InviteLink(invite.Code)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invites": response})
+}
+
+// 生成邀请码
+func CreateInviteCode(c *gin.Context) {
+	var req InviteCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	if req.Role == "" {
+		req.Role = models.RoleStudent
+	}
+	// 邀请教师相当于分配教师角色，需满足角色分配的权限要求；管理员账号不能通过邀请码注册
+	switch {
+	case req.Role == models.RoleStudent:
+	case req.Role == models.RoleTeacher && permissionService.CanGrantRole(currentActor(c), models.RoleTeacher, nil):
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权生成该角色的邀请码"})
+		return
+	}
+	if req.MaxUses < 0 || req.ExpiresInHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "使用次数和有效期不能为负数"})
+		return
+	}
+
+	if req.ClassID != nil {
+		if _, ok := loadManagedClass(c, *req.ClassID); !ok {
+			return
+		}
+	}
+
+	invite := models.InviteCode{
+		TenantID:  tenantID,
+		Role:      req.Role,
+		ClassID:   req.ClassID,
+		MaxUses:   req.MaxUses,
+		IsActive:  true,
+		CreatedBy: middleware.GetCurrentUserID(c),
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if err := inviteService.CreateInvite(&invite); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成邀请码失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, InviteCodeResponse{InviteCode: invite, Link: services.InviteLink(invite.Code)})
+}
+
+// 停用邀请码
+func DeactivateInviteCode(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请码ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var invite models.InviteCode
+	if err := utils.WithTenant(database.DB, tenantID).First(&invite, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邀请码不存在"})
+		return
+	}
+	if !middleware.HasPermission(c, services.PermClassManageAll) && invite.CreatedBy != middleware.GetCurrentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权停用该邀请码"})
+		return
+	}
+
+	if err := database.DB.Model(&invite).Update("is_active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "停用邀请码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "邀请码已停用"})
+}
@@ -15,12 +15,13 @@ import (
 )
 
 type ExamRequest struct {
-	PaperID     uint      `json:"paper_id" binding:"required"`
-	Title       string    `json:"title" binding:"required"`
-	Description string    `json:"description"`
-	StartTime   time.Time `json:"start_time" binding:"required"`
-	EndTime     time.Time `json:"end_time" binding:"required"`
-	StudentIDs  []uint    `json:"student_ids"` // 指定学生ID列表，为空则所有学生可参加
+	PaperID     uint              `json:"paper_id" binding:"required"`
+	Title       string            `json:"title" binding:"required"`
+	Description string            `json:"description"`
+	StartTime   time.Time         `json:"start_time" binding:"required"`
+	EndTime     time.Time         `json:"end_time" binding:"required"`
+	StudentIDs  []uint            `json:"student_ids"` // 指定学生ID列表，为空则所有学生可参加
+	Visibility  models.Visibility `json:"visibility"`  // 对其他教师的可见范围，默认仅创建者
 }
 
 type ExamListResponse struct {
@@ -65,11 +66,8 @@ func GetExams(c *gin.Context) {
 
 	query := utils.WithTenant(database.DB, tenantID).Model(&models.Exam{}).Preload("Paper").Preload("Paper.Subject").Preload("Creator")
 
-	// 如果是教师，只能看到自己创建的考试
-	currentRole := middleware.GetCurrentUserRole(c)
-	if currentRole == models.RoleTeacher {
-		query = query.Where("created_by = ?", middleware.GetCurrentUserID(c))
-	}
+	// 只显示当前用户可见的考试（自己创建、共享给自己或按可见范围公开的）
+	query = accessService.ScopeVisible(query, currentActor(c), services.ResourceExam)
 
 	// 状态筛选
 	if status != "" {
@@ -229,6 +227,14 @@ func GetExam(c *gin.Context) {
 			questions[i].Answer = ""
 			questions[i].Explanation = ""
 		}
+		services.HideQuestionOptionAnswers(questions)
+	}
+
+	// 教师和管理员需要有查看权限
+	if middleware.GetCurrentUserRole(c) != models.RoleStudent &&
+		!accessService.CanView(currentActor(c), services.ResourceExam, exam.ID, exam.CreatedBy, exam.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此考试"})
+		return
 	}
 
 	// 如果是学生，获取考试记录
@@ -266,6 +272,17 @@ func CreateExam(c *gin.Context) {
 
 	// 获取租户ID
 	tenantID := middleware.GetTenantID(c)
+	actor := currentActor(c)
+
+	// 设置默认可见范围
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityPrivate
+	}
+	if !services.IsValidVisibility(visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+		return
+	}
 
 	// 验证时间
 	if req.StartTime.After(req.EndTime) {
@@ -273,12 +290,16 @@ func CreateExam(c *gin.Context) {
 		return
 	}
 
-	// 验证试卷是否存在
+	// 验证试卷是否存在且当前用户可见
 	var paper models.Paper
 	if err := utils.WithTenant(database.DB, tenantID).First(&paper, req.PaperID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "试卷不存在"})
 		return
 	}
+	if !accessService.CanView(actor, services.ResourcePaper, paper.ID, paper.CreatedBy, paper.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限使用此试卷"})
+		return
+	}
 
 	// 验证学生ID（如果指定了）
 	if len(req.StudentIDs) > 0 {
@@ -306,6 +327,7 @@ func CreateExam(c *gin.Context) {
 		EndTime:     req.EndTime,
 		Status:      models.ExamDraft,
 		StudentIDs:  studentIDsJSON,
+		Visibility:  visibility,
 		CreatedBy:   middleware.GetCurrentUserID(c),
 	}
 
@@ -316,6 +338,7 @@ func CreateExam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建考试失败"})
 		return
 	}
+	recordAudit(c, services.AuditExamCreate, services.ResourceExam, exam.ID, nil, exam)
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Paper").Preload("Paper.Subject").Preload("Creator").First(&exam, exam.ID)
@@ -350,14 +373,27 @@ func UpdateExam(c *gin.Context) {
 		return
 	}
 
-	// 检查权限（只有创建者或管理员可以修改）
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-	if exam.CreatedBy != currentUserID && currentRole != models.RoleAdmin {
+	// 检查权限（创建者、协作编辑者和内容管理者可以修改）
+	before := exam
+	actor := currentActor(c)
+	if !accessService.CanEdit(actor, services.ResourceExam, exam.ID, exam.CreatedBy) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限修改此考试"})
 		return
 	}
 
+	// 修改可见范围需要共享管理权限
+	if req.Visibility != "" && req.Visibility != exam.Visibility {
+		if !services.IsValidVisibility(req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+			return
+		}
+		if !accessService.CanManage(actor, exam.CreatedBy) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有创建者可以修改共享设置"})
+			return
+		}
+		exam.Visibility = req.Visibility
+	}
+
 	// 检查考试是否已开始
 	if exam.Status != models.ExamDraft {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "考试已开始，无法修改"})
@@ -370,12 +406,16 @@ func UpdateExam(c *gin.Context) {
 		return
 	}
 
-	// 验证试卷是否存在
+	// 验证试卷是否存在且当前用户可见
 	var paper models.Paper
 	if err := utils.WithTenant(database.DB, tenantID).First(&paper, req.PaperID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "试卷不存在"})
 		return
 	}
+	if !accessService.CanView(actor, services.ResourcePaper, paper.ID, paper.CreatedBy, paper.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限使用此试卷"})
+		return
+	}
 
 	// 验证学生ID（如果指定了）
 	if len(req.StudentIDs) > 0 {
@@ -406,6 +446,7 @@ func UpdateExam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新考试失败"})
 		return
 	}
+	recordAudit(c, services.AuditExamUpdate, services.ResourceExam, exam.ID, before, exam)
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Paper").Preload("Paper.Subject").Preload("Creator").First(&exam, exam.ID)
@@ -435,10 +476,8 @@ func DeleteExam(c *gin.Context) {
 		return
 	}
 
-	// 检查权限（只有创建者或管理员可以删除）
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-	if exam.CreatedBy != currentUserID && currentRole != models.RoleAdmin {
+	// 检查权限（只有创建者和内容管理者可以删除，协作编辑者不可以）
+	if !accessService.CanManage(currentActor(c), exam.CreatedBy) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限删除此考试"})
 		return
 	}
@@ -453,6 +492,8 @@ func DeleteExam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除考试失败"})
 		return
 	}
+	accessService.DeleteShares(tenantID, services.ResourceExam, exam.ID)
+	recordAudit(c, services.AuditExamDelete, services.ResourceExam, exam.ID, exam, nil)
 
 	// 清除相关缓存
 	cacheService := services.NewCacheService()
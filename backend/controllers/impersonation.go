@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImpersonateRequest struct {
+	Reason   string `json:"reason" binding:"required"` // 模拟原因，记录在审计日志中
+	ReadOnly *bool  `json:"read_only"`                 // 是否禁止修改数据，默认只读
+	Minutes  int    `json:"minutes"`                   // 有效期（分钟），不超过 IMPERSONATION_TTL
+}
+
+// ImpersonationResponse 模拟登录令牌，不包含刷新令牌，过期后需重新发起
+type ImpersonationResponse struct {
+	Token          string      `json:"token"`
+	ExpiresIn      int64       `json:"expires_in"`
+	ReadOnly       bool        `json:"read_only"`
+	ImpersonatorID uint        `json:"impersonator_id"`
+	User           models.User `json:"user"`
+}
+
+// 以指定用户的身份登录，用于排查用户反馈的问题
+func StartImpersonation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写模拟原因"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	if middleware.IsImpersonating(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "模拟登录期间不能再次发起模拟"})
+		return
+	}
+
+	admin, err := cacheService.GetUserWithCache(tenantID, middleware.GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	var target models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&target, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if target.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能模拟自己"})
+		return
+	}
+	if !target.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户已停用"})
+		return
+	}
+	// 不能模拟管理员或同样拥有模拟权限的用户，避免借此提升权限
+	if target.Role == models.RoleAdmin ||
+		permissionService.HasPermission(tenantID, target.Role, target.RoleID, services.PermUserImpersonate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能模拟管理员"})
+		return
+	}
+
+	readOnly := req.ReadOnly == nil || *req.ReadOnly
+	act := &middleware.ActClaim{
+		Sub:            strconv.FormatUint(uint64(admin.ID), 10),
+		UserID:         admin.ID,
+		Username:       admin.Username,
+		SessionVersion: admin.SessionVersion,
+		ReadOnly:       readOnly,
+	}
+	token, expiresAt, err := middleware.IssueImpersonationToken(&target, act, time.Duration(req.Minutes)*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	auditService.Record(&models.AuditLog{
+		TenantID:     tenantID,
+		UserID:       admin.ID,
+		Username:     admin.Username,
+		Action:       services.AuditImpersonationStart,
+		ResourceType: "user",
+		ResourceID:   strconv.FormatUint(uint64(target.ID), 10),
+		Method:       c.Request.Method,
+		Path:         c.Request.URL.Path,
+		StatusCode:   http.StatusOK,
+		IP:           c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Detail: services.AuditDetail(gin.H{
+			"target":     target.Username,
+			"reason":     req.Reason,
+			"read_only":  readOnly,
+			"expires_at": expiresAt,
+		}),
+	})
+
+	target.Password = ""
+	c.JSON(http.StatusOK, ImpersonationResponse{
+		Token:          token,
+		ExpiresIn:      int64(time.Until(expiresAt).Seconds()),
+		ReadOnly:       readOnly,
+		ImpersonatorID: admin.ID,
+		User:           target,
+	})
+}
+
+// recordImpersonationEnd 使用模拟登录令牌退出时记录模拟结束
+func recordImpersonationEnd(c *gin.Context, tenantID, impersonatorID uint) {
+	userID := middleware.GetCurrentUserID(c)
+	auditService.Record(&models.AuditLog{
+		TenantID:       tenantID,
+		UserID:         userID,
+		Username:       c.GetString("username"),
+		ImpersonatorID: &impersonatorID,
+		Action:         services.AuditImpersonationEnd,
+		ResourceType:   "user",
+		ResourceID:     strconv.FormatUint(uint64(userID), 10),
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		StatusCode:     http.StatusOK,
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+	})
+}
+
+// 查看模拟登录相关的审计日志
+func GetImpersonationLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	query := utils.WithTenant(database.DB, tenantID).Model(&models.AuditLog{}).
+		Where("action IN ?", []string{services.AuditImpersonationStart, services.AuditImpersonationRequest, services.AuditImpersonationEnd})
+	if impersonatorID := c.Query("impersonator_id"); impersonatorID != "" {
+		query = query.Where("impersonator_id = ? OR (action = ? AND user_id = ?)", impersonatorID, services.AuditImpersonationStart, impersonatorID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("(user_id = ? AND impersonator_id IS NOT NULL) OR (action = ? AND resource_id = ?)", userID, services.AuditImpersonationStart, userID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":  logs,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var importService = services.NewImportService()
+
+// importKindPermissions 查看各类导入任务所需的权限
+var importKindPermissions = map[string]string{
+	services.ImportKindQuestions: services.PermQuestionWrite,
+	services.ImportKindUsers:     services.PermUserWrite,
+}
+
+// bindImportJob 读取导入模式（mode，默认all_or_nothing）和幂等键（Idempotency-Key请求头或idempotency_key参数）
+func bindImportJob(c *gin.Context, kind string) (*models.ImportJob, bool) {
+	mode := models.ImportMode(c.Query("mode"))
+	if mode == "" {
+		mode = models.ImportMode(c.DefaultPostForm("mode", string(models.ImportAllOrNothing)))
+	}
+	if !services.IsValidImportMode(mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidImportMode.Error()})
+		return nil, false
+	}
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		key = c.Query("idempotency_key")
+	}
+	if key == "" {
+		key = c.PostForm("idempotency_key")
+	}
+	if len(key) > 128 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "幂等键不能超过128个字符"})
+		return nil, false
+	}
+	return &models.ImportJob{
+		TenantID:       middleware.GetTenantID(c),
+		Kind:           kind,
+		Mode:           mode,
+		IdempotencyKey: key,
+		CreatedBy:      middleware.GetCurrentUserID(c),
+	}, true
+}
+
+// importAuditFunc 记录导入任务中单个资源的变更
+type importAuditFunc func(resourceID uint, before, after interface{})
+
+// startImportJob 创建导入任务并在后台执行，相同幂等键的重复提交返回已有任务。
+// created、updated 分别记录新建和更新的资源，after 在有变更提交后调用
+func startImportJob(c *gin.Context, job *models.ImportJob, tasks []services.ImportRowTask, created, updated importAuditFunc, after func(changes []services.ImportChange)) {
+	job.Total = len(tasks)
+	existing, err := importService.CreateJob(job)
+	if errors.Is(err, services.ErrIdempotencyConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建导入任务失败"})
+		return
+	}
+	if existing {
+		c.JSON(http.StatusOK, gin.H{"message": "该导入已提交", "job": job, "duplicate": true})
+		return
+	}
+
+	jobCopy := *job
+	go func() {
+		changes := importService.Run(&jobCopy, tasks)
+		for _, change := range changes {
+			if change.Before == nil {
+				created(change.ResourceID, nil, change.After)
+			} else if updated != nil {
+				updated(change.ResourceID, change.Before, change.After)
+			}
+		}
+		if len(changes) > 0 && after != nil {
+			after(changes)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "导入任务已创建", "job": job})
+}
+
+// loadImportJob 按ID读取导入任务，需具备该类型导入所需的权限
+func loadImportJob(c *gin.Context) (*models.ImportJob, bool) {
+	tenantID := middleware.GetTenantID(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return nil, false
+	}
+
+	var job models.ImportJob
+	if err := utils.WithTenant(database.DB, tenantID).First(&job, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "导入任务不存在"})
+		return nil, false
+	}
+	if !canViewImportJob(c, &job) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该导入任务"})
+		return nil, false
+	}
+	return &job, true
+}
+
+// canViewImportJob 判断当前用户能否查看导入任务
+func canViewImportJob(c *gin.Context, job *models.ImportJob) bool {
+	permission, ok := importKindPermissions[job.Kind]
+	if !ok {
+		return false
+	}
+	return permissionService.HasPermission(middleware.GetTenantID(c), middleware.GetCurrentUserRole(c), middleware.GetCurrentRoleID(c), permission)
+}
+
+// 获取当前用户创建的导入任务
+func GetImportJobs(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	query := utils.WithTenant(database.DB, tenantID).Model(&models.ImportJob{}).
+		Where("created_by = ?", middleware.GetCurrentUserID(c))
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var total int64
+	query.Count(&total)
+	var jobs []models.ImportJob
+	if err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取导入任务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "total": total, "page": page, "size": size})
+}
+
+// 获取导入任务详情，任务完成后包含逐行报告
+func GetImportJob(c *gin.Context) {
+	job, ok := loadImportJob(c)
+	if !ok {
+		return
+	}
+	response := gin.H{"job": job}
+	if report, err := importService.GetReport(job); err == nil {
+		response["report"] = report
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// 下载导入报告，format 为 csv（默认）或 json
+func DownloadImportReport(c *gin.Context) {
+	job, ok := loadImportJob(c)
+	if !ok {
+		return
+	}
+	report, err := importService.GetReport(job)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "import-report-" + strconv.FormatUint(uint64(job.ID), 10)
+	switch c.DefaultQuery("format", "csv") {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+		if err := services.WriteImportReportCSV(c.Writer, report); err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+	case "json":
+		c.Header("Content-Disposition", "attachment; filename="+filename+".json")
+		c.JSON(http.StatusOK, report)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报告格式只能为csv或json"})
+	}
+}
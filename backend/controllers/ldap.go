@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LDAPConfigRequest struct {
+	Enabled            bool            `json:"enabled"`
+	URL                string          `json:"url" binding:"required"`
+	StartTLS           bool            `json:"start_tls"`
+	InsecureSkipVerify bool            `json:"insecure_skip_verify"`
+	BindDN             string          `json:"bind_dn"`
+	BindPassword       string          `json:"bind_password"` // 为空时保留原密码
+	BaseDN             string          `json:"base_dn" binding:"required"`
+	UserFilter         string          `json:"user_filter" binding:"required"`
+	EmailAttribute     string          `json:"email_attribute"`
+	NameAttribute      string          `json:"name_attribute"`
+	GroupAttribute     string          `json:"group_attribute"`
+	GroupBaseDN        string          `json:"group_base_dn"`
+	GroupFilter        string          `json:"group_filter"`
+	AdminGroups        string          `json:"admin_groups"`
+	TeacherGroups      string          `json:"teacher_groups"`
+	DefaultRole        models.UserRole `json:"default_role"`
+	AutoProvision      bool            `json:"auto_provision"`
+	AllowLocalFallback bool            `json:"allow_local_fallback"`
+}
+
+type LDAPTestRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ldapConfigResponse 配置响应，服务账号密码不返回，只告知是否已设置
+func ldapConfigResponse(cfg models.LDAPConfig) gin.H {
+	return gin.H{
+		"config":            cfg,
+		"has_bind_password": cfg.BindPassword != "",
+	}
+}
+
+// 获取当前租户的LDAP配置
+func GetLDAPConfig(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+	c.JSON(http.StatusOK, ldapConfigResponse(services.GetLDAPConfig(tenantID)))
+}
+
+// 更新当前租户的LDAP配置
+func UpdateLDAPConfig(c *gin.Context) {
+	var req LDAPConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	if !strings.HasPrefix(req.URL, "ldap://") && !strings.HasPrefix(req.URL, "ldaps://") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL必须以 ldap:// 或 ldaps:// 开头"})
+		return
+	}
+	if !strings.Contains(req.UserFilter, "{username}") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_filter必须包含 {username} 占位符"})
+		return
+	}
+	// 默认角色不能是管理员，管理员只能通过组映射获得
+	if req.DefaultRole != "" && req.DefaultRole != models.RoleStudent && req.DefaultRole != models.RoleTeacher {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "default_role只能为student、teacher或空"})
+		return
+	}
+
+	defaults := services.DefaultLDAPConfig(tenantID)
+	cfg := services.GetLDAPConfig(tenantID)
+	cfg.Enabled = req.Enabled
+	cfg.URL = req.URL
+	cfg.StartTLS = req.StartTLS
+	cfg.InsecureSkipVerify = req.InsecureSkipVerify
+	cfg.BindDN = req.BindDN
+	if req.BindPassword != "" || req.BindDN == "" {
+		cfg.BindPassword = req.BindPassword
+	}
+	cfg.BaseDN = req.BaseDN
+	cfg.UserFilter = req.UserFilter
+	cfg.EmailAttribute = firstNonEmpty(req.EmailAttribute, defaults.EmailAttribute)
+	cfg.NameAttribute = firstNonEmpty(req.NameAttribute, defaults.NameAttribute)
+	cfg.GroupAttribute = firstNonEmpty(req.GroupAttribute, defaults.GroupAttribute)
+	cfg.GroupBaseDN = req.GroupBaseDN
+	cfg.GroupFilter = firstNonEmpty(req.GroupFilter, defaults.GroupFilter)
+	cfg.AdminGroups = req.AdminGroups
+	cfg.TeacherGroups = req.TeacherGroups
+	cfg.DefaultRole = req.DefaultRole
+	cfg.AutoProvision = req.AutoProvision
+	cfg.AllowLocalFallback = req.AllowLocalFallback
+
+	if err := saveWithZeroValues(&cfg, cfg.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新LDAP配置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ldapConfigResponse(cfg))
+}
+
+// 使用已保存的配置测试目录连接和账号映射（不创建本地账号）
+func TestLDAPConfig(c *gin.Context) {
+	var req LDAPTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	cfg := services.GetLDAPConfig(tenantID)
+	if cfg.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先保存LDAP配置"})
+		return
+	}
+
+	authenticator := services.NewLDAPAuthenticator(cfg)
+	entry, err := authenticator.Lookup(strings.ToLower(strings.TrimSpace(req.Username)), req.Password)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrAuthSourceUnavailable) {
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	role, err := authenticator.MapRole(entry.Groups)
+	response := gin.H{
+		"success": err == nil,
+		"entry":   entry,
+		"role":    role,
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单点登录服务
+var oidcService = services.NewOIDCService()
+
+var oidcProviderNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+type OIDCExchangeRequest struct {
+	Ticket string `json:"ticket" binding:"required"`
+}
+
+type OIDCLinkRequest struct {
+	ReturnTo string `json:"return_to"` // 关联完成后返回的前端页面
+}
+
+type OIDCProviderRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	DisplayName   string          `json:"display_name"`
+	IssuerURL     string          `json:"issuer_url" binding:"required"`
+	ClientID      string          `json:"client_id" binding:"required"`
+	ClientSecret  string          `json:"client_secret"` // 更新时为空表示保留原密钥
+	Scopes        string          `json:"scopes"`
+	UsernameClaim string          `json:"username_claim"`
+	RoleClaim     string          `json:"role_claim"`
+	AdminValues   string          `json:"admin_values"`
+	TeacherValues string          `json:"teacher_values"`
+	DefaultRole   models.UserRole `json:"default_role"`
+	AutoProvision bool            `json:"auto_provision"`
+	Enabled       bool            `json:"enabled"`
+}
+
+// oidcProviderResponse 客户端密钥不返回，只告知是否已设置
+func oidcProviderResponse(p models.OIDCProvider) gin.H {
+	return gin.H{
+		"provider":          p,
+		"redirect_url":      services.OIDCRedirectURL(&p),
+		"has_client_secret": p.ClientSecret != "",
+	}
+}
+
+// oidcFrontendRedirect 跳转回前端页面，附带查询参数
+func oidcFrontendRedirect(c *gin.Context, path string, params url.Values) {
+	target := strings.TrimRight(config.GetConfig().FrontendURL, "/") + path
+	if len(params) > 0 {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		target += separator + params.Encode()
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// 获取租户已启用的身份提供方（登录页显示单点登录按钮）
+func GetOIDCProviders(c *gin.Context) {
+	providers := oidcService.ListProviders(middleware.GetTenantID(c))
+	result := make([]gin.H, 0, len(providers))
+	for _, p := range providers {
+		result = append(result, gin.H{
+			"name":         p.Name,
+			"display_name": firstNonEmpty(p.DisplayName, p.Name),
+			"login_url":    "/api/v1/auth/oidc/" + p.Name + "/login?tenant_id=" + strconv.FormatUint(uint64(p.TenantID), 10),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": result})
+}
+
+// 跳转到身份提供方登录（浏览器直接访问，无法携带租户请求头时通过 tenant_id 参数指定租户）
+func OIDCLogin(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+	if v := c.Query("tenant_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的租户ID"})
+			return
+		}
+		tenantID = uint(id)
+	}
+
+	provider, err := oidcService.FindProvider(tenantID, c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	authURL, err := oidcService.BeginAuth(c.Request.Context(), provider, 0, services.SafeReturnPath(c.Query("return_to"), ""))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "身份提供方暂时不可用，请稍后再试"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// 身份提供方回调：登录时生成一次性票据跳转回前端，关联时跳转回个人设置页
+func OIDCCallback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		oidcFrontendRedirect(c, "/oidc/callback", url.Values{"error": {firstNonEmpty(c.Query("error_description"), errCode)}})
+		return
+	}
+
+	result, err := oidcService.CompleteAuth(c.Request.Context(), c.Param("provider"), c.Query("state"), c.Query("code"))
+	if result != nil && result.Linked {
+		params := url.Values{}
+		if err != nil {
+			params.Set("error", err.Error())
+		} else {
+			params.Set("linked", result.Provider.Name)
+		}
+		oidcFrontendRedirect(c, services.SafeReturnPath(result.ReturnTo, "/profile"), params)
+		return
+	}
+	if err != nil {
+		oidcFrontendRedirect(c, "/oidc/callback", url.Values{"error": {err.Error()}})
+		return
+	}
+
+	ticket, err := oidcService.CreateLoginTicket(result.User)
+	if err != nil {
+		oidcFrontendRedirect(c, "/oidc/callback", url.Values{"error": {"登录失败"}})
+		return
+	}
+	params := url.Values{"ticket": {ticket}}
+	if result.ReturnTo != "" {
+		params.Set("return_to", result.ReturnTo)
+	}
+	oidcFrontendRedirect(c, "/oidc/callback", params)
+}
+
+// 用回调中的一次性票据换取登录令牌（开启两步验证的用户仍需验证）
+func OIDCExchange(c *gin.Context) {
+	var req OIDCExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := oidcService.RedeemLoginTicket(req.Ticket)
+	if err != nil || user.TenantID != middleware.GetTenantID(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": services.ErrOIDCStateInvalid.Error()})
+		return
+	}
+
+	beginLogin(c, user.TenantID, user)
+}
+
+// 获取当前用户关联的外部身份
+func GetUserIdentities(c *gin.Context) {
+	var identities []models.UserIdentity
+	utils.WithTenant(database.DB, middleware.GetTenantID(c)).
+		Preload("Provider").
+		Where("user_id = ?", middleware.GetCurrentUserID(c)).
+		Order("id ASC").
+		Find(&identities)
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// 关联外部身份：返回身份提供方授权地址，由前端跳转
+func LinkUserIdentity(c *gin.Context) {
+	var req OIDCLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	provider, err := oidcService.FindProvider(tenantID, c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	authURL, err := oidcService.BeginAuth(c.Request.Context(), provider, middleware.GetCurrentUserID(c), services.SafeReturnPath(req.ReturnTo, "/profile"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "身份提供方暂时不可用，请稍后再试"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// 取消关联外部身份（通过单点登录创建的账号没有本地密码，不能取消最后一个关联）
+func UnlinkUserIdentity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+	userID := middleware.GetCurrentUserID(c)
+
+	var identity models.UserIdentity
+	if err := utils.WithTenant(database.DB, tenantID).Where("user_id = ?", userID).First(&identity, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "关联记录不存在"})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.AuthProvider == models.AuthProviderOIDC {
+		var count int64
+		database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&count)
+		if count <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该账号只能通过单点登录，不能取消最后一个关联"})
+			return
+		}
+	}
+
+	if err := database.DB.Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消关联失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消关联"})
+}
+
+// 获取当前租户的身份提供方配置
+func GetOIDCProviderConfigs(c *gin.Context) {
+	var providers []models.OIDCProvider
+	utils.WithTenant(database.DB, middleware.GetTenantID(c)).Order("id ASC").Find(&providers)
+
+	result := make([]gin.H, 0, len(providers))
+	for _, p := range providers {
+		result = append(result, oidcProviderResponse(p))
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": result})
+}
+
+// validateOIDCProviderRequest 校验身份提供方配置，返回错误信息
+func validateOIDCProviderRequest(req *OIDCProviderRequest) string {
+	if !oidcProviderNamePattern.MatchString(req.Name) {
+		return "name只能包含小写字母、数字和连字符"
+	}
+	u, err := url.Parse(req.IssuerURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "issuer_url必须是有效的http(s)地址"
+	}
+	// 默认角色不能是管理员，管理员只能通过声明映射获得
+	if req.DefaultRole != "" && req.DefaultRole != models.RoleStudent && req.DefaultRole != models.RoleTeacher {
+		return "default_role只能为student、teacher或空"
+	}
+	return ""
+}
+
+func applyOIDCProviderRequest(p *models.OIDCProvider, req *OIDCProviderRequest) {
+	p.Name = req.Name
+	p.DisplayName = req.DisplayName
+	p.IssuerURL = strings.TrimRight(req.IssuerURL, "/")
+	p.ClientID = req.ClientID
+	if req.ClientSecret != "" {
+		p.ClientSecret = req.ClientSecret
+	}
+	p.Scopes = firstNonEmpty(req.Scopes, "openid profile email")
+	p.UsernameClaim = firstNonEmpty(req.UsernameClaim, "preferred_username")
+	p.RoleClaim = req.RoleClaim
+	p.AdminValues = req.AdminValues
+	p.TeacherValues = req.TeacherValues
+	p.DefaultRole = req.DefaultRole
+	p.AutoProvision = req.AutoProvision
+	p.Enabled = req.Enabled
+}
+
+// 新增身份提供方
+func CreateOIDCProvider(c *gin.Context) {
+	var req OIDCProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateOIDCProviderRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var count int64
+	utils.WithTenant(database.DB, tenantID).Model(&models.OIDCProvider{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "同名身份提供方已存在"})
+		return
+	}
+
+	provider := models.OIDCProvider{TenantID: tenantID}
+	applyOIDCProviderRequest(&provider, &req)
+	if err := saveWithZeroValues(&provider, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建身份提供方失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, oidcProviderResponse(provider))
+}
+
+// 更新身份提供方
+func UpdateOIDCProvider(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+	var req OIDCProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateOIDCProviderRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var provider models.OIDCProvider
+	if err := utils.WithTenant(database.DB, tenantID).First(&provider, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "身份提供方不存在"})
+		return
+	}
+
+	var count int64
+	utils.WithTenant(database.DB, tenantID).Model(&models.OIDCProvider{}).Where("name = ? AND id <> ?", req.Name, provider.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "同名身份提供方已存在"})
+		return
+	}
+
+	applyOIDCProviderRequest(&provider, &req)
+	if err := saveWithZeroValues(&provider, provider.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新身份提供方失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, oidcProviderResponse(provider))
+}
+
+// 删除身份提供方及其关联的外部身份
+func DeleteOIDCProvider(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var provider models.OIDCProvider
+	if err := utils.WithTenant(database.DB, tenantID).First(&provider, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "身份提供方不存在"})
+		return
+	}
+
+	database.DB.Where("provider_id = ?", provider.ID).Delete(&models.UserIdentity{})
+	if err := database.DB.Delete(&provider).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除身份提供方失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "身份提供方已删除"})
+}
@@ -5,19 +5,23 @@ import (
 	"online-exam-system/database"
 	"online-exam-system/middleware"
 	"online-exam-system/models"
+	"online-exam-system/services"
 	"online-exam-system/utils"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type PaperRequest struct {
-	SubjectID   uint   `json:"subject_id" binding:"required"`
-	Title       string `json:"title" binding:"required"`
-	Description string `json:"description"`
-	Duration    int    `json:"duration" binding:"required"` // 考试时长（分钟）
-	TotalScore  int    `json:"total_score"`
-	Questions   []uint `json:"questions" binding:"required"` // 题目ID列表
+	SubjectID        uint              `json:"subject_id" binding:"required"`
+	Title            string            `json:"title" binding:"required"`
+	Description      string            `json:"description"`
+	Duration         int               `json:"duration" binding:"required"` // 考试时长（分钟）
+	TotalScore       int               `json:"total_score"`
+	Questions        []uint            `json:"questions" binding:"required"` // 题目ID列表，材料题及其子题整体加入试卷
+	Visibility       models.Visibility `json:"visibility"`                   // 可见范围，默认租户内可见
+	RefreshRevisions bool              `json:"refresh_revisions"`            // 修改试卷时将全部题目改为最新版本，默认保留已有题目组卷时的版本
 }
 
 type AutoPaperRequest struct {
@@ -26,8 +30,10 @@ type AutoPaperRequest struct {
 	Description    string                          `json:"description"`
 	Duration       int                             `json:"duration" binding:"required"`
 	QuestionConfig []AutoPaperQuestionConfig      `json:"question_config" binding:"required"`
+	Visibility     models.Visibility               `json:"visibility"`
 }
 
+// AutoPaperQuestionConfig 自动组卷配置，材料题按组计数，Score为每组的分值
 type AutoPaperQuestionConfig struct {
 	Type       models.QuestionType `json:"type" binding:"required"`
 	Count      int                 `json:"count" binding:"required"`
@@ -59,6 +65,9 @@ func GetPapers(c *gin.Context) {
 
 	query := utils.WithTenant(database.DB, tenantID).Model(&models.Paper{}).Preload("Subject").Preload("Creator")
 
+	// 只显示当前用户可见的试卷
+	query = accessService.ScopeVisible(query, currentActor(c), services.ResourcePaper)
+
 	// 科目筛选
 	if subjectID != "" {
 		query = query.Where("subject_id = ?", subjectID)
@@ -103,9 +112,14 @@ func GetPaper(c *gin.Context) {
 		return
 	}
 
-	// 获取试卷题目
-	var questions []models.Question
-	if err := database.DB.Preload("Subject").Model(&paper).Association("Questions").Find(&questions); err != nil {
+	if !accessService.CanView(currentActor(c), services.ResourcePaper, paper.ID, paper.CreatedBy, paper.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此试卷"})
+		return
+	}
+
+	// 获取试卷题目（组卷时的版本）
+	questions, err := services.LoadPaperQuestions(database.DB, tenantID, paper.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取试卷题目失败"})
 		return
 	}
@@ -124,6 +138,12 @@ func CreatePaper(c *gin.Context) {
 		return
 	}
 	tenantID := middleware.GetTenantID(c)
+	actor := currentActor(c)
+
+	visibility, ok := paperVisibility(c, req.Visibility)
+	if !ok {
+		return
+	}
 
 	// 验证科目是否存在
 	var subject models.Subject
@@ -132,24 +152,24 @@ func CreatePaper(c *gin.Context) {
 		return
 	}
 
-	// 验证题目是否存在且属于该科目
+	// 验证题目是否存在、属于该科目且当前用户可见
 	var questions []models.Question
-	if err := utils.WithTenant(database.DB, tenantID).Where("id IN ? AND subject_id = ?", req.Questions, req.SubjectID).Find(&questions).Error; err != nil {
+	questionQuery := utils.WithTenant(database.DB, tenantID).Where("id IN ? AND subject_id = ?", req.Questions, req.SubjectID)
+	questionQuery = accessService.ScopeVisible(questionQuery, actor, services.ResourceQuestion)
+	if err := questionQuery.Find(&questions).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证题目失败"})
 		return
 	}
 
 	if len(questions) != len(req.Questions) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "部分题目不存在或不属于该科目"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分题目不存在、不属于该科目或没有权限使用"})
 		return
 	}
 
-	// 计算总分
-	totalScore := req.TotalScore
-	if totalScore == 0 {
-		for _, q := range questions {
-			totalScore += q.Score
-		}
+	// 只能使用已通过审核的题目
+	if ids := unreviewedQuestionIDs(questions, nil); len(ids) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分题目尚未通过审核，不能加入试卷", "question_ids": ids})
+		return
 	}
 
 	// 创建试卷
@@ -158,21 +178,38 @@ func CreatePaper(c *gin.Context) {
 		Title:       req.Title,
 		Description: req.Description,
 		Duration:    req.Duration,
-		TotalScore:  totalScore,
+		TotalScore:  req.TotalScore,
+		Visibility:  visibility,
 		CreatedBy:   middleware.GetCurrentUserID(c),
 	}
 	utils.SetTenantID(&paper, tenantID)
 
-	if err := database.DB.Create(&paper).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建试卷失败"})
-		return
-	}
+	// 试卷、题目关联和固定的题目版本在同一事务中写入
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 材料题与其子题整体加入试卷
+		questions, err := services.ExpandQuestionGroups(tx, tenantID, questions)
+		if err != nil {
+			return err
+		}
+		// 计算总分（材料题的分值已包含在子题中）
+		if paper.TotalScore == 0 {
+			paper.TotalScore = services.QuestionsTotalScore(questions)
+		}
 
-	// 关联题目
-	if err := database.DB.Model(&paper).Association("Questions").Append(questions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "关联题目失败"})
+		if err := tx.Create(&paper).Error; err != nil {
+			return err
+		}
+		// 关联题目，并固定题目的当前版本
+		if err := tx.Model(&paper).Association("Questions").Append(questions); err != nil {
+			return err
+		}
+		return services.PinPaperRevisions(tx, tenantID, paper.ID, false)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建试卷失败"})
 		return
 	}
+	recordAudit(c, services.AuditPaperCreate, services.ResourcePaper, paper.ID, nil, newPaperSnapshot(paper))
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Subject").Preload("Creator").First(&paper, paper.ID)
@@ -188,6 +225,12 @@ func AutoCreatePaper(c *gin.Context) {
 		return
 	}
 	tenantID := middleware.GetTenantID(c)
+	actor := currentActor(c)
+
+	visibility, ok := paperVisibility(c, req.Visibility)
+	if !ok {
+		return
+	}
 
 	// 验证科目是否存在
 	var subject models.Subject
@@ -196,12 +239,23 @@ func AutoCreatePaper(c *gin.Context) {
 		return
 	}
 
-	var selectedQuestions []uint
+	var selectedQuestions []models.Question
+	var selectedCount int // 材料题及其子题计为一组
 	var totalScore int
 
 	// 根据配置选择题目
 	for _, config := range req.QuestionConfig {
 		query := utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("subject_id = ? AND type = ?", req.SubjectID, config.Type)
+		query = accessService.ScopeVisible(query, actor, services.ResourceQuestion)
+		// 只抽取已通过审核的题目（审核通过或已发布）
+		query = query.Where("status IN ?", services.ReviewedQuestionStatuses)
+
+		// 子题只随材料题整体选中，材料题需包含子题
+		if config.Type == models.Material {
+			query = query.Where("EXISTS (SELECT 1 FROM questions AS children WHERE children.parent_id = questions.id)")
+		} else {
+			query = query.Where("parent_id IS NULL")
+		}
 
 		// 如果指定了难度
 		if config.Difficulty > 0 {
@@ -220,12 +274,23 @@ func AutoCreatePaper(c *gin.Context) {
 		}
 
 		for _, q := range questions {
-			selectedQuestions = append(selectedQuestions, q.ID)
+			selectedCount++
+			score := q.Score
+			selectedQuestions = append(selectedQuestions, q)
+			if q.Type == models.Material {
+				children, err := services.LoadQuestionChildren(database.DB, tenantID, q.ID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目失败"})
+					return
+				}
+				selectedQuestions = append(selectedQuestions, children...)
+				score = services.QuestionsTotalScore(children)
+			}
 			// 使用配置中的分数或题目原有分数
 			if config.Score > 0 {
 				totalScore += config.Score
 			} else {
-				totalScore += q.Score
+				totalScore += score
 			}
 		}
 	}
@@ -235,13 +300,6 @@ func AutoCreatePaper(c *gin.Context) {
 		return
 	}
 
-	// 获取选中的题目对象
-	var selectedQuestionObjs []models.Question
-	if err := utils.WithTenant(database.DB, tenantID).Where("id IN ?", selectedQuestions).Find(&selectedQuestionObjs).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目失败"})
-		return
-	}
-
 	// 创建试卷
 	paper := models.Paper{
 		SubjectID:   req.SubjectID,
@@ -249,27 +307,34 @@ func AutoCreatePaper(c *gin.Context) {
 		Description: req.Description,
 		Duration:    req.Duration,
 		TotalScore:  totalScore,
+		Visibility:  visibility,
 		CreatedBy:   middleware.GetCurrentUserID(c),
 	}
 	utils.SetTenantID(&paper, tenantID)
 
-	if err := database.DB.Create(&paper).Error; err != nil {
+	// 试卷、题目关联和固定的题目版本在同一事务中写入
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&paper).Error; err != nil {
+			return err
+		}
+		// 关联题目，并固定题目的当前版本
+		if err := tx.Model(&paper).Association("Questions").Append(selectedQuestions); err != nil {
+			return err
+		}
+		return services.PinPaperRevisions(tx, tenantID, paper.ID, false)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建试卷失败"})
 		return
 	}
-
-	// 关联题目
-	if err := database.DB.Model(&paper).Association("Questions").Append(selectedQuestionObjs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "关联题目失败"})
-		return
-	}
+	recordAudit(c, services.AuditPaperCreate, services.ResourcePaper, paper.ID, nil, newPaperSnapshot(paper))
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Subject").Preload("Creator").First(&paper, paper.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"paper":            paper,
-		"selected_count":   len(selectedQuestions),
+		"selected_count":   selectedCount,
 		"total_score":      totalScore,
 	})
 }
@@ -295,14 +360,27 @@ func UpdatePaper(c *gin.Context) {
 		return
 	}
 
-	// 检查权限（只有创建者或管理员可以修改）
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-	if paper.CreatedBy != currentUserID && currentRole != models.RoleAdmin {
+	// 检查权限（创建者、协作编辑者和内容管理者可以修改）
+	before := newPaperSnapshot(paper)
+	actor := currentActor(c)
+	if !accessService.CanEdit(actor, services.ResourcePaper, paper.ID, paper.CreatedBy) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限修改此试卷"})
 		return
 	}
 
+	// 修改可见范围需要共享管理权限
+	if req.Visibility != "" && req.Visibility != paper.Visibility {
+		if !services.IsValidVisibility(req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+			return
+		}
+		if !accessService.CanManage(actor, paper.CreatedBy) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有创建者可以修改共享设置"})
+			return
+		}
+		paper.Visibility = req.Visibility
+	}
+
 	// 检查试卷是否已被使用（有考试关联）
 	var examCount int64
 	utils.WithTenant(database.DB, tenantID).Model(&models.Exam{}).Where("paper_id = ?", uint(id)).Count(&examCount)
@@ -318,45 +396,66 @@ func UpdatePaper(c *gin.Context) {
 		return
 	}
 
-	// 验证题目是否存在且属于该科目
+	// 验证题目是否存在、属于该科目且当前用户可见
 	var questions []models.Question
-	if err := utils.WithTenant(database.DB, tenantID).Where("id IN ? AND subject_id = ?", req.Questions, req.SubjectID).Find(&questions).Error; err != nil {
+	questionQuery := utils.WithTenant(database.DB, tenantID).Where("id IN ? AND subject_id = ?", req.Questions, req.SubjectID)
+	questionQuery = accessService.ScopeVisible(questionQuery, actor, services.ResourceQuestion)
+	if err := questionQuery.Find(&questions).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证题目失败"})
 		return
 	}
 
 	if len(questions) != len(req.Questions) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "部分题目不存在或不属于该科目"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分题目不存在、不属于该科目或没有权限使用"})
 		return
 	}
 
-	// 计算总分
-	totalScore := req.TotalScore
-	if totalScore == 0 {
-		for _, q := range questions {
-			totalScore += q.Score
+	// 只能使用已通过审核的题目；试卷中原有的题目保留组卷时固定的版本，之后被修改退回审核也不影响，刷新版本时除外
+	pinned := make(map[uint]bool)
+	if !req.RefreshRevisions {
+		for _, questionID := range before.QuestionIDs {
+			pinned[questionID] = true
 		}
 	}
+	if ids := unreviewedQuestionIDs(questions, pinned); len(ids) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分题目尚未通过审核，不能加入试卷", "question_ids": ids})
+		return
+	}
 
 	// 更新试卷
 	paper.SubjectID = req.SubjectID
 	paper.Title = req.Title
 	paper.Description = req.Description
 	paper.Duration = req.Duration
-	paper.TotalScore = totalScore
-
-
-
-	// 更新题目关联
-	if err := database.DB.Model(&paper).Association("Questions").Replace(questions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新题目关联失败"})
-		return
-	}
+	paper.TotalScore = req.TotalScore
+
+	// 试卷信息、题目关联和固定的题目版本在同一事务中更新
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 材料题与其子题整体加入试卷
+		questions, err := services.ExpandQuestionGroups(tx, tenantID, questions)
+		if err != nil {
+			return err
+		}
+		// 计算总分（材料题的分值已包含在子题中）
+		if paper.TotalScore == 0 {
+			paper.TotalScore = services.QuestionsTotalScore(questions)
+		}
 
-	if err := database.DB.Save(&paper).Error; err != nil {
+		if err := tx.Save(&paper).Error; err != nil {
+			return err
+		}
+		// 更新题目关联，新加入的题目固定当前版本
+		if err := tx.Model(&paper).Association("Questions").Replace(questions); err != nil {
+			return err
+		}
+		return services.PinPaperRevisions(tx, tenantID, paper.ID, req.RefreshRevisions)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新试卷失败"})
 		return
 	}
+	recordAudit(c, services.AuditPaperUpdate, services.ResourcePaper, paper.ID, before, newPaperSnapshot(paper))
+	services.NewCacheService().InvalidatePaperCache(tenantID, paper.ID) // 题目或固定的版本可能已变化
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Subject").Preload("Creator").First(&paper, paper.ID)
@@ -379,13 +478,12 @@ func DeletePaper(c *gin.Context) {
 		return
 	}
 
-	// 检查权限（只有创建者或管理员可以删除）
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-	if paper.CreatedBy != currentUserID && currentRole != models.RoleAdmin {
+	// 检查权限（只有创建者和内容管理者可以删除，协作编辑者不可以）
+	if !accessService.CanManage(currentActor(c), paper.CreatedBy) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限删除此试卷"})
 		return
 	}
+	before := newPaperSnapshot(paper)
 
 	// 检查试卷是否已被使用（有考试关联）
 	var examCount int64
@@ -399,6 +497,43 @@ func DeletePaper(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除试卷失败"})
 		return
 	}
+	recordAudit(c, services.AuditPaperDelete, services.ResourcePaper, paper.ID, before, nil)
+	accessService.DeleteShares(tenantID, services.ResourcePaper, paper.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "试卷删除成功"})
-}
\ No newline at end of file
+}
+
+// paperVisibility 校验新试卷的可见范围，未指定时租户内可见
+func paperVisibility(c *gin.Context, visibility models.Visibility) (models.Visibility, bool) {
+	if visibility == "" {
+		return models.VisibilityTenant, true
+	}
+	if !services.IsValidVisibility(visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+		return "", false
+	}
+	return visibility, true
+}
+
+// paperSnapshot 试卷及其题目ID列表，用于审计日志记录题目变化
+type paperSnapshot struct {
+	models.Paper
+	QuestionIDs []uint `json:"question_ids"`
+}
+
+func newPaperSnapshot(paper models.Paper) paperSnapshot {
+	var questionIDs []uint
+	database.DB.Table("paper_questions").Where("paper_id = ?", paper.ID).Order("question_id").Pluck("question_id", &questionIDs)
+	return paperSnapshot{Paper: paper, QuestionIDs: questionIDs}
+}
+
+// unreviewedQuestionIDs 返回未通过审核的题目ID，skip 中的题目除外
+func unreviewedQuestionIDs(questions []models.Question, skip map[uint]bool) []uint {
+	var ids []uint
+	for _, question := range questions {
+		if !skip[question.ID] && !services.IsReviewedQuestionStatus(question.Status) {
+			ids = append(ids, question.ID)
+		}
+	}
+	return ids
+}
@@ -9,6 +9,7 @@ import (
 	"online-exam-system/database"
 	"online-exam-system/middleware"
 	"online-exam-system/models"
+	"online-exam-system/services"
 	"online-exam-system/utils"
 	"sort"
 	"strconv"
@@ -109,8 +110,10 @@ func StartPractice(c *gin.Context) {
 		req.QuestionCount = 10
 	}
 
-	// 构建查询条件
+	// 构建查询条件，只使用已发布的题目（发布前需审核通过，审核通过但未发布的题目不对学生开放）
 	query := utils.WithTenant(database.DB, tenantID).Where("subject_id = ? AND status = ?", req.SubjectID, models.QuestionPublished)
+	// 练习只抽取独立题目，材料题需连同子题整体作答
+	query = query.Where("parent_id IS NULL AND type <> ?", models.Material)
 	if req.Difficulty > 0 {
 		query = query.Where("difficulty = ?", req.Difficulty)
 	}
@@ -152,6 +155,11 @@ func StartPractice(c *gin.Context) {
 		utils.BadRequestResponse(c, "没有找到符合条件的题目")
 		return
 	}
+	if err := services.AttachQuestionOptions(database.DB, tenantID, questions); err != nil {
+		utils.InternalServerErrorResponse(c, "获取题目选项失败")
+		return
+	}
+	services.HideQuestionOptionAnswers(questions) // 选项反馈在提交答案后返回
 
 	// 创建练习记录
 	questionIDs := make([]uint, len(questions))
@@ -226,11 +234,23 @@ func SubmitPracticeAnswer(c *gin.Context) {
 		utils.NotFoundResponse(c, "题目不存在")
 		return
 	}
+	if services.IsChoiceQuestionType(question.Type) {
+		options, err := services.LoadQuestionOptions(database.DB, tenantID, []uint{question.ID})
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "获取题目选项失败")
+			return
+		}
+		question.Choices = options[question.ID]
+		// 选择题作答统一保存为所选选项的ID
+		req.Answer = services.NormalizeChoiceAnswer(req.Answer, question.Choices)
+	}
 
-	// 判断答案是否正确
-	isCorrect := checkPracticeAnswer(question, req.Answer)
-	score := 0
-	if isCorrect {
+	// 判断答案是否正确，结构化题型按比例给分
+	var isCorrect bool
+	var score int
+	if services.IsStructuredQuestionType(question.Type) {
+		score, isCorrect = gradeAnswer(question, req.Answer)
+	} else if isCorrect = checkPracticeAnswer(question, req.Answer); isCorrect {
 		score = question.Score
 	}
 
@@ -269,6 +289,7 @@ func SubmitPracticeAnswer(c *gin.Context) {
 		"is_correct": isCorrect,
 		"score":      score,
 		"explanation": question.Explanation,
+		"feedback":    services.SelectedOptionFeedback(req.Answer, question.Choices), // 所选选项的反馈
 	})
 }
 
@@ -422,6 +443,19 @@ func GetWrongQuestions(c *gin.Context) {
 		Offset(offset).Limit(pageSize).
 		Scan(&wrongQuestions)
 
+	// 选择题作答保存为选项ID，转换为选项字母展示
+	questionIDs := make([]uint, len(wrongQuestions))
+	for i, item := range wrongQuestions {
+		questionIDs[i] = item.QuestionID
+	}
+	if options, err := services.LoadQuestionOptions(database.DB, tenantID, questionIDs); err == nil {
+		for i := range wrongQuestions {
+			if choices := options[wrongQuestions[i].QuestionID]; len(choices) > 0 {
+				wrongQuestions[i].UserAnswer = services.ChoiceAnswerLetters(wrongQuestions[i].UserAnswer, choices)
+			}
+		}
+	}
+
 	utils.SuccessPaginationResponse(c, wrongQuestions, total, page, pageSize)
 }
 
@@ -454,31 +488,31 @@ func StartWrongQuestionReview(c *gin.Context) {
 		req.MaxQuestions = 20
 	}
 
+	// 只能复习自己答错的题目，指定题目ID时同样取与错题的交集；与开始练习一致，只包含已发布的独立题目
+	// 联表查询已按租户限定每张表，不能再用WithTenant添加有歧义的tenant_id条件
 	var questionIDs []uint
+	query := database.DB.Table("practice_answers").
+		Select("DISTINCT practice_answers.question_id").
+		Joins("JOIN practice_records ON practice_answers.practice_record_id = practice_records.id").
+		Joins("JOIN questions ON practice_answers.question_id = questions.id").
+		Where("practice_records.user_id = ? AND practice_answers.is_correct = ? AND practice_records.tenant_id = ? AND practice_answers.tenant_id = ? AND questions.tenant_id = ?", userID, false, tenantID, tenantID, tenantID).
+		Where("questions.status = ? AND questions.parent_id IS NULL AND questions.type <> ?", models.QuestionPublished, models.Material)
 
 	if len(req.QuestionIDs) > 0 {
-		// 使用指定的错题ID
-		questionIDs = req.QuestionIDs
-	} else {
-		// 获取用户的错题
-		query := utils.WithTenant(database.DB, tenantID).Table("practice_answers").
-			Select("DISTINCT practice_answers.question_id").
-			Joins("JOIN practice_records ON practice_answers.practice_record_id = practice_records.id").
-			Joins("JOIN questions ON practice_answers.question_id = questions.id").
-			Where("practice_records.user_id = ? AND practice_answers.is_correct = ? AND practice_records.tenant_id = ? AND practice_answers.tenant_id = ? AND questions.tenant_id = ?", userID, false, tenantID, tenantID, tenantID)
-
-		if req.SubjectID > 0 {
-			query = query.Where("questions.subject_id = ?", req.SubjectID)
-		}
+		query = query.Where("practice_answers.question_id IN ?", req.QuestionIDs)
+	}
 
-		// 如果指定了练习记录ID，只获取该次练习的错题
-		if req.PracticeRecordID > 0 {
-			query = query.Where("practice_answers.practice_record_id = ?", req.PracticeRecordID)
-		}
+	if req.SubjectID > 0 {
+		query = query.Where("questions.subject_id = ?", req.SubjectID)
+	}
 
-		query.Order("practice_answers.created_at DESC").Limit(req.MaxQuestions).Pluck("question_id", &questionIDs)
+	// 如果指定了练习记录ID，只获取该次练习的错题
+	if req.PracticeRecordID > 0 {
+		query = query.Where("practice_answers.practice_record_id = ?", req.PracticeRecordID)
 	}
 
+	query.Order("practice_answers.created_at DESC").Limit(req.MaxQuestions).Pluck("question_id", &questionIDs)
+
 	if len(questionIDs) == 0 {
 		utils.BadRequestResponse(c, "没有找到错题")
 		return
@@ -486,10 +520,17 @@ func StartWrongQuestionReview(c *gin.Context) {
 
 	// 获取题目详情
 	var questions []models.Question
-	if err := utils.WithTenant(database.DB, tenantID).Preload("Subject").Where("id IN ?", questionIDs).Find(&questions).Error; err != nil {
+	if err := utils.WithTenant(database.DB, tenantID).Preload("Subject").
+		Where("id IN ? AND status = ? AND parent_id IS NULL AND type <> ?", questionIDs, models.QuestionPublished, models.Material).
+		Find(&questions).Error; err != nil {
 		utils.InternalServerErrorResponse(c, "获取题目失败")
 		return
 	}
+	if err := services.AttachQuestionOptions(database.DB, tenantID, questions); err != nil {
+		utils.InternalServerErrorResponse(c, "获取题目选项失败")
+		return
+	}
+	services.HideQuestionOptionAnswers(questions)
 
 	// 创建复习练习记录
 	questionIDsJSON, _ := json.Marshal(questionIDs)
@@ -528,6 +569,11 @@ func checkPracticeAnswer(question models.Question, userAnswer string) bool {
 	log.Printf("[DEBUG] Correct Answer: '%s'", correctAnswer)
 	log.Printf("[DEBUG] User Answer: '%s'", userAnswer)
 
+	// 已迁移到选项表的选择题按所选选项判断
+	if services.IsChoiceQuestionType(question.Type) && len(question.Choices) > 0 {
+		return services.GradeChoiceAnswer(question.Choices, userAnswer)
+	}
+
 	// 如果是多选题，需要特殊处理
 	if question.Type == "multiple" {
 		var correctOptions []string
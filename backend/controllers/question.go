@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"online-exam-system/database"
 	"online-exam-system/middleware"
@@ -11,19 +13,26 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// QuestionRequest 字段与 services.QuestionJSON 相同，批量导入时直接转换
 type QuestionRequest struct {
-	SubjectID   uint                   `json:"subject_id" binding:"required"`
-	Type        models.QuestionType    `json:"type" binding:"required"`
-	Title       string                 `json:"title" binding:"required"`
-	Content     string                 `json:"content"`
-	Options     []string               `json:"options"`
-	Answer      string                 `json:"answer" binding:"required"`
-	Explanation string                 `json:"explanation"`
-	Difficulty  int                    `json:"difficulty"`
-	Score       int                    `json:"score"`
-	Status      models.QuestionStatus  `json:"status"`
+	ID             uint                          `json:"id"` // 仅批量导入时使用：填写时更新该题目
+	SubjectID      uint                          `json:"subject_id" binding:"required"`
+	Type           models.QuestionType           `json:"type" binding:"required"`
+	Title          string                        `json:"title" binding:"required"`
+	Content        string                        `json:"content"`
+	Options        services.QuestionOptionInputs `json:"options"` // 选择题的选项可以是内容字符串，也可以是带 id、is_correct、feedback 的对象
+	Answer         string                        `json:"answer"`  // 材料题不需要答案；选择题为正确选项字母，选项中标记了 is_correct 时可不填
+	Explanation    string                        `json:"explanation"`
+	Difficulty     int                           `json:"difficulty"`
+	Score          int                           `json:"score"` // 材料题的分值为子题分值之和，无需填写
+	KnowledgePoint string                        `json:"knowledge_point"`
+	Status         models.QuestionStatus         `json:"status"`     // 新建时默认按是否为审核人决定；修改时需符合审核流程
+	Visibility     models.Visibility             `json:"visibility"` // 可见范围，默认租户内可见
+	ParentID       *uint                         `json:"parent_id"`  // 所属材料题；更新时不填写表示不变，填写0表示移出材料题
+	Position       int                           `json:"position"`   // 在材料题中的序号
 }
 
 type QuestionListResponse struct {
@@ -37,15 +46,52 @@ type QuestionListResponse struct {
 func GetQuestions(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	offset := (page - 1) * size
+
+	query := filteredQuestionQuery(c).Preload("Subject").Preload("Creator")
+
+	// 子题随材料题展示，列表默认只显示顶层题目
+	if c.Query("parent_id") == "" {
+		query = query.Where("parent_id IS NULL")
+	}
+
+	// 获取总数
+	var total int64
+	query.Count(&total)
+
+	// 获取题目列表
+	var questions []models.Question
+	if err := query.Offset(offset).Limit(size).Order("created_at DESC").Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目列表失败"})
+		return
+	}
+	if err := services.AttachQuestionOptions(database.DB, middleware.GetTenantID(c), questions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目选项失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, QuestionListResponse{
+		Questions: questions,
+		Total:     total,
+		Page:      page,
+		Size:      size,
+	})
+}
+
+// filteredQuestionQuery 按查询参数筛选当前用户可见的题目，题目列表和导出共用
+func filteredQuestionQuery(c *gin.Context) *gorm.DB {
 	subjectID := c.Query("subject_id")
 	questionType := c.Query("type")
 	search := c.Query("search")
 	difficulty := c.Query("difficulty")
+	status := c.Query("status")
+	knowledgePoint := c.Query("knowledge_point")
 	tenantID := middleware.GetTenantID(c)
 
-	offset := (page - 1) * size
+	query := utils.WithTenant(database.DB, tenantID).Model(&models.Question{})
 
-	query := utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Preload("Subject").Preload("Creator")
+	// 只显示当前用户可见的题目
+	query = accessService.ScopeVisible(query, currentActor(c), services.ResourceQuestion)
 
 	// 科目筛选
 	if subjectID != "" {
@@ -62,28 +108,53 @@ func GetQuestions(c *gin.Context) {
 		query = query.Where("difficulty = ?", difficulty)
 	}
 
+	// 状态筛选
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// 所属材料题筛选
+	if parentID := c.Query("parent_id"); parentID != "" {
+		query = query.Where("parent_id = ?", parentID)
+	}
+
+	// 知识点筛选
+	if knowledgePoint != "" {
+		query = query.Where("knowledge_point LIKE ?", "%"+knowledgePoint+"%")
+	}
+
 	// 搜索筛选
 	if search != "" {
 		query = query.Where("title ILIKE ? OR content ILIKE ?", "%"+search+"%", "%"+search+"%")
 	}
+	return query
+}
 
-	// 获取总数
-	var total int64
-	query.Count(&total)
-
-	// 获取题目列表
-	var questions []models.Question
-	if err := query.Offset(offset).Limit(size).Order("created_at DESC").Find(&questions).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目列表失败"})
-		return
+// questionOptionsAndAnswer 返回保存到题目的选项和答案（JSON）：选择题校验选项并生成选项表中的选项，题目中保存选项内容和正确选项字母的副本；
+// 结构化题型（填空、配对、排序、数值）校验答案并由答案生成展示数据；材料题没有选项和答案，其他题型直接保存请求中的选项和答案
+func questionOptionsAndAnswer(req *QuestionRequest) (string, string, []models.QuestionOption, error) {
+	if req.Type == models.Material {
+		if len(req.Options) > 0 || req.Answer != "" {
+			return "", "", nil, errors.New("材料题不需要填写选项和答案，请在子题中填写")
+		}
+		return "", "", nil, nil
 	}
-
-	c.JSON(http.StatusOK, QuestionListResponse{
-		Questions: questions,
-		Total:     total,
-		Page:      page,
-		Size:      size,
-	})
+	if services.IsChoiceQuestionType(req.Type) {
+		choices, optionsJSON, answer, err := services.BuildQuestionOptions(req.Type, req.Options, req.Answer)
+		return optionsJSON, answer, choices, err
+	}
+	if req.Answer == "" {
+		return "", "", nil, errors.New("答案不能为空")
+	}
+	if services.IsStructuredQuestionType(req.Type) {
+		if len(req.Options) > 0 {
+			return "", "", nil, errors.New("该题型不需要填写选项，展示内容由答案生成")
+		}
+		answer, layout, err := services.NormalizeStructuredAnswer(req.Type, req.Content, req.Answer)
+		return layout, answer, nil, err
+	}
+	optionsJSON, _ := json.Marshal(req.Options.Contents())
+	return string(optionsJSON), req.Answer, nil, nil
 }
 
 // 获取单个题目
@@ -103,6 +174,25 @@ func GetQuestion(c *gin.Context) {
 		return
 	}
 
+	if !accessService.CanView(currentActor(c), services.ResourceQuestion, question.ID, question.CreatedBy, question.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此题目"})
+		return
+	}
+
+	// 材料题附带按序号排列的子题
+	if question.Type == models.Material {
+		children, err := services.LoadQuestionChildren(database.DB, tenantID, question.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取子题失败"})
+			return
+		}
+		if err := services.AttachQuestionOptions(database.DB, tenantID, children); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目选项失败"})
+			return
+		}
+		question.Children = children
+	}
+
 	c.JSON(http.StatusOK, question)
 }
 
@@ -122,41 +212,111 @@ func CreateQuestion(c *gin.Context) {
 		return
 	}
 
-	// 将选项转换为JSON字符串
-	optionsJSON, _ := json.Marshal(req.Options)
+	options, answer, choices, err := questionOptionsAndAnswer(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 设置默认状态
-	status := req.Status
-	if status == "" {
-		status = models.QuestionPublished
+	// 验证所属材料题
+	if req.ParentID != nil && *req.ParentID == 0 {
+		req.ParentID = nil
+	}
+	if req.ParentID != nil {
+		if err := services.CheckQuestionParent(database.DB, tenantID, *req.ParentID, req.SubjectID, req.Type); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	score := req.Score
+	if req.Type == models.Material {
+		score = 0 // 创建子题时累加
+	}
+
+	// 设置初始状态：新题目为草稿或创建后直接提交审核；子题的状态与材料题相同
+	actor := currentActor(c)
+	status, err := services.InitialQuestionStatus(req.Status)
+	if err != nil {
+		c.JSON(reviewErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	submit := status == models.QuestionSubmitted
+	if submit {
+		status = models.QuestionDraft // 创建后提交审核，分配审核人并记录
+	}
+
+	// 设置默认可见范围
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityTenant
+	}
+	if !services.IsValidVisibility(visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+		return
 	}
 
 	// 创建题目
 	question := models.Question{
-		SubjectID:   req.SubjectID,
-		Type:        req.Type,
-		Title:       req.Title,
-		Content:     req.Content,
-		Options:     string(optionsJSON),
-		Answer:      req.Answer,
-		Explanation: req.Explanation,
-		Difficulty:  req.Difficulty,
-		Score:       req.Score,
-		Status:      status,
-		CreatedBy:   middleware.GetCurrentUserID(c),
+		TenantID:       tenantID,
+		SubjectID:      req.SubjectID,
+		Type:           req.Type,
+		Title:          req.Title,
+		Content:        req.Content,
+		Options:        options,
+		Answer:         answer,
+		Explanation:    req.Explanation,
+		Difficulty:     req.Difficulty,
+		Score:          score,
+		KnowledgePoint: req.KnowledgePoint,
+		Status:         status,
+		Visibility:     visibility,
+		ParentID:       req.ParentID,
+		Position:       req.Position,
+		CreatedBy:      middleware.GetCurrentUserID(c),
 	}
 	utils.SetTenantID(&question, tenantID)
+	if err := services.CheckQuestionAttachments(database.DB, tenantID, question); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := database.DB.Create(&question).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&question).Error; err != nil {
+			return err
+		}
+		var err error
+		if question.Choices, err = services.SaveQuestionOptions(tx, tenantID, question.ID, choices); err != nil {
+			return err
+		}
+		if _, _, err := services.RecordQuestionRevision(tx, &question, question.CreatedBy); err != nil {
+			return err
+		}
+		if question.ParentID != nil {
+			// 新加入子题相当于修改材料题
+			if err := reviewService.ReviseQuestion(tx, actor, &question); err != nil {
+				return err
+			}
+		} else if submit {
+			if _, err := reviewService.Transition(tx, actor, &question, services.ReviewSubmit, ""); err != nil {
+				return err
+			}
+		}
+		return services.SyncQuestionAttachments(tx, tenantID, question)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建题目失败"})
 		return
 	}
+	recordAudit(c, services.AuditQuestionCreate, services.ResourceQuestion, question.ID, nil, question)
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Subject").Preload("Creator").First(&question, question.ID)
 
 	// 清除相关缓存
 	cacheService := services.NewCacheService()
+	if question.ParentID != nil {
+		refreshMaterialScore(tenantID, *question.ParentID)
+	}
 	cacheService.InvalidatePaperCache(tenantID, 0) // 清除所有试卷缓存，因为题目可能被多个试卷使用
 
 	c.JSON(http.StatusCreated, question)
@@ -183,14 +343,32 @@ func UpdateQuestion(c *gin.Context) {
 		return
 	}
 
-	// 检查权限（只有创建者或管理员可以修改）
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-	if question.CreatedBy != currentUserID && currentRole != models.RoleAdmin {
+	// 修改前的选项用于审计记录
+	if options, err := services.LoadQuestionOptions(database.DB, tenantID, []uint{question.ID}); err == nil {
+		question.Choices = options[question.ID]
+	}
+
+	// 检查权限（创建者、协作编辑者和内容管理者可以修改）
+	before := question
+	actor := currentActor(c)
+	if !accessService.CanEdit(actor, services.ResourceQuestion, question.ID, question.CreatedBy) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限修改此题目"})
 		return
 	}
 
+	// 修改可见范围需要共享管理权限
+	if req.Visibility != "" && req.Visibility != question.Visibility {
+		if !services.IsValidVisibility(req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+			return
+		}
+		if !accessService.CanManage(actor, question.CreatedBy) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有创建者可以修改共享设置"})
+			return
+		}
+		question.Visibility = req.Visibility
+	}
+
 	// 验证科目是否存在
 	var subject models.Subject
 	if err := utils.WithTenant(database.DB, tenantID).First(&subject, req.SubjectID).Error; err != nil {
@@ -198,27 +376,122 @@ func UpdateQuestion(c *gin.Context) {
 		return
 	}
 
-	// 将选项转换为JSON字符串
-	optionsJSON, _ := json.Marshal(req.Options)
+	options, answer, choices, err := questionOptionsAndAnswer(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 材料题包含子题时不能修改题型和科目
+	if err := services.CheckMaterialChange(database.DB, question, req.Type, req.SubjectID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 修改状态需符合审核流程，审核和发布需要科目审核人执行
+	statusAction := ""
+	if req.Status != "" && req.Status != question.Status {
+		if !services.IsValidQuestionStatus(req.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidQuestionStatus.Error()})
+			return
+		}
+		action, ok := services.QuestionStatusAction(question.Status, req.Status)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidQuestionTransition.Error()})
+			return
+		}
+		statusAction = action
+	}
+
+	// 验证所属材料题，未填写时保持不变
+	parentID := question.ParentID
+	if req.ParentID != nil {
+		parentID = req.ParentID
+		if *req.ParentID == 0 {
+			parentID = nil
+		}
+	}
+	if parentID != nil {
+		if *parentID == question.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidQuestionParent.Error()})
+			return
+		}
+		if err := services.CheckQuestionParent(database.DB, tenantID, *parentID, req.SubjectID, req.Type); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// 更新题目
 	question.SubjectID = req.SubjectID
 	question.Type = req.Type
 	question.Title = req.Title
 	question.Content = req.Content
-	question.Options = string(optionsJSON)
-	question.Answer = req.Answer
+	question.Options = options
+	question.Answer = answer
 	question.Explanation = req.Explanation
 	question.Difficulty = req.Difficulty
-	question.Score = req.Score
-	if req.Status != "" {
-		question.Status = req.Status
+	if req.Type != models.Material {
+		question.Score = req.Score
+	}
+	if req.KnowledgePoint != "" {
+		question.KnowledgePoint = req.KnowledgePoint
+	}
+	question.ParentID = parentID
+	if req.ParentID != nil || req.Position != 0 {
+		question.Position = req.Position
+	}
+
+	if err := services.CheckQuestionAttachments(database.DB, tenantID, question); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := database.DB.Save(&question).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 升级前创建的题目先保存修改前的内容作为第一个版本
+		if err := services.EnsureQuestionRevisions(tx, tenantID, []uint{question.ID}); err != nil {
+			return err
+		}
+		if err := tx.Save(&question).Error; err != nil {
+			return err
+		}
+		var err error
+		if question.Choices, err = services.SaveQuestionOptions(tx, tenantID, question.ID, choices); err != nil {
+			return err
+		}
+		_, revised, err := services.RecordQuestionRevision(tx, &question, middleware.GetCurrentUserID(c))
+		if err != nil {
+			return err
+		}
+		// 内容修改后需重新审核
+		if revised {
+			if err := reviewService.ReviseQuestion(tx, actor, &question); err != nil {
+				return err
+			}
+		}
+		if statusAction != "" {
+			if err := reviewService.ChangeStatus(tx, actor, &question, req.Status); err != nil {
+				return err
+			}
+		}
+		return services.SyncQuestionAttachments(tx, tenantID, question)
+	})
+	if errors.Is(err, services.ErrInvalidQuestionOption) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if code := reviewErrorStatus(err); err != nil && code != http.StatusInternalServerError {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新题目失败"})
 		return
 	}
+	recordAudit(c, services.AuditQuestionUpdate, services.ResourceQuestion, question.ID, before, question)
+	if question.Type == models.Material {
+		refreshMaterialScore(tenantID, question.ID)
+	}
 
 	// 预加载关联数据
 	utils.WithTenant(database.DB, tenantID).Preload("Subject").Preload("Creator").First(&question, question.ID)
@@ -226,6 +499,12 @@ func UpdateQuestion(c *gin.Context) {
 	// 清除相关缓存
 	cacheService := services.NewCacheService()
 	cacheService.InvalidateQuestionCache(tenantID, uint(id))
+	if before.ParentID != nil {
+		refreshMaterialScore(tenantID, *before.ParentID)
+	}
+	if question.ParentID != nil && (before.ParentID == nil || *before.ParentID != *question.ParentID) {
+		refreshMaterialScore(tenantID, *question.ParentID)
+	}
 	cacheService.InvalidatePaperCache(tenantID, 0) // 清除所有试卷缓存
 
 	c.JSON(http.StatusOK, question)
@@ -246,28 +525,65 @@ func DeleteQuestion(c *gin.Context) {
 		return
 	}
 
-	// 检查权限（只有创建者或管理员可以删除）
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-	if question.CreatedBy != currentUserID && currentRole != models.RoleAdmin {
+	// 检查权限（只有创建者和内容管理者可以删除，协作编辑者不可以）
+	if !accessService.CanManage(currentActor(c), question.CreatedBy) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限删除此题目"})
 		return
 	}
 
-	if err := database.DB.Delete(&question).Error; err != nil {
+	// 删除材料题时一并删除其子题
+	var children []models.Question
+	if question.Type == models.Material {
+		utils.WithTenant(database.DB, tenantID).Where("parent_id = ?", question.ID).Find(&children)
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		questionIDs := []uint{question.ID}
+		if len(children) > 0 {
+			if err := utils.WithTenant(tx, tenantID).Where("parent_id = ?", question.ID).Delete(&models.Question{}).Error; err != nil {
+				return err
+			}
+			for _, child := range children {
+				questionIDs = append(questionIDs, child.ID)
+			}
+		}
+		if err := services.DeleteQuestionAttachments(tx, tenantID, questionIDs); err != nil {
+			return err
+		}
+		if err := services.DeleteQuestionOptions(tx, tenantID, questionIDs); err != nil {
+			return err
+		}
+		return tx.Delete(&question).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除题目失败"})
 		return
 	}
+	accessService.DeleteShares(tenantID, services.ResourceQuestion, question.ID)
+	recordAudit(c, services.AuditQuestionDelete, services.ResourceQuestion, question.ID, question, nil)
 
 	// 清除相关缓存
 	cacheService := services.NewCacheService()
 	cacheService.InvalidateQuestionCache(tenantID, uint(id))
+	for _, child := range children {
+		accessService.DeleteShares(tenantID, services.ResourceQuestion, child.ID)
+		recordAudit(c, services.AuditQuestionDelete, services.ResourceQuestion, child.ID, child, nil)
+		cacheService.InvalidateQuestionCache(tenantID, child.ID)
+	}
+	if question.ParentID != nil {
+		refreshMaterialScore(tenantID, *question.ParentID)
+	}
 	cacheService.InvalidatePaperCache(tenantID, 0) // 清除所有试卷缓存
 
 	c.JSON(http.StatusOK, gin.H{"message": "题目删除成功"})
 }
 
-// 批量导入题目
+// refreshMaterialScore 子题变化后重新计算材料题分值并清除其缓存
+func refreshMaterialScore(tenantID, materialID uint) {
+	services.RefreshMaterialScore(database.DB, tenantID, materialID)
+	services.NewCacheService().InvalidateQuestionCache(tenantID, materialID)
+}
+
+// 批量导入题目，作为导入任务在后台执行，mode 为 all_or_nothing（默认）或 best_effort
 func BatchImportQuestions(c *gin.Context) {
 	var req struct {
 		Questions []QuestionRequest `json:"questions" binding:"required"`
@@ -277,52 +593,27 @@ func BatchImportQuestions(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if len(req.Questions) > maxQuestionImportCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次最多导入%d道题目", maxQuestionImportCount)})
+		return
+	}
+	job, ok := bindImportJob(c, services.ImportKindQuestions)
+	if !ok {
+		return
+	}
 	tenantID := middleware.GetTenantID(c)
 
-	var successCount int
-	var errors []string
-	currentUserID := middleware.GetCurrentUserID(c)
-
+	items := make([]services.ImportedQuestion, len(req.Questions))
 	for i, questionReq := range req.Questions {
-		// 验证科目是否存在
-		var subject models.Subject
-		if err := utils.WithTenant(database.DB, tenantID).First(&subject, questionReq.SubjectID).Error; err != nil {
-			errors = append(errors, "第"+strconv.Itoa(i+1)+"题：科目不存在")
-			continue
-		}
-
-		// 将选项转换为JSON字符串
-		optionsJSON, _ := json.Marshal(questionReq.Options)
-
-		// 创建题目
-		question := models.Question{
-			SubjectID:   questionReq.SubjectID,
-			Type:        questionReq.Type,
-			Title:       questionReq.Title,
-			Content:     questionReq.Content,
-			Options:     string(optionsJSON),
-			Answer:      questionReq.Answer,
-			Explanation: questionReq.Explanation,
-			Difficulty:  questionReq.Difficulty,
-			Score:       questionReq.Score,
-			Status:      questionReq.Status,
-			CreatedBy:   currentUserID,
-		}
-		utils.SetTenantID(&question, tenantID)
-
-		if err := database.DB.Create(&question).Error; err != nil {
-			errors = append(errors, "第"+strconv.Itoa(i+1)+"题：创建失败")
-			continue
-		}
-
-		successCount++
+		items[i] = services.QuestionJSON(questionReq).Imported(i + 1)
 	}
+	questionImportService.Validate(tenantID, items, services.QuestionImportDefaults{Difficulty: 1, Score: 1})
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "批量导入完成",
-		"success_count": successCount,
-		"errors":        errors,
-	})
+	payload, _ := json.Marshal(req.Questions)
+	job.PayloadDigest = services.ImportPayloadDigest(payload, []byte(job.Mode))
+	job.Source = "json"
+	tasks := questionImportService.Tasks(currentActor(c), items, models.VisibilityTenant, false)
+	startQuestionImportJob(c, job, tasks)
 }
 
 // 获取题目统计信息
@@ -335,6 +626,11 @@ func GetQuestionStats(c *gin.Context) {
 		MultipleChoice int64 `json:"multiple_choice"`
 		TrueFalse      int64 `json:"true_false"`
 		ShortAnswer    int64 `json:"short_answer"`
+		FillBlank      int64 `json:"fill_blank"`
+		Matching       int64 `json:"matching"`
+		Ordering       int64 `json:"ordering"`
+		Numeric        int64 `json:"numeric"`
+		Material       int64 `json:"material"`
 	}
 
 	// 总题目数
@@ -345,6 +641,11 @@ func GetQuestionStats(c *gin.Context) {
 	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.MultipleChoice).Count(&stats.MultipleChoice)
 	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.TrueFalse).Count(&stats.TrueFalse)
 	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.ShortAnswer).Count(&stats.ShortAnswer)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.FillBlank).Count(&stats.FillBlank)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Matching).Count(&stats.Matching)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Ordering).Count(&stats.Ordering)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Numeric).Count(&stats.Numeric)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Material).Count(&stats.Material)
 
 	c.JSON(http.StatusOK, stats)
 }
\ No newline at end of file
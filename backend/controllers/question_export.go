@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单次最多导出的题目数
+const maxQuestionExportCount = 10000
+
+// questionExportFormats 导出格式对应的文件名和类型
+var questionExportFormats = map[string]struct {
+	filename    string
+	contentType string
+	write       func(w io.Writer, questions []models.Question) error
+	interop     bool // 其他平台的格式，部分题型无法表示
+}{
+	"xlsx":                 {"questions.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", writeQuestionXLSX, false},
+	"csv":                  {"questions.csv", "text/csv; charset=utf-8", writeQuestionCSV, false},
+	"json":                 {"questions.json", "application/json; charset=utf-8", writeQuestionJSON, false},
+	services.InteropQTI:    {"questions-qti21.zip", "application/zip", services.WriteQTIPackage, true},
+	services.InteropMoodle: {"questions-moodle.xml", "application/xml; charset=utf-8", services.WriteMoodleXML, true},
+	services.InteropGIFT:   {"questions.gift", "text/plain; charset=utf-8", services.WriteGIFT, true},
+}
+
+// 导出题目，筛选条件与题目列表相同（科目、题型、难度、状态、知识点、关键词）。
+// format 为 xlsx、csv、json 时使用导入模板的格式并带有题目ID，修改后重新导入即可批量更新；
+// 为 qti（QTI 2.1题目包）、moodle（Moodle XML）或 gift 时，无法表示的题目不导出，其ID通过 X-Unsupported-Questions 响应头返回
+func ExportQuestions(c *gin.Context) {
+	format, ok := questionExportFormats[c.Query("format")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式只能为xlsx、csv、json、qti、moodle或gift"})
+		return
+	}
+
+	var total int64
+	filteredQuestionQuery(c).Count(&total)
+	if total > maxQuestionExportCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次最多导出%d道题目，请缩小筛选范围", maxQuestionExportCount)})
+		return
+	}
+
+	// 按科目排序，便于按科目生成分类
+	var questions []models.Question
+	if err := filteredQuestionQuery(c).Preload("Subject").Order("subject_id, id").Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出题目失败"})
+		return
+	}
+	// 选项的正确标记和反馈随JSON、Moodle XML导出
+	if err := services.AttachQuestionOptions(database.DB, middleware.GetTenantID(c), questions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出题目失败"})
+		return
+	}
+
+	if format.interop {
+		if unsupported := services.InteropUnsupportedQuestions(questions); len(unsupported) > 0 {
+			ids := make([]string, len(unsupported))
+			for i, id := range unsupported {
+				ids[i] = strconv.FormatUint(uint64(id), 10)
+			}
+			c.Header("X-Unsupported-Questions", strings.Join(ids, ","))
+		}
+	}
+	c.Header("Content-Type", format.contentType)
+	c.Header("Content-Disposition", "attachment; filename="+format.filename)
+	if err := format.write(c.Writer, questions); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// writeQuestionXLSX 按导入模板的列写出题目
+func writeQuestionXLSX(w io.Writer, questions []models.Question) error {
+	xw, err := services.NewXLSXWriter(w, "题目")
+	if err != nil {
+		return err
+	}
+	if err := xw.WriteRow(services.QuestionImportTemplateHeader); err != nil {
+		return err
+	}
+	for _, question := range questions {
+		if err := xw.WriteRow(services.QuestionTableRow(question, question.Subject.Name)); err != nil {
+			return err
+		}
+	}
+	return xw.Close()
+}
+
+// writeQuestionCSV 按导入模板的列写出题目（UTF-8 BOM，便于Excel打开）
+func writeQuestionCSV(w io.Writer, questions []models.Question) error {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(services.QuestionImportTemplateHeader); err != nil {
+		return err
+	}
+	for _, question := range questions {
+		if err := cw.Write(services.QuestionTableRow(question, question.Subject.Name)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeQuestionJSON 以批量导入接口的格式（{"questions": [...]}）逐题写出
+func writeQuestionJSON(w io.Writer, questions []models.Question) error {
+	if _, err := io.WriteString(w, "{\"questions\":["); err != nil {
+		return err
+	}
+	for i, question := range questions {
+		data, err := json.Marshal(services.NewQuestionJSON(question))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]}")
+	return err
+}
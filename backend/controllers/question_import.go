@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 题库导入文件大小上限
+const maxQuestionImportSize = 10 << 20
+
+// 单个文件最多导入的题目数
+const maxQuestionImportCount = 2000
+
+var questionImportService = services.NewQuestionImportService()
+
+// QuestionImportResult 文件导入的预览结果
+type QuestionImportResult struct {
+	DryRun       bool                        `json:"dry_run"`
+	Total        int                         `json:"total"`
+	ValidCount   int                         `json:"valid_count"`
+	InvalidCount int                         `json:"invalid_count"`
+	Questions    []services.ImportedQuestion `json:"questions"`
+}
+
+// 从Excel、CSV、Word或文本文件导入题目，dry_run=true时只解析和校验，否则创建导入任务在后台写入
+func ImportQuestionsFromFile(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传题目文件"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxQuestionImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小不能超过10MB"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxQuestionImportSize+1))
+	if err != nil || len(data) > maxQuestionImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+
+	dryRun := c.DefaultPostForm("dry_run", "false") == "true"
+	defaults := services.QuestionImportDefaults{Difficulty: 1, Score: 1}
+	if subjectID, err := strconv.ParseUint(c.PostForm("subject_id"), 10, 32); err == nil {
+		defaults.SubjectID = uint(subjectID)
+	}
+	if difficulty, err := strconv.Atoi(c.PostForm("difficulty")); err == nil {
+		defaults.Difficulty = difficulty
+	}
+	if score, err := strconv.Atoi(c.PostForm("score")); err == nil {
+		defaults.Score = score
+	}
+	visibility := models.Visibility(c.DefaultPostForm("visibility", string(models.VisibilityTenant)))
+	if !services.IsValidVisibility(visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidVisibility.Error()})
+		return
+	}
+
+	items, err := questionImportService.ParseFile(header.Filename, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) > maxQuestionImportCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单个文件最多导入%d道题目", maxQuestionImportCount)})
+		return
+	}
+	questionImportService.Validate(tenantID, items, defaults)
+
+	result := QuestionImportResult{DryRun: dryRun, Total: len(items), Questions: items}
+	for _, item := range items {
+		if item.Valid {
+			result.ValidCount++
+		}
+	}
+	result.InvalidCount = result.Total - result.ValidCount
+
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	if result.ValidCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrNoQuestionsFound.Error(), "result": result})
+		return
+	}
+
+	// mode=all_or_nothing（默认）时有错误则整个文件都不导入，best_effort 时跳过错误的题目
+	job, ok := bindImportJob(c, services.ImportKindQuestions)
+	if !ok {
+		return
+	}
+	duplicate := c.DefaultPostForm("duplicate", "skip")
+	if duplicate != "skip" && duplicate != "create" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "重复题目处理方式只能为skip或create"})
+		return
+	}
+	job.Source = header.Filename
+	job.PayloadDigest = services.ImportPayloadDigest(data, []byte(job.Mode), []byte(duplicate), []byte(visibility),
+		[]byte(fmt.Sprintf("%d/%d/%d", defaults.SubjectID, defaults.Difficulty, defaults.Score)))
+	tasks := questionImportService.Tasks(currentActor(c), items, visibility, duplicate == "skip")
+	startQuestionImportJob(c, job, tasks)
+}
+
+// startQuestionImportJob 启动题目导入任务：新建和更新的题目分别记录审计日志，完成后清除题目和试卷缓存
+func startQuestionImportJob(c *gin.Context, job *models.ImportJob, tasks []services.ImportRowTask) {
+	tenantID := job.TenantID
+	startImportJob(c, job, tasks,
+		auditRecorder(c, services.AuditQuestionImport, services.ResourceQuestion),
+		auditRecorder(c, services.AuditQuestionUpdate, services.ResourceQuestion),
+		func(changes []services.ImportChange) {
+			cache := services.NewCacheService()
+			for _, change := range changes {
+				if change.Before != nil {
+					cache.InvalidateQuestionCache(tenantID, change.ResourceID)
+				}
+				// 子题变化后材料题的分值已重新计算
+				for _, snapshot := range []interface{}{change.Before, change.After} {
+					if question, ok := snapshot.(models.Question); ok && question.ParentID != nil {
+						cache.InvalidateQuestionCache(tenantID, *question.ParentID)
+					}
+				}
+			}
+			cache.InvalidatePaperCache(tenantID, 0)
+		})
+}
+
+// 下载题库导入模板，format 为 xlsx、csv、docx 或 txt
+func DownloadQuestionImportTemplate(c *gin.Context) {
+	format := c.DefaultQuery("format", "xlsx")
+	filename := "question-import-template." + format
+	var err error
+
+	switch format {
+	case "xlsx":
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		var xw *services.XLSXWriter
+		if xw, err = services.NewXLSXWriter(c.Writer, "题目"); err == nil {
+			for _, row := range append([][]string{services.QuestionImportTemplateHeader}, services.QuestionImportSampleRows()...) {
+				if err = xw.WriteRow(row); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = xw.Close()
+			}
+		}
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		err = writeCSV(c.Writer, append([][]string{services.QuestionImportTemplateHeader}, services.QuestionImportSampleRows()...))
+	case "docx":
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		err = services.WriteDOCX(c.Writer, services.QuestionImportTextTemplate())
+	case "txt":
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		for _, line := range services.QuestionImportTextTemplate() {
+			if _, err = io.WriteString(c.Writer, line+"\r\n"); err != nil {
+				break
+			}
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板格式只能为xlsx、csv、docx或txt"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// writeCSV 写出带BOM的UTF-8 CSV，便于Excel正确识别中文
+func writeCSV(w io.Writer, rows [][]string) error {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 检查当前租户中选项仍为旧格式（JSON字符串）的选择题，返回可以转换的数量和无法识别的题目，不修改数据
+func GetQuestionOptionMigration(c *gin.Context) {
+	report, err := services.MigrateQuestionOptions(database.DB, middleware.GetTenantID(c), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查题目选项失败"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// 将当前租户中旧格式的选择题选项转换为选项表，学生作答转换为选项ID；无法识别的题目保持原样并在结果中列出
+func RunQuestionOptionMigration(c *gin.Context) {
+	report, err := services.MigrateQuestionOptions(database.DB, middleware.GetTenantID(c), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转换题目选项失败"})
+		return
+	}
+	if report.Converted > 0 {
+		services.NewCacheService().InvalidatePaperCache(middleware.GetTenantID(c), 0)
+	}
+	recordAuditDetail(c, services.AuditQuestionOptionMigrate, services.ResourceQuestion, 0, gin.H{
+		"converted":           report.Converted,
+		"failed":              len(report.Failed),
+		"answers_converted":   report.AnswersConverted,
+		"answers_unconverted": report.AnswersUnconverted,
+	})
+	c.JSON(http.StatusOK, report)
+}
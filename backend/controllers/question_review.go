@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var reviewService = services.NewQuestionReviewService()
+
+type ReviewQuestionRequest struct {
+	Action  string `json:"action" binding:"required"` // submit、withdraw、approve、reject、publish、archive、restore
+	Comment string `json:"comment"`                   // 审核意见，驳回时必填
+}
+
+type SubjectReviewersRequest struct {
+	UserIDs []uint `json:"user_ids"`
+}
+
+// reviewErrorStatus 审核流程错误对应的HTTP状态码，其他错误返回500
+func reviewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrNotQuestionReviewer), errors.Is(err, services.ErrReviewOwnQuestion):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidQuestionStatus), errors.Is(err, services.ErrInvalidReviewAction),
+		errors.Is(err, services.ErrInvalidQuestionTransition), errors.Is(err, services.ErrReviewCommentRequired),
+		errors.Is(err, services.ErrReviewChildQuestion), errors.Is(err, services.ErrInitialQuestionStatus):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// 审核队列：当前用户可以审核的科目中待审核的题目，mine=true 只看分配给自己的题目；
+// status=approved 查看审核通过待发布的题目
+func GetQuestionReviewQueue(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	offset := (page - 1) * size
+	actor := currentActor(c)
+
+	status := models.QuestionStatus(c.DefaultQuery("status", string(models.QuestionSubmitted)))
+	if status != models.QuestionSubmitted && status != models.QuestionApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status只能为submitted或approved"})
+		return
+	}
+
+	query := utils.WithTenant(database.DB, actor.TenantID).Model(&models.Question{}).
+		Where("status = ? AND parent_id IS NULL", status)
+	query = reviewService.ScopeReviewable(query, actor)
+	if subjectID := c.Query("subject_id"); subjectID != "" {
+		query = query.Where("subject_id = ?", subjectID)
+	}
+	if c.Query("mine") == "true" {
+		query = query.Where("reviewer_id = ?", actor.UserID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var questions []models.Question
+	if err := query.Preload("Subject").Preload("Creator").Offset(offset).Limit(size).Order("updated_at ASC").Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核队列失败"})
+		return
+	}
+	if err := services.AttachQuestionOptions(database.DB, actor.TenantID, questions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目选项失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, QuestionListResponse{
+		Questions: questions,
+		Total:     total,
+		Page:      page,
+		Size:      size,
+	})
+}
+
+// 对题目执行审核动作：提交、撤回、归档和恢复需要编辑权限，审核通过、驳回和发布需要科目审核人
+func ReviewQuestion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的题目ID"})
+		return
+	}
+	var req ReviewQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !services.IsReviewAction(req.Action) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidReviewAction.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var question models.Question
+	if err := utils.WithTenant(database.DB, tenantID).First(&question, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题目不存在"})
+		return
+	}
+
+	actor := currentActor(c)
+	switch req.Action {
+	case services.ReviewApprove, services.ReviewReject, services.ReviewPublish:
+		// 审核人权限在审核服务中检查
+	default:
+		if !accessService.CanEdit(actor, services.ResourceQuestion, question.ID, question.CreatedBy) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有权限修改此题目"})
+			return
+		}
+	}
+
+	review, err := reviewService.Transition(database.DB, actor, &question, req.Action, req.Comment)
+	if err != nil {
+		code := reviewErrorStatus(err)
+		if code == http.StatusInternalServerError {
+			c.JSON(code, gin.H{"error": "更新题目状态失败"})
+			return
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	recordAuditDetail(c, services.AuditQuestionReview, services.ResourceQuestion, question.ID, gin.H{
+		"action":  review.Action,
+		"from":    review.FromStatus,
+		"to":      review.ToStatus,
+		"comment": review.Comment,
+	})
+	services.NewCacheService().InvalidateQuestionCache(tenantID, question.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"question_id": question.ID,
+		"status":      question.Status,
+		"reviewer_id": question.ReviewerID,
+		"review":      review,
+	})
+}
+
+// 获取题目的审核记录（含审核意见），从新到旧
+func GetQuestionReviews(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的题目ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var question models.Question
+	if err := utils.WithTenant(database.DB, tenantID).First(&question, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题目不存在"})
+		return
+	}
+	actor := currentActor(c)
+	if !accessService.CanView(actor, services.ResourceQuestion, question.ID, question.CreatedBy, question.Visibility) &&
+		!reviewService.CanReview(actor, question.SubjectID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此题目"})
+		return
+	}
+
+	reviews, err := reviewService.GetQuestionReviews(tenantID, question.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"question_id": question.ID,
+		"status":      question.Status,
+		"reviewer_id": question.ReviewerID,
+		"reviews":     reviews,
+	})
+}
+
+// 获取科目的审核人
+func GetSubjectReviewers(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的科目ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var subject models.Subject
+	if err := utils.WithTenant(database.DB, tenantID).First(&subject, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "科目不存在"})
+		return
+	}
+	reviewers, err := reviewService.GetSubjectReviewers(tenantID, subject.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核人失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subject_id": subject.ID, "reviewers": reviewers})
+}
+
+// 设置科目的审核人（整体替换）
+func UpdateSubjectReviewers(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的科目ID"})
+		return
+	}
+	var req SubjectReviewersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var subject models.Subject
+	if err := utils.WithTenant(database.DB, tenantID).First(&subject, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "科目不存在"})
+		return
+	}
+
+	before, _ := reviewService.GetSubjectReviewers(tenantID, subject.ID)
+	if err := reviewService.SetSubjectReviewers(currentActor(c), subject.ID, req.UserIDs); err != nil {
+		if errors.Is(err, services.ErrInvalidReviewer) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置审核人失败"})
+		return
+	}
+	reviewers, _ := reviewService.GetSubjectReviewers(tenantID, subject.ID)
+	recordAudit(c, services.AuditSubjectReviewers, "subject", subject.ID, reviewerUserIDs(before), reviewerUserIDs(reviewers))
+
+	c.JSON(http.StatusOK, gin.H{"subject_id": subject.ID, "reviewers": reviewers})
+}
+
+// reviewerUserIDs 审计记录中的审核人列表
+func reviewerUserIDs(reviewers []models.SubjectReviewer) gin.H {
+	ids := make([]uint, len(reviewers))
+	for i, reviewer := range reviewers {
+		ids[i] = reviewer.UserID
+	}
+	return gin.H{"user_ids": ids}
+}
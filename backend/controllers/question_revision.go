@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 版本历史中的一项：版本内容以及相对上一版本改动的字段
+type questionRevisionItem struct {
+	models.QuestionRevision
+	ChangedFields []string `json:"changed_fields"`
+}
+
+// 读取路径中的题目并检查查看权限，失败时已写入响应
+func loadRevisionQuestion(c *gin.Context) (*models.Question, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的题目ID"})
+		return nil, false
+	}
+	var question models.Question
+	if err := utils.WithTenant(database.DB, middleware.GetTenantID(c)).First(&question, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题目不存在"})
+		return nil, false
+	}
+	if !accessService.CanView(currentActor(c), services.ResourceQuestion, question.ID, question.CreatedBy, question.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此题目"})
+		return nil, false
+	}
+	// 早于版本功能创建的题目补建第一个版本
+	if err := services.EnsureQuestionRevisions(database.DB, question.TenantID, []uint{question.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目版本失败"})
+		return nil, false
+	}
+	if question.Version == 0 {
+		question.Version = 1
+	}
+	return &question, true
+}
+
+// 获取题目的版本历史，按版本号从新到旧，每个版本列出相对上一版本改动的字段
+func GetQuestionRevisions(c *gin.Context) {
+	question, ok := loadRevisionQuestion(c)
+	if !ok {
+		return
+	}
+	revisions, err := services.GetQuestionRevisions(database.DB, question.TenantID, question.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取题目版本失败"})
+		return
+	}
+
+	items := make([]questionRevisionItem, len(revisions))
+	for i, revision := range revisions {
+		items[i] = questionRevisionItem{QuestionRevision: revision, ChangedFields: []string{}}
+		if i+1 >= len(revisions) {
+			continue
+		}
+		diff := services.DiffQuestionRevisions(revisions[i+1], revision)
+		for _, change := range diff.Fields {
+			items[i].ChangedFields = append(items[i].ChangedFields, change.Field)
+		}
+		if len(diff.Options) > 0 {
+			items[i].ChangedFields = append(items[i].ChangedFields, "options")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"question_id": question.ID,
+		"version":     question.Version,
+		"revisions":   items,
+		"total":       len(items),
+	})
+}
+
+// 获取题目指定版本的内容
+func GetQuestionRevision(c *gin.Context) {
+	question, ok := loadRevisionQuestion(c)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号"})
+		return
+	}
+	revision, err := services.GetQuestionRevision(database.DB, question.TenantID, question.ID, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// 比较题目的两个版本，默认比较最新版本和它的上一版本
+func DiffQuestionRevisions(c *gin.Context) {
+	question, ok := loadRevisionQuestion(c)
+	if !ok {
+		return
+	}
+
+	to := question.Version
+	if v := c.Query("to"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号"})
+			return
+		}
+		to = parsed
+	}
+	from := to - 1
+	if v := c.Query("from"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号"})
+			return
+		}
+		from = parsed
+	}
+	if from <= 0 || from == to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要两个不同的版本进行比较"})
+		return
+	}
+
+	fromRevision, err := services.GetQuestionRevision(database.DB, question.TenantID, question.ID, from)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return
+	}
+	toRevision, err := services.GetQuestionRevision(database.DB, question.TenantID, question.ID, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, services.DiffQuestionRevisions(*fromRevision, *toRevision))
+}
@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionPolicyRequest struct {
+	Target     string                 `json:"target" binding:"required"`
+	Action     models.RetentionAction `json:"action" binding:"required"`
+	RetainDays int                    `json:"retain_days" binding:"required,min=1"`
+	IsActive   *bool                  `json:"is_active"`
+}
+
+type TenantDeletionRequest struct {
+	Confirm   string `json:"confirm" binding:"required"` // 必须填写当前租户ID以确认删除
+	BatchSize int    `json:"batch_size"`
+}
+
+// 获取数据保留策略列表
+func GetRetentionPolicies(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	var policies []models.RetentionPolicy
+	if err := utils.WithTenant(database.DB, tenantID).Order("id ASC").Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取数据保留策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies": policies,
+		"targets":  services.RetentionTargetNames(),
+	})
+}
+
+// 创建数据保留策略
+func CreateRetentionPolicy(c *gin.Context) {
+	var req RetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	if !services.IsValidRetentionRule(req.Target, req.Action) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该数据不支持此保留动作"})
+		return
+	}
+
+	// 同一数据同一动作只允许一条策略
+	var existing models.RetentionPolicy
+	if err := utils.WithTenant(database.DB, tenantID).Where("target = ? AND action = ?", req.Target, req.Action).First(&existing).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该数据已存在相同动作的保留策略"})
+		return
+	}
+
+	policy := models.RetentionPolicy{
+		TenantID:   tenantID,
+		Target:     req.Target,
+		Action:     req.Action,
+		RetainDays: req.RetainDays,
+		IsActive:   req.IsActive == nil || *req.IsActive,
+	}
+
+	if err := database.DB.Create(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建数据保留策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, policy)
+}
+
+// 更新数据保留策略
+func UpdateRetentionPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的策略ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var req RetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !services.IsValidRetentionRule(req.Target, req.Action) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该数据不支持此保留动作"})
+		return
+	}
+
+	var policy models.RetentionPolicy
+	if err := utils.WithTenant(database.DB, tenantID).First(&policy, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "数据保留策略不存在"})
+		return
+	}
+
+	policy.Target = req.Target
+	policy.Action = req.Action
+	policy.RetainDays = req.RetainDays
+	if req.IsActive != nil {
+		policy.IsActive = *req.IsActive
+	}
+
+	if err := database.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新数据保留策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// 删除数据保留策略
+func DeleteRetentionPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的策略ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	result := utils.WithTenant(database.DB, tenantID).Delete(&models.RetentionPolicy{}, uint(id))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除数据保留策略失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "数据保留策略不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "数据保留策略删除成功"})
+}
+
+// 立即执行当前租户的数据保留策略
+func RunRetentionPolicies(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	results := services.NewRetentionService().RunTenantPolicies(tenantID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "数据保留策略执行完成",
+		"results": results,
+	})
+}
+
+// 创建租户删除任务（删除当前租户的全部数据）
+func CreateTenantDeletionJob(c *gin.Context) {
+	var req TenantDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	if req.Confirm != fmt.Sprint(tenantID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "确认信息不匹配，请填写当前租户ID"})
+		return
+	}
+
+	username, _ := c.Get("username")
+	retentionService := services.NewRetentionService()
+	job, err := retentionService.CreateDeletionJob(tenantID, fmt.Sprint(username), req.BatchSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 删除可能耗时较长，异步执行；任务记录不属于租户，删除完成后仍可查询
+	go func() {
+		if err := retentionService.RunDeletionJob(job); err != nil {
+			log.Printf("租户删除任务 %d 失败: %v", job.ID, err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "租户删除任务已创建",
+		"job":     job,
+	})
+}
+
+// 获取租户删除任务及报告
+func GetTenantDeletionJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var job models.TenantDeletionJob
+	if err := database.DB.Where("target_tenant_id = ?", tenantID).First(&job, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "删除任务不存在"})
+		return
+	}
+
+	response := gin.H{"job": job}
+	if job.Status == models.DeletionCompleted || job.Report != "" {
+		verified, tables, err := services.NewRetentionService().VerifyDeletionJob(&job)
+		response["verified"] = verified
+		response["remaining"] = tables
+		if err != nil {
+			response["verify_error"] = err.Error()
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 权限服务
+var permissionService = services.NewPermissionService()
+
+type RoleRequest struct {
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description"`
+	BaseRole    models.UserRole `json:"base_role" binding:"required"`
+	Permissions []string        `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	RoleID *uint           `json:"role_id"` // 自定义角色ID
+	Role   models.UserRole `json:"role"`    // 不指定自定义角色时使用的内置角色
+}
+
+// RoleResponse 自定义角色及其权限列表
+type RoleResponse struct {
+	models.TenantRole
+	Permissions []string `json:"permissions"`
+	UserCount   int64    `json:"user_count"`
+}
+
+func newRoleResponse(role models.TenantRole) RoleResponse {
+	var count int64
+	database.DB.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&count)
+	return RoleResponse{
+		TenantRole:  role,
+		Permissions: services.ParseRolePermissions(&role),
+		UserCount:   count,
+	}
+}
+
+// 获取全部可分配的权限
+func GetPermissionCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": services.PermissionCatalog})
+}
+
+// 获取内置角色和当前租户的自定义角色
+func GetRoles(c *gin.Context) {
+	var roles []models.TenantRole
+	utils.WithTenant(database.DB, middleware.GetTenantID(c)).Order("id ASC").Find(&roles)
+
+	result := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, newRoleResponse(role))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"presets": services.RolePresets(),
+		"roles":   result,
+	})
+}
+
+// 获取当前用户的权限列表（前端据此显示菜单和按钮）
+func GetMyPermissions(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+	c.JSON(http.StatusOK, gin.H{
+		"role":        middleware.GetCurrentUserRole(c),
+		"role_id":     middleware.GetCurrentRoleID(c),
+		"permissions": permissionService.Permissions(tenantID, middleware.GetCurrentUserRole(c), middleware.GetCurrentRoleID(c)),
+	})
+}
+
+// bindRoleRequest 解析并校验角色请求，返回JSON格式的权限列表
+func bindRoleRequest(c *gin.Context, req *RoleRequest) (string, bool) {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || services.IsBuiltinRole(models.UserRole(req.Name)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色名称不能为空，也不能与内置角色同名"})
+		return "", false
+	}
+	if !services.IsBuiltinRole(req.BaseRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidBaseRole.Error()})
+		return "", false
+	}
+	permissions, err := services.NormalizePermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	// 只能设置自己已拥有的权限，否则可以借自定义角色给自己提权
+	if !permissionService.CanGrantPermissions(currentActor(c), req.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrPermissionGrant.Error()})
+		return "", false
+	}
+	return permissions, true
+}
+
+// 创建自定义角色
+func CreateRole(c *gin.Context) {
+	var req RoleRequest
+	permissions, ok := bindRoleRequest(c, &req)
+	if !ok {
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var count int64
+	utils.WithTenant(database.DB, tenantID).Model(&models.TenantRole{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "同名角色已存在"})
+		return
+	}
+
+	role := models.TenantRole{
+		TenantID:    tenantID,
+		Name:        req.Name,
+		Description: req.Description,
+		BaseRole:    req.BaseRole,
+		Permissions: permissions,
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建角色失败"})
+		return
+	}
+	recordAudit(c, services.AuditRoleCreate, "role", role.ID, nil, role)
+
+	c.JSON(http.StatusCreated, newRoleResponse(role))
+}
+
+// 更新自定义角色（权限变化立即生效，基础角色变化时该角色下的用户需重新登录）
+func UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return
+	}
+	var req RoleRequest
+	permissions, ok := bindRoleRequest(c, &req)
+	if !ok {
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var role models.TenantRole
+	if err := utils.WithTenant(database.DB, tenantID).First(&role, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return
+	}
+	if !permissionService.CanGrantPermissions(currentActor(c), services.ParseRolePermissions(&role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能修改权限超出自己的角色"})
+		return
+	}
+
+	var count int64
+	utils.WithTenant(database.DB, tenantID).Model(&models.TenantRole{}).Where("name = ? AND id <> ?", req.Name, role.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "同名角色已存在"})
+		return
+	}
+
+	before := role
+	baseRoleChanged := role.BaseRole != req.BaseRole
+	role.Name = req.Name
+	role.Description = req.Description
+	role.BaseRole = req.BaseRole
+	role.Permissions = permissions
+	if err := database.DB.Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新角色失败"})
+		return
+	}
+	recordAudit(c, services.AuditRoleUpdate, "role", role.ID, before, role)
+	permissionService.InvalidateRole(tenantID, role.ID)
+
+	if baseRoleChanged {
+		var users []models.User
+		utils.WithTenant(database.DB, tenantID).Where("role_id = ?", role.ID).Find(&users)
+		for i := range users {
+			database.DB.Model(&users[i]).Update("role", role.BaseRole)
+			sessionService.EndUserSessions(tenantID, &users[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, newRoleResponse(role))
+}
+
+// 删除自定义角色（仍有用户使用时不能删除）
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var role models.TenantRole
+	if err := utils.WithTenant(database.DB, tenantID).First(&role, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrRoleInUse.Error(), "user_count": count})
+		return
+	}
+
+	if err := database.DB.Delete(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除角色失败"})
+		return
+	}
+	recordAudit(c, services.AuditRoleDelete, "role", role.ID, role, nil)
+	permissionService.InvalidateRole(tenantID, role.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色已删除"})
+}
+
+// 为用户分配自定义角色，或恢复为内置角色
+func AssignUserRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	role := req.Role
+	if req.RoleID != nil {
+		var tenantRole models.TenantRole
+		if err := utils.WithTenant(database.DB, tenantID).First(&tenantRole, *req.RoleID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在"})
+			return
+		}
+		role = tenantRole.BaseRole
+	} else if !services.IsBuiltinRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定role_id或内置角色role"})
+		return
+	}
+
+	// 只能分配自己已拥有全部权限的角色，也不能修改权限超出自己的用户的角色
+	actor := currentActor(c)
+	if !permissionService.CanGrantRole(actor, role, req.RoleID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrRoleGrantDenied.Error()})
+		return
+	}
+	if !permissionService.CanGrantRole(actor, user.Role, user.RoleID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能修改权限超出自己的用户的角色"})
+		return
+	}
+
+	// 不能移除自己的角色管理权限，避免租户内无人可以管理角色
+	if user.ID == middleware.GetCurrentUserID(c) &&
+		!permissionService.HasPermission(tenantID, role, req.RoleID, services.PermRoleManage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能移除自己的角色管理权限"})
+		return
+	}
+
+	before := user
+	roleChanged := user.Role != role
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"role":    role,
+		"role_id": req.RoleID,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配角色失败"})
+		return
+	}
+	user.Role = role
+	user.RoleID = req.RoleID
+	recordAudit(c, services.AuditUserRoleAssign, "user", user.ID, before, user)
+
+	// 基础角色变化时令牌中的角色已过期，需重新登录；否则刷新用户缓存使新权限立即生效
+	if roleChanged {
+		sessionService.EndUserSessions(tenantID, &user)
+	} else {
+		cacheService.InvalidateUserCache(tenantID, user.ID, user.Username)
+	}
+
+	user.Password = ""
+	c.JSON(http.StatusOK, user)
+}
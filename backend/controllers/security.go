@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SecurityPolicyRequest struct {
+	MaxLoginFailures     int `json:"max_login_failures" binding:"required,min=1"`
+	MaxIPLoginFailures   int `json:"max_ip_login_failures" binding:"required,min=1"`
+	LockoutMinutes       int `json:"lockout_minutes" binding:"required,min=1"`
+	FailureWindowMinutes int `json:"failure_window_minutes" binding:"required,min=1"`
+	BackoffBaseSeconds   int `json:"backoff_base_seconds" binding:"min=0"`
+
+	// 密码策略，未提供的字段保持不变
+	PasswordMinLength    *int  `json:"password_min_length" binding:"omitempty,min=4,max=128"`
+	PasswordMinClasses   *int  `json:"password_min_classes" binding:"omitempty,min=1,max=4"`
+	PasswordBanCommon    *bool `json:"password_ban_common"`
+	PasswordMaxAgeDays   *int  `json:"password_max_age_days" binding:"omitempty,min=0"`
+	PasswordHistoryCount *int  `json:"password_history_count" binding:"omitempty,min=0,max=24"`
+
+	RequireTwoFactorForStaff *bool `json:"require_two_factor_for_staff"`
+}
+
+type LoginAttemptListResponse struct {
+	Attempts []models.LoginAttempt `json:"attempts"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	Size     int                   `json:"size"`
+}
+
+// 获取当前租户的安全策略
+func GetSecurityPolicy(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+	c.JSON(http.StatusOK, services.GetSecurityPolicy(tenantID))
+}
+
+// 更新当前租户的安全策略（不存在时创建）
+func UpdateSecurityPolicy(c *gin.Context) {
+	var req SecurityPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	policy := services.GetSecurityPolicy(tenantID)
+	policy.MaxLoginFailures = req.MaxLoginFailures
+	policy.MaxIPLoginFailures = req.MaxIPLoginFailures
+	policy.LockoutMinutes = req.LockoutMinutes
+	policy.FailureWindowMinutes = req.FailureWindowMinutes
+	policy.BackoffBaseSeconds = req.BackoffBaseSeconds
+	if req.PasswordMinLength != nil {
+		policy.PasswordMinLength = *req.PasswordMinLength
+	}
+	if req.PasswordMinClasses != nil {
+		policy.PasswordMinClasses = *req.PasswordMinClasses
+	}
+	if req.PasswordBanCommon != nil {
+		policy.PasswordBanCommon = *req.PasswordBanCommon
+	}
+	if req.PasswordMaxAgeDays != nil {
+		policy.PasswordMaxAgeDays = *req.PasswordMaxAgeDays
+	}
+	if req.PasswordHistoryCount != nil {
+		policy.PasswordHistoryCount = *req.PasswordHistoryCount
+	}
+	if req.RequireTwoFactorForStaff != nil {
+		policy.RequireTwoFactorForStaff = *req.RequireTwoFactorForStaff
+	}
+
+	if err := saveWithZeroValues(&policy, policy.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新安全策略失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// 获取当前被限制登录的用户名和IP
+func GetLoginLockouts(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": loginGuard.ListLockouts(tenantID),
+	})
+}
+
+// 清除登录锁定：指定kind和key时清除单个对象，否则清除全部
+func ClearLoginLockout(c *gin.Context) {
+	kind := c.Query("kind")
+	key := c.Query("key")
+	tenantID := middleware.GetTenantID(c)
+
+	if kind != "" && kind != services.LockoutKindUser && kind != services.LockoutKindIP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind只能为user或ip"})
+		return
+	}
+	if kind != "" && key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定要解除锁定的用户名或IP"})
+		return
+	}
+
+	cleared := loginGuard.ClearLockout(tenantID, kind, key)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "登录锁定已解除",
+		"cleared": cleared,
+	})
+}
+
+// 获取登录尝试记录
+func GetLoginAttempts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	username := c.Query("username")
+	ip := c.Query("ip")
+	success := c.Query("success")
+	tenantID := middleware.GetTenantID(c)
+
+	offset := (page - 1) * size
+
+	query := utils.WithTenant(database.DB, tenantID).Model(&models.LoginAttempt{})
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if success != "" {
+		query = query.Where("success = ?", success == "true")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var attempts []models.LoginAttempt
+	if err := query.Offset(offset).Limit(size).Order("created_at DESC").Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginAttemptListResponse{
+		Attempts: attempts,
+		Total:    total,
+		Page:     page,
+		Size:     size,
+	})
+}
+
+// saveWithZeroValues 保存租户配置记录。新建时gorm会用字段默认值替换false等零值，
+// 因此先创建记录，再整体保存一次写入所有字段
+func saveWithZeroValues(record interface{}, id uint) error {
+	if id == 0 {
+		if err := database.DB.Create(record).Error; err != nil {
+			return err
+		}
+	}
+	return database.DB.Save(record).Error
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 资源访问控制服务
+var accessService = services.NewAccessService()
+
+type SharingRequest struct {
+	Visibility models.Visibility     `json:"visibility" binding:"required"`
+	Shares     []services.ShareEntry `json:"shares"`
+}
+
+// sharedResource 共享设置涉及的资源字段
+type sharedResource struct {
+	ID         uint
+	CreatedBy  uint
+	Visibility models.Visibility
+}
+
+// currentActor 当前请求的操作者，院系信息从用户缓存读取
+func currentActor(c *gin.Context) services.Actor {
+	tenantID := middleware.GetTenantID(c)
+	actor := services.Actor{
+		TenantID: tenantID,
+		UserID:   middleware.GetCurrentUserID(c),
+		Role:     middleware.GetCurrentUserRole(c),
+		RoleID:   middleware.GetCurrentRoleID(c),
+	}
+	if user, err := cacheService.GetUserWithCache(tenantID, actor.UserID); err == nil {
+		actor.Department = user.Department
+	}
+	return actor
+}
+
+// loadSharedResource 读取资源的创建者和可见范围
+func loadSharedResource(c *gin.Context, resourceType string) (*sharedResource, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的资源ID"})
+		return nil, false
+	}
+
+	var resource sharedResource
+	err = database.DB.Table(services.ResourceTable(resourceType)).
+		Select("id, created_by, visibility").
+		Where("id = ? AND tenant_id = ?", uint(id), middleware.GetTenantID(c)).
+		Take(&resource).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "资源不存在"})
+		return nil, false
+	}
+	return &resource, true
+}
+
+// getSharing 查看资源的可见范围和共享列表
+func getSharing(c *gin.Context, resourceType string) {
+	resource, ok := loadSharedResource(c, resourceType)
+	if !ok {
+		return
+	}
+	actor := currentActor(c)
+	if !accessService.CanView(actor, resourceType, resource.ID, resource.CreatedBy, resource.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此资源"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"visibility": resource.Visibility,
+		"owner_id":   resource.CreatedBy,
+		"shares":     accessService.GetShares(actor.TenantID, resourceType, resource.ID),
+		"can_manage": accessService.CanManage(actor, resource.CreatedBy),
+	})
+}
+
+// updateSharing 修改资源的可见范围和共享列表，只有创建者和内容管理者可以操作
+func updateSharing(c *gin.Context, resourceType string) {
+	resource, ok := loadSharedResource(c, resourceType)
+	if !ok {
+		return
+	}
+	var req SharingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := currentActor(c)
+	if !accessService.CanManage(actor, resource.CreatedBy) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有创建者可以修改共享设置"})
+		return
+	}
+	before := sharingSnapshot(resource.Visibility, accessService.GetShares(actor.TenantID, resourceType, resource.ID))
+
+	err := accessService.SetSharing(actor, resourceType, resource.ID, resource.CreatedBy, req.Visibility, req.Shares)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVisibility) || errors.Is(err, services.ErrInvalidShareUser) ||
+			errors.Is(err, services.ErrPrivateWithShares) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新共享设置失败"})
+		return
+	}
+	invalidateSharedResourceCache(actor.TenantID, resourceType, resource.ID)
+
+	shares := accessService.GetShares(actor.TenantID, resourceType, resource.ID)
+	recordAudit(c, resourceType+".share", resourceType, resource.ID, before, sharingSnapshot(req.Visibility, shares))
+
+	c.JSON(http.StatusOK, gin.H{
+		"visibility": req.Visibility,
+		"owner_id":   resource.CreatedBy,
+		"shares":     shares,
+		"can_manage": true,
+	})
+}
+
+// sharingSnapshot 共享设置的审计快照，共享列表记为“用户ID:edit/view”
+func sharingSnapshot(visibility models.Visibility, shares []models.ResourceShare) gin.H {
+	entries := make([]string, 0, len(shares))
+	for _, share := range shares {
+		mode := "view"
+		if share.CanEdit {
+			mode = "edit"
+		}
+		entries = append(entries, fmt.Sprintf("%d:%s", share.UserID, mode))
+	}
+	return gin.H{"visibility": visibility, "shares": entries}
+}
+
+// invalidateSharedResourceCache 可见范围变化后清除资源缓存
+func invalidateSharedResourceCache(tenantID uint, resourceType string, id uint) {
+	switch resourceType {
+	case services.ResourceQuestion:
+		cacheService.InvalidateQuestionCache(tenantID, id)
+	case services.ResourcePaper:
+		cacheService.InvalidatePaperCache(tenantID, id)
+	case services.ResourceExam:
+		cacheService.InvalidateExamCache(tenantID, id)
+		cacheService.InvalidateExamListCache(tenantID)
+	}
+}
+
+// 获取题目共享设置
+func GetQuestionSharing(c *gin.Context) { getSharing(c, services.ResourceQuestion) }
+
+// 更新题目共享设置
+func UpdateQuestionSharing(c *gin.Context) { updateSharing(c, services.ResourceQuestion) }
+
+// 获取试卷共享设置
+func GetPaperSharing(c *gin.Context) { getSharing(c, services.ResourcePaper) }
+
+// 更新试卷共享设置
+func UpdatePaperSharing(c *gin.Context) { updateSharing(c, services.ResourcePaper) }
+
+// 获取考试共享设置
+func GetExamSharing(c *gin.Context) { getSharing(c, services.ResourceExam) }
+
+// 更新考试共享设置
+func UpdateExamSharing(c *gin.Context) { updateSharing(c, services.ResourceExam) }
@@ -7,6 +7,7 @@ import (
 	"online-exam-system/database"
 	"online-exam-system/middleware"
 	"online-exam-system/models"
+	"online-exam-system/services"
 	"online-exam-system/utils"
 	"strconv"
 	"time"
@@ -43,6 +44,11 @@ type QuestionStats struct {
 	MultipleChoice    int64 `json:"multiple_choice"`
 	TrueFalse         int64 `json:"true_false"`
 	ShortAnswer       int64 `json:"short_answer"`
+	FillBlank         int64 `json:"fill_blank"`
+	Matching          int64 `json:"matching"`
+	Ordering          int64 `json:"ordering"`
+	Numeric           int64 `json:"numeric"`
+	Material          int64 `json:"material"`
 }
 
 type RecentActivity struct {
@@ -124,8 +130,7 @@ type ScoreRange struct {
 
 // 获取仪表板统计数据（管理员）
 func GetDashboardStats(c *gin.Context) {
-	currentRole := middleware.GetCurrentUserRole(c)
-	if currentRole != models.RoleAdmin {
+	if !middleware.HasPermission(c, services.PermDashboardRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
 		return
 	}
@@ -153,6 +158,11 @@ func GetDashboardStats(c *gin.Context) {
 	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.MultipleChoice).Count(&stats.QuestionStats.MultipleChoice)
 	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.TrueFalse).Count(&stats.QuestionStats.TrueFalse)
 	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.ShortAnswer).Count(&stats.QuestionStats.ShortAnswer)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.FillBlank).Count(&stats.QuestionStats.FillBlank)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Matching).Count(&stats.QuestionStats.Matching)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Ordering).Count(&stats.QuestionStats.Ordering)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Numeric).Count(&stats.QuestionStats.Numeric)
+	utils.WithTenant(database.DB, tenantID).Model(&models.Question{}).Where("type = ?", models.Material).Count(&stats.QuestionStats.Material)
 
 	// 最近活动
 	stats.RecentActivity = getRecentActivity(tenantID)
@@ -163,12 +173,6 @@ func GetDashboardStats(c *gin.Context) {
 // 获取学生统计数据
 func GetStudentStats(c *gin.Context) {
 	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-
-	if currentRole != models.RoleStudent {
-		c.JSON(http.StatusForbidden, gin.H{"error": "只有学生可以查看此统计"})
-		return
-	}
 	tenantID := middleware.GetTenantID(c)
 
 	stats := StudentStats{}
@@ -211,12 +215,6 @@ func GetStudentStats(c *gin.Context) {
 // 获取教师统计数据
 func GetTeacherStats(c *gin.Context) {
 	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
-
-	if currentRole != models.RoleTeacher {
-		c.JSON(http.StatusForbidden, gin.H{"error": "只有教师可以查看此统计"})
-		return
-	}
 	tenantID := middleware.GetTenantID(c)
 
 	stats := TeacherStats{}
@@ -246,8 +244,6 @@ func GetExamAnalysis(c *gin.Context) {
 		return
 	}
 	tenantID := middleware.GetTenantID(c)
-	currentUserID := middleware.GetCurrentUserID(c)
-	currentRole := middleware.GetCurrentUserRole(c)
 
 	// 获取考试信息
 	var exam models.Exam
@@ -257,7 +253,7 @@ func GetExamAnalysis(c *gin.Context) {
 	}
 
 	// 权限检查
-	if currentRole == models.RoleTeacher && exam.CreatedBy != currentUserID {
+	if !accessService.CanView(currentActor(c), services.ResourceExam, exam.ID, exam.CreatedBy, exam.Visibility) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看此考试分析"})
 		return
 	}
@@ -195,6 +195,7 @@ func DeleteSubject(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除科目失败"})
 		return
 	}
+	utils.WithTenant(database.DB, tenantID).Where("subject_id = ?", subject.ID).Delete(&models.SubjectReviewer{})
 
 	c.JSON(http.StatusOK, gin.H{"message": "科目删除成功"})
 }
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"online-exam-system/middleware"
+	"online-exam-system/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 租户归档上传大小上限
+const maxTenantArchiveSize = 512 << 20
+
+// 导出当前租户数据
+func ExportTenant(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	filename := fmt.Sprintf("tenant-%d-%s.zip", tenantID, time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	transferService := services.NewTenantTransferService()
+	if _, err := transferService.Export(tenantID, c.Writer); err != nil {
+		// 响应头可能已经发出，这里只能记录日志并中断连接
+		log.Printf("导出租户 %d 数据失败: %v", tenantID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+}
+
+// 导入租户归档到当前租户
+func ImportTenant(c *gin.Context) {
+	tenantID := middleware.GetTenantID(c)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传租户归档文件"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxTenantArchiveSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "归档文件过大"})
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取归档文件失败"})
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "归档文件格式错误"})
+		return
+	}
+
+	opts := services.TenantImportOptions{
+		OnConflict:   c.DefaultPostForm("on_conflict", services.ConflictFail),
+		RenameSuffix: c.PostForm("rename_suffix"),
+	}
+	switch opts.OnConflict {
+	case services.ConflictFail, services.ConflictRename, services.ConflictMerge:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的冲突处理策略"})
+		return
+	}
+
+	transferService := services.NewTenantTransferService()
+	report, err := transferService.Import(zr, tenantID, opts)
+	if err != nil {
+		var conflictErr *services.UsernameConflictError
+		if errors.As(err, &conflictErr) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "部分用户与现有账号冲突",
+				"conflicts": conflictErr.Conflicts,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "租户数据导入成功",
+		"report":  report,
+	})
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"online-exam-system/database"
+	"online-exam-system/middleware"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"online-exam-system/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // 验证码或恢复码
+}
+
+// loadCurrentUser 读取当前登录用户（包含密码哈希）
+func loadCurrentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := utils.WithTenant(database.DB, middleware.GetTenantID(c)).First(&user, middleware.GetCurrentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// respondTwoFactorError 将两步验证错误转换为响应
+func respondTwoFactorError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorCodeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled), errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// 获取两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, twoFactorService.Status(user))
+}
+
+// 开始绑定两步验证：生成密钥和二维码内容
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	setup, err := twoFactorService.Setup(user)
+	if err != nil {
+		respondTwoFactorError(c, err, "生成两步验证密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// 输入身份验证器中的验证码完成绑定，返回恢复码
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := twoFactorService.Enable(user, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err, "开启两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "两步验证已开启，请妥善保存恢复码",
+		"recovery_codes": codes,
+	})
+}
+
+// 关闭两步验证（需要密码和验证码）
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	policy := services.GetSecurityPolicy(user.TenantID)
+	if policy.RequireTwoFactorForStaff && (user.Role == models.RoleAdmin || user.Role == models.RoleTeacher) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "租户要求管理员和教师必须开启两步验证"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+	if err := twoFactorService.Verify(user, req.Code); err != nil {
+		respondTwoFactorError(c, err, "关闭两步验证失败")
+		return
+	}
+
+	if err := twoFactorService.Disable(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭两步验证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// 重新生成恢复码（需要验证码）
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := twoFactorService.Verify(user, req.Code); err != nil {
+		respondTwoFactorError(c, err, "生成恢复码失败")
+		return
+	}
+	codes, err := twoFactorService.RegenerateRecoveryCodes(user)
+	if err != nil {
+		respondTwoFactorError(c, err, "生成恢复码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// 管理员重置用户的两步验证（用户丢失设备和恢复码时使用）
+func ResetUserTwoFactor(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	tenantID := middleware.GetTenantID(c)
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, uint(id)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !requireManageUser(c, &user) {
+		return
+	}
+
+	if err := twoFactorService.Disable(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置两步验证失败"})
+		return
+	}
+	recordAuditDetail(c, services.AuditUserTwoFactorOff, "user", user.ID, gin.H{"username": user.Username})
+
+	// 重置后撤销该用户已有会话，下次登录需重新绑定
+	sessionService.EndUserSessions(tenantID, &user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已重置"})
+}
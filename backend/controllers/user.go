@@ -1,17 +1,27 @@
 package controllers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/mail"
 	"online-exam-system/database"
 	"online-exam-system/middleware"
 	"online-exam-system/models"
+	"online-exam-system/services"
 	"online-exam-system/utils"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// 单次最多导入的用户数
+const maxUserImportCount = 2000
+
 type UserListResponse struct {
 	Users []models.User `json:"users"`
 	Total int64         `json:"total"`
@@ -35,6 +45,14 @@ func GetUsers(c *gin.Context) {
 	if role != "" {
 		query = query.Where("role = ?", role)
 	}
+	if roleID := c.Query("role_id"); roleID != "" {
+		query = query.Where("role_id = ?", roleID)
+	}
+
+	// 院系筛选
+	if department := c.Query("department"); department != "" {
+		query = query.Where("department = ?", department)
+	}
 
 	// 搜索筛选
 	if search != "" {
@@ -95,6 +113,19 @@ func CreateUser(c *gin.Context) {
 	}
 	tenantID := middleware.GetTenantID(c)
 
+	// 新用户默认为学生；指定其他角色相当于分配角色，需满足角色分配的权限要求
+	if req.Role == "" {
+		req.Role = models.RoleStudent
+	}
+	if !services.IsBuiltinRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色"})
+		return
+	}
+	if req.Role != models.RoleStudent && !permissionService.CanGrantRole(currentActor(c), req.Role, nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrRoleGrantDenied.Error()})
+		return
+	}
+
 	// 检查用户名是否已存在
 	var existingUser models.User
 	if err := utils.WithTenant(database.DB, tenantID).Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
@@ -108,6 +139,12 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	// 校验密码策略
+	if err := services.ValidatePassword(services.GetSecurityPolicy(tenantID), req.Password, req.Username); err != nil {
+		respondPasswordPolicyError(c, err)
+		return
+	}
+
 	// 加密密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -116,20 +153,24 @@ func CreateUser(c *gin.Context) {
 	}
 
 	// 创建用户
+	now := time.Now()
 	user := models.User{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Name:     req.Name,
-		Role:     req.Role,
-		IsActive: true,
+		TenantID:          tenantID,
+		Username:          req.Username,
+		Email:             req.Email,
+		Password:          string(hashedPassword),
+		PasswordChangedAt: &now,
+		Name:              req.Name,
+		Role:              req.Role,
+		Department:        strings.TrimSpace(req.Department),
+		IsActive:          true,
 	}
-	utils.SetTenantID(&user, tenantID)
 
 	if err := database.DB.Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
 		return
 	}
+	recordAudit(c, services.AuditUserCreate, "user", user.ID, nil, user)
 
 	// 清除密码字段
 	user.Password = ""
@@ -147,11 +188,12 @@ func UpdateUser(c *gin.Context) {
 	tenantID := middleware.GetTenantID(c)
 
 	var req struct {
-		Username string          `json:"username"`
-		Email    string          `json:"email"`
-		Name     string          `json:"name"`
-		Role     models.UserRole `json:"role"`
-		IsActive bool            `json:"is_active"`
+		Username   string          `json:"username"`
+		Email      string          `json:"email"`
+		Name       string          `json:"name"`
+		Role       models.UserRole `json:"role"` // 不能在此修改，需通过分配角色接口
+		Department string          `json:"department"`
+		IsActive   bool            `json:"is_active"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -164,6 +206,15 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
+	if !requireManageUser(c, &user) {
+		return
+	}
+
+	// 角色只能通过分配角色接口修改，该接口会检查角色管理权限
+	if req.Role != "" && req.Role != user.Role {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请通过分配角色接口修改用户角色"})
+		return
+	}
 
 	// 检查用户名是否已被其他用户使用
 	if req.Username != user.Username {
@@ -183,17 +234,34 @@ func UpdateUser(c *gin.Context) {
 		}
 	}
 
+	// 用户名变更或停用账号时，已签发的token需要立即失效
+	before := user
+	oldUsername := user.Username
+	endSessions := req.Username != user.Username || (user.IsActive && !req.IsActive)
+
+	// 管理员修改邮箱后需要用户重新验证
+	if req.Email != user.Email {
+		user.EmailVerified = false
+		user.PendingEmail = ""
+	}
+
 	// 更新用户信息
 	user.Username = req.Username
 	user.Email = req.Email
 	user.Name = req.Name
-	user.Role = req.Role
+	user.Department = strings.TrimSpace(req.Department)
 	user.IsActive = req.IsActive
 
 	if err := database.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户失败"})
 		return
 	}
+	recordAudit(c, services.AuditUserUpdate, "user", user.ID, before, user)
+
+	cacheService.InvalidateUserCache(tenantID, user.ID, oldUsername)
+	if endSessions {
+		sessionService.EndUserSessions(tenantID, &user)
+	}
 
 	// 清除密码字段
 	user.Password = ""
@@ -201,6 +269,15 @@ func UpdateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// requireManageUser 修改、停用、删除用户或重置其凭据前检查操作者的权限是否覆盖目标用户
+func requireManageUser(c *gin.Context, user *models.User) bool {
+	if !permissionService.CanManageUser(currentActor(c), user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrUserManageDenied.Error()})
+		return false
+	}
+	return true
+}
+
 // 删除用户
 func DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -215,6 +292,9 @@ func DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
+	if !requireManageUser(c, &user) {
+		return
+	}
 
 	// 不能删除管理员账号
 	if user.Role == models.RoleAdmin {
@@ -226,6 +306,10 @@ func DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
 		return
 	}
+	recordAudit(c, services.AuditUserDelete, "user", user.ID, user, nil)
+
+	// 删除后清理缓存并撤销会话
+	sessionService.EndUserSessions(tenantID, &user)
 
 	c.JSON(http.StatusOK, gin.H{"message": "用户删除成功"})
 }
@@ -240,7 +324,7 @@ func ResetPassword(c *gin.Context) {
 	tenantID := middleware.GetTenantID(c)
 
 	var req struct {
-		NewPassword string `json:"new_password" binding:"required,min=6"`
+		NewPassword string `json:"new_password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -253,6 +337,19 @@ func ResetPassword(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
+	if !requireManageUser(c, &user) {
+		return
+	}
+
+	if services.IsExternalAccount(&user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目录或单点登录账号的密码由统一身份系统管理"})
+		return
+	}
+
+	if err := services.CheckNewPassword(&user, req.NewPassword); err != nil {
+		respondPasswordPolicyError(c, err)
+		return
+	}
 
 	// 加密新密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
@@ -261,17 +358,21 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// 更新密码
+	// 更新密码，管理员设置的密码要求用户下次登录后修改
 	user.Password = string(hashedPassword)
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := services.RecordPasswordChange(database.DB, &user, true); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码重置失败"})
 		return
 	}
+	recordAuditDetail(c, services.AuditUserPasswordReset, "user", user.ID, gin.H{"username": user.Username})
+
+	// 重置密码后使该用户的所有会话失效
+	sessionService.EndUserSessions(tenantID, &user)
 
 	c.JSON(http.StatusOK, gin.H{"message": "密码重置成功"})
 }
 
-// 批量导入用户
+// 批量导入用户，作为导入任务在后台执行，mode 为 all_or_nothing（默认）或 best_effort
 func BatchImportUsers(c *gin.Context) {
 	var req struct {
 		Users []RegisterRequest `json:"users" binding:"required"`
@@ -281,54 +382,118 @@ func BatchImportUsers(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if len(req.Users) > maxUserImportCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次最多导入%d个用户", maxUserImportCount)})
+		return
+	}
+	job, ok := bindImportJob(c, services.ImportKindUsers)
+	if !ok {
+		return
+	}
 	tenantID := middleware.GetTenantID(c)
-
-	var successCount int
-	var errors []string
-
-	for _, userReq := range req.Users {
-		// 检查用户名是否已存在
-		var existingUser models.User
-		if err := utils.WithTenant(database.DB, tenantID).Where("username = ?", userReq.Username).First(&existingUser).Error; err == nil {
-			errors = append(errors, "用户名 "+userReq.Username+" 已存在")
-			continue
+	policy := services.GetSecurityPolicy(tenantID)
+	actor := currentActor(c)
+
+	tasks := make([]services.ImportRowTask, len(req.Users))
+	seenUsernames := make(map[string]int)
+	seenEmails := make(map[string]int)
+	for i := range req.Users {
+		userReq := req.Users[i]
+		row := i + 1
+		task := services.ImportRowTask{Row: row, Key: userReq.Username}
+		addError := func(field, reason string) {
+			task.Errors = append(task.Errors, services.ImportRowError{Row: row, Field: field, Reason: reason})
 		}
 
-		// 检查邮箱是否已存在
-		if err := utils.WithTenant(database.DB, tenantID).Where("email = ?", userReq.Email).First(&existingUser).Error; err == nil {
-			errors = append(errors, "邮箱 "+userReq.Email+" 已存在")
-			continue
+		// 预校验：必填字段、邮箱格式、角色、密码策略和文件内重复
+		for _, field := range []struct{ name, value string }{
+			{"username", userReq.Username}, {"email", userReq.Email}, {"password", userReq.Password}, {"name", userReq.Name},
+		} {
+			if strings.TrimSpace(field.value) == "" {
+				addError(field.name, "不能为空")
+			}
 		}
-
-		// 加密密码
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userReq.Password), bcrypt.DefaultCost)
-		if err != nil {
-			errors = append(errors, "用户 "+userReq.Username+" 密码加密失败")
-			continue
+		if userReq.Email != "" {
+			if _, err := mail.ParseAddress(userReq.Email); err != nil {
+				addError("email", "邮箱格式不正确")
+			}
 		}
-
-		// 创建用户
-		user := models.User{
-			Username: userReq.Username,
-			Email:    userReq.Email,
-			Password: string(hashedPassword),
-			Name:     userReq.Name,
-			Role:     userReq.Role,
-			IsActive: true,
+		switch userReq.Role {
+		case "", models.RoleStudent:
+		case models.RoleTeacher, models.RoleAdmin:
+			// 导入教师或管理员相当于分配角色，需满足角色分配的权限要求
+			if !permissionService.CanGrantRole(actor, userReq.Role, nil) {
+				addError("role", services.ErrRoleGrantDenied.Error())
+			}
+		default:
+			addError("role", "无效的角色："+string(userReq.Role))
 		}
-		utils.SetTenantID(&user, tenantID)
-
-		if err := database.DB.Create(&user).Error; err != nil {
-			errors = append(errors, "用户 "+userReq.Username+" 创建失败")
-			continue
+		if userReq.Password != "" {
+			if err := services.ValidatePassword(policy, userReq.Password, userReq.Username); err != nil {
+				addError("password", err.Error())
+			}
+		}
+		if previous, ok := seenUsernames[userReq.Username]; ok && userReq.Username != "" {
+			addError("username", fmt.Sprintf("与第%d行的用户名重复", previous))
+		} else {
+			seenUsernames[userReq.Username] = row
+		}
+		if previous, ok := seenEmails[strings.ToLower(userReq.Email)]; ok && userReq.Email != "" {
+			addError("email", fmt.Sprintf("与第%d行的邮箱重复", previous))
+		} else {
+			seenEmails[strings.ToLower(userReq.Email)] = row
 		}
 
-		successCount++
+		task.Apply = func(tx *gorm.DB) (services.ImportOutcome, error) {
+			// 用户名和邮箱全局唯一；本租户已有相同用户名和邮箱的用户时视为已导入
+			var existingUser models.User
+			result := tx.Where("username = ?", userReq.Username).Limit(1).Find(&existingUser)
+			if result.Error != nil {
+				return services.ImportOutcome{}, result.Error
+			}
+			if result.RowsAffected > 0 {
+				if existingUser.TenantID == tenantID && strings.EqualFold(existingUser.Email, userReq.Email) {
+					return services.ImportOutcome{Skipped: true, Reason: "用户已存在", ResourceID: existingUser.ID}, nil
+				}
+				return services.ImportOutcome{}, services.NewImportFieldError("username", "用户名已存在")
+			}
+			result = tx.Where("email = ?", userReq.Email).Limit(1).Find(&existingUser)
+			if result.Error != nil {
+				return services.ImportOutcome{}, result.Error
+			}
+			if result.RowsAffected > 0 {
+				return services.ImportOutcome{}, services.NewImportFieldError("email", "邮箱已存在")
+			}
+
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userReq.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return services.ImportOutcome{}, services.NewImportFieldError("password", "密码加密失败")
+			}
+
+			// 批量导入的初始密码要求首次登录后修改
+			now := time.Now()
+			user := models.User{
+				TenantID:           tenantID,
+				Username:           userReq.Username,
+				Email:              userReq.Email,
+				Password:           string(hashedPassword),
+				PasswordChangedAt:  &now,
+				MustChangePassword: true,
+				Name:               userReq.Name,
+				Role:               userReq.Role,
+				Department:         strings.TrimSpace(userReq.Department),
+				IsActive:           true,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return services.ImportOutcome{}, err
+			}
+			return services.ImportOutcome{ResourceID: user.ID, Snapshot: user}, nil
+		}
+		tasks[i] = task
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "批量导入完成",
-		"success_count": successCount,
-		"errors":        errors,
-	})
-}
\ No newline at end of file
+	payload, _ := json.Marshal(req.Users)
+	job.PayloadDigest = services.ImportPayloadDigest(payload, []byte(job.Mode))
+	job.Source = "json"
+	startImportJob(c, job, tasks, auditRecorder(c, services.AuditUserImport, "user"), nil, nil)
+}
@@ -49,6 +49,31 @@ func AutoMigrate() {
 		&models.PracticeRecord{},
 		&models.PracticeAnswer{},
 		&models.PracticeRecommendation{},
+		&models.RetentionPolicy{},
+		&models.TenantDeletionJob{},
+		&models.RefreshToken{},
+		&models.TenantSecurityPolicy{},
+		&models.LoginAttempt{},
+		&models.Class{},
+		&models.ClassMember{},
+		&models.InviteCode{},
+		&models.PasswordHistory{},
+		&models.UserTwoFactor{},
+		&models.TwoFactorRecoveryCode{},
+		&models.LDAPConfig{},
+		&models.OIDCProvider{},
+		&models.UserIdentity{},
+		&models.TenantRole{},
+		&models.ResourceShare{},
+		&models.AuditLog{},
+		&models.ImportJob{},
+		&models.Attachment{},
+		&models.QuestionAttachment{},
+		&models.QuestionOption{},
+		&models.QuestionRevision{},
+		&models.PaperQuestionRevision{},
+		&models.SubjectReviewer{},
+		&models.QuestionReview{},
 	)
 	
 	if err != nil {
@@ -73,6 +98,8 @@ func createDefaultAdmin() {
 			Role:     models.RoleAdmin,
 			Name:     "系统管理员",
 			IsActive: true,
+			// 默认密码为公开的弱密码，首次登录后必须修改
+			MustChangePassword: true,
 		}
 		
 		if err := DB.Create(&admin).Error; err != nil {
@@ -86,6 +113,17 @@ func createDefaultAdmin() {
 	createDefaultTeacher()
 	// 创建默认学生用户
 	createDefaultStudent()
+	// 仍在使用默认密码的已有账号也要求修改
+	requireDefaultPasswordChange()
+}
+
+func requireDefaultPasswordChange() {
+	result := DB.Model(&models.User{}).
+		Where("password = ? AND password_changed_at IS NULL AND must_change_password = ?", "$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi", false).
+		Update("must_change_password", true)
+	if result.RowsAffected > 0 {
+		log.Printf("%d accounts still use the default password and must change it on next login", result.RowsAffected)
+	}
 }
 
 func createDefaultTeacher() {
@@ -100,6 +138,8 @@ func createDefaultTeacher() {
 			Role:     models.RoleTeacher,
 			Name:     "张老师",
 			IsActive: true,
+			// 默认密码为公开的弱密码，首次登录后必须修改
+			MustChangePassword: true,
 		}
 		
 		if err := DB.Create(&teacher).Error; err != nil {
@@ -122,6 +162,8 @@ func createDefaultStudent() {
 			Role:     models.RoleStudent,
 			Name:     "王同学",
 			IsActive: true,
+			// 默认密码为公开的弱密码，首次登录后必须修改
+			MustChangePassword: true,
 		}
 		
 		if err := DB.Create(&student).Error; err != nil {
@@ -30,6 +30,32 @@ func main() {
 	// 自动迁移数据库表
 	database.AutoMigrate()
 
+	// 将选项仍为JSON字符串的选择题转换为选项表，无法识别的题目保持原样，可在管理接口查看
+	if report, err := services.MigrateQuestionOptions(database.DB, 0, false); err != nil {
+		log.Printf("Question option migration failed: %v", err)
+	} else if report.Checked > 0 {
+		failed := make([]uint, len(report.Failed))
+		for i, item := range report.Failed {
+			failed[i] = item.QuestionID
+		}
+		log.Printf("Question option migration: converted %d questions, %d answers; unconverted questions %v, %d answers",
+			report.Converted, report.AnswersConverted, failed, report.AnswersUnconverted)
+	}
+
+	// 升级前组的试卷按题目当前内容固定版本，之后修改题目不再影响这些试卷
+	if count, err := services.BackfillPaperRevisions(database.DB, 0); err != nil {
+		log.Printf("Paper revision backfill failed: %v", err)
+	} else if count > 0 {
+		log.Printf("Paper revision backfill: pinned %d papers", count)
+	}
+
+	// 审核流程上线前已发布的题目按 LEGACY_QUESTION_REVIEW 处理：视为已审核或改为待审核，并记录审核记录
+	if count, err := services.MigrateLegacyQuestions(database.DB, 0, config.GetConfig().LegacyQuestionReview); err != nil {
+		log.Printf("Legacy question review migration failed: %v", err)
+	} else if count > 0 {
+		log.Printf("Legacy question review migration: %d questions marked as %s", count, config.GetConfig().LegacyQuestionReview)
+	}
+
 	// 启动缓存预热服务
 	warmupService := services.NewWarmupService()
 	warmupService.StartWarmupScheduler()
@@ -37,6 +63,9 @@ func main() {
 	// 执行初始数据预热
 	go warmupService.PerformFullWarmup()
 
+	// 启动数据保留调度器
+	services.NewRetentionService().StartRetentionScheduler()
+
 	// 设置Gin模式
 	gin.SetMode(gin.DebugMode)
 
@@ -47,7 +76,8 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Tenant-ID")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Tenant-ID, Idempotency-Key")
+		c.Header("Access-Control-Expose-Headers", "Content-Disposition, X-Unsupported-Questions")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -1,8 +1,8 @@
 package middleware
 
 import (
-	"crypto/sha256"
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"online-exam-system/config"
 	"online-exam-system/models"
@@ -17,28 +17,83 @@ import (
 // 全局缓存服务实例
 var cacheService = services.NewCacheService()
 
+// 全局会话服务实例
+var sessionService = services.NewSessionService()
+
+// 全局权限服务实例
+var permissionService = services.NewPermissionService()
+
 type Claims struct {
 	UserID   uint             `json:"user_id"`
 	Username string           `json:"username"`
 	Role     models.UserRole  `json:"role"`
+	TenantID uint             `json:"tenant_id,omitempty"`
+	SessionVersion uint       `json:"sv"`
+	Act      *ActClaim        `json:"act,omitempty"` // 模拟登录时为实际操作的管理员
 	jwt.RegisteredClaims
 }
 
-// 生成JWT Token
-func GenerateToken(user *models.User) (string, error) {
+// ActClaim 模拟登录令牌中的实际操作者（RFC 8693 act声明）
+type ActClaim struct {
+	Sub            string `json:"sub"`
+	UserID         uint   `json:"user_id"`
+	Username       string `json:"username"`
+	SessionVersion uint   `json:"sv"`
+	ReadOnly       bool   `json:"read_only"` // 只读模式下禁止修改数据
+}
+
+// 生成JWT Token，act不为空时生成以act为实际操作者的模拟登录令牌
+func GenerateToken(user *models.User, act ...*ActClaim) (string, error) {
+	if len(act) > 0 && act[0] != nil {
+		token, _, err := IssueImpersonationToken(user, act[0], 0)
+		return token, err
+	}
+	token, _, err := IssueAccessToken(user)
+	return token, err
+}
+
+// IssueAccessToken 签发短期访问令牌，返回令牌及其过期时间
+func IssueAccessToken(user *models.User) (string, time.Time, error) {
+	return signToken(user, nil, config.GetConfig().AccessTokenTTL)
+}
+
+// IssueImpersonationToken 签发模拟登录令牌，有效期不超过 IMPERSONATION_TTL
+func IssueImpersonationToken(user *models.User, act *ActClaim, ttl time.Duration) (string, time.Time, error) {
+	if maxTTL := config.GetConfig().ImpersonationTTL; ttl <= 0 || ttl > maxTTL {
+		ttl = maxTTL
+	}
+	return signToken(user, act, ttl)
+}
+
+func signToken(user *models.User, act *ActClaim, ttl time.Duration) (string, time.Time, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
 	claims := Claims{
 		UserID:   user.ID,
 		Username: user.Username,
 		Role:     user.Role,
+		TenantID: user.TenantID,
+		SessionVersion: user.SessionVersion,
+		Act:      act,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        hex.EncodeToString(jti),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.GetConfig().JWTSecret))
+	signed, err := token.SignedString([]byte(config.GetConfig().JWTSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
 // 解析JWT Token
@@ -58,6 +113,14 @@ func ParseToken(tokenString string) (*Claims, error) {
 	return nil, jwt.ErrInvalidKey
 }
 
+// TokenExpiresAt 获取token过期时间，未设置时按访问令牌有效期计算
+func TokenExpiresAt(claims *Claims) time.Time {
+	if claims.ExpiresAt != nil {
+		return claims.ExpiresAt.Time
+	}
+	return time.Now().Add(config.GetConfig().AccessTokenTTL)
+}
+
 // JWT认证中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -78,41 +141,113 @@ func AuthMiddleware() gin.HandlerFunc {
 		// 获取租户ID
 		tenantID := GetTenantID(c)
 
-		// 尝试从缓存获取token信息
-		tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(tokenString)))
+		// 已登出或被撤销的token直接拒绝
+		tokenHash := services.HashToken(tokenString)
+		if sessionService.IsAccessTokenRevoked(tenantID, tokenHash) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+		c.Set("token_hash", tokenHash)
+
+		// 尝试从缓存获取token信息，缓存未命中时解析JWT token
+		var userID, sessionVersion uint
+		var act *ActClaim
 		if tokenInfo, found := cacheService.GetTokenCache(tenantID, tokenHash); found {
-			// 从缓存中获取到token信息，直接使用
-			if userID, ok := tokenInfo["user_id"].(float64); ok {
-				c.Set("user_id", uint(userID))
+			if id, ok := tokenInfo["user_id"].(float64); ok {
+				userID = uint(id)
 			}
-			if username, ok := tokenInfo["username"].(string); ok {
-				c.Set("username", username)
+			if sv, ok := tokenInfo["session_version"].(float64); ok {
+				sessionVersion = uint(sv)
 			}
-			if roleStr, ok := tokenInfo["role"].(string); ok {
-				c.Set("role", models.UserRole(roleStr))
+		} else {
+			claims, err := ParseToken(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
 			}
-			c.Next()
+
+			// token只能在签发它的租户内使用（旧token未携带租户ID）
+			if claims.TenantID != 0 && claims.TenantID != tenantID {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+
+			// 缓存token信息；模拟登录令牌不缓存，每次请求都重新校验发起模拟的管理员
+			if claims.Act != nil {
+				act = claims.Act
+			} else {
+				cacheService.SetTokenCache(tenantID, tokenHash, claims.UserID, claims.Username, claims.Role, claims.SessionVersion, TokenExpiresAt(claims))
+			}
+			userID = claims.UserID
+			sessionVersion = claims.SessionVersion
+		}
+
+		// 校验用户当前状态：停用、删除或会话版本变化（角色变更等）后token立即失效
+		user, err := cacheService.GetUserWithCache(tenantID, userID)
+		if err != nil || !user.IsActive || user.SessionVersion != sessionVersion {
+			cacheService.InvalidateTokenCache(tenantID, tokenHash)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please login again"})
+			c.Abort()
+			return
+		}
+
+		if act != nil {
+			handleImpersonatedRequest(c, tenantID, user, act)
 			return
 		}
 
-		// 缓存未命中，解析JWT token
-		claims, err := ParseToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		// 需要修改密码的用户只能访问修改密码、查看个人信息和退出登录接口
+		if user.MustChangePassword && !passwordChangeAllowed(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                "请先修改密码",
+				"must_change_password": true,
+			})
 			c.Abort()
 			return
 		}
 
-		// 缓存token信息
-		cacheService.SetTokenCache(tenantID, tokenHash, claims.UserID, claims.Username, claims.Role)
+		// 租户要求管理员和教师开启两步验证时，未开启前只能访问绑定相关接口
+		if !user.TwoFactorEnabled && user.Role != models.RoleStudent &&
+			services.TwoFactorSetupRequired(services.GetSecurityPolicy(tenantID), user) && !twoFactorSetupAllowed(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                     "请先开启两步验证",
+				"two_factor_setup_required": true,
+			})
+			c.Abort()
+			return
+		}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Set("role_id", user.RoleID)
 		c.Next()
 	}
 }
 
+// passwordChangeAllowed 判断强制修改密码期间是否允许访问当前接口
+func passwordChangeAllowed(c *gin.Context) bool {
+	switch c.FullPath() {
+	case "/api/v1/user/password", "/api/v1/auth/logout":
+		return true
+	case "/api/v1/user/profile":
+		return c.Request.Method == http.MethodGet
+	}
+	return false
+}
+
+// twoFactorSetupAllowed 判断强制开启两步验证期间是否允许访问当前接口
+func twoFactorSetupAllowed(c *gin.Context) bool {
+	switch c.FullPath() {
+	case "/api/v1/user/2fa", "/api/v1/user/2fa/setup", "/api/v1/user/2fa/enable":
+		return true
+	}
+	return passwordChangeAllowed(c)
+}
+
 // 角色权限中间件
 func RoleMiddleware(allowedRoles ...models.UserRole) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -136,6 +271,36 @@ func RoleMiddleware(allowedRoles ...models.UserRole) gin.HandlerFunc {
 	}
 }
 
+// RequirePermission 权限中间件：拥有任一指定权限即可访问
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("role"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(c, permissions...) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasPermission 判断当前用户是否拥有任一指定权限
+func HasPermission(c *gin.Context, permissions ...string) bool {
+	return permissionService.HasPermission(GetTenantID(c), GetCurrentUserRole(c), GetCurrentRoleID(c), permissions...)
+}
+
+// 获取当前用户的自定义角色ID，未分配时为nil
+func GetCurrentRoleID(c *gin.Context) *uint {
+	roleID, _ := c.Get("role_id")
+	id, _ := roleID.(*uint)
+	return id
+}
+
 // 获取当前用户ID
 func GetCurrentUserID(c *gin.Context) uint {
 	userID, _ := c.Get("user_id")
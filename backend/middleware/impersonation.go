@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"online-exam-system/models"
+	"online-exam-system/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 全局审计日志服务实例
+var auditService = services.NewAuditService()
+
+// handleImpersonatedRequest 处理模拟登录令牌的请求：校验发起模拟的管理员和只读限制，并为每个请求记录审计日志
+func handleImpersonatedRequest(c *gin.Context, tenantID uint, user *models.User, act *ActClaim) {
+	// 管理员被停用、会话失效或失去模拟权限后，模拟令牌立即失效
+	admin, err := cacheService.GetUserWithCache(tenantID, act.UserID)
+	if err != nil || !admin.IsActive || admin.SessionVersion != act.SessionVersion ||
+		!permissionService.HasPermission(tenantID, admin.Role, admin.RoleID, services.PermUserImpersonate) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation session expired"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("role_id", user.RoleID)
+	c.Set("impersonator_id", admin.ID)
+	c.Set("impersonation_read_only", act.ReadOnly)
+	c.Header("X-Impersonated-By", admin.Username)
+
+	switch {
+	case impersonationForbidden(c):
+		c.JSON(http.StatusForbidden, gin.H{"error": "模拟登录期间不能修改账号和安全设置", "impersonating": true})
+		c.Abort()
+	case act.ReadOnly && !readOnlyAllowed(c):
+		c.JSON(http.StatusForbidden, gin.H{"error": "只读模拟登录不能修改数据", "impersonating": true, "read_only": true})
+		c.Abort()
+	default:
+		c.Next()
+	}
+
+	impersonatorID := admin.ID
+	auditService.Record(&models.AuditLog{
+		TenantID:       tenantID,
+		UserID:         user.ID,
+		Username:       user.Username,
+		ImpersonatorID: &impersonatorID,
+		Action:         services.AuditImpersonationRequest,
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		StatusCode:     c.Writer.Status(),
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		Detail: services.AuditDetail(gin.H{
+			"route":        c.FullPath(),
+			"query":        c.Request.URL.RawQuery,
+			"read_only":    act.ReadOnly,
+			"impersonator": admin.Username,
+		}),
+	})
+}
+
+// impersonationForbidden 模拟登录期间始终禁止的操作：修改被模拟用户的账号和安全设置、再次发起模拟
+func impersonationForbidden(c *gin.Context) bool {
+	if isReadMethod(c.Request.Method) {
+		return false
+	}
+	path := c.FullPath()
+	return strings.HasPrefix(path, "/api/v1/user/") || strings.HasSuffix(path, "/impersonate")
+}
+
+// readOnlyAllowed 只读模拟登录期间允许的请求：只读请求和退出登录
+func readOnlyAllowed(c *gin.Context) bool {
+	return isReadMethod(c.Request.Method) || c.FullPath() == "/api/v1/auth/logout"
+}
+
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// GetImpersonatorID 模拟登录时返回发起模拟的管理员ID，否则为nil
+func GetImpersonatorID(c *gin.Context) *uint {
+	value, exists := c.Get("impersonator_id")
+	if !exists {
+		return nil
+	}
+	id, ok := value.(uint)
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// IsImpersonating 当前请求是否使用模拟登录令牌
+func IsImpersonating(c *gin.Context) bool {
+	return GetImpersonatorID(c) != nil
+}
@@ -1,18 +1,25 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// ErrAuditLogImmutable 试图修改审计日志
+var ErrAuditLogImmutable = errors.New("审计日志不允许修改")
+
 // 租户模型
 type Tenant struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"not null"`
-	Code        string    `json:"code" gorm:"uniqueIndex;not null"`
-	Description string    `json:"description"`
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	Name              string    `json:"name" gorm:"not null"`
+	Code              string    `json:"code" gorm:"uniqueIndex;not null"`
+	Description       string    `json:"description"`
+	IsActive          bool      `json:"is_active" gorm:"default:true"`
+	AttachmentQuotaMB int       `json:"attachment_quota_mb" gorm:"default:0"` // 附件配额，0表示使用 ATTACHMENT_QUOTA_MB
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 // 用户角色枚举
@@ -32,6 +39,11 @@ const (
 	MultipleChoice QuestionType = "multiple_choice"
 	TrueFalse      QuestionType = "true_false"
 	ShortAnswer    QuestionType = "short_answer"
+	FillBlank      QuestionType = "fill_blank" // 填空题，答案和展示数据的格式见 services/question_grading.go
+	Matching       QuestionType = "matching"   // 配对题
+	Ordering       QuestionType = "ordering"   // 排序题
+	Numeric        QuestionType = "numeric"    // 数值题
+	Material       QuestionType = "material"   // 材料题：共享的阅读材料，包含按顺序排列的子题
 )
 
 // 考试状态枚举
@@ -56,17 +68,38 @@ const (
 
 // 用户模型
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	TenantID  uint      `json:"tenant_id" gorm:"not null;index;default:100"`
-	Username  string    `json:"username" gorm:"uniqueIndex;not null"`
-	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	Role      UserRole  `json:"role" gorm:"not null;default:'student'"`
-	Name      string    `json:"name" gorm:"not null"`
-	Avatar    string    `json:"avatar"`
-	IsActive  bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	TenantID           uint       `json:"tenant_id" gorm:"not null;index;default:100"`
+	Username           string     `json:"username" gorm:"uniqueIndex;not null"`
+	Email              string     `json:"email" gorm:"uniqueIndex;not null"`
+	EmailVerified      bool       `json:"email_verified" gorm:"default:false"`
+	PendingEmail       string     `json:"pending_email"` // 修改邮箱后待验证的新地址，验证通过后替换Email
+	Password           string     `json:"-" gorm:"not null"`
+	AuthProvider       string     `json:"auth_provider" gorm:"not null;default:'local'"` // local、ldap 或 oidc，外部账号的密码由目录服务或身份提供方校验
+	PasswordChangedAt  *time.Time `json:"password_changed_at"`
+	MustChangePassword bool       `json:"must_change_password" gorm:"default:false"` // 首次登录或管理员重置后必须修改密码
+	TwoFactorEnabled   bool       `json:"two_factor_enabled" gorm:"default:false"`   // 已开启TOTP两步验证
+	Role               UserRole   `json:"role" gorm:"not null;default:'student'"`
+	RoleID             *uint      `json:"role_id" gorm:"index"`    // 租户自定义角色，为空时按 Role 使用内置权限
+	Department         string     `json:"department" gorm:"index"` // 所属院系/教研组，用于按院系共享题目和试卷
+	Name               string     `json:"name" gorm:"not null"`
+	Avatar             string     `json:"avatar"`
+	IsActive           bool       `json:"is_active" gorm:"default:true"`
+	SessionVersion     uint       `json:"session_version" gorm:"not null;default:0"` // 角色变更、停用或删除时递增，使已签发的token全部失效
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// 租户自定义角色，权限为命名权限列表，BaseRole 决定学生/教师/管理员专属页面和数据范围
+type TenantRole struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"tenant_id" gorm:"not null;uniqueIndex:idx_tenant_role_name;default:100"`
+	Name        string    `json:"name" gorm:"not null;uniqueIndex:idx_tenant_role_name"`
+	Description string    `json:"description"`
+	BaseRole    UserRole  `json:"base_role" gorm:"not null"`
+	Permissions string    `json:"permissions" gorm:"type:text"` // JSON格式存储权限名称列表
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // 科目模型
@@ -85,51 +118,74 @@ type Subject struct {
 // 题目状态枚举
 type QuestionStatus string
 
+// 审核流程：草稿 → 待审核 → 审核通过/驳回 → 已发布 → 已归档
 const (
 	QuestionDraft     QuestionStatus = "draft"
+	QuestionSubmitted QuestionStatus = "submitted" // 已提交，待审核
+	QuestionApproved  QuestionStatus = "approved"  // 审核通过，尚未发布
+	QuestionRejected  QuestionStatus = "rejected"  // 审核驳回，修改后可重新提交
 	QuestionPublished QuestionStatus = "published"
 	QuestionArchived  QuestionStatus = "archived"
 )
 
+// 资源可见范围
+type Visibility string
+
+const (
+	VisibilityPrivate    Visibility = "private"    // 仅创建者
+	VisibilityShared     Visibility = "shared"     // 创建者和指定的教师
+	VisibilityDepartment Visibility = "department" // 与创建者同院系的用户
+	VisibilityTenant     Visibility = "tenant"     // 租户内所有用户
+)
+
 // 题目模型
 type Question struct {
-	ID             uint           `json:"id" gorm:"primaryKey"`
-	TenantID       uint           `json:"tenant_id" gorm:"not null;index;default:100"`
-	SubjectID      uint           `json:"subject_id" gorm:"not null"`
-	Subject        Subject        `json:"subject" gorm:"foreignKey:SubjectID"`
-	Type           QuestionType   `json:"type" gorm:"not null"`
-	Title          string         `json:"title" gorm:"not null"`
-	Content        string         `json:"content" gorm:"type:text"`
-	Options        string         `json:"options" gorm:"type:text"` // JSON格式存储选项
-	Answer         string         `json:"answer" gorm:"not null"`
-	Explanation    string         `json:"explanation" gorm:"type:text"`
-	Difficulty     int            `json:"difficulty" gorm:"default:1"` // 1-5难度等级
-	Score          int            `json:"score" gorm:"default:1"`      // 题目分值
-	Status         QuestionStatus `json:"status" gorm:"default:'published'"`
-	KnowledgePoint string         `json:"knowledge_point" gorm:"default:''"`  // 知识点
-	UsageCount     int            `json:"usage_count" gorm:"default:0"`       // 使用次数
-	CorrectRate    float64        `json:"correct_rate" gorm:"default:0"`      // 正确率(0-1)
-	CreatedBy      uint           `json:"created_by"`
-	Creator        User           `json:"creator" gorm:"foreignKey:CreatedBy"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
+	ID             uint             `json:"id" gorm:"primaryKey"`
+	TenantID       uint             `json:"tenant_id" gorm:"not null;index;default:100"`
+	SubjectID      uint             `json:"subject_id" gorm:"not null"`
+	Subject        Subject          `json:"subject" gorm:"foreignKey:SubjectID"`
+	Type           QuestionType     `json:"type" gorm:"not null"`
+	Title          string           `json:"title" gorm:"not null"`
+	Content        string           `json:"content" gorm:"type:text"`
+	Options        string           `json:"options" gorm:"type:text"` // JSON格式存储选项，结构化题型（填空、配对等）为展示数据；选择题以 Choices 为准，此处为选项内容的副本
+	Answer         string           `json:"answer" gorm:"not null"`   // 选择题为由正确选项生成的字母（如 A,C）
+	Explanation    string           `json:"explanation" gorm:"type:text"`
+	Difficulty     int              `json:"difficulty" gorm:"default:1"` // 1-5难度等级
+	Score          int              `json:"score" gorm:"default:1"`      // 题目分值
+	Status         QuestionStatus   `json:"status" gorm:"default:'draft'"`
+	ReviewerID     *uint            `json:"reviewer_id"`                       // 提交审核时分配的审核人
+	KnowledgePoint string           `json:"knowledge_point" gorm:"default:''"` // 知识点
+	UsageCount     int              `json:"usage_count" gorm:"default:0"`      // 使用次数
+	CorrectRate    float64          `json:"correct_rate" gorm:"default:0"`     // 正确率(0-1)
+	Visibility     Visibility       `json:"visibility" gorm:"not null;default:'tenant'"`
+	ParentID       *uint            `json:"parent_id" gorm:"index"`            // 所属材料题
+	Position       int              `json:"position" gorm:"default:0"`         // 在材料题中的序号
+	Children       []Question       `json:"children,omitempty" gorm:"-"`       // 材料题的子题，按需加载
+	Choices        []QuestionOption `json:"choices,omitempty" gorm:"-"`        // 选择题的选项，按需加载
+	Version        int              `json:"version" gorm:"default:0"`          // 当前版本号，每次修改内容加一
+	LatestVersion  int              `json:"latest_version,omitempty" gorm:"-"` // 试卷中显示的是较早版本时为题目的当前版本号
+	CreatedBy      uint             `json:"created_by"`
+	Creator        User             `json:"creator" gorm:"foreignKey:CreatedBy"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
 }
 
 // 试卷模型
 type Paper struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	TenantID    uint      `json:"tenant_id" gorm:"not null;index;default:100"`
-	Title       string    `json:"title" gorm:"not null"`
-	Description string    `json:"description"`
-	SubjectID   uint      `json:"subject_id"`
-	Subject     Subject   `json:"subject" gorm:"foreignKey:SubjectID"`
-	TotalScore  int       `json:"total_score" gorm:"default:0"`
-	Duration    int       `json:"duration" gorm:"default:60"` // 考试时长(分钟)
-	CreatedBy   uint      `json:"created_by"`
-	Creator     User      `json:"creator" gorm:"foreignKey:CreatedBy"`
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TenantID    uint       `json:"tenant_id" gorm:"not null;index;default:100"`
+	Title       string     `json:"title" gorm:"not null"`
+	Description string     `json:"description"`
+	SubjectID   uint       `json:"subject_id"`
+	Subject     Subject    `json:"subject" gorm:"foreignKey:SubjectID"`
+	TotalScore  int        `json:"total_score" gorm:"default:0"`
+	Duration    int        `json:"duration" gorm:"default:60"` // 考试时长(分钟)
+	Visibility  Visibility `json:"visibility" gorm:"not null;default:'tenant'"`
+	CreatedBy   uint       `json:"created_by"`
+	Creator     User       `json:"creator" gorm:"foreignKey:CreatedBy"`
 	Questions   []Question `json:"questions" gorm:"many2many:paper_questions;"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 // 考试模型
@@ -144,13 +200,27 @@ type Exam struct {
 	EndTime     time.Time  `json:"end_time"`
 	Duration    int        `json:"duration"` // 考试时长(分钟)
 	Status      ExamStatus `json:"status" gorm:"default:'draft'"`
-	StudentIDs  string     `json:"student_ids" gorm:"type:text"` // JSON格式存储学生ID列表
+	StudentIDs  string     `json:"student_ids" gorm:"type:text"`                 // JSON格式存储学生ID列表
+	Visibility  Visibility `json:"visibility" gorm:"not null;default:'private'"` // 对其他教师的可见范围，不影响学生参加考试
 	CreatedBy   uint       `json:"created_by"`
 	Creator     User       `json:"creator" gorm:"foreignKey:CreatedBy"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
+// 资源共享记录：共享给指定用户查看，CanEdit 为协作编辑者
+type ResourceShare struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TenantID     uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	ResourceType string    `json:"resource_type" gorm:"not null;uniqueIndex:idx_resource_share"` // question、paper 或 exam
+	ResourceID   uint      `json:"resource_id" gorm:"not null;uniqueIndex:idx_resource_share"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_resource_share;index"`
+	User         *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	CanEdit      bool      `json:"can_edit" gorm:"default:false"`
+	CreatedBy    uint      `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // 考试参与记录
 type ExamRecord struct {
 	ID         uint              `json:"id" gorm:"primaryKey"`
@@ -253,4 +323,401 @@ type AIChat struct {
 	Response  string    `json:"response" gorm:"type:text"`
 	Context   string    `json:"context" gorm:"type:text"`
 	CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+}
+// 数据保留策略动作
+type RetentionAction string
+
+const (
+	RetentionDelete    RetentionAction = "delete"    // 删除过期记录
+	RetentionAnonymize RetentionAction = "anonymize" // 解除记录与用户的关联
+)
+
+// 数据保留策略（按租户配置）
+type RetentionPolicy struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	TenantID     uint            `json:"tenant_id" gorm:"not null;index;default:100"`
+	Target       string          `json:"target" gorm:"not null"` // 目标数据，如 ai_chats、exam_records
+	Action       RetentionAction `json:"action" gorm:"not null"`
+	RetainDays   int             `json:"retain_days" gorm:"not null"` // 保留天数，超过后执行动作
+	IsActive     bool            `json:"is_active" gorm:"default:true"`
+	LastRunAt    *time.Time      `json:"last_run_at"`
+	LastAffected int64           `json:"last_affected" gorm:"default:0"` // 上次执行影响的记录数
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// 租户删除任务状态枚举
+type DeletionJobStatus string
+
+const (
+	DeletionPending   DeletionJobStatus = "pending"
+	DeletionRunning   DeletionJobStatus = "running"
+	DeletionCompleted DeletionJobStatus = "completed"
+	DeletionFailed    DeletionJobStatus = "failed"
+)
+
+// 租户删除任务（不带租户字段，删除完成后作为凭证保留）
+type TenantDeletionJob struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	TargetTenantID uint              `json:"target_tenant_id" gorm:"not null;index"`
+	Status         DeletionJobStatus `json:"status" gorm:"default:'pending'"`
+	BatchSize      int               `json:"batch_size" gorm:"default:500"`
+	RequestedBy    string            `json:"requested_by"`            // 发起人用户名
+	Report         string            `json:"report" gorm:"type:text"` // JSON格式的删除报告
+	ReportDigest   string            `json:"report_digest"`           // 删除报告的SHA-256
+	Error          string            `json:"error" gorm:"type:text"`
+	StartedAt      *time.Time        `json:"started_at"`
+	FinishedAt     *time.Time        `json:"finished_at"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// 刷新令牌（服务端会话），每次刷新都会轮换出新令牌
+type RefreshToken struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	TenantID        uint       `json:"tenant_id" gorm:"not null;index;default:100"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash       string     `json:"-" gorm:"uniqueIndex;not null"`
+	FamilyID        string     `json:"family_id" gorm:"not null;index"` // 同一次登录轮换出的令牌共享同一个FamilyID
+	AccessTokenHash string     `json:"-" gorm:"index"`                  // 随该令牌签发的访问令牌
+	AccessExpiresAt time.Time  `json:"access_expires_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	ReplacedByID    *uint      `json:"replaced_by_id"`
+	IP              string     `json:"ip"`
+	UserAgent       string     `json:"user_agent"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// 租户安全策略（每个租户一条，未配置时使用默认值）
+type TenantSecurityPolicy struct {
+	ID                       uint      `json:"id" gorm:"primaryKey"`
+	TenantID                 uint      `json:"tenant_id" gorm:"not null;uniqueIndex;default:100"`
+	MaxLoginFailures         int       `json:"max_login_failures" gorm:"default:5"`      // 同一用户名连续失败多少次后锁定
+	MaxIPLoginFailures       int       `json:"max_ip_login_failures" gorm:"default:50"`  // 同一IP失败多少次后锁定（学校出口IP常被多人共用）
+	LockoutMinutes           int       `json:"lockout_minutes" gorm:"default:15"`        // 锁定时长（分钟）
+	FailureWindowMinutes     int       `json:"failure_window_minutes" gorm:"default:15"` // 失败次数的统计窗口（分钟）
+	BackoffBaseSeconds       int       `json:"backoff_base_seconds" gorm:"default:1"`    // 退避基数，第n次失败后需等待 base*2^(n-1) 秒
+	PasswordMinLength        int       `json:"password_min_length" gorm:"default:8"`
+	PasswordMinClasses       int       `json:"password_min_classes" gorm:"default:2"`             // 至少包含几类字符（大写、小写、数字、符号）
+	PasswordBanCommon        bool      `json:"password_ban_common" gorm:"default:true"`           // 禁止使用常见弱密码
+	PasswordMaxAgeDays       int       `json:"password_max_age_days" gorm:"default:0"`            // 密码最长使用天数，0表示不过期
+	PasswordHistoryCount     int       `json:"password_history_count" gorm:"default:5"`           // 不能与最近N次使用过的密码相同
+	RequireTwoFactorForStaff bool      `json:"require_two_factor_for_staff" gorm:"default:false"` // 管理员和教师必须开启两步验证
+	CreatedAt                time.Time `json:"created_at"`
+	UpdatedAt                time.Time `json:"updated_at"`
+}
+
+// 认证方式
+const (
+	AuthProviderLocal = "local"
+	AuthProviderLDAP  = "ldap"
+	AuthProviderOIDC  = "oidc"
+)
+
+// 租户LDAP/Active Directory配置
+type LDAPConfig struct {
+	ID                 uint      `json:"id" gorm:"primaryKey"`
+	TenantID           uint      `json:"tenant_id" gorm:"not null;uniqueIndex;default:100"`
+	Enabled            bool      `json:"enabled" gorm:"default:false"`
+	URL                string    `json:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool      `json:"start_tls" gorm:"default:false"`
+	InsecureSkipVerify bool      `json:"insecure_skip_verify" gorm:"default:false"` // 仅用于测试环境的自签名证书
+	BindDN             string    `json:"bind_dn"`                                   // 用于查找用户的服务账号，为空时匿名查找
+	BindPassword       string    `json:"-"`
+	BaseDN             string    `json:"base_dn"`
+	UserFilter         string    `json:"user_filter" gorm:"default:'(uid={username})'"` // AD通常为 (sAMAccountName={username})
+	EmailAttribute     string    `json:"email_attribute" gorm:"default:'mail'"`
+	NameAttribute      string    `json:"name_attribute" gorm:"default:'cn'"`        // AD通常为 displayName
+	GroupAttribute     string    `json:"group_attribute" gorm:"default:'memberOf'"` // 用户条目上记录所属组的属性
+	GroupBaseDN        string    `json:"group_base_dn"`                             // 不为空时额外按GroupFilter搜索用户所在的组
+	GroupFilter        string    `json:"group_filter" gorm:"default:'(member={dn})'"`
+	AdminGroups        string    `json:"admin_groups"`                             // 映射为管理员的组，多个用分号分隔，可写完整DN或组名
+	TeacherGroups      string    `json:"teacher_groups"`                           // 映射为教师的组
+	DefaultRole        UserRole  `json:"default_role" gorm:"default:'student'"`    // 不属于以上组时的角色，为空表示拒绝登录
+	AutoProvision      bool      `json:"auto_provision" gorm:"default:true"`       // 首次登录时自动创建本地账号
+	AllowLocalFallback bool      `json:"allow_local_fallback" gorm:"default:true"` // 目录中不存在或目录不可用时允许本地账号登录
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// 租户OpenID Connect身份提供方
+type OIDCProvider struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TenantID      uint      `json:"tenant_id" gorm:"not null;uniqueIndex:idx_oidc_provider_tenant_name;default:100"`
+	Name          string    `json:"name" gorm:"not null;uniqueIndex:idx_oidc_provider_tenant_name"` // 出现在登录地址中的标识，如 district
+	DisplayName   string    `json:"display_name"`                                                   // 登录按钮上显示的名称
+	IssuerURL     string    `json:"issuer_url" gorm:"not null"`                                     // 通过 {issuer}/.well-known/openid-configuration 自动发现端点
+	ClientID      string    `json:"client_id" gorm:"not null"`
+	ClientSecret  string    `json:"-"`
+	Scopes        string    `json:"scopes" gorm:"default:'openid profile email'"`
+	UsernameClaim string    `json:"username_claim" gorm:"default:'preferred_username'"`
+	RoleClaim     string    `json:"role_claim"`   // 用于映射角色的声明，支持 realm_access.roles 形式的嵌套路径
+	AdminValues   string    `json:"admin_values"` // 映射为管理员的声明值，多个用分号分隔
+	TeacherValues string    `json:"teacher_values"`
+	DefaultRole   UserRole  `json:"default_role" gorm:"default:'student'"` // 为空表示不匹配时拒绝登录
+	AutoProvision bool      `json:"auto_provision" gorm:"default:true"`
+	Enabled       bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// 用户关联的外部身份（OIDC提供方中的subject）
+type UserIdentity struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	TenantID    uint          `json:"tenant_id" gorm:"not null;index;default:100"`
+	UserID      uint          `json:"user_id" gorm:"not null;index"`
+	ProviderID  uint          `json:"provider_id" gorm:"not null;uniqueIndex:idx_user_identity_subject"`
+	Provider    *OIDCProvider `json:"provider,omitempty" gorm:"foreignKey:ProviderID"`
+	Subject     string        `json:"subject" gorm:"not null;uniqueIndex:idx_user_identity_subject"`
+	Email       string        `json:"email"`
+	LastLoginAt *time.Time    `json:"last_login_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// 用户两步验证（TOTP）配置
+type UserTwoFactor struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TenantID     uint       `json:"tenant_id" gorm:"not null;index;default:100"`
+	UserID       uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Secret       string     `json:"-" gorm:"not null"`            // 加密后的TOTP密钥
+	Enabled      bool       `json:"enabled" gorm:"default:false"` // 绑定时先生成密钥，验证通过后才启用
+	EnabledAt    *time.Time `json:"enabled_at"`
+	LastUsedStep int64      `json:"-"` // 最近一次验证通过的时间步，防止同一验证码重放
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// 两步验证恢复码（只保存哈希，每个只能使用一次）
+type TwoFactorRecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TenantID  uint       `json:"tenant_id" gorm:"not null;index;default:100"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 登录尝试记录
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	Username  string    `json:"username" gorm:"index"`
+	UserID    uint      `json:"user_id"` // 用户不存在时为0
+	IP        string    `json:"ip" gorm:"index"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"` // 失败原因，如 invalid_credentials、locked
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// 班级模型
+type Class struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	TeacherID   uint      `json:"teacher_id" gorm:"index"` // 班主任/负责教师
+	Teacher     User      `json:"teacher" gorm:"foreignKey:TeacherID"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// 班级成员
+type ClassMember struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	ClassID   uint      `json:"class_id" gorm:"not null;uniqueIndex:idx_class_member"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_class_member"`
+	User      User      `json:"user" gorm:"foreignKey:UserID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 注册邀请码
+type InviteCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TenantID  uint       `json:"tenant_id" gorm:"not null;index;default:100"`
+	Code      string     `json:"code" gorm:"uniqueIndex;not null"` // 全局唯一，注册时据此确定租户
+	Role      UserRole   `json:"role" gorm:"not null;default:'student'"`
+	ClassID   *uint      `json:"class_id" gorm:"index"` // 注册后自动加入的班级
+	Class     *Class     `json:"class,omitempty" gorm:"foreignKey:ClassID"`
+	MaxUses   int        `json:"max_uses" gorm:"default:0"` // 0表示不限次数
+	UsedCount int        `json:"used_count" gorm:"default:0"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	IsActive  bool       `json:"is_active" gorm:"default:true"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// 密码历史（用于禁止重复使用最近的密码）
+type PasswordHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TenantID     uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// 审计日志，只追加不修改
+type AuditLog struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	TenantID       uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	UserID         uint      `json:"user_id" gorm:"index"` // 请求身份对应的用户，模拟登录时为被模拟的用户
+	Username       string    `json:"username"`
+	ImpersonatorID *uint     `json:"impersonator_id" gorm:"index"` // 模拟登录时发起模拟的管理员
+	Action         string    `json:"action" gorm:"not null;index"`
+	ResourceType   string    `json:"resource_type" gorm:"index"`
+	ResourceID     string    `json:"resource_id"`
+	Method         string    `json:"method"`
+	Path           string    `json:"path"`
+	StatusCode     int       `json:"status_code"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+	Before         string    `json:"before" gorm:"type:text"`  // 变更前的资源快照（JSON）
+	After          string    `json:"after" gorm:"type:text"`   // 变更后的资源快照（JSON）
+	Changes        string    `json:"changes" gorm:"type:text"` // 字段差异：{"字段": {"from": 旧值, "to": 新值}}
+	Detail         string    `json:"detail" gorm:"type:text"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
+
+// BeforeUpdate 审计日志只追加，禁止修改
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// 导入任务状态
+type ImportJobStatus string
+
+const (
+	ImportPending   ImportJobStatus = "pending"
+	ImportRunning   ImportJobStatus = "running"
+	ImportCompleted ImportJobStatus = "completed" // 已执行完毕，尽力导入模式下可能有部分行失败
+	ImportFailed    ImportJobStatus = "failed"    // 整体导入模式下有行失败，已全部回滚
+)
+
+// 导入模式
+type ImportMode string
+
+const (
+	ImportAllOrNothing ImportMode = "all_or_nothing" // 任何一行失败则全部不导入
+	ImportBestEffort   ImportMode = "best_effort"    // 跳过失败的行，导入其余行
+)
+
+// 批量导入任务，逐行结果保存在报告中
+type ImportJob struct {
+	ID             uint            `json:"id" gorm:"primaryKey"`
+	TenantID       uint            `json:"tenant_id" gorm:"not null;index;default:100"`
+	Kind           string          `json:"kind" gorm:"not null"` // questions 或 users
+	Mode           ImportMode      `json:"mode" gorm:"not null"`
+	Status         ImportJobStatus `json:"status" gorm:"default:'pending'"`
+	IdempotencyKey string          `json:"idempotency_key" gorm:"index"` // 未指定时使用导入内容的摘要
+	PayloadDigest  string          `json:"payload_digest"`               // 导入内容的SHA-256，同一幂等键只能用于相同内容
+	Source         string          `json:"source"`                       // 上传的文件名，JSON导入为空
+	Total          int             `json:"total"`
+	CreatedCount   int             `json:"created_count"`
+	UpdatedCount   int             `json:"updated_count"`
+	SkippedCount   int             `json:"skipped_count"`
+	FailedCount    int             `json:"failed_count"`
+	Report         string          `json:"-" gorm:"type:text"` // JSON格式的逐行结果
+	Error          string          `json:"error" gorm:"type:text"`
+	CreatedBy      uint            `json:"created_by" gorm:"index"`
+	StartedAt      *time.Time      `json:"started_at"`
+	FinishedAt     *time.Time      `json:"finished_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// 附件（题目中的图片、音频等），同一租户内按内容哈希去重，文件保存在附件存储中
+type Attachment struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    uint      `json:"tenant_id" gorm:"not null;uniqueIndex:idx_attachment_tenant_hash;default:100"`
+	Hash        string    `json:"hash" gorm:"size:64;not null;uniqueIndex:idx_attachment_tenant_hash"` // 内容的SHA-256
+	StorageKey  string    `json:"-" gorm:"not null"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedBy   uint      `json:"created_by" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// 选择题的选项，选项ID在修改题目时保持不变，学生作答保存为所选选项的ID
+type QuestionOption struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TenantID   uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	QuestionID uint      `json:"question_id" gorm:"not null;index"`
+	Position   int       `json:"position" gorm:"default:0"` // 选项顺序，从0开始，对应字母A、B、C…
+	Content    string    `json:"content" gorm:"type:text"`
+	IsCorrect  bool      `json:"is_correct,omitempty" gorm:"default:false"`
+	Feedback   string    `json:"feedback,omitempty" gorm:"type:text"` // 选择该选项后显示的反馈
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 题目引用的附件，保存题目时按题干、选项和解析中的 attachment://ID 重新生成
+type QuestionAttachment struct {
+	ID           uint `json:"id" gorm:"primaryKey"`
+	TenantID     uint `json:"tenant_id" gorm:"not null;index;default:100"`
+	QuestionID   uint `json:"question_id" gorm:"not null;index"`
+	AttachmentID uint `json:"attachment_id" gorm:"not null;index"`
+}
+
+// 题目的一个版本，创建和每次修改题目内容时保存，删除题目后保留，已有版本不再修改
+type QuestionRevision struct {
+	ID             uint             `json:"id" gorm:"primaryKey"`
+	TenantID       uint             `json:"tenant_id" gorm:"not null;index;default:100"`
+	QuestionID     uint             `json:"question_id" gorm:"not null;uniqueIndex:idx_question_revision"`
+	Version        int              `json:"version" gorm:"not null;uniqueIndex:idx_question_revision"`
+	Type           QuestionType     `json:"type"`
+	Title          string           `json:"title"`
+	Content        string           `json:"content" gorm:"type:text"`
+	Options        string           `json:"options" gorm:"type:text"`
+	Answer         string           `json:"answer"`
+	Explanation    string           `json:"explanation" gorm:"type:text"`
+	Difficulty     int              `json:"difficulty"`
+	Score          int              `json:"score"`
+	KnowledgePoint string           `json:"knowledge_point"`
+	ParentID       *uint            `json:"parent_id"`
+	Position       int              `json:"position"`
+	ChoicesJSON    string           `json:"-" gorm:"column:choices;type:text"` // 选择题选项（含选项ID）的JSON
+	Choices        []QuestionOption `json:"choices,omitempty" gorm:"-"`
+	CreatedBy      uint             `json:"created_by"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+// 试卷中题目引用的版本，组卷时确定，考试和成绩按该版本显示和评分
+type PaperQuestionRevision struct {
+	ID         uint `json:"id" gorm:"primaryKey"`
+	TenantID   uint `json:"tenant_id" gorm:"not null;index;default:100"`
+	PaperID    uint `json:"paper_id" gorm:"not null;uniqueIndex:idx_paper_question_revision"`
+	QuestionID uint `json:"question_id" gorm:"not null;uniqueIndex:idx_paper_question_revision"`
+	RevisionID uint `json:"revision_id" gorm:"not null"`
+}
+
+// 科目的审核人，负责审核该科目下提交的题目
+type SubjectReviewer struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  uint      `json:"tenant_id" gorm:"not null;index;default:100"`
+	SubjectID uint      `json:"subject_id" gorm:"not null;uniqueIndex:idx_subject_reviewer"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_subject_reviewer;index"`
+	User      *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 题目审核记录：提交、通过、驳回、发布、归档等状态变化及审核意见
+type QuestionReview struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	TenantID   uint           `json:"tenant_id" gorm:"not null;index;default:100"`
+	QuestionID uint           `json:"question_id" gorm:"not null;index"`
+	Version    int            `json:"version"` // 操作时题目的版本号
+	Action     string         `json:"action" gorm:"not null"`
+	FromStatus QuestionStatus `json:"from_status"`
+	ToStatus   QuestionStatus `json:"to_status"`
+	Comment    string         `json:"comment" gorm:"type:text"`
+	UserID     uint           `json:"user_id"` // 操作人
+	User       *User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
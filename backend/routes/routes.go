@@ -3,7 +3,7 @@ package routes
 import (
 	"online-exam-system/controllers"
 	"online-exam-system/middleware"
-	"online-exam-system/models"
+	"online-exam-system/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,26 +15,56 @@ func SetupRoutes(r *gin.Engine) {
 
 	// 公开路由（无需认证）
 	public := api.Group("/")
+	public.Use(middleware.TenantMiddleware())
 	{
 		// 认证相关
 		auth := public.Group("/auth")
 		{
 			auth.POST("/login", controllers.Login)
-			auth.POST("/register", controllers.Register) // 注册功能（可能需要管理员权限）
+			auth.POST("/register", controllers.Register) // 通过邀请码自助注册
+			auth.GET("/invites/:code", controllers.GetInviteInfo) // 注册前查看邀请码信息
+			auth.POST("/forgot-password", controllers.ForgotPassword) // 发送重置密码邮件
+			auth.POST("/reset-password", controllers.ResetPasswordByToken) // 通过邮件链接重置密码
+			auth.POST("/verify-email", controllers.VerifyEmail) // 验证邮箱
+			auth.POST("/refresh", controllers.RefreshToken) // 使用刷新令牌换取新的访问令牌
+			auth.POST("/2fa/verify", controllers.VerifyTwoFactorLogin) // 两步验证登录
+
+			// OpenID Connect 单点登录
+			auth.GET("/oidc/providers", controllers.GetOIDCProviders)
+			auth.GET("/oidc/:provider/login", controllers.OIDCLogin) // 跳转到身份提供方
+			auth.GET("/oidc/:provider/callback", controllers.OIDCCallback) // 身份提供方回调
+			auth.POST("/oidc/exchange", controllers.OIDCExchange) // 用一次性票据换取令牌
 		}
 	}
 
 	// 需要认证的路由
 	protected := api.Group("/")
+	protected.Use(middleware.TenantMiddleware()) // 租户中间件需在认证之前，token按租户校验
 	protected.Use(middleware.AuthMiddleware())
-	protected.Use(middleware.TenantMiddleware()) // 添加租户中间件
 	{
+		// 退出登录
+		protected.POST("/auth/logout", controllers.Logout)
+
 		// 用户相关
 		user := protected.Group("/user")
 		{
 			user.GET("/profile", controllers.GetProfile)
 			user.PUT("/profile", controllers.UpdateProfile)
 			user.PUT("/password", controllers.ChangePassword)
+			user.POST("/email/verification", controllers.ResendEmailVerification) // 重新发送验证邮件
+			user.GET("/permissions", controllers.GetMyPermissions) // 当前用户的权限列表
+
+			// 两步验证
+			user.GET("/2fa", controllers.GetTwoFactorStatus)
+			user.POST("/2fa/setup", controllers.SetupTwoFactor)
+			user.POST("/2fa/enable", controllers.EnableTwoFactor)
+			user.POST("/2fa/disable", controllers.DisableTwoFactor)
+			user.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+
+			// 关联外部身份（单点登录）
+			user.GET("/identities", controllers.GetUserIdentities)
+			user.POST("/identities/:provider/link", controllers.LinkUserIdentity)
+			user.DELETE("/identities/:id", controllers.UnlinkUserIdentity)
 		}
 
 		// 科目相关（所有角色都可以查看）
@@ -49,6 +79,10 @@ func SetupRoutes(r *gin.Engine) {
 		protected.GET("/questions/:id", controllers.GetQuestion)
 		protected.GET("/questions/:id/analyze", controllers.AnalyzeQuestion) // AI分析题目
 
+		// 附件（题目中引用的图片、音频等）
+		protected.GET("/attachments/:id", controllers.GetAttachment)
+		protected.POST("/attachments/resolve", controllers.ResolveAttachments) // 批量获取附件临时地址
+
 		// 试卷相关
 		paper := protected.Group("/papers")
 		{
@@ -62,14 +96,14 @@ func SetupRoutes(r *gin.Engine) {
 			exam.GET("/", controllers.GetExams)
 			exam.GET("/student", controllers.GetStudentExams) // 学生考试列表
 			exam.GET("/:id", controllers.GetExam)
-			exam.POST("/:id/start", controllers.StartExam) // 学生开始考试
+			exam.POST("/:id/start", middleware.RequirePermission(services.PermExamTake), controllers.StartExam) // 学生开始考试
 			exam.GET("/:id/result", controllers.GetExamResult) // 考试结果
-			exam.GET("/:id/analysis", controllers.GetExamAnalysis) // 考试分析
+			exam.GET("/:id/analysis", middleware.RequirePermission(services.PermGradeRead), controllers.GetExamAnalysis) // 考试分析
 		}
 
 		// 答题相关（学生专用）
 		answer := protected.Group("/answers")
-		answer.Use(middleware.RoleMiddleware(models.RoleStudent))
+		answer.Use(middleware.RequirePermission(services.PermExamTake))
 		{
 			answer.POST("/exam/:exam_id", controllers.SubmitAnswer) // 提交单个答案
 			answer.POST("/exam/:exam_id/submit", controllers.SubmitExam) // 提交整份试卷
@@ -86,7 +120,7 @@ func SetupRoutes(r *gin.Engine) {
 
 		// 练习相关（学生专用）
 		practice := protected.Group("/practice")
-		practice.Use(middleware.RoleMiddleware(models.RoleStudent))
+		practice.Use(middleware.RequirePermission(services.PermPracticeUse))
 		{
 			practice.GET("/recommendations", controllers.GetPracticeRecommendations) // 获取推荐练习
 			practice.POST("/start", controllers.StartPractice)                      // 开始练习
@@ -101,74 +135,205 @@ func SetupRoutes(r *gin.Engine) {
 		// 统计相关
 		stats := protected.Group("/stats")
 		{
-			stats.GET("/student", middleware.RoleMiddleware(models.RoleStudent), controllers.GetStudentStats)
-			stats.GET("/teacher", middleware.RoleMiddleware(models.RoleTeacher), controllers.GetTeacherStats)
+			stats.GET("/student", middleware.RequirePermission(services.PermExamTake), controllers.GetStudentStats)
+			stats.GET("/teacher", middleware.RequirePermission(services.PermGradeRead), controllers.GetTeacherStats)
+		}
+
+		// 导入任务（题目、用户批量导入），按任务类型校验权限
+		importJobs := protected.Group("/import-jobs")
+		{
+			importJobs.GET("", controllers.GetImportJobs)
+			importJobs.GET("/:id", controllers.GetImportJob)
+			importJobs.GET("/:id/report", controllers.DownloadImportReport) // 下载导入报告（csv或json）
 		}
 	}
 
 	// 管理员专用路由
 	admin := api.Group("/admin")
-	admin.Use(middleware.AuthMiddleware())
-	admin.Use(middleware.TenantMiddleware()) // 添加租户中间件
-	admin.Use(middleware.RoleMiddleware(models.RoleAdmin))
+	admin.Use(middleware.TenantMiddleware()) // 租户中间件需在认证之前，token按租户校验
+	admin.Use(middleware.AuthMiddleware()) // 各接口按权限校验，内置管理员角色拥有全部权限
 	{
 		// 用户管理
 		users := admin.Group("/users")
 		{
-			users.GET("/", controllers.GetUsers)
-			users.GET("/:id", controllers.GetUser)
-			users.POST("/", controllers.CreateUser)
-			users.PUT("/:id", controllers.UpdateUser)
-			users.DELETE("/:id", controllers.DeleteUser)
-			users.PUT("/:id/password", controllers.ResetPassword)
-			users.POST("/import", controllers.BatchImportUsers)
+			users.GET("/", middleware.RequirePermission(services.PermUserRead), controllers.GetUsers)
+			users.GET("/:id", middleware.RequirePermission(services.PermUserRead), controllers.GetUser)
+			users.POST("/", middleware.RequirePermission(services.PermUserWrite), controllers.CreateUser)
+			users.PUT("/:id", middleware.RequirePermission(services.PermUserWrite), controllers.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(services.PermUserWrite), controllers.DeleteUser)
+			users.PUT("/:id/password", middleware.RequirePermission(services.PermUserWrite), controllers.ResetPassword)
+			users.DELETE("/:id/2fa", middleware.RequirePermission(services.PermUserWrite), controllers.ResetUserTwoFactor) // 重置两步验证
+			users.POST("/import", middleware.RequirePermission(services.PermUserWrite), controllers.BatchImportUsers)
+			users.PUT("/:id/role", middleware.RequirePermission(services.PermRoleManage), controllers.AssignUserRole) // 分配自定义角色
+			users.POST("/:id/impersonate", middleware.RequirePermission(services.PermUserImpersonate), controllers.StartImpersonation) // 模拟用户登录
+		}
+
+		// 模拟登录审计日志
+		admin.GET("/impersonations", middleware.RequirePermission(services.PermUserImpersonate), controllers.GetImpersonationLogs)
+
+		// 审计日志
+		admin.GET("/audit-logs", middleware.RequirePermission(services.PermAuditRead), controllers.GetAuditLogs)
+		admin.GET("/audit-logs/export", middleware.RequirePermission(services.PermAuditRead), controllers.ExportAuditLogs) // 导出CSV
+
+		// 角色与权限
+		roles := admin.Group("/roles")
+		roles.Use(middleware.RequirePermission(services.PermRoleManage))
+		{
+			roles.GET("/", controllers.GetRoles) // 内置角色和自定义角色
+			roles.GET("/permissions", controllers.GetPermissionCatalog) // 全部可分配的权限
+			roles.POST("/", controllers.CreateRole)
+			roles.PUT("/:id", controllers.UpdateRole)
+			roles.DELETE("/:id", controllers.DeleteRole)
 		}
 
 		// 科目管理
 		subjects := admin.Group("/subjects")
+		subjects.Use(middleware.RequirePermission(services.PermSubjectWrite))
 		{
 			subjects.POST("/", controllers.CreateSubject)
 			subjects.PUT("/:id", controllers.UpdateSubject)
 			subjects.DELETE("/:id", controllers.DeleteSubject)
+			subjects.GET("/:id/reviewers", controllers.GetSubjectReviewers)    // 科目审核人
+			subjects.PUT("/:id/reviewers", controllers.UpdateSubjectReviewers) // 设置科目审核人
 		}
 
+		// 旧格式选择题选项的转换报告（GET试运行）和执行转换
+		admin.GET("/question-options/migration", middleware.RequirePermission(services.PermContentManage), controllers.GetQuestionOptionMigration)
+		admin.POST("/question-options/migration", middleware.RequirePermission(services.PermContentManage), controllers.RunQuestionOptionMigration)
+
 		// 仪表板统计
-		admin.GET("/dashboard", controllers.GetDashboardStats)
+		admin.GET("/dashboard", middleware.RequirePermission(services.PermDashboardRead), controllers.GetDashboardStats)
+
+		// 租户数据迁移
+		tenant := admin.Group("/tenant")
+		tenant.Use(middleware.RequirePermission(services.PermTenantManage))
+		{
+			tenant.GET("/export", controllers.ExportTenant)
+			tenant.POST("/import", controllers.ImportTenant)
+			tenant.POST("/deletion-jobs", controllers.CreateTenantDeletionJob)
+			tenant.GET("/deletion-jobs/:id", controllers.GetTenantDeletionJob)
+		}
+
+		// 数据保留策略
+		retention := admin.Group("/retention")
+		retention.Use(middleware.RequirePermission(services.PermRetentionManage))
+		{
+			retention.GET("/policies", controllers.GetRetentionPolicies)
+			retention.POST("/policies", controllers.CreateRetentionPolicy)
+			retention.PUT("/policies/:id", controllers.UpdateRetentionPolicy)
+			retention.DELETE("/policies/:id", controllers.DeleteRetentionPolicy)
+			retention.POST("/run", controllers.RunRetentionPolicies)
+		}
+
+		// 登录安全
+		security := admin.Group("/security")
+		security.Use(middleware.RequirePermission(services.PermSecurityManage))
+		{
+			security.GET("/policy", controllers.GetSecurityPolicy)
+			security.PUT("/policy", controllers.UpdateSecurityPolicy)
+			security.GET("/lockouts", controllers.GetLoginLockouts)
+			security.DELETE("/lockouts", controllers.ClearLoginLockout)
+			security.GET("/login-attempts", controllers.GetLoginAttempts)
+
+			// LDAP/Active Directory 登录
+			security.GET("/ldap", controllers.GetLDAPConfig)
+			security.PUT("/ldap", controllers.UpdateLDAPConfig)
+			security.POST("/ldap/test", controllers.TestLDAPConfig) // 测试连接和组映射
+
+			// OpenID Connect 身份提供方
+			security.GET("/oidc", controllers.GetOIDCProviderConfigs)
+			security.POST("/oidc", controllers.CreateOIDCProvider)
+			security.PUT("/oidc/:id", controllers.UpdateOIDCProvider)
+			security.DELETE("/oidc/:id", controllers.DeleteOIDCProvider)
+		}
 	}
 
 	// 教师专用路由
 	teacher := api.Group("/teacher")
-	teacher.Use(middleware.AuthMiddleware())
-	teacher.Use(middleware.TenantMiddleware()) // 添加租户中间件
-	teacher.Use(middleware.RoleMiddleware(models.RoleTeacher, models.RoleAdmin)) // 管理员也可以访问
+	teacher.Use(middleware.TenantMiddleware()) // 租户中间件需在认证之前，token按租户校验
+	teacher.Use(middleware.AuthMiddleware()) // 各接口按权限校验
 	{
 		// 题目管理
 		questions := teacher.Group("/questions")
+		questions.Use(middleware.RequirePermission(services.PermQuestionWrite))
 		{
 			questions.POST("/", controllers.CreateQuestion)
 			questions.PUT("/:id", controllers.UpdateQuestion)
 			questions.DELETE("/:id", controllers.DeleteQuestion)
 			questions.POST("/import", controllers.BatchImportQuestions)
+			questions.POST("/import/file", controllers.ImportQuestionsFromFile)           // 从Excel、CSV、Word、文本、Moodle XML、GIFT、QTI文件导入，支持dry_run预览
+			questions.GET("/import/template", controllers.DownloadQuestionImportTemplate) // 下载导入模板
+			questions.GET("/export", controllers.ExportQuestions)                         // 导出题目（XLSX、CSV、JSON、QTI 2.1、Moodle XML、GIFT）
+
+			questions.GET("/:id/sharing", controllers.GetQuestionSharing)    // 共享设置
+			questions.PUT("/:id/sharing", controllers.UpdateQuestionSharing) // 修改可见范围和协作者
+
+			questions.GET("/:id/revisions", controllers.GetQuestionRevisions)         // 版本历史
+			questions.GET("/:id/revisions/diff", controllers.DiffQuestionRevisions)   // 比较两个版本
+			questions.GET("/:id/revisions/:version", controllers.GetQuestionRevision) // 指定版本的内容
+
+			questions.GET("/reviews", controllers.GetQuestionReviewQueue) // 审核队列
+			questions.POST("/:id/review", controllers.ReviewQuestion)     // 提交审核、审核、发布、归档
+			questions.GET("/:id/reviews", controllers.GetQuestionReviews) // 审核记录
+		}
+
+		// 附件管理
+		attachments := teacher.Group("/attachments")
+		attachments.Use(middleware.RequirePermission(services.PermQuestionWrite))
+		{
+			attachments.POST("/", controllers.UploadAttachment)
+			attachments.GET("/", controllers.GetAttachments)
+			attachments.GET("/usage", controllers.GetAttachmentUsage) // 空间使用情况
+			attachments.DELETE("/:id", controllers.DeleteAttachment)
 		}
 
 		// 试卷管理
 		papers := teacher.Group("/papers")
+		papers.Use(middleware.RequirePermission(services.PermPaperWrite))
 		{
 			papers.POST("/", controllers.CreatePaper)
 			papers.POST("/auto", controllers.AutoCreatePaper) // 自动组卷
 			papers.PUT("/:id", controllers.UpdatePaper)
 			papers.DELETE("/:id", controllers.DeletePaper)
+			papers.GET("/:id/sharing", controllers.GetPaperSharing)
+			papers.PUT("/:id/sharing", controllers.UpdatePaperSharing)
 		}
 
 		// 考试管理
 		exams := teacher.Group("/exams")
 		{
-			exams.POST("/", controllers.CreateExam)
-			exams.PUT("/:id", controllers.UpdateExam)
-			exams.DELETE("/:id", controllers.DeleteExam)
+			exams.POST("/", middleware.RequirePermission(services.PermExamCreate), controllers.CreateExam)
+			exams.PUT("/:id", middleware.RequirePermission(services.PermExamUpdate), controllers.UpdateExam)
+			exams.DELETE("/:id", middleware.RequirePermission(services.PermExamUpdate), controllers.DeleteExam)
+			exams.GET("/:id/sharing", middleware.RequirePermission(services.PermExamCreate, services.PermExamUpdate), controllers.GetExamSharing)
+			exams.PUT("/:id/sharing", middleware.RequirePermission(services.PermExamUpdate), controllers.UpdateExamSharing)
+		}
+
+		// 班级管理
+		classes := teacher.Group("/classes")
+		classes.Use(middleware.RequirePermission(services.PermClassManage))
+		{
+			classes.GET("/", controllers.GetClasses)
+			classes.POST("/", controllers.CreateClass)
+			classes.GET("/:id", controllers.GetClass)
+			classes.PUT("/:id", controllers.UpdateClass)
+			classes.DELETE("/:id", controllers.DeleteClass)
+			classes.DELETE("/:id/members/:user_id", controllers.RemoveClassMember)
+		}
+
+		// 注册邀请码
+		invites := teacher.Group("/invites")
+		invites.Use(middleware.RequirePermission(services.PermInviteManage))
+		{
+			invites.GET("/", controllers.GetInviteCodes)
+			invites.POST("/", controllers.CreateInviteCode)
+			invites.DELETE("/:id", controllers.DeactivateInviteCode)
 		}
 	}
 
+	// 附件内容，通过临时地址中的签名授权，供 <img>、<audio> 等无法携带令牌的标签使用
+	api.GET("/files/:id", controllers.ServeAttachmentFile)
+
 	// 健康检查
 	api.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
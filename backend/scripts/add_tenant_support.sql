@@ -11,6 +11,9 @@ CREATE TABLE IF NOT EXISTS tenants (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- 租户的题目附件配额（MB），0表示使用 ATTACHMENT_QUOTA_MB
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS attachment_quota_mb INTEGER NOT NULL DEFAULT 0;
+
 -- 插入默认演示租户
 INSERT INTO tenants (id, name, code, description, is_active) 
 VALUES (100, '演示租户', 'demo', '默认演示租户', true)
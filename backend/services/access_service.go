@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+
+	"gorm.io/gorm"
+)
+
+// 可共享的资源类型
+const (
+	ResourceQuestion = "question"
+	ResourcePaper    = "paper"
+	ResourceExam     = "exam"
+)
+
+// resourceTables 资源类型对应的表名
+var resourceTables = map[string]string{
+	ResourceQuestion: "questions",
+	ResourcePaper:    "papers",
+	ResourceExam:     "exams",
+}
+
+var (
+	ErrInvalidVisibility = errors.New("visibility只能为private、shared、department或tenant")
+	ErrInvalidShareUser  = errors.New("只能共享给本租户的教师或管理员")
+	ErrPrivateWithShares = errors.New("私有资源不能共享给其他用户")
+)
+
+// Actor 当前操作者
+type Actor struct {
+	TenantID   uint
+	UserID     uint
+	Role       models.UserRole
+	RoleID     *uint
+	Department string
+}
+
+// ShareEntry 共享设置中的一项
+type ShareEntry struct {
+	UserID  uint `json:"user_id" binding:"required"`
+	CanEdit bool `json:"can_edit"` // 协作编辑者可以修改内容，但不能修改共享设置或删除
+}
+
+// AccessService 题目、试卷和考试的所有权与共享
+type AccessService struct {
+	permissionService *PermissionService
+}
+
+// NewAccessService 创建访问控制服务实例
+func NewAccessService() *AccessService {
+	return &AccessService{permissionService: NewPermissionService()}
+}
+
+// IsValidVisibility 判断可见范围是否合法
+func IsValidVisibility(v models.Visibility) bool {
+	switch v {
+	case models.VisibilityPrivate, models.VisibilityShared, models.VisibilityDepartment, models.VisibilityTenant:
+		return true
+	}
+	return false
+}
+
+// manageAll 可以查看和管理租户内所有人的内容
+func (as *AccessService) manageAll(actor Actor) bool {
+	return as.permissionService.HasPermission(actor.TenantID, actor.Role, actor.RoleID, PermContentManage)
+}
+
+// manageDepartment 可以查看和管理本院系成员的内容
+func (as *AccessService) manageDepartment(actor Actor) bool {
+	return actor.Department != "" &&
+		as.permissionService.HasPermission(actor.TenantID, actor.Role, actor.RoleID, PermContentManageDepartment)
+}
+
+func (as *AccessService) ownerDepartment(tenantID, ownerID uint) string {
+	var owner models.User
+	if err := utils.WithTenant(database.DB, tenantID).Select("department").First(&owner, ownerID).Error; err != nil {
+		return ""
+	}
+	return owner.Department
+}
+
+func (as *AccessService) findShare(actor Actor, resourceType string, resourceID uint) (*models.ResourceShare, bool) {
+	var share models.ResourceShare
+	result := utils.WithTenant(database.DB, actor.TenantID).
+		Where("resource_type = ? AND resource_id = ? AND user_id = ?", resourceType, resourceID, actor.UserID).
+		Limit(1).Find(&share)
+	return &share, result.Error == nil && result.RowsAffected > 0
+}
+
+// ScopeVisible 将列表查询限定为操作者可以查看的资源
+func (as *AccessService) ScopeVisible(query *gorm.DB, actor Actor, resourceType string) *gorm.DB {
+	if as.manageAll(actor) {
+		return query
+	}
+	table := resourceTables[resourceType]
+
+	conds := fmt.Sprintf("%[1]s.created_by = ? OR %[1]s.visibility = ? OR %[1]s.id IN (SELECT resource_id FROM resource_shares WHERE resource_type = ? AND user_id = ?)", table)
+	args := []interface{}{actor.UserID, models.VisibilityTenant, resourceType, actor.UserID}
+	if actor.Department != "" {
+		if as.manageDepartment(actor) {
+			conds += fmt.Sprintf(" OR %s.created_by IN (SELECT id FROM users WHERE tenant_id = ? AND department = ?)", table)
+			args = append(args, actor.TenantID, actor.Department)
+		} else {
+			conds += fmt.Sprintf(" OR (%[1]s.visibility = ? AND %[1]s.created_by IN (SELECT id FROM users WHERE tenant_id = ? AND department = ?))", table)
+			args = append(args, models.VisibilityDepartment, actor.TenantID, actor.Department)
+		}
+	}
+	return query.Where("("+conds+")", args...)
+}
+
+// CanView 判断操作者能否查看资源
+func (as *AccessService) CanView(actor Actor, resourceType string, resourceID, ownerID uint, visibility models.Visibility) bool {
+	if ownerID == actor.UserID || visibility == models.VisibilityTenant || as.manageAll(actor) {
+		return true
+	}
+	if _, ok := as.findShare(actor, resourceType, resourceID); ok {
+		return true
+	}
+	if actor.Department != "" && (visibility == models.VisibilityDepartment || as.manageDepartment(actor)) {
+		return as.ownerDepartment(actor.TenantID, ownerID) == actor.Department
+	}
+	return false
+}
+
+// CanEdit 判断操作者能否修改资源内容：创建者、协作编辑者和内容管理者
+func (as *AccessService) CanEdit(actor Actor, resourceType string, resourceID, ownerID uint) bool {
+	if ownerID == actor.UserID || as.manageAll(actor) {
+		return true
+	}
+	if share, ok := as.findShare(actor, resourceType, resourceID); ok && share.CanEdit {
+		return true
+	}
+	return as.manageDepartment(actor) && as.ownerDepartment(actor.TenantID, ownerID) == actor.Department
+}
+
+// CanManage 判断操作者能否删除资源或修改共享设置：创建者和内容管理者，协作编辑者不可以
+func (as *AccessService) CanManage(actor Actor, ownerID uint) bool {
+	if ownerID == actor.UserID || as.manageAll(actor) {
+		return true
+	}
+	return as.manageDepartment(actor) && as.ownerDepartment(actor.TenantID, ownerID) == actor.Department
+}
+
+// GetShares 资源的共享列表
+func (as *AccessService) GetShares(tenantID uint, resourceType string, resourceID uint) []models.ResourceShare {
+	var shares []models.ResourceShare
+	utils.WithTenant(database.DB, tenantID).Preload("User").
+		Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("id ASC").Find(&shares)
+	for i := range shares {
+		if shares[i].User != nil {
+			shares[i].User.Password = ""
+		}
+	}
+	return shares
+}
+
+// SetSharing 更新资源的可见范围和共享列表（整体替换）
+func (as *AccessService) SetSharing(actor Actor, resourceType string, resourceID, ownerID uint, visibility models.Visibility, entries []ShareEntry) error {
+	if !IsValidVisibility(visibility) {
+		return ErrInvalidVisibility
+	}
+	if visibility == models.VisibilityPrivate && len(entries) > 0 {
+		return ErrPrivateWithShares
+	}
+
+	userIDs := make([]uint, 0, len(entries))
+	for _, e := range entries {
+		if e.UserID != ownerID {
+			userIDs = append(userIDs, e.UserID)
+		}
+	}
+	if len(userIDs) > 0 {
+		var count int64
+		utils.WithTenant(database.DB, actor.TenantID).Model(&models.User{}).
+			Where("id IN ? AND role IN ?", userIDs, []models.UserRole{models.RoleTeacher, models.RoleAdmin}).
+			Count(&count)
+		if int(count) != len(uniqueIDs(userIDs)) {
+			return ErrInvalidShareUser
+		}
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(resourceTables[resourceType]).Where("id = ? AND tenant_id = ?", resourceID, actor.TenantID).
+			Update("visibility", visibility).Error; err != nil {
+			return err
+		}
+		if err := utils.WithTenant(tx, actor.TenantID).Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+			Delete(&models.ResourceShare{}).Error; err != nil {
+			return err
+		}
+		seen := make(map[uint]bool)
+		for _, e := range entries {
+			if e.UserID == ownerID || seen[e.UserID] {
+				continue
+			}
+			seen[e.UserID] = true
+			share := models.ResourceShare{
+				TenantID:     actor.TenantID,
+				ResourceType: resourceType,
+				ResourceID:   resourceID,
+				UserID:       e.UserID,
+				CanEdit:      e.CanEdit,
+				CreatedBy:    actor.UserID,
+			}
+			if err := tx.Create(&share).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteShares 删除资源时清理共享记录
+func (as *AccessService) DeleteShares(tenantID uint, resourceType string, resourceID uint) {
+	utils.WithTenant(database.DB, tenantID).Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Delete(&models.ResourceShare{})
+}
+
+// ResourceTable 资源类型对应的表名，未知类型返回空字符串
+func ResourceTable(resourceType string) string {
+	return resourceTables[resourceType]
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool)
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
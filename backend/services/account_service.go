@@ -0,0 +1,259 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeEmailVerify   = "email_verify"
+
+	PasswordResetTokenTTL = time.Hour
+	EmailVerifyTokenTTL   = 48 * time.Hour
+
+	// 同一用户两次发送找回密码邮件的最小间隔
+	passwordResetThrottle = time.Minute
+	passwordResetSentKey  = "password_reset_sent"
+)
+
+var (
+	ErrAccountTokenInvalid = errors.New("链接无效或已被使用")
+	ErrAccountTokenExpired = errors.New("链接已过期，请重新申请")
+)
+
+// accountTokenPayload 签名令牌中携带的信息
+type accountTokenPayload struct {
+	Purpose     string `json:"p"`
+	UserID      uint   `json:"u"`
+	TenantID    uint   `json:"t"`
+	ExpiresAt   int64  `json:"e"`
+	Fingerprint string `json:"f"` // 绑定用户当前状态，状态变化后令牌自动失效
+}
+
+// AccountService 找回密码与邮箱验证
+type AccountService struct {
+	sessionService *SessionService
+	cacheService   *CacheService
+}
+
+// NewAccountService 创建账号服务实例
+func NewAccountService() *AccountService {
+	return &AccountService{
+		sessionService: NewSessionService(),
+		cacheService:   NewCacheService(),
+	}
+}
+
+func accountTokenMAC(purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.GetConfig().JWTSecret))
+	mac.Write([]byte(purpose + "." + payload))
+	return mac.Sum(nil)
+}
+
+// signAccountToken 生成 base64(payload).base64(hmac) 格式的签名令牌
+func signAccountToken(p accountTokenPayload) string {
+	data, _ := json.Marshal(p)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(accountTokenMAC(p.Purpose, payload))
+}
+
+// parseAccountToken 校验签名、用途和有效期
+func parseAccountToken(token, purpose string) (*accountTokenPayload, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrAccountTokenInvalid
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, accountTokenMAC(purpose, payload)) {
+		return nil, ErrAccountTokenInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrAccountTokenInvalid
+	}
+	var p accountTokenPayload
+	if err := json.Unmarshal(data, &p); err != nil || p.Purpose != purpose {
+		return nil, ErrAccountTokenInvalid
+	}
+	if time.Now().Unix() > p.ExpiresAt {
+		return nil, ErrAccountTokenExpired
+	}
+	return &p, nil
+}
+
+// passwordFingerprint 由当前密码哈希派生，密码修改后重置令牌即失效（一次性）
+func passwordFingerprint(user *models.User) string {
+	sum := sha256.Sum256([]byte(TokenPurposePasswordReset + ":" + user.Password))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// emailFingerprint 绑定待验证的邮箱地址
+func emailFingerprint(email string) string {
+	sum := sha256.Sum256([]byte(TokenPurposeEmailVerify + ":" + strings.ToLower(email)))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+func frontendLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(config.GetConfig().FrontendURL, "/"), path, url.QueryEscape(token))
+}
+
+// sendAsync 异步发送邮件，避免响应时间暴露账号是否存在
+// 发送器在发送时按配置创建：服务实例在包初始化阶段创建，此时配置尚未加载
+func (as *AccountService) sendAsync(msg MailMessage) {
+	mailer := NewMailer()
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("发送邮件到 %s 失败: %v", msg.To, err)
+		}
+	}()
+}
+
+// SendPasswordReset 向该邮箱对应的账号发送重置密码链接；账号不存在时静默返回
+func (as *AccountService) SendPasswordReset(tenantID uint, email string) {
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).Where("email = ? AND is_active = ? AND auth_provider = ?", email, true, models.AuthProviderLocal).First(&user).Error; err != nil {
+		return
+	}
+
+	// 限制发送频率，防止邮件轰炸
+	throttleKey := fmt.Sprintf("%s:%d", passwordResetSentKey, user.ID)
+	var sent bool
+	if storeGet(tenantID, throttleKey, &sent) {
+		return
+	}
+	storeSet(tenantID, throttleKey, true, passwordResetThrottle)
+
+	token := signAccountToken(accountTokenPayload{
+		Purpose:     TokenPurposePasswordReset,
+		UserID:      user.ID,
+		TenantID:    tenantID,
+		ExpiresAt:   time.Now().Add(PasswordResetTokenTTL).Unix(),
+		Fingerprint: passwordFingerprint(&user),
+	})
+
+	as.sendAsync(MailMessage{
+		To:      user.Email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，您好：\n\n我们收到了重置您账号（%s）密码的请求。请在%d分钟内打开以下链接设置新密码：\n\n%s\n\n如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。\n",
+			user.Name, user.Username, int(PasswordResetTokenTTL.Minutes()), frontendLink("/reset-password", token)),
+	})
+}
+
+// ResetPassword 使用重置令牌设置新密码，成功后撤销该用户的所有会话
+func (as *AccountService) ResetPassword(token, newPassword string) (*models.User, error) {
+	p, err := parseAccountToken(token, TokenPurposePasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, p.TenantID).First(&user, p.UserID).Error; err != nil || !user.IsActive {
+		return nil, ErrAccountTokenInvalid
+	}
+	if !hmac.Equal([]byte(p.Fingerprint), []byte(passwordFingerprint(&user))) {
+		return nil, ErrAccountTokenInvalid
+	}
+
+	if err := CheckNewPassword(&user, newPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = string(hashedPassword)
+	if err := RecordPasswordChange(database.DB, &user, false); err != nil {
+		return nil, err
+	}
+
+	// 能收到重置邮件说明邮箱属于本人，同时标记为已验证
+	user.EmailVerified = true
+	database.DB.Model(&user).Update("email_verified", true)
+
+	as.sessionService.EndUserSessions(p.TenantID, &user)
+	return &user, nil
+}
+
+// SendEmailVerification 发送邮箱验证链接：有待确认的新邮箱时发往新邮箱，否则发往当前未验证的邮箱
+func (as *AccountService) SendEmailVerification(user *models.User) bool {
+	target := user.PendingEmail
+	if target == "" {
+		if user.EmailVerified || user.Email == "" {
+			return false
+		}
+		target = user.Email
+	}
+
+	token := signAccountToken(accountTokenPayload{
+		Purpose:     TokenPurposeEmailVerify,
+		UserID:      user.ID,
+		TenantID:    user.TenantID,
+		ExpiresAt:   time.Now().Add(EmailVerifyTokenTTL).Unix(),
+		Fingerprint: emailFingerprint(target),
+	})
+
+	as.sendAsync(MailMessage{
+		To:      target,
+		Subject: "验证您的邮箱",
+		Body: fmt.Sprintf("%s，您好：\n\n请在%d小时内打开以下链接，确认 %s 是您账号（%s）的邮箱：\n\n%s\n\n如果这不是您本人的操作，请忽略本邮件。\n",
+			user.Name, int(EmailVerifyTokenTTL.Hours()), target, user.Username, frontendLink("/verify-email", token)),
+	})
+	return true
+}
+
+// VerifyEmail 校验邮箱验证令牌；验证的是待确认的新邮箱时，同时完成邮箱变更
+func (as *AccountService) VerifyEmail(token string) (*models.User, error) {
+	p, err := parseAccountToken(token, TokenPurposeEmailVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, p.TenantID).First(&user, p.UserID).Error; err != nil {
+		return nil, ErrAccountTokenInvalid
+	}
+
+	oldUsername := user.Username
+	switch {
+	case user.PendingEmail != "" && p.Fingerprint == emailFingerprint(user.PendingEmail):
+		var count int64
+		database.DB.Model(&models.User{}).Where("email = ? AND id <> ?", user.PendingEmail, user.ID).Count(&count)
+		if count > 0 {
+			return nil, ErrEmailTaken
+		}
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+	case p.Fingerprint == emailFingerprint(user.Email):
+	default:
+		return nil, ErrAccountTokenInvalid
+	}
+	user.EmailVerified = true
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"email":          user.Email,
+		"pending_email":  user.PendingEmail,
+		"email_verified": true,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	as.cacheService.InvalidateUserCache(p.TenantID, user.ID, oldUsername)
+	return &user, nil
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAttachmentEmpty    = errors.New("文件为空")
+	ErrAttachmentType     = errors.New("只支持图片（PNG、JPEG、GIF、WebP）、音频（MP3、WAV、OGG、M4A）、视频（MP4、WebM）和PDF文件")
+	ErrAttachmentQuota    = errors.New("附件空间不足，请删除不再使用的附件或联系管理员调整配额")
+	ErrAttachmentInUse    = errors.New("附件正在被题目引用，不能删除")
+	ErrAttachmentNotFound = errors.New("引用的附件不存在")
+)
+
+// attachmentRefPattern 题目内容中引用附件的写法：attachment://ID，如 ![示意图](attachment://12)
+var attachmentRefPattern = regexp.MustCompile(`attachment://(\d+)`)
+
+// attachmentContentTypes 允许上传的文件类型（按文件内容识别），SVG等可能包含脚本的类型不允许
+var attachmentContentTypes = map[string]bool{
+	"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true,
+	"audio/mpeg": true, "audio/wave": true, "audio/ogg": true, "audio/mp4": true,
+	"video/mp4": true, "video/webm": true,
+	"application/pdf": true,
+}
+
+// attachmentExtensionTypes 无法按内容识别或需要区分音频、视频时按扩展名确定类型
+var attachmentExtensionTypes = map[string]string{
+	".mp3": "audio/mpeg", ".m4a": "audio/mp4", ".ogg": "audio/ogg", ".oga": "audio/ogg", ".wav": "audio/wave",
+}
+
+// attachmentURLTTL 附件临时地址的最短有效期，同一小时内生成的地址相同，便于浏览器缓存
+const attachmentURLTTL = time.Hour
+
+// AttachmentService 附件上传、去重、配额和访问控制
+type AttachmentService struct {
+	storage AttachmentStorage
+}
+
+// NewAttachmentService 创建附件服务实例
+func NewAttachmentService() *AttachmentService {
+	return &AttachmentService{storage: NewAttachmentStorage()}
+}
+
+// MaxAttachmentSize 单个附件的大小上限（字节）
+func MaxAttachmentSize() int64 {
+	return int64(config.GetConfig().AttachmentMaxSizeMB) << 20
+}
+
+// detectAttachmentType 按文件内容识别类型，音频按扩展名区分，返回空字符串表示不支持
+func detectAttachmentType(filename string, data []byte) string {
+	contentType := strings.SplitN(http.DetectContentType(data), ";", 2)[0]
+	if byExt, ok := attachmentExtensionTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		switch contentType {
+		case "application/octet-stream", "application/ogg", "video/mp4", byExt:
+			// MP3没有ID3标签时无法识别；OGG和M4A按内容识别为通用容器
+			contentType = byExt
+		}
+	}
+	if contentType == "application/ogg" {
+		contentType = "audio/ogg"
+	}
+	if !attachmentContentTypes[contentType] {
+		return ""
+	}
+	return contentType
+}
+
+// Usage 租户已使用的附件空间和配额（字节）
+func (as *AttachmentService) Usage(tenantID uint) (int64, int64) {
+	var used int64
+	utils.WithTenant(database.DB, tenantID).Model(&models.Attachment{}).Select("COALESCE(SUM(size), 0)").Scan(&used)
+
+	quotaMB := config.GetConfig().AttachmentQuotaMB
+	var tenant models.Tenant
+	if database.DB.Migrator().HasTable(&models.Tenant{}) {
+		if err := database.DB.Select("attachment_quota_mb").First(&tenant, tenantID).Error; err == nil && tenant.AttachmentQuotaMB > 0 {
+			quotaMB = tenant.AttachmentQuotaMB
+		}
+	}
+	return used, int64(quotaMB) << 20
+}
+
+// Upload 保存上传的附件。租户内已有相同内容的附件时直接返回该附件（第二个返回值为true），不重复存储也不占用配额
+func (as *AttachmentService) Upload(actor Actor, filename string, data []byte) (*models.Attachment, bool, error) {
+	if len(data) == 0 {
+		return nil, false, ErrAttachmentEmpty
+	}
+	if int64(len(data)) > MaxAttachmentSize() {
+		return nil, false, fmt.Errorf("文件大小不能超过%dMB", config.GetConfig().AttachmentMaxSizeMB)
+	}
+	contentType := detectAttachmentType(filename, data)
+	if contentType == "" {
+		return nil, false, ErrAttachmentType
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if existing, ok := as.findByHash(actor.TenantID, hash); ok {
+		return existing, true, nil
+	}
+
+	used, quota := as.Usage(actor.TenantID)
+	if used+int64(len(data)) > quota {
+		return nil, false, ErrAttachmentQuota
+	}
+
+	attachment := models.Attachment{
+		TenantID:    actor.TenantID,
+		Hash:        hash,
+		StorageKey:  attachmentStorageKey(actor.TenantID, hash),
+		Filename:    filepath.Base(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		CreatedBy:   actor.UserID,
+	}
+	if err := as.storage.Put(attachment.StorageKey, data, contentType); err != nil {
+		return nil, false, fmt.Errorf("保存附件失败: %w", err)
+	}
+	if err := database.DB.Create(&attachment).Error; err != nil {
+		// 同时上传相同内容时，另一请求已创建记录
+		if existing, ok := as.findByHash(actor.TenantID, hash); ok {
+			return existing, true, nil
+		}
+		return nil, false, err
+	}
+	return &attachment, false, nil
+}
+
+// attachmentStorageKey 附件在存储中的路径：租户ID/哈希前两位/哈希
+func attachmentStorageKey(tenantID uint, hash string) string {
+	return fmt.Sprintf("%d/%s/%s", tenantID, hash[:2], hash)
+}
+
+func (as *AttachmentService) findByHash(tenantID uint, hash string) (*models.Attachment, bool) {
+	var attachment models.Attachment
+	result := utils.WithTenant(database.DB, tenantID).Where("hash = ?", hash).Limit(1).Find(&attachment)
+	return &attachment, result.Error == nil && result.RowsAffected > 0
+}
+
+// Open 读取附件内容
+func (as *AttachmentService) Open(attachment *models.Attachment) (io.ReadCloser, error) {
+	return as.storage.Open(attachment.StorageKey)
+}
+
+// Delete 删除未被题目引用的附件
+func (as *AttachmentService) Delete(attachment *models.Attachment) error {
+	var refs int64
+	utils.WithTenant(database.DB, attachment.TenantID).Model(&models.QuestionAttachment{}).Where("attachment_id = ?", attachment.ID).Count(&refs)
+	if refs > 0 {
+		return ErrAttachmentInUse
+	}
+	if err := database.DB.Delete(attachment).Error; err != nil {
+		return err
+	}
+	return as.storage.Delete(attachment.StorageKey)
+}
+
+// DeleteTenantFiles 删除租户的全部附件文件，数据库记录由租户删除任务按表删除
+func (as *AttachmentService) DeleteTenantFiles(tenantID uint) error {
+	var attachments []models.Attachment
+	if err := utils.WithTenant(database.DB, tenantID).Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := as.storage.Delete(attachment.StorageKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CanRead 判断操作者能否读取附件：上传者和内容管理者，或附件被操作者可以查看的题目引用；
+// 学生只能读取当前可以看到的题目中的附件，见 studentVisibleAttachments
+func (as *AttachmentService) CanRead(actor Actor, attachment *models.Attachment) bool {
+	return len(as.Readable(actor, []models.Attachment{*attachment})) == 1
+}
+
+// Readable 过滤出操作者可以读取的附件，批量获取时只计算一次学生可见的附件
+func (as *AttachmentService) Readable(actor Actor, attachments []models.Attachment) []models.Attachment {
+	access := NewAccessService()
+	var studentVisible map[uint]bool
+	if actor.Role == models.RoleStudent {
+		studentVisible = studentVisibleAttachments(actor)
+	}
+	result := make([]models.Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		if access.CanManage(actor, attachment.CreatedBy) || studentVisible[attachment.ID] {
+			result = append(result, attachment)
+			continue
+		}
+		if actor.Role == models.RoleStudent {
+			continue
+		}
+		var questions []models.Question
+		utils.WithTenant(database.DB, actor.TenantID).
+			Where("id IN (?)", utils.WithTenant(database.DB, actor.TenantID).Model(&models.QuestionAttachment{}).
+				Select("question_id").Where("attachment_id = ?", attachment.ID)).
+			Select("id", "created_by", "visibility").Find(&questions)
+		for _, question := range questions {
+			if access.CanView(actor, ResourceQuestion, question.ID, question.CreatedBy, question.Visibility) {
+				result = append(result, attachment)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// studentVisibleAttachments 学生当前可以看到的附件：练习中的已发布题目，以及自己正在进行或已完成的考试中的题目（按组卷时的版本）。
+// 只在解析中引用的附件要等答案公布后才能读取：练习中已作答该题，或考试已完成
+func studentVisibleAttachments(actor Actor) map[uint]bool {
+	visible := make(map[uint]bool)
+	add := func(texts ...string) {
+		for _, id := range AttachmentRefs(texts...) {
+			visible[id] = true
+		}
+	}
+
+	var questions []models.Question
+	utils.WithTenant(database.DB, actor.TenantID).
+		Where("id IN (?)", utils.WithTenant(database.DB, actor.TenantID).Model(&models.QuestionAttachment{}).Select("question_id")).
+		Where("status = ? AND parent_id IS NULL AND type <> ?", models.QuestionPublished, models.Material).
+		Select("id", "content", "options", "explanation").Find(&questions)
+	if len(questions) > 0 {
+		var answered []uint
+		utils.WithTenant(database.DB, actor.TenantID).Model(&models.PracticeAnswer{}).
+			Where("practice_record_id IN (?)", utils.WithTenant(database.DB, actor.TenantID).Model(&models.PracticeRecord{}).
+				Select("id").Where("user_id = ?", actor.UserID)).
+			Distinct().Pluck("question_id", &answered)
+		released := make(map[uint]bool, len(answered))
+		for _, id := range answered {
+			released[id] = true
+		}
+		for _, question := range questions {
+			add(question.Content, question.Options)
+			if released[question.ID] {
+				add(question.Explanation)
+			}
+		}
+	}
+
+	var records []models.ExamRecord
+	utils.WithTenant(database.DB, actor.TenantID).Preload("Exam").
+		Where("student_id = ? AND status IN ?", actor.UserID, []models.ExamRecordStatus{models.ExamInProgress, models.ExamCompleted}).
+		Find(&records)
+	// 同一试卷可能用于多场考试，任一场已完成即公布解析
+	papers := make(map[uint]bool)
+	for _, record := range records {
+		if record.Exam.PaperID != 0 {
+			papers[record.Exam.PaperID] = papers[record.Exam.PaperID] || record.Status == models.ExamCompleted
+		}
+	}
+	for paperID, showExplanation := range papers {
+		paperQuestions, err := LoadPaperQuestions(database.DB, actor.TenantID, paperID)
+		if err != nil {
+			continue
+		}
+		for _, question := range paperQuestions {
+			add(question.Content, question.Options)
+			if showExplanation {
+				add(question.Explanation)
+			}
+		}
+	}
+	return visible
+}
+
+func attachmentSignature(tenantID, attachmentID uint, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(config.GetConfig().JWTSecret))
+	fmt.Fprintf(mac, "attachment.%d.%d.%d", tenantID, attachmentID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedAttachmentURL 生成附件的临时访问地址，供无法携带令牌的 <img>、<audio> 等标签使用
+func SignedAttachmentURL(attachment *models.Attachment) string {
+	hour := int64(time.Hour / time.Second)
+	expires := (time.Now().Add(attachmentURLTTL).Unix()/hour + 1) * hour
+	return fmt.Sprintf("/api/v1/files/%d?tenant=%d&expires=%d&signature=%s",
+		attachment.ID, attachment.TenantID, expires, attachmentSignature(attachment.TenantID, attachment.ID, expires))
+}
+
+// VerifyAttachmentSignature 校验附件临时地址的签名和有效期
+func VerifyAttachmentSignature(tenantID, attachmentID uint, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(attachmentSignature(tenantID, attachmentID, expires)))
+}
+
+// AttachmentRefs 提取文本中引用的附件ID，去重并排序
+func AttachmentRefs(texts ...string) []uint {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, text := range texts {
+		for _, match := range attachmentRefPattern.FindAllStringSubmatch(text, -1) {
+			id, err := strconv.ParseUint(match[1], 10, 32)
+			if err != nil || id == 0 || seen[uint(id)] {
+				continue
+			}
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// RemapAttachmentRefs 按映射改写文本中的附件引用，没有对应附件的引用改为 attachment://missing，不再指向任何附件
+func RemapAttachmentRefs(text string, remap func(uint) (uint, bool)) string {
+	return attachmentRefPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		id, err := strconv.ParseUint(strings.TrimPrefix(ref, "attachment://"), 10, 32)
+		if err == nil {
+			if newID, ok := remap(uint(id)); ok {
+				return fmt.Sprintf("attachment://%d", newID)
+			}
+		}
+		return "attachment://missing"
+	})
+}
+
+// questionAttachmentRefs 题干、选项和解析中引用的附件
+func questionAttachmentRefs(question models.Question) []uint {
+	return AttachmentRefs(question.Content, question.Options, question.Explanation)
+}
+
+// CheckQuestionAttachments 校验题目引用的附件都属于该租户
+func CheckQuestionAttachments(db *gorm.DB, tenantID uint, question models.Question) error {
+	ids := questionAttachmentRefs(question)
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []uint
+	if err := utils.WithTenant(db, tenantID).Model(&models.Attachment{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return err
+	}
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			return fmt.Errorf("%w：%d", ErrAttachmentNotFound, id)
+		}
+	}
+	return nil
+}
+
+// SyncQuestionAttachments 按题目当前内容重新记录其引用的附件
+func SyncQuestionAttachments(db *gorm.DB, tenantID uint, question models.Question) error {
+	if err := utils.WithTenant(db, tenantID).Where("question_id = ?", question.ID).Delete(&models.QuestionAttachment{}).Error; err != nil {
+		return err
+	}
+	for _, id := range questionAttachmentRefs(question) {
+		ref := models.QuestionAttachment{TenantID: tenantID, QuestionID: question.ID, AttachmentID: id}
+		if err := db.Create(&ref).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteQuestionAttachments 删除题目时清理其附件引用（附件本身保留，可单独删除）
+func DeleteQuestionAttachments(db *gorm.DB, tenantID uint, questionIDs []uint) error {
+	if len(questionIDs) == 0 {
+		return nil
+	}
+	return utils.WithTenant(db, tenantID).Where("question_id IN ?", questionIDs).Delete(&models.QuestionAttachment{}).Error
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"online-exam-system/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrAttachmentObjectNotFound 存储中没有该附件文件
+var ErrAttachmentObjectNotFound = errors.New("附件文件不存在")
+
+// AttachmentStorage 附件文件存储接口，可按 ATTACHMENT_DRIVER 切换实现。key 为“租户ID/哈希前两位/哈希”
+type AttachmentStorage interface {
+	Put(key string, data []byte, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// NewAttachmentStorage 根据配置创建附件存储
+func NewAttachmentStorage() AttachmentStorage {
+	cfg := config.GetConfig()
+	switch cfg.AttachmentDriver {
+	case "s3":
+		return &S3AttachmentStorage{
+			Endpoint:  strings.TrimRight(cfg.S3Endpoint, "/"),
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Client:    &http.Client{Timeout: 60 * time.Second},
+		}
+	default:
+		return &LocalAttachmentStorage{Dir: cfg.AttachmentDir}
+	}
+}
+
+// LocalAttachmentStorage 将附件保存在本地目录
+type LocalAttachmentStorage struct {
+	Dir string
+}
+
+func (s *LocalAttachmentStorage) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+func (s *LocalAttachmentStorage) Put(key string, data []byte, contentType string) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免读取到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalAttachmentStorage) Open(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAttachmentObjectNotFound
+	}
+	return file, err
+}
+
+func (s *LocalAttachmentStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// S3AttachmentStorage 将附件保存在S3兼容的对象存储中（AWS S3、MinIO等），使用路径风格的地址和V4签名
+type S3AttachmentStorage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func (s *S3AttachmentStorage) Put(key string, data []byte, contentType string) error {
+	resp, err := s.do(http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError(resp)
+	}
+	return nil
+}
+
+func (s *S3AttachmentStorage) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrAttachmentObjectNotFound
+	}
+	defer resp.Body.Close()
+	return nil, s.responseError(resp)
+}
+
+func (s *S3AttachmentStorage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s.responseError(resp)
+}
+
+func (s *S3AttachmentStorage) responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("对象存储返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// do 发送带 AWS Signature Version 4 签名的请求
+func (s *S3AttachmentStorage) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	if s.Endpoint == "" || s.Bucket == "" {
+		return nil, fmt.Errorf("未配置S3_ENDPOINT或S3_BUCKET")
+	}
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("S3_ENDPOINT格式错误: %v", err)
+	}
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	canonicalURI := strings.TrimRight(endpoint.EscapedPath(), "/") + "/" + url.PathEscape(s.Bucket) + "/" + strings.Join(segments, "/")
+
+	req, err := http.NewRequest(method, endpoint.Scheme+"://"+endpoint.Host+canonicalURI, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		"",
+		"host:" + endpoint.Host + "\nx-amz-content-sha256:" + payloadHex + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 审计动作
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditImpersonationEnd     = "impersonation.end"
+
+	AuditLogin          = "auth.login"
+	AuditLoginFailed    = "auth.login_failed"
+	AuditPasswordChange = "auth.password_change"
+	AuditPasswordReset  = "auth.password_reset" // 通过邮件链接重置密码
+
+	AuditUserCreate        = "user.create"
+	AuditUserUpdate        = "user.update"
+	AuditUserDelete        = "user.delete"
+	AuditUserImport        = "user.import"
+	AuditUserRoleAssign    = "user.role_assign"
+	AuditUserPasswordReset = "user.password_reset" // 管理员重置密码
+	AuditUserTwoFactorOff  = "user.2fa_reset"
+
+	AuditRoleCreate = "role.create"
+	AuditRoleUpdate = "role.update"
+	AuditRoleDelete = "role.delete"
+
+	AuditQuestionCreate = "question.create"
+	AuditQuestionUpdate = "question.update"
+	AuditQuestionDelete = "question.delete"
+	AuditQuestionImport = "question.import"
+	AuditPaperCreate    = "paper.create"
+	AuditPaperUpdate    = "paper.update"
+	AuditPaperDelete    = "paper.delete"
+	AuditExamCreate     = "exam.create"
+	AuditExamUpdate     = "exam.update"
+	AuditExamDelete     = "exam.delete"
+
+	AuditAttachmentUpload = "attachment.upload"
+	AuditAttachmentDelete = "attachment.delete"
+
+	AuditQuestionOptionMigrate = "question.option_migrate" // 旧格式的选择题选项转换为选项表
+
+	AuditQuestionReview   = "question.review"   // 提交审核、审核通过、驳回、发布、归档等状态变化
+	AuditSubjectReviewers = "subject.reviewers" // 修改科目审核人
+
+	AuditExamGrade = "exam_record.grade" // 考试成绩计算或修改
+)
+
+// auditRedactedFields 快照中隐去的敏感字段（模型中的敏感字段大多不参与JSON序列化，这里兜底）
+var auditRedactedFields = map[string]bool{
+	"password":       true,
+	"bind_password":  true,
+	"client_secret":  true,
+	"secret":         true,
+	"token":          true,
+	"recovery_codes": true,
+}
+
+// auditDiffIgnoredFields 不参与差异比较的字段
+var auditDiffIgnoredFields = map[string]bool{"updated_at": true}
+
+// AuditChange 单个字段的变更
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditFilter 审计日志查询条件
+type AuditFilter struct {
+	Action         string // 精确匹配，以 . 结尾时按前缀匹配（如 question.）
+	UserID         string
+	ImpersonatorID string
+	ResourceType   string
+	ResourceID     string
+	IP             string
+	From           *time.Time
+	To             *time.Time
+}
+
+// AuditService 审计日志，只追加不修改
+type AuditService struct{}
+
+// NewAuditService 创建审计日志服务实例
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// Record 写入一条审计日志，写入失败只记录到系统日志，不影响业务请求
+func (as *AuditService) Record(entry *models.AuditLog) {
+	entry.ID = 0
+	if err := database.DB.Create(entry).Error; err != nil {
+		log.Printf("写入审计日志失败(租户 %d, 动作 %s): %v", entry.TenantID, entry.Action, err)
+	}
+}
+
+// Query 按条件构建审计日志查询
+func (as *AuditService) Query(tenantID uint, filter AuditFilter) *gorm.DB {
+	query := utils.WithTenant(database.DB, tenantID).Model(&models.AuditLog{})
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, ".") {
+			query = query.Where("action LIKE ?", filter.Action+"%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.ImpersonatorID != "" {
+		query = query.Where("impersonator_id = ?", filter.ImpersonatorID)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// auditCSVHeader 审计日志CSV导出的列
+var auditCSVHeader = []string{
+	"id", "created_at", "user_id", "username", "impersonator_id", "action", "resource_type", "resource_id",
+	"method", "path", "status_code", "ip", "user_agent", "changes", "before", "after", "detail",
+}
+
+// ExportCSV 按条件将审计日志以CSV格式写入w，按时间顺序分批读取，返回导出的记录数
+func (as *AuditService) ExportCSV(tenantID uint, filter AuditFilter, w io.Writer) (int, error) {
+	// 写入UTF-8 BOM，便于Excel正确识别中文
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return 0, err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(auditCSVHeader); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var logs []models.AuditLog
+	err := as.Query(tenantID, filter).Order("id ASC").FindInBatches(&logs, 500, func(tx *gorm.DB, batch int) error {
+		for _, entry := range logs {
+			impersonatorID, statusCode := "", ""
+			if entry.ImpersonatorID != nil {
+				impersonatorID = strconv.FormatUint(uint64(*entry.ImpersonatorID), 10)
+			}
+			if entry.StatusCode != 0 {
+				statusCode = strconv.Itoa(entry.StatusCode)
+			}
+			if err := cw.Write([]string{
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.Format(time.RFC3339),
+				strconv.FormatUint(uint64(entry.UserID), 10),
+				entry.Username,
+				impersonatorID,
+				entry.Action,
+				entry.ResourceType,
+				entry.ResourceID,
+				entry.Method,
+				entry.Path,
+				statusCode,
+				entry.IP,
+				entry.UserAgent,
+				entry.Changes,
+				entry.Before,
+				entry.After,
+				entry.Detail,
+			}); err != nil {
+				return err
+			}
+			count++
+		}
+		cw.Flush()
+		return cw.Error()
+	}).Error
+	if err != nil {
+		return count, err
+	}
+	cw.Flush()
+	return count, cw.Error()
+}
+
+// ApplyAuditDiff 写入变更前后的快照和字段差异，新建时before为nil，删除时after为nil
+func ApplyAuditDiff(entry *models.AuditLog, before, after interface{}) {
+	beforeSnapshot := auditSnapshot(before)
+	afterSnapshot := auditSnapshot(after)
+	if beforeSnapshot != nil {
+		entry.Before = AuditDetail(beforeSnapshot)
+	}
+	if afterSnapshot != nil {
+		entry.After = AuditDetail(afterSnapshot)
+	}
+	if beforeSnapshot != nil && afterSnapshot != nil {
+		if changes := auditChanges(beforeSnapshot, afterSnapshot); len(changes) > 0 {
+			entry.Changes = AuditDetail(changes)
+		}
+	}
+}
+
+// auditSnapshot 将资源转换为扁平的字段表，去掉关联对象并隐去敏感字段
+func auditSnapshot(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	for key, value := range fields {
+		if isNestedValue(value) {
+			delete(fields, key)
+			continue
+		}
+		if auditRedactedFields[key] {
+			fields[key] = "******"
+		}
+	}
+	return fields
+}
+
+// isNestedValue 判断字段是否为关联对象或关联对象列表
+func isNestedValue(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// auditChanges 比较两个快照，返回发生变化的字段
+func auditChanges(before, after map[string]interface{}) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+	compare := func(key string) {
+		if auditDiffIgnoredFields[key] {
+			return
+		}
+		if _, done := changes[key]; !done && !reflect.DeepEqual(before[key], after[key]) {
+			changes[key] = AuditChange{From: before[key], To: after[key]}
+		}
+	}
+	for key := range before {
+		compare(key)
+	}
+	for key := range after {
+		compare(key)
+	}
+	return changes
+}
+
+// AuditDetail 将附加信息序列化为审计日志的detail字段
+func AuditDetail(detail interface{}) string {
+	if detail == nil {
+		return ""
+	}
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	// ErrUserNotFound 认证源中没有该用户，可以继续尝试下一个认证源
+	ErrUserNotFound = errors.New("用户不存在")
+	// ErrAuthSourceUnavailable 认证源暂时不可用（如目录服务器连接失败）
+	ErrAuthSourceUnavailable = errors.New("认证服务暂时不可用")
+)
+
+// Credentials 登录时提交的凭据
+type Credentials struct {
+	TenantID uint
+	Username string
+	Password string
+}
+
+// Authenticator 可插拔的身份认证源
+type Authenticator interface {
+	Name() string
+	// Authenticate 验证凭据并返回对应的本地用户；密码错误时尽量同时返回用户，便于记录登录失败
+	Authenticate(creds Credentials) (*models.User, error)
+}
+
+// IsExternalAccount 账号由LDAP或OIDC创建，不使用本地密码
+func IsExternalAccount(user *models.User) bool {
+	return user.AuthProvider != "" && user.AuthProvider != models.AuthProviderLocal
+}
+
+// LocalAuthenticator 使用本地数据库中的bcrypt密码哈希认证
+type LocalAuthenticator struct{}
+
+func (a *LocalAuthenticator) Name() string {
+	return models.AuthProviderLocal
+}
+
+func (a *LocalAuthenticator) Authenticate(creds Credentials) (*models.User, error) {
+	// 从数据库读取用户（缓存中的用户不包含密码哈希，不能用于验证）
+	var user models.User
+	if err := utils.WithTenant(database.DB, creds.TenantID).Where("username = ? AND is_active = ?", creds.Username, true).First(&user).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	// 外部账号只能通过目录服务或身份提供方认证
+	if IsExternalAccount(&user) {
+		return &user, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
+		return &user, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// AuthService 按租户配置组合认证源
+type AuthService struct {
+	local *LocalAuthenticator
+}
+
+// NewAuthService 创建认证服务实例
+func NewAuthService() *AuthService {
+	return &AuthService{local: &LocalAuthenticator{}}
+}
+
+// Authenticators 返回租户启用的认证源，按尝试顺序排列
+func (as *AuthService) Authenticators(tenantID uint) []Authenticator {
+	cfg := GetLDAPConfig(tenantID)
+	if !cfg.Enabled {
+		return []Authenticator{as.local}
+	}
+	return []Authenticator{NewLDAPAuthenticator(cfg), as.local}
+}
+
+// Authenticate 依次尝试各认证源：目录中没有该用户或目录不可用时，按配置回退到本地账号
+func (as *AuthService) Authenticate(creds Credentials) (*models.User, error) {
+	if creds.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	authenticators := as.Authenticators(creds.TenantID)
+	for i, authenticator := range authenticators {
+		user, err := authenticator.Authenticate(creds)
+		if err == nil {
+			return user, nil
+		}
+
+		last := i == len(authenticators)-1
+		switch {
+		case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrAuthSourceUnavailable):
+			if errors.Is(err, ErrAuthSourceUnavailable) {
+				log.Printf("租户 %d 认证源 %s 不可用: %v", creds.TenantID, authenticator.Name(), err)
+			}
+			noFallback := false
+			if ldap, ok := authenticator.(*LDAPAuthenticator); ok {
+				noFallback = !ldap.config.AllowLocalFallback
+			}
+			if noFallback && errors.Is(err, ErrAuthSourceUnavailable) {
+				return nil, err
+			}
+			if noFallback || last {
+				return nil, ErrInvalidCredentials
+			}
+		default:
+			return user, err
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"online-exam-system/cache"
+	"online-exam-system/config"
 	"online-exam-system/database"
 	"online-exam-system/models"
 	"online-exam-system/utils"
@@ -26,7 +27,6 @@ const (
 	SubjectCacheTTL  = 2 * time.Hour     // 科目信息缓存2小时
 	ListCacheTTL     = 10 * time.Minute  // 列表缓存10分钟
 	UserCacheTTL     = 2 * time.Hour     // 用户信息缓存2小时
-	TokenCacheTTL    = 24 * time.Hour    // Token缓存24小时（与JWT过期时间一致）
 )
 
 // CacheService 缓存服务
@@ -72,6 +72,11 @@ func (cs *CacheService) GetQuestionWithCache(tenantID uint, questionID uint) (*m
 	if err := utils.WithTenant(database.DB, tenantID).Preload("Subject").Preload("Creator").First(&question, questionID).Error; err != nil {
 		return nil, err
 	}
+	loaded := []models.Question{question}
+	if err := AttachQuestionOptions(database.DB, tenantID, loaded); err != nil {
+		return nil, err
+	}
+	question = loaded[0]
 
 	// 存入缓存
 	cache.SetWithTenant(tenantID, cacheKey, question, QuestionCacheTTL)
@@ -108,7 +113,9 @@ func (cs *CacheService) GetPaperWithQuestionsCache(tenantID uint, paperID uint)
 
 	// 从数据库获取题目
 	if !questionsCached {
-		if err := utils.WithTenant(database.DB, tenantID).Preload("Subject").Model(&paper).Association("Questions").Find(&questions); err != nil {
+		// 按组卷时的版本，材料题后紧跟其子题
+		var err error
+		if questions, err = LoadPaperQuestions(database.DB, tenantID, paperID); err != nil {
 			return nil, nil, err
 		}
 		// 缓存题目列表
@@ -263,15 +270,24 @@ func (cs *CacheService) InvalidateUserCache(tenantID uint, userID uint, username
 }
 
 // SetTokenCache 缓存token信息（用于快速验证）
-func (cs *CacheService) SetTokenCache(tenantID uint, tokenHash string, userID uint, username string, role models.UserRole) {
+func (cs *CacheService) SetTokenCache(tenantID uint, tokenHash string, userID uint, username string, role models.UserRole, sessionVersion uint, expiresAt time.Time) {
 	cacheKey := fmt.Sprintf("%s:%s", TokenCachePrefix, tokenHash)
 	tokenInfo := map[string]interface{}{
 		"user_id":  userID,
 		"username": username,
 		"role":     role,
 		"tenant_id": tenantID,
+		"session_version": sessionVersion,
+	}
+	// 缓存时间不超过访问令牌剩余有效期，避免缓存命中时绕过过期校验
+	ttl := time.Until(expiresAt)
+	if maxTTL := config.GetConfig().AccessTokenTTL; ttl > maxTTL {
+		ttl = maxTTL
+	}
+	if ttl <= 0 {
+		return
 	}
-	cache.SetWithTenant(tenantID, cacheKey, tokenInfo, TokenCacheTTL)
+	cache.SetWithTenant(tenantID, cacheKey, tokenInfo, ttl)
 }
 
 // GetTokenCache 从缓存获取token信息
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 导入任务类型
+const (
+	ImportKindQuestions = "questions"
+	ImportKindUsers     = "users"
+)
+
+// 导入报告中每行的结果
+const (
+	ImportRowCreated     = "created"
+	ImportRowUpdated     = "updated"      // 按ID更新了已有数据
+	ImportRowSkipped     = "skipped"      // 已存在相同数据，未重复导入
+	ImportRowFailed      = "failed"       // 校验或写入失败
+	ImportRowNotImported = "not_imported" // 本行无误，但整体导入因其他行失败而回滚
+)
+
+var (
+	ErrInvalidImportMode    = errors.New("导入模式只能为all_or_nothing或best_effort")
+	ErrIdempotencyConflict  = errors.New("该幂等键已用于内容不同的导入")
+	ErrImportReportNotReady = errors.New("导入任务尚未完成")
+	errImportRowFailed      = errors.New("导入行失败")
+)
+
+// importJobReusableStatuses 相同幂等键再次提交时直接返回的任务状态，失败的任务可以重新提交
+var importJobReusableStatuses = []models.ImportJobStatus{models.ImportPending, models.ImportRunning, models.ImportCompleted}
+
+// importReportCSVHeader 导入报告CSV的列
+var importReportCSVHeader = []string{"row", "key", "status", "resource_id", "field", "reason"}
+
+// ImportRowError 单行的校验或写入错误
+type ImportRowError struct {
+	Row    int    `json:"row"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ImportFieldError 写入时发现的字段错误（如用户名已被占用）
+type ImportFieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ImportFieldError) Error() string {
+	return e.Reason
+}
+
+// NewImportFieldError 创建字段错误
+func NewImportFieldError(field, reason string) error {
+	return &ImportFieldError{Field: field, Reason: reason}
+}
+
+// ImportOutcome 单行写入的结果
+type ImportOutcome struct {
+	Skipped    bool
+	Reason     string      // 跳过的原因
+	ResourceID uint        // 新建或更新的资源ID
+	Before     interface{} // 更新前的资源，新建时为nil
+	Snapshot   interface{} // 新建或更新后的资源，用于审计日志
+}
+
+// ImportRowTask 导入任务中的一行：预校验错误和写入操作
+type ImportRowTask struct {
+	Row    int
+	Key    string           // 报告中标识该行的内容（用户名、题目标题等）
+	Errors []ImportRowError // 预校验错误，非空时该行失败
+	Apply  func(tx *gorm.DB) (ImportOutcome, error)
+}
+
+// ImportRowResult 报告中单行的结果
+type ImportRowResult struct {
+	Row        int              `json:"row"`
+	Key        string           `json:"key"`
+	Status     string           `json:"status"`
+	ResourceID uint             `json:"resource_id,omitempty"`
+	Errors     []ImportRowError `json:"errors,omitempty"`
+}
+
+// ImportReport 导入任务报告
+type ImportReport struct {
+	JobID      uint                   `json:"job_id"`
+	Kind       string                 `json:"kind"`
+	Mode       models.ImportMode      `json:"mode"`
+	Status     models.ImportJobStatus `json:"status"`
+	Total      int                    `json:"total"`
+	Created    int                    `json:"created"`
+	Updated    int                    `json:"updated"`
+	Skipped    int                    `json:"skipped"`
+	Failed     int                    `json:"failed"`
+	Rows       []ImportRowResult      `json:"rows"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+}
+
+// ImportChange 导入任务中新建或更新的资源，提交后由调用方记录审计日志，Before为nil时为新建
+type ImportChange struct {
+	ResourceID uint
+	Before     interface{}
+	After      interface{}
+}
+
+// ImportService 批量导入任务
+type ImportService struct{}
+
+// NewImportService 创建导入任务服务实例
+func NewImportService() *ImportService {
+	return &ImportService{}
+}
+
+// IsValidImportMode 判断导入模式是否有效
+func IsValidImportMode(mode models.ImportMode) bool {
+	return mode == models.ImportAllOrNothing || mode == models.ImportBestEffort
+}
+
+// ImportPayloadDigest 计算导入内容的摘要，用于幂等判断
+func ImportPayloadDigest(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(strconv.Itoa(len(part))))
+		h.Write([]byte{0})
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateJob 创建导入任务；相同幂等键已有未失败的任务时返回该任务（existing为true），内容不同时返回 ErrIdempotencyConflict
+func (is *ImportService) CreateJob(job *models.ImportJob) (existing bool, err error) {
+	if job.IdempotencyKey == "" {
+		job.IdempotencyKey = job.PayloadDigest
+	}
+
+	var previous models.ImportJob
+	result := utils.WithTenant(database.DB, job.TenantID).
+		Where("kind = ? AND idempotency_key = ? AND status IN ?", job.Kind, job.IdempotencyKey, importJobReusableStatuses).
+		Order("id DESC").Limit(1).Find(&previous)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		if previous.PayloadDigest != job.PayloadDigest {
+			return false, ErrIdempotencyConflict
+		}
+		*job = previous
+		return true, nil
+	}
+
+	job.Status = models.ImportPending
+	return false, database.DB.Create(job).Error
+}
+
+// Run 执行导入任务并保存报告，返回已提交的变更
+func (is *ImportService) Run(job *models.ImportJob, tasks []ImportRowTask) []ImportChange {
+	startedAt := time.Now()
+	job.Status = models.ImportRunning
+	job.StartedAt = &startedAt
+	database.DB.Save(job)
+
+	report := ImportReport{
+		JobID:     job.ID,
+		Kind:      job.Kind,
+		Mode:      job.Mode,
+		Total:     len(tasks),
+		StartedAt: startedAt,
+		Rows:      make([]ImportRowResult, len(tasks)),
+	}
+	hasErrors := false
+	for i, task := range tasks {
+		report.Rows[i] = ImportRowResult{Row: task.Row, Key: task.Key}
+		if len(task.Errors) > 0 {
+			report.Rows[i].Status = ImportRowFailed
+			report.Rows[i].Errors = task.Errors
+			hasErrors = true
+		}
+	}
+
+	var changes []ImportChange
+	var runErr error
+	if job.Mode == models.ImportAllOrNothing {
+		// 整体导入：预校验全部通过后在一个事务中写入，任何一行失败都回滚
+		if !hasErrors {
+			runErr = database.DB.Transaction(func(tx *gorm.DB) error {
+				for i, task := range tasks {
+					outcome, err := task.Apply(tx)
+					if err != nil {
+						report.Rows[i].Status = ImportRowFailed
+						report.Rows[i].Errors = importRowErrors(task.Row, err)
+						return errImportRowFailed
+					}
+					if applyImportOutcome(&report.Rows[i], outcome) {
+						changes = append(changes, ImportChange{ResourceID: outcome.ResourceID, Before: outcome.Before, After: outcome.Snapshot})
+					}
+				}
+				return nil
+			})
+			hasErrors = runErr != nil
+		}
+		if hasErrors {
+			changes = nil
+			for i := range report.Rows {
+				if report.Rows[i].Status != ImportRowFailed {
+					report.Rows[i].Status = ImportRowNotImported
+					report.Rows[i].ResourceID = 0
+				}
+			}
+		}
+	} else {
+		// 尽力导入：每行单独一个事务
+		for i, task := range tasks {
+			if len(task.Errors) > 0 {
+				continue
+			}
+			var outcome ImportOutcome
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				var err error
+				outcome, err = task.Apply(tx)
+				return err
+			})
+			if err != nil {
+				report.Rows[i].Status = ImportRowFailed
+				report.Rows[i].Errors = importRowErrors(task.Row, err)
+				continue
+			}
+			if applyImportOutcome(&report.Rows[i], outcome) {
+				changes = append(changes, ImportChange{ResourceID: outcome.ResourceID, Before: outcome.Before, After: outcome.Snapshot})
+			}
+		}
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case ImportRowCreated:
+			report.Created++
+		case ImportRowUpdated:
+			report.Updated++
+		case ImportRowSkipped:
+			report.Skipped++
+		case ImportRowFailed:
+			report.Failed++
+		}
+	}
+	report.Status = models.ImportCompleted
+	if job.Mode == models.ImportAllOrNothing && hasErrors {
+		report.Status = models.ImportFailed
+		job.Error = fmt.Sprintf("有%d行未通过校验或写入失败，已全部回滚", report.Failed)
+		if runErr != nil && !errors.Is(runErr, errImportRowFailed) {
+			job.Error = "导入失败，已全部回滚: " + runErr.Error()
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	reportJSON, _ := json.Marshal(report)
+	job.Report = string(reportJSON)
+	job.Status = report.Status
+	job.CreatedCount = report.Created
+	job.UpdatedCount = report.Updated
+	job.SkippedCount = report.Skipped
+	job.FailedCount = report.Failed
+	job.FinishedAt = &report.FinishedAt
+	if err := database.DB.Save(job).Error; err != nil {
+		log.Printf("保存导入任务 %d 失败: %v", job.ID, err)
+	}
+	return changes
+}
+
+// applyImportOutcome 将写入结果记入报告，返回是否新建或更新了资源
+func applyImportOutcome(row *ImportRowResult, outcome ImportOutcome) bool {
+	if outcome.Skipped {
+		row.Status = ImportRowSkipped
+		row.ResourceID = outcome.ResourceID
+		row.Errors = []ImportRowError{{Row: row.Row, Reason: outcome.Reason}}
+		return false
+	}
+	row.Status = ImportRowCreated
+	if outcome.Before != nil {
+		row.Status = ImportRowUpdated
+	}
+	row.ResourceID = outcome.ResourceID
+	return true
+}
+
+// importRowErrors 将写入错误转换为行错误
+func importRowErrors(row int, err error) []ImportRowError {
+	var fieldErr *ImportFieldError
+	if errors.As(err, &fieldErr) {
+		return []ImportRowError{{Row: row, Field: fieldErr.Field, Reason: fieldErr.Reason}}
+	}
+	return []ImportRowError{{Row: row, Reason: "写入失败: " + err.Error()}}
+}
+
+// GetReport 读取导入任务的报告，任务未完成时返回错误
+func (is *ImportService) GetReport(job *models.ImportJob) (*ImportReport, error) {
+	if job.Report == "" {
+		return nil, ErrImportReportNotReady
+	}
+	var report ImportReport
+	if err := json.Unmarshal([]byte(job.Report), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// WriteImportReportCSV 以CSV格式写出导入报告，每个错误一行，无错误的行单独一行
+func WriteImportReportCSV(w io.Writer, report *ImportReport) error {
+	// 写入UTF-8 BOM，便于Excel正确识别中文
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(importReportCSVHeader); err != nil {
+		return err
+	}
+	for _, row := range report.Rows {
+		resourceID := ""
+		if row.ResourceID != 0 {
+			resourceID = strconv.FormatUint(uint64(row.ResourceID), 10)
+		}
+		base := []string{strconv.Itoa(row.Row), row.Key, row.Status, resourceID}
+		if len(row.Errors) == 0 {
+			if err := cw.Write(append(base, "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, rowErr := range row.Errors {
+			if err := cw.Write(append(append([]string{}, base...), rowErr.Field, rowErr.Reason)); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 邀请码字符集（去掉了易混淆的 0/O、1/I/L）
+const inviteCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+const inviteCodeLength = 10
+
+var (
+	ErrInviteInvalid   = errors.New("邀请码无效")
+	ErrInviteExpired   = errors.New("邀请码已过期")
+	ErrInviteExhausted = errors.New("邀请码使用次数已达上限")
+	ErrUsernameTaken   = errors.New("用户名已存在")
+	ErrEmailTaken      = errors.New("邮箱已存在")
+)
+
+// InviteRegistration 通过邀请码注册时提交的信息
+type InviteRegistration struct {
+	Code     string
+	Username string
+	Email    string
+	Password string
+	Name     string
+}
+
+// InviteService 班级邀请码与自助注册
+type InviteService struct{}
+
+// NewInviteService 创建邀请码服务实例
+func NewInviteService() *InviteService {
+	return &InviteService{}
+}
+
+// GenerateInviteCode 生成随机邀请码
+func GenerateInviteCode() (string, error) {
+	buf := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = inviteCodeAlphabet[int(b)%len(inviteCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// NormalizeInviteCode 统一邀请码格式（忽略大小写和空白）
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// InviteLink 生成邀请注册链接
+func InviteLink(code string) string {
+	return fmt.Sprintf("%s/register?code=%s", strings.TrimRight(config.GetConfig().FrontendURL, "/"), url.QueryEscape(code))
+}
+
+// CreateInvite 创建邀请码，code由系统生成（极小概率冲突时重新生成）
+func (is *InviteService) CreateInvite(invite *models.InviteCode) error {
+	for attempt := 1; ; attempt++ {
+		code, err := GenerateInviteCode()
+		if err != nil {
+			return err
+		}
+		invite.ID = 0
+		invite.Code = code
+		err = database.DB.Create(invite).Error
+		if err == nil || attempt >= 5 {
+			return err
+		}
+	}
+}
+
+// FindUsableInvite 查找可用的邀请码（不区分租户，租户由邀请码决定）
+func (is *InviteService) FindUsableInvite(db *gorm.DB, code string) (*models.InviteCode, error) {
+	var invite models.InviteCode
+	if err := db.Preload("Class").Where("code = ?", NormalizeInviteCode(code)).First(&invite).Error; err != nil {
+		return nil, ErrInviteInvalid
+	}
+	if !invite.IsActive {
+		return nil, ErrInviteInvalid
+	}
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		return nil, ErrInviteExpired
+	}
+	if invite.MaxUses > 0 && invite.UsedCount >= invite.MaxUses {
+		return nil, ErrInviteExhausted
+	}
+	return &invite, nil
+}
+
+// Register 使用邀请码注册账号，自动归入邀请码所属租户和班级
+func (is *InviteService) Register(reg InviteRegistration) (*models.User, *models.InviteCode, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(reg.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	var invite *models.InviteCode
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invite, err = is.FindUsableInvite(tx, reg.Code)
+		if err != nil {
+			return err
+		}
+		if err := ValidatePassword(GetSecurityPolicy(invite.TenantID), reg.Password, reg.Username); err != nil {
+			return err
+		}
+
+		// 用户名和邮箱在全局唯一
+		var count int64
+		tx.Model(&models.User{}).Where("username = ?", reg.Username).Count(&count)
+		if count > 0 {
+			return ErrUsernameTaken
+		}
+		tx.Model(&models.User{}).Where("email = ?", reg.Email).Count(&count)
+		if count > 0 {
+			return ErrEmailTaken
+		}
+
+		// 条件更新保证并发注册不会超过使用次数上限
+		result := tx.Model(&models.InviteCode{}).
+			Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", invite.ID).
+			UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteExhausted
+		}
+
+		user = models.User{
+			TenantID: invite.TenantID,
+			Username: reg.Username,
+			Email:    reg.Email,
+			Password: string(hashedPassword),
+			Name:     reg.Name,
+			Role:     invite.Role,
+			IsActive: true,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// 注册时设置的密码同样记入历史，之后修改密码时不能重复使用
+		if err := RecordPasswordChange(tx, &user, false); err != nil {
+			return err
+		}
+
+		if invite.ClassID != nil {
+			member := models.ClassMember{
+				TenantID: invite.TenantID,
+				ClassID:  *invite.ClassID,
+				UserID:   user.ID,
+			}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, invite, nil
+}
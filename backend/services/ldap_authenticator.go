@@ -0,0 +1,336 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const ldapTimeout = 5 * time.Second
+
+var (
+	ErrLDAPNoRole         = errors.New("目录账号不属于任何允许登录的组")
+	ErrLDAPNotProvisioned = errors.New("该目录账号尚未开通，请联系管理员")
+	ErrAccountDisabled    = errors.New("账号已被停用")
+)
+
+// LDAPEntry 从目录中读取到的用户信息
+type LDAPEntry struct {
+	DN     string   `json:"dn"`
+	Email  string   `json:"email"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+// LDAPAuthenticator 通过LDAP/Active Directory绑定认证，首次登录时自动创建本地账号
+type LDAPAuthenticator struct {
+	config         models.LDAPConfig
+	sessionService *SessionService
+}
+
+// NewLDAPAuthenticator 按租户配置创建LDAP认证源
+func NewLDAPAuthenticator(cfg models.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{config: cfg, sessionService: NewSessionService()}
+}
+
+// DefaultLDAPConfig 租户未配置LDAP时的默认值（OpenLDAP风格的属性名）
+func DefaultLDAPConfig(tenantID uint) models.LDAPConfig {
+	return models.LDAPConfig{
+		TenantID:           tenantID,
+		UserFilter:         "(uid={username})",
+		EmailAttribute:     "mail",
+		NameAttribute:      "cn",
+		GroupAttribute:     "memberOf",
+		GroupFilter:        "(member={dn})",
+		DefaultRole:        models.RoleStudent,
+		AutoProvision:      true,
+		AllowLocalFallback: true,
+	}
+}
+
+// GetLDAPConfig 读取租户的LDAP配置，未配置时返回默认值
+func GetLDAPConfig(tenantID uint) models.LDAPConfig {
+	var cfg models.LDAPConfig
+	if err := utils.WithTenant(database.DB, tenantID).First(&cfg).Error; err != nil {
+		return DefaultLDAPConfig(tenantID)
+	}
+	return cfg
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return models.AuthProviderLDAP
+}
+
+// normalizeLDAPUsername 目录用户名不区分大小写，统一转为小写作为本地用户名
+func normalizeLDAPUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// connect 连接目录服务器，并用服务账号绑定（未配置时匿名）
+func (a *LDAPAuthenticator) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.config.InsecureSkipVerify}
+	if u, err := url.Parse(a.config.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(a.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthSourceUnavailable, err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: StartTLS失败: %v", ErrAuthSourceUnavailable, err)
+		}
+	}
+	if err := a.bindService(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) bindService(conn *ldap.Conn) error {
+	if a.config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return fmt.Errorf("%w: 服务账号绑定失败: %v", ErrAuthSourceUnavailable, err)
+	}
+	return nil
+}
+
+// Lookup 查找用户并用其密码绑定验证，返回目录中的用户信息
+func (a *LDAPAuthenticator) Lookup(username, password string) (*LDAPEntry, error) {
+	// 空密码会被目录当作匿名绑定而成功，必须拒绝
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(a.config.UserFilter, "{username}", ldap.EscapeFilter(username))
+	attributes := []string{a.config.EmailAttribute, a.config.NameAttribute, a.config.GroupAttribute}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false, filter, attributes, nil))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			log.Printf("LDAP过滤器 %s 匹配到多个条目，拒绝登录", filter)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: 查找用户失败: %v", ErrAuthSourceUnavailable, err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		log.Printf("LDAP过滤器 %s 匹配到多个条目，拒绝登录", filter)
+		return nil, ErrInvalidCredentials
+	}
+
+	item := result.Entries[0]
+	if err := conn.Bind(item.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAuthSourceUnavailable, err)
+	}
+
+	entry := &LDAPEntry{
+		DN:     item.DN,
+		Email:  item.GetAttributeValue(a.config.EmailAttribute),
+		Name:   item.GetAttributeValue(a.config.NameAttribute),
+		Groups: item.GetAttributeValues(a.config.GroupAttribute),
+	}
+
+	// 按组搜索成员关系（OpenLDAP未启用memberOf时使用），用服务账号重新绑定
+	if a.config.GroupBaseDN != "" {
+		if err := a.bindService(conn); err != nil {
+			return nil, err
+		}
+		groupFilter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(item.DN),
+			"{username}", ldap.EscapeFilter(username),
+		).Replace(a.config.GroupFilter)
+		groups, err := conn.Search(ldap.NewSearchRequest(
+			a.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(ldapTimeout.Seconds()), false, groupFilter, []string{"cn"}, nil))
+		if err != nil {
+			return nil, fmt.Errorf("%w: 查找用户组失败: %v", ErrAuthSourceUnavailable, err)
+		}
+		for _, group := range groups.Entries {
+			entry.Groups = append(entry.Groups, group.DN)
+		}
+	}
+
+	return entry, nil
+}
+
+// groupName 取组DN的第一个RDN值（如 CN=Teachers,OU=Groups → Teachers）
+func groupName(group string) string {
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return group
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
+
+// inGroups 判断用户是否属于配置中的任一组（分号分隔，可写完整DN或组名，不区分大小写）
+func inGroups(userGroups []string, configured string) bool {
+	for _, want := range strings.FieldsFunc(configured, func(r rune) bool { return r == ';' || r == '\n' }) {
+		want = strings.TrimSpace(want)
+		if want == "" {
+			continue
+		}
+		for _, group := range userGroups {
+			if strings.EqualFold(group, want) || strings.EqualFold(groupName(group), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MapRole 按组映射角色：管理员组优先，其次教师组，否则使用默认角色
+func (a *LDAPAuthenticator) MapRole(groups []string) (models.UserRole, error) {
+	switch {
+	case inGroups(groups, a.config.AdminGroups):
+		return models.RoleAdmin, nil
+	case inGroups(groups, a.config.TeacherGroups):
+		return models.RoleTeacher, nil
+	case a.config.DefaultRole != "":
+		return a.config.DefaultRole, nil
+	}
+	return "", ErrLDAPNoRole
+}
+
+func (a *LDAPAuthenticator) Authenticate(creds Credentials) (*models.User, error) {
+	username := normalizeLDAPUsername(creds.Username)
+	entry, err := a.Lookup(username, creds.Password)
+	if err != nil {
+		return nil, err
+	}
+	role, err := a.MapRole(entry.Groups)
+	if err != nil {
+		return nil, err
+	}
+	return a.provision(creds.TenantID, username, entry, role)
+}
+
+// provision 创建或同步本地账号：姓名、邮箱和角色以目录为准
+func (a *LDAPAuthenticator) provision(tenantID uint, username string, entry *LDAPEntry, role models.UserRole) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		if !a.config.AutoProvision {
+			return nil, ErrLDAPNotProvisioned
+		}
+		return a.createUser(tenantID, username, entry, role)
+	}
+
+	// 用户名全局唯一，其他租户已有同名账号时不能关联
+	if user.TenantID != tenantID {
+		return nil, ErrUsernameTaken
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+
+	updates := map[string]interface{}{
+		"auth_provider":        models.AuthProviderLDAP,
+		"role":                 role,
+		"must_change_password": false,
+	}
+	if user.Role != role {
+		// 目录映射的角色优先，取消与之不符的自定义角色
+		updates["role_id"] = nil
+	}
+	if entry.Name != "" {
+		updates["name"] = entry.Name
+	}
+	if entry.Email != "" && !strings.EqualFold(entry.Email, user.Email) && !emailInUse(entry.Email, user.ID) {
+		updates["email"] = entry.Email
+		updates["email_verified"] = true
+	}
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	// 目录中的组变化导致角色变化时，使该用户已签发的令牌失效
+	roleChanged := user.Role != role
+	if err := database.DB.First(&user, user.ID).Error; err != nil {
+		return nil, err
+	}
+	if roleChanged {
+		a.sessionService.EndUserSessions(tenantID, &user)
+	} else {
+		a.sessionService.cacheService.InvalidateUserCache(tenantID, user.ID, user.Username)
+	}
+	return &user, nil
+}
+
+func emailInUse(email string, exceptUserID uint) bool {
+	var count int64
+	database.DB.Model(&models.User{}).Where("email = ? AND id <> ?", email, exceptUserID).Count(&count)
+	return count > 0
+}
+
+func (a *LDAPAuthenticator) createUser(tenantID uint, username string, entry *LDAPEntry, role models.UserRole) (*models.User, error) {
+	// 目录账号不使用本地密码，保存一个无法登录的随机哈希
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword(random, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	email := entry.Email
+	verified := email != ""
+	if email == "" || emailInUse(email, 0) {
+		email = username + "@ldap.invalid"
+		verified = false
+	}
+	name := entry.Name
+	if name == "" {
+		name = username
+	}
+
+	user := models.User{
+		TenantID:      tenantID,
+		Username:      username,
+		Email:         email,
+		EmailVerified: verified,
+		Password:      string(hashedPassword),
+		AuthProvider:  models.AuthProviderLDAP,
+		Name:          name,
+		Role:          role,
+		IsActive:      true,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("租户 %d 自动创建目录账号 %s（%s）", tenantID, username, role)
+	return &user, nil
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"fmt"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 登录失败状态的缓存键前缀
+	LoginFailurePrefix = "login_failure"
+	// 正在跟踪的登录失败对象索引，用于管理员查看锁定列表
+	loginFailureIndexKey = "login_failure_index"
+
+	LockoutKindUser = "user"
+	LockoutKindIP   = "ip"
+)
+
+// loginGuardMu 串行化同一进程内对失败状态和索引的读改写
+var loginGuardMu sync.Mutex
+
+// loginFailureState 某个用户名或IP的登录失败状态
+type loginFailureState struct {
+	Failures    int       `json:"failures"`
+	FirstAt     time.Time `json:"first_at"`
+	LastAt      time.Time `json:"last_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginLockout 管理员查看的登录限制信息
+type LoginLockout struct {
+	Kind          string     `json:"kind"` // user 或 ip
+	Key           string     `json:"key"`  // 用户名或IP
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"` // 未锁定（仅退避）时为空
+	RetryAfter    int        `json:"retry_after"`  // 距离可再次尝试的秒数
+}
+
+// LoginGuardService 登录防暴力破解：失败计数、指数退避与临时锁定
+type LoginGuardService struct{}
+
+// NewLoginGuardService 创建登录防护服务实例
+func NewLoginGuardService() *LoginGuardService {
+	return &LoginGuardService{}
+}
+
+// DefaultSecurityPolicy 租户未配置安全策略时使用的默认值
+func DefaultSecurityPolicy(tenantID uint) models.TenantSecurityPolicy {
+	return models.TenantSecurityPolicy{
+		TenantID:             tenantID,
+		MaxLoginFailures:     5,
+		MaxIPLoginFailures:   50,
+		LockoutMinutes:       15,
+		FailureWindowMinutes: 15,
+		BackoffBaseSeconds:   1,
+		PasswordMinLength:    8,
+		PasswordMinClasses:   2,
+		PasswordBanCommon:    true,
+		PasswordMaxAgeDays:   0,
+		PasswordHistoryCount: 5,
+	}
+}
+
+// GetSecurityPolicy 获取租户安全策略
+func GetSecurityPolicy(tenantID uint) models.TenantSecurityPolicy {
+	var policy models.TenantSecurityPolicy
+	if err := utils.WithTenant(database.DB, tenantID).First(&policy).Error; err != nil {
+		return DefaultSecurityPolicy(tenantID)
+	}
+	return policy
+}
+
+func failureKey(kind, key string) string {
+	return fmt.Sprintf("%s:%s:%s", LoginFailurePrefix, kind, key)
+}
+
+// stateTTL 失败状态在存储中的保留时间
+func stateTTL(policy models.TenantSecurityPolicy) time.Duration {
+	window := time.Duration(policy.FailureWindowMinutes) * time.Minute
+	lockout := time.Duration(policy.LockoutMinutes) * time.Minute
+	if lockout > window {
+		return lockout
+	}
+	return window
+}
+
+// waitFor 计算距离允许下一次尝试还需等待的时间
+func (st *loginFailureState) waitFor(policy models.TenantSecurityPolicy, now time.Time) time.Duration {
+	if now.Before(st.LockedUntil) {
+		return st.LockedUntil.Sub(now)
+	}
+	if st.Failures == 0 || now.Sub(st.FirstAt) > time.Duration(policy.FailureWindowMinutes)*time.Minute {
+		return 0
+	}
+
+	// 指数退避：第n次失败后需等待 base*2^(n-1) 秒，最长不超过锁定时长
+	delay := time.Duration(policy.BackoffBaseSeconds) * time.Second
+	maxDelay := time.Duration(policy.LockoutMinutes) * time.Minute
+	for i := 1; i < st.Failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if next := st.LastAt.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func loadFailureState(tenantID uint, kind, key string) loginFailureState {
+	var st loginFailureState
+	storeGet(tenantID, failureKey(kind, key), &st)
+	return st
+}
+
+// Check 检查用户名和IP当前是否允许尝试登录，返回需要等待的时间（0表示允许）
+func (ls *LoginGuardService) Check(tenantID uint, username, ip string) time.Duration {
+	policy := GetSecurityPolicy(tenantID)
+	now := time.Now()
+
+	userState := loadFailureState(tenantID, LockoutKindUser, username)
+	ipState := loadFailureState(tenantID, LockoutKindIP, ip)
+
+	wait := userState.waitFor(policy, now)
+	if ipWait := ipState.waitFor(policy, now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait
+}
+
+// RecordFailure 记录一次失败的登录尝试，达到阈值时锁定
+func (ls *LoginGuardService) RecordFailure(tenantID uint, username string, userID uint, ip, userAgent, reason string) {
+	policy := GetSecurityPolicy(tenantID)
+
+	loginGuardMu.Lock()
+	ls.addFailure(tenantID, policy, LockoutKindUser, username, policy.MaxLoginFailures)
+	ls.addFailure(tenantID, policy, LockoutKindIP, ip, policy.MaxIPLoginFailures)
+	loginGuardMu.Unlock()
+
+	ls.recordAttempt(tenantID, username, userID, ip, userAgent, false, reason)
+}
+
+func (ls *LoginGuardService) addFailure(tenantID uint, policy models.TenantSecurityPolicy, kind, key string, maxFailures int) {
+	if key == "" {
+		return
+	}
+	now := time.Now()
+	st := loadFailureState(tenantID, kind, key)
+
+	// 超出统计窗口且未处于锁定中时重新计数
+	if st.Failures > 0 && now.After(st.LockedUntil) && now.Sub(st.FirstAt) > time.Duration(policy.FailureWindowMinutes)*time.Minute {
+		st = loginFailureState{}
+	}
+	if st.Failures == 0 {
+		st.FirstAt = now
+	}
+	st.Failures++
+	st.LastAt = now
+	if maxFailures > 0 && st.Failures >= maxFailures {
+		st.LockedUntil = now.Add(time.Duration(policy.LockoutMinutes) * time.Minute)
+	}
+
+	ttl := stateTTL(policy)
+	storeSet(tenantID, failureKey(kind, key), st, ttl)
+	updateFailureIndex(tenantID, kind+":"+key, now.Add(ttl))
+}
+
+// RecordSuccess 登录成功后清除该用户名的失败计数（IP计数保留，避免攻击者用自己的账号重置）
+func (ls *LoginGuardService) RecordSuccess(tenantID uint, username string, userID uint, ip, userAgent string) {
+	loginGuardMu.Lock()
+	storeDelete(tenantID, failureKey(LockoutKindUser, username))
+	updateFailureIndex(tenantID, LockoutKindUser+":"+username, time.Time{})
+	loginGuardMu.Unlock()
+
+	ls.recordAttempt(tenantID, username, userID, ip, userAgent, true, "")
+}
+
+// RecordBlocked 记录因锁定或退避被拒绝的登录尝试（不增加失败计数）
+func (ls *LoginGuardService) RecordBlocked(tenantID uint, username, ip, userAgent string) {
+	ls.recordAttempt(tenantID, username, 0, ip, userAgent, false, "locked")
+}
+
+func (ls *LoginGuardService) recordAttempt(tenantID uint, username string, userID uint, ip, userAgent string, success bool, reason string) {
+	database.DB.Create(&models.LoginAttempt{
+		TenantID:  tenantID,
+		Username:  username,
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   success,
+		Reason:    reason,
+	})
+}
+
+// updateFailureIndex 更新索引中某个对象的过期时间，零值表示移除
+func updateFailureIndex(tenantID uint, member string, expiresAt time.Time) {
+	index := make(map[string]time.Time)
+	storeGet(tenantID, loginFailureIndexKey, &index)
+
+	now := time.Now()
+	var maxExpiry time.Time
+	for k, v := range index {
+		if now.After(v) {
+			delete(index, k)
+		}
+	}
+	if expiresAt.IsZero() {
+		delete(index, member)
+	} else {
+		index[member] = expiresAt
+	}
+	for _, v := range index {
+		if v.After(maxExpiry) {
+			maxExpiry = v
+		}
+	}
+
+	if len(index) == 0 {
+		storeDelete(tenantID, loginFailureIndexKey)
+		return
+	}
+	storeSet(tenantID, loginFailureIndexKey, index, time.Until(maxExpiry))
+}
+
+// ListLockouts 列出租户内仍在限制中的用户名和IP
+func (ls *LoginGuardService) ListLockouts(tenantID uint) []LoginLockout {
+	policy := GetSecurityPolicy(tenantID)
+	now := time.Now()
+
+	index := make(map[string]time.Time)
+	storeGet(tenantID, loginFailureIndexKey, &index)
+
+	lockouts := make([]LoginLockout, 0, len(index))
+	for member := range index {
+		kind, key, ok := strings.Cut(member, ":")
+		if !ok {
+			continue
+		}
+		st := loadFailureState(tenantID, kind, key)
+		if st.Failures == 0 {
+			continue
+		}
+		wait := st.waitFor(policy, now)
+
+		lockout := LoginLockout{
+			Kind:          kind,
+			Key:           key,
+			Failures:      st.Failures,
+			LastFailureAt: st.LastAt,
+			RetryAfter:    int(wait.Seconds() + 0.5),
+		}
+		if now.Before(st.LockedUntil) {
+			lockedUntil := st.LockedUntil
+			lockout.LockedUntil = &lockedUntil
+		}
+		lockouts = append(lockouts, lockout)
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LastFailureAt.After(lockouts[j].LastFailureAt)
+	})
+	return lockouts
+}
+
+// ClearLockout 清除指定用户名或IP的失败计数与锁定；kind为空时清除全部
+func (ls *LoginGuardService) ClearLockout(tenantID uint, kind, key string) int {
+	loginGuardMu.Lock()
+	defer loginGuardMu.Unlock()
+
+	if kind != "" {
+		storeDelete(tenantID, failureKey(kind, key))
+		updateFailureIndex(tenantID, kind+":"+key, time.Time{})
+		return 1
+	}
+
+	index := make(map[string]time.Time)
+	storeGet(tenantID, loginFailureIndexKey, &index)
+	for member := range index {
+		if k, v, ok := strings.Cut(member, ":"); ok {
+			storeDelete(tenantID, failureKey(k, v))
+		}
+	}
+	storeDelete(tenantID, loginFailureIndexKey)
+	return len(index)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"online-exam-system/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MailMessage 一封纯文本邮件
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送接口，可按 MAIL_DRIVER 切换实现
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+// NewMailer 根据配置创建邮件发送器
+func NewMailer() Mailer {
+	cfg := config.GetConfig()
+	switch cfg.MailDriver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			User:     cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case "file":
+		return &FileMailer{Dir: cfg.MailFileDir, From: cfg.MailFrom}
+	default:
+		return &LogMailer{From: cfg.MailFrom}
+	}
+}
+
+// buildMessage 生成RFC 5322格式的邮件内容
+func buildMessage(from string, msg MailMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// SMTPMailer 通过SMTP服务器发送邮件（STARTTLS由net/smtp自动协商）
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg MailMessage) error {
+	if m.Host == "" {
+		return fmt.Errorf("未配置SMTP_HOST")
+	}
+	var auth smtp.Auth
+	if m.User != "" {
+		auth = smtp.PlainAuth("", m.User, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, buildMessage(m.From, msg))
+}
+
+// FileMailer 将邮件写入目录下的 .eml 文件，便于本地调试
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg MailMessage) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage(m.From, msg), 0o600)
+}
+
+// LogMailer 只把邮件内容打印到日志
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(msg MailMessage) error {
+	log.Printf("[mail] to=%s subject=%s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 只实现题库导入导出需要的XLSX/DOCX读写：读取第一个工作表的文本和Word文档的段落，写出单工作表和纯文本段落
+
+// maxSpreadsheetRows 读取工作表的最大行数，避免行号异常的文件占用过多内存
+const maxSpreadsheetRows = 10000
+
+var (
+	ErrInvalidOfficeFile = errors.New("文件已损坏或不是有效的Office文档")
+	ErrTooManyRows       = fmt.Errorf("工作表超过 %d 行", maxSpreadsheetRows)
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+// xlsxRichText 共享字符串或内联字符串，带格式的文本由多个r组成
+type xlsxRichText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt xlsxRichText) text() string {
+	if len(rt.R) == 0 {
+		return rt.T
+	}
+	var sb strings.Builder
+	sb.WriteString(rt.T)
+	for _, r := range rt.R {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string        `xml:"r,attr"`
+			T  string        `xml:"t,attr"`
+			V  string        `xml:"v"`
+			IS *xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX 读取XLSX第一个工作表的所有单元格文本，返回值的下标加1即为Excel中的行号
+func ReadXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidOfficeFile
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst xlsxSharedStrings
+		if err := decodeZipXML(f, &sst); err != nil {
+			return nil, err
+		}
+		shared = make([]string, len(sst.Items))
+		for i, item := range sst.Items {
+			shared[i] = item.text()
+		}
+	}
+
+	f, ok := files[firstSheetPath(files)]
+	if !ok {
+		return nil, ErrInvalidOfficeFile
+	}
+	var sheet xlsxWorksheet
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		rowIndex := len(rows)
+		if row.R > 0 {
+			rowIndex = row.R - 1
+		}
+		if rowIndex >= maxSpreadsheetRows {
+			return nil, ErrTooManyRows
+		}
+		for len(rows) <= rowIndex {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for _, cell := range row.Cells {
+			col := len(cells)
+			if cell.R != "" {
+				col = columnIndex(cell.R)
+			}
+			if col < 0 || col > 255 {
+				continue
+			}
+			value := cell.V
+			switch cell.T {
+			case "s":
+				if i, err := strconv.Atoi(cell.V); err == nil && i >= 0 && i < len(shared) {
+					value = shared[i]
+				}
+			case "inlineStr":
+				if cell.IS != nil {
+					value = cell.IS.text()
+				}
+			case "b":
+				if cell.V == "1" {
+					value = "TRUE"
+				} else {
+					value = "FALSE"
+				}
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = value
+		}
+		rows[rowIndex] = cells
+	}
+	return rows, nil
+}
+
+// firstSheetPath 按workbook.xml中的顺序找到第一个工作表的文件路径
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	wf, ok1 := files["xl/workbook.xml"]
+	rf, ok2 := files["xl/_rels/workbook.xml.rels"]
+	if !ok1 || !ok2 || decodeZipXML(wf, &workbook) != nil || decodeZipXML(rf, &rels) != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return fallback
+}
+
+// columnIndex 将单元格引用（如 C12）的列转换为从0开始的下标
+func columnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
+
+// columnName 将从0开始的列下标转换为列名（A、B、…、AA）
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return ErrInvalidOfficeFile
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return ErrInvalidOfficeFile
+	}
+	return nil
+}
+
+// ReadDOCXLines 读取Word文档正文的文本，每个段落（以及段落内的手动换行）为一行
+func ReadDOCXLines(data []byte) ([]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidOfficeFile
+	}
+	var document *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			document = f
+			break
+		}
+	}
+	if document == nil {
+		return nil, ErrInvalidOfficeFile
+	}
+	rc, err := document.Open()
+	if err != nil {
+		return nil, ErrInvalidOfficeFile
+	}
+	defer rc.Close()
+
+	var lines []string
+	var current strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidOfficeFile
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				current.WriteString("\t")
+			case "br", "cr":
+				lines = append(lines, current.String())
+				current.Reset()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				lines = append(lines, current.String())
+				current.Reset()
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+	return lines, nil
+}
+
+const (
+	xmlHeader          = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	packageRelsXML     = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="%s"/></Relationships>`
+	xlsxContentTypes   = xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxWorkbookXML    = xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels   = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetHeader    = xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter    = `</sheetData></worksheet>`
+	docxContentTypes   = xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`
+	docxDocumentHeader = xmlHeader + `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`
+	docxDocumentFooter = `</w:body></w:document>`
+)
+
+// XLSXWriter 逐行写出只有一个工作表的XLSX文件，单元格均为文本
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+// NewXLSXWriter 写入工作簿结构并开始写工作表，写完所有行后必须调用 Close
+func NewXLSXWriter(w io.Writer, sheetName string) (*XLSXWriter, error) {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", fmt.Sprintf(packageRelsXML, "xl/workbook.xml")},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbookXML, xmlEscape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		if err := writeZipPart(zw, part.name, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+	return &XLSXWriter{zw: zw, sheet: sheet}, nil
+}
+
+// WriteRow 写出一行
+func (xw *XLSXWriter) WriteRow(cells []string) error {
+	xw.rows++
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<row r="%d">`, xw.rows)
+	for i, cell := range cells {
+		if cell == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, columnName(i), xw.rows, xmlEscape(cell))
+	}
+	sb.WriteString(`</row>`)
+	_, err := io.WriteString(xw.sheet, sb.String())
+	return err
+}
+
+// Close 结束工作表并写出zip目录
+func (xw *XLSXWriter) Close() error {
+	if _, err := io.WriteString(xw.sheet, xlsxSheetFooter); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
+
+// WriteDOCX 写出只包含纯文本段落的Word文档
+func WriteDOCX(w io.Writer, paragraphs []string) error {
+	zw := zip.NewWriter(w)
+	var body strings.Builder
+	body.WriteString(docxDocumentHeader)
+	for _, p := range paragraphs {
+		fmt.Fprintf(&body, `<w:p><w:r><w:t xml:space="preserve">%s</w:t></w:r></w:p>`, xmlEscape(p))
+	}
+	body.WriteString(docxDocumentFooter)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", fmt.Sprintf(packageRelsXML, "word/document.xml")},
+		{"word/document.xml", body.String()},
+	}
+	for _, part := range parts {
+		if err := writeZipPart(zw, part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipPart(zw *zip.Writer, name, content string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,513 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	// OIDCStateTTL 从跳转到身份提供方到回调的最长时间
+	OIDCStateTTL = 10 * time.Minute
+	// OIDCTicketTTL 回调后前端用登录票据换取令牌的有效期
+	OIDCTicketTTL = time.Minute
+
+	oidcStatePrefix  = "oidc_state"
+	oidcTicketPrefix = "oidc_ticket"
+
+	// 发现文档缓存时间，签名公钥由go-oidc按需刷新
+	oidcDiscoveryTTL = time.Hour
+)
+
+var (
+	ErrOIDCProviderNotFound = errors.New("身份提供方不存在或未启用")
+	ErrOIDCStateInvalid     = errors.New("登录请求已失效，请重新登录")
+	ErrOIDCTokenInvalid     = errors.New("身份提供方返回的令牌无效")
+	ErrOIDCIdentityLinked   = errors.New("该外部账号已关联其他用户")
+	ErrOIDCEmailExists      = errors.New("该邮箱已有账号，请先用原账号登录后在个人设置中关联")
+	ErrOIDCNotProvisioned   = errors.New("该账号尚未开通，请联系管理员")
+	ErrOIDCNoRole           = errors.New("外部账号没有可用的角色")
+)
+
+var usernameSanitizer = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// oidcState 跳转到身份提供方前保存的请求状态
+type oidcState struct {
+	ProviderID   uint   `json:"provider_id"`
+	CodeVerifier string `json:"code_verifier"` // PKCE
+	Nonce        string `json:"nonce"`
+	LinkUserID   uint   `json:"link_user_id"` // 不为0时表示为已登录用户关联外部身份
+	ReturnTo     string `json:"return_to"`
+}
+
+// OIDCResult 回调处理结果
+type OIDCResult struct {
+	User     *models.User
+	Provider *models.OIDCProvider
+	Linked   bool // 本次为关联操作
+	ReturnTo string
+}
+
+type cachedOIDCProvider struct {
+	provider  *oidc.Provider
+	expiresAt time.Time
+}
+
+// OIDCService OpenID Connect 单点登录
+type OIDCService struct {
+	sessionService *SessionService
+
+	mu        sync.Mutex
+	discovery map[string]cachedOIDCProvider
+}
+
+// NewOIDCService 创建单点登录服务实例
+func NewOIDCService() *OIDCService {
+	return &OIDCService{
+		sessionService: NewSessionService(),
+		discovery:      make(map[string]cachedOIDCProvider),
+	}
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// tenantToken 生成 "租户ID.随机串" 格式的令牌，回调时据此确定租户
+func tenantToken(tenantID uint) (string, error) {
+	random, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%s", tenantID, random), nil
+}
+
+func parseTenantToken(token string) (uint, bool) {
+	prefix, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+	tenantID, err := strconv.ParseUint(prefix, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(tenantID), true
+}
+
+// OIDCRedirectURL 在身份提供方登记的回调地址
+func OIDCRedirectURL(provider *models.OIDCProvider) string {
+	return fmt.Sprintf("%s/api/v1/auth/oidc/%s/callback", strings.TrimRight(config.GetConfig().PublicURL, "/"), provider.Name)
+}
+
+// SafeReturnPath 只允许站内相对路径，防止开放重定向
+func SafeReturnPath(path, fallback string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return fallback
+	}
+	return path
+}
+
+// ListProviders 租户已启用的身份提供方
+func (s *OIDCService) ListProviders(tenantID uint) []models.OIDCProvider {
+	var providers []models.OIDCProvider
+	utils.WithTenant(database.DB, tenantID).Where("enabled = ?", true).Order("id ASC").Find(&providers)
+	return providers
+}
+
+// FindProvider 按名称查找租户已启用的身份提供方
+func (s *OIDCService) FindProvider(tenantID uint, name string) (*models.OIDCProvider, error) {
+	var provider models.OIDCProvider
+	if err := utils.WithTenant(database.DB, tenantID).Where("name = ? AND enabled = ?", name, true).First(&provider).Error; err != nil {
+		return nil, ErrOIDCProviderNotFound
+	}
+	return &provider, nil
+}
+
+// discover 读取发现文档，按issuer缓存
+func (s *OIDCService) discover(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	s.mu.Lock()
+	cached, ok := s.discovery[issuer]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("读取身份提供方配置失败: %w", err)
+	}
+
+	s.mu.Lock()
+	s.discovery[issuer] = cachedOIDCProvider{provider: provider, expiresAt: time.Now().Add(oidcDiscoveryTTL)}
+	s.mu.Unlock()
+	return provider, nil
+}
+
+func (s *OIDCService) oauthConfig(ctx context.Context, p *models.OIDCProvider) (*oauth2.Config, *oidc.Provider, error) {
+	discovered, err := s.discover(ctx, p.IssuerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	scopes := strings.Fields(p.Scopes)
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == oidc.ScopeOpenID {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     discovered.Endpoint(),
+		RedirectURL:  OIDCRedirectURL(p),
+		Scopes:       scopes,
+	}, discovered, nil
+}
+
+// BeginAuth 生成跳转到身份提供方的授权地址（PKCE + nonce）
+func (s *OIDCService) BeginAuth(ctx context.Context, p *models.OIDCProvider, linkUserID uint, returnTo string) (string, error) {
+	oauthCfg, _, err := s.oauthConfig(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := tenantToken(p.TenantID)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	storeSet(p.TenantID, oidcStatePrefix+":"+HashToken(state), oidcState{
+		ProviderID:   p.ID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ReturnTo:     returnTo,
+	}, OIDCStateTTL)
+
+	return oauthCfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// CompleteAuth 处理回调：校验state、用授权码换取并验证ID令牌，然后登录或关联账号
+func (s *OIDCService) CompleteAuth(ctx context.Context, providerName, state, code string) (*OIDCResult, error) {
+	tenantID, ok := parseTenantToken(state)
+	if !ok {
+		return nil, ErrOIDCStateInvalid
+	}
+	key := oidcStatePrefix + ":" + HashToken(state)
+	var saved oidcState
+	if !storeGet(tenantID, key, &saved) {
+		return nil, ErrOIDCStateInvalid
+	}
+	// state只能使用一次
+	storeDelete(tenantID, key)
+
+	p, err := s.FindProvider(tenantID, providerName)
+	if err != nil || p.ID != saved.ProviderID {
+		return nil, ErrOIDCStateInvalid
+	}
+	result := &OIDCResult{Provider: p, Linked: saved.LinkUserID != 0, ReturnTo: saved.ReturnTo}
+
+	oauthCfg, discovered, err := s.oauthConfig(ctx, p)
+	if err != nil {
+		return result, err
+	}
+	token, err := oauthCfg.Exchange(ctx, code, oauth2.VerifierOption(saved.CodeVerifier))
+	if err != nil {
+		log.Printf("身份提供方 %s 授权码换取令牌失败: %v", p.Name, err)
+		return result, ErrOIDCTokenInvalid
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return result, ErrOIDCTokenInvalid
+	}
+
+	// 校验签名（JWKS）、issuer、audience和有效期
+	idToken, err := discovered.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("身份提供方 %s 的ID令牌校验失败: %v", p.Name, err)
+		return result, ErrOIDCTokenInvalid
+	}
+	if idToken.Nonce != saved.Nonce {
+		return result, ErrOIDCTokenInvalid
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return result, ErrOIDCTokenInvalid
+	}
+
+	if saved.LinkUserID != 0 {
+		result.User, err = s.link(p, saved.LinkUserID, idToken.Subject, claims)
+	} else {
+		result.User, err = s.login(p, idToken.Subject, claims)
+	}
+	return result, err
+}
+
+// claimValue 读取声明，支持 a.b.c 形式的嵌套路径
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+func claimString(claims map[string]interface{}, path string) string {
+	if v, ok := claimValue(claims, path).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// claimStrings 声明值可能是字符串或字符串数组
+func claimStrings(claims map[string]interface{}, path string) []string {
+	switch v := claimValue(claims, path).(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// MapOIDCRole 按声明值映射角色：管理员优先，其次教师，否则使用默认角色
+func MapOIDCRole(p *models.OIDCProvider, claims map[string]interface{}) (models.UserRole, error) {
+	var values []string
+	if p.RoleClaim != "" {
+		values = claimStrings(claims, p.RoleClaim)
+	}
+	switch {
+	case inGroups(values, p.AdminValues):
+		return models.RoleAdmin, nil
+	case inGroups(values, p.TeacherValues):
+		return models.RoleTeacher, nil
+	case p.DefaultRole != "":
+		return p.DefaultRole, nil
+	}
+	return "", ErrOIDCNoRole
+}
+
+// login 按外部身份登录；没有关联记录时按配置自动创建账号
+func (s *OIDCService) login(p *models.OIDCProvider, subject string, claims map[string]interface{}) (*models.User, error) {
+	role, err := MapOIDCRole(p, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity models.UserIdentity
+	if err := database.DB.Where("provider_id = ? AND subject = ?", p.ID, subject).First(&identity).Error; err == nil {
+		var user models.User
+		if err := utils.WithTenant(database.DB, p.TenantID).First(&user, identity.UserID).Error; err != nil {
+			return nil, ErrOIDCNotProvisioned
+		}
+		if !user.IsActive {
+			return nil, ErrAccountDisabled
+		}
+		now := time.Now()
+		database.DB.Model(&identity).Update("last_login_at", now)
+
+		// 由单点登录创建的账号按声明同步角色；关联的本地账号保留本地角色
+		if user.AuthProvider == models.AuthProviderOIDC && user.Role != role {
+			database.DB.Model(&user).Updates(map[string]interface{}{"role": role, "role_id": nil})
+			user.Role = role
+			user.RoleID = nil
+			s.sessionService.EndUserSessions(p.TenantID, &user)
+		}
+		return &user, nil
+	}
+
+	if !p.AutoProvision {
+		return nil, ErrOIDCNotProvisioned
+	}
+
+	// 不按邮箱自动关联已有账号，避免通过外部账号接管本地账号
+	email := claimString(claims, "email")
+	if email != "" && emailInUse(email, 0) {
+		return nil, ErrOIDCEmailExists
+	}
+
+	user, err := s.createUser(p, subject, claims, role)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// uniqueUsername 用户名全局唯一，冲突时追加subject摘要
+func uniqueUsername(p *models.OIDCProvider, subject, preferred string) string {
+	base := usernameSanitizer.ReplaceAllString(strings.ToLower(preferred), "")
+	if base == "" {
+		base = p.Name
+	}
+	var count int64
+	database.DB.Model(&models.User{}).Where("username = ?", base).Count(&count)
+	if count == 0 {
+		return base
+	}
+	sum := sha256.Sum256([]byte(p.Name + ":" + subject))
+	return fmt.Sprintf("%s_%x", base, sum[:3])
+}
+
+func (s *OIDCService) createUser(p *models.OIDCProvider, subject string, claims map[string]interface{}, role models.UserRole) (*models.User, error) {
+	// 外部账号不使用本地密码，保存一个无法登录的随机哈希
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword(random, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	username := uniqueUsername(p, subject, firstNonEmptyString(claimString(claims, p.UsernameClaim), claimString(claims, "preferred_username")))
+	email := claimString(claims, "email")
+	verified, _ := claimValue(claims, "email_verified").(bool)
+	if email == "" {
+		email = username + "@oidc.invalid"
+		verified = false
+	}
+	name := firstNonEmptyString(claimString(claims, "name"), username)
+
+	now := time.Now()
+	user := models.User{
+		TenantID:      p.TenantID,
+		Username:      username,
+		Email:         email,
+		EmailVerified: verified,
+		Password:      string(hashedPassword),
+		AuthProvider:  models.AuthProviderOIDC,
+		Name:          name,
+		Role:          role,
+		IsActive:      true,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserIdentity{
+			TenantID:    p.TenantID,
+			UserID:      user.ID,
+			ProviderID:  p.ID,
+			Subject:     subject,
+			Email:       claimString(claims, "email"),
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("租户 %d 通过身份提供方 %s 自动创建账号 %s（%s）", p.TenantID, p.Name, username, role)
+	return &user, nil
+}
+
+// link 将外部身份关联到已登录的用户
+func (s *OIDCService) link(p *models.OIDCProvider, userID uint, subject string, claims map[string]interface{}) (*models.User, error) {
+	var user models.User
+	if err := utils.WithTenant(database.DB, p.TenantID).First(&user, userID).Error; err != nil {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	var existing models.UserIdentity
+	if err := database.DB.Where("provider_id = ? AND subject = ?", p.ID, subject).First(&existing).Error; err == nil {
+		if existing.UserID != user.ID {
+			return nil, ErrOIDCIdentityLinked
+		}
+		return &user, nil
+	}
+
+	// 每个用户在同一身份提供方只关联一个外部账号
+	if err := database.DB.Where("user_id = ? AND provider_id = ?", user.ID, p.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return nil, err
+	}
+	identity := models.UserIdentity{
+		TenantID:   p.TenantID,
+		UserID:     user.ID,
+		ProviderID: p.ID,
+		Subject:    subject,
+		Email:      claimString(claims, "email"),
+	}
+	if err := database.DB.Create(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateLoginTicket 回调后生成一次性登录票据，前端用它换取令牌（令牌不出现在URL中）
+func (s *OIDCService) CreateLoginTicket(user *models.User) (string, error) {
+	ticket, err := tenantToken(user.TenantID)
+	if err != nil {
+		return "", err
+	}
+	storeSet(user.TenantID, oidcTicketPrefix+":"+HashToken(ticket), user.ID, OIDCTicketTTL)
+	return ticket, nil
+}
+
+// RedeemLoginTicket 兑换登录票据，票据只能使用一次
+func (s *OIDCService) RedeemLoginTicket(ticket string) (*models.User, error) {
+	tenantID, ok := parseTenantToken(ticket)
+	if !ok {
+		return nil, ErrOIDCStateInvalid
+	}
+	key := oidcTicketPrefix + ":" + HashToken(ticket)
+	var userID uint
+	if !storeGet(tenantID, key, &userID) {
+		return nil, ErrOIDCStateInvalid
+	}
+	storeDelete(tenantID, key)
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, userID).Error; err != nil || !user.IsActive {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &user, nil
+}
+
+func firstNonEmptyString(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
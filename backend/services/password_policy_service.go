@@ -0,0 +1,163 @@
+package services
+
+import (
+	_ "embed"
+	"fmt"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords 常见弱密码（小写）
+var commonPasswords = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+// PasswordPolicyError 密码不符合策略，Violations列出所有不满足的规则
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "密码不符合安全要求：" + strings.Join(e.Violations, "；")
+}
+
+// characterClasses 统计密码包含的字符类别数（大写、小写、数字、符号）
+func characterClasses(password string) int {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, ok := range []bool{upper, lower, digit, symbol} {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// ValidatePassword 按租户策略校验密码强度，username用于禁止密码包含用户名
+func ValidatePassword(policy models.TenantSecurityPolicy, password, username string) error {
+	var violations []string
+
+	if len([]rune(password)) < policy.PasswordMinLength {
+		violations = append(violations, fmt.Sprintf("长度至少%d位", policy.PasswordMinLength))
+	}
+	if policy.PasswordMinClasses > 1 && characterClasses(password) < policy.PasswordMinClasses {
+		violations = append(violations, fmt.Sprintf("至少包含大写字母、小写字母、数字、符号中的%d类", policy.PasswordMinClasses))
+	}
+	if policy.PasswordBanCommon {
+		lower := strings.ToLower(password)
+		if commonPasswords[lower] {
+			violations = append(violations, "不能使用常见弱密码")
+		} else if username != "" && len(username) >= 3 && strings.Contains(lower, strings.ToLower(username)) {
+			violations = append(violations, "不能包含用户名")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// CheckPasswordReuse 检查新密码是否与当前密码或最近N次使用过的密码相同
+func CheckPasswordReuse(policy models.TenantSecurityPolicy, user *models.User, password string) error {
+	if policy.PasswordHistoryCount <= 0 {
+		return nil
+	}
+
+	if user.Password != "" && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return &PasswordPolicyError{Violations: []string{"不能与当前密码相同"}}
+	}
+
+	var history []models.PasswordHistory
+	utils.WithTenant(database.DB, user.TenantID).Where("user_id = ?", user.ID).
+		Order("id DESC").Limit(policy.PasswordHistoryCount).Find(&history)
+	for _, h := range history {
+		if bcrypt.CompareHashAndPassword([]byte(h.PasswordHash), []byte(password)) == nil {
+			return &PasswordPolicyError{Violations: []string{fmt.Sprintf("不能与最近%d次使用过的密码相同", policy.PasswordHistoryCount)}}
+		}
+	}
+	return nil
+}
+
+// CheckNewPassword 修改或重置已有用户的密码时同时校验强度和历史
+func CheckNewPassword(user *models.User, password string) error {
+	policy := GetSecurityPolicy(user.TenantID)
+	if err := ValidatePassword(policy, password, user.Username); err != nil {
+		return err
+	}
+	return CheckPasswordReuse(policy, user, password)
+}
+
+// RecordPasswordChange 保存新密码哈希到历史并更新修改时间，只保留策略要求的条数
+func RecordPasswordChange(db *gorm.DB, user *models.User, mustChange bool) error {
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	user.MustChangePassword = mustChange
+	if err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password":             user.Password,
+		"password_changed_at":  now,
+		"must_change_password": mustChange,
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := db.Create(&models.PasswordHistory{
+		TenantID:     user.TenantID,
+		UserID:       user.ID,
+		PasswordHash: user.Password,
+	}).Error; err != nil {
+		return err
+	}
+
+	keep := GetSecurityPolicy(user.TenantID).PasswordHistoryCount
+	if keep < 1 {
+		keep = 1
+	}
+	var ids []uint
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Order("id DESC").Pluck("id", &ids)
+	if len(ids) > keep {
+		return db.Where("id IN ?", ids[keep:]).Delete(&models.PasswordHistory{}).Error
+	}
+	return nil
+}
+
+// PasswordExpired 检查密码是否超过策略规定的最长使用时间
+func PasswordExpired(policy models.TenantSecurityPolicy, user *models.User) bool {
+	// 外部账号的密码有效期由目录或身份提供方管理
+	if policy.PasswordMaxAgeDays <= 0 || IsExternalAccount(user) {
+		return false
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > time.Duration(policy.PasswordMaxAgeDays)*24*time.Hour
+}
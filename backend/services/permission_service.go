@@ -0,0 +1,252 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"sort"
+	"time"
+)
+
+// 命名权限，路由通过 RequirePermission 按权限校验
+const (
+	PermDashboardRead   = "dashboard.read"
+	PermUserRead        = "user.read"
+	PermUserWrite       = "user.write"
+	PermUserImpersonate = "user.impersonate"
+	PermRoleManage      = "role.manage"
+	PermSubjectWrite    = "subject.write"
+	PermQuestionWrite   = "question.write"
+	PermPaperWrite      = "paper.write"
+	PermExamCreate      = "exam.create"
+	PermExamUpdate      = "exam.update"
+	PermExamTake        = "exam.take"
+	PermGradeRead       = "grade.read"
+	PermPracticeUse     = "practice.use"
+	PermClassManage     = "class.manage"
+	PermClassManageAll  = "class.manage_all"
+	PermInviteManage    = "invite.manage"
+	PermTenantManage    = "tenant.manage"
+	PermRetentionManage = "retention.manage"
+	PermSecurityManage  = "security.manage"
+	PermAuditRead       = "audit.read"
+
+	PermContentManage           = "content.manage"
+	PermContentManageDepartment = "content.manage_department"
+)
+
+// rolePermissionsCacheTTL 自定义角色权限的缓存时间，角色修改或删除时立即失效
+const rolePermissionsCacheTTL = 5 * time.Minute
+
+var (
+	ErrUnknownPermission = errors.New("未知的权限")
+	ErrInvalidBaseRole   = errors.New("base_role只能为admin、teacher或student")
+	ErrRoleInUse         = errors.New("该角色仍有用户使用，请先调整这些用户的角色")
+	ErrRoleGrantDenied   = errors.New("分配角色需要角色管理权限，且只能分配自己已拥有全部权限的角色")
+	ErrPermissionGrant   = errors.New("只能为角色设置自己已拥有的权限")
+	ErrUserManageDenied  = errors.New("不能管理权限超出自己的用户")
+)
+
+// PermissionInfo 权限说明
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalog 系统支持的全部权限
+var PermissionCatalog = []PermissionInfo{
+	{PermDashboardRead, "查看管理仪表板"},
+	{PermUserRead, "查看用户"},
+	{PermUserWrite, "创建、编辑、停用和导入用户，重置密码和两步验证"},
+	{PermUserImpersonate, "以其他教师或学生的身份登录以排查问题（所有请求都会记录审计日志）"},
+	{PermRoleManage, "管理自定义角色并为用户分配角色"},
+	{PermSubjectWrite, "管理科目"},
+	{PermQuestionWrite, "创建、编辑、删除和导入题目"},
+	{PermPaperWrite, "创建、编辑和删除试卷，自动组卷"},
+	{PermExamCreate, "创建考试"},
+	{PermExamUpdate, "编辑和删除考试"},
+	{PermExamTake, "参加考试和提交答案"},
+	{PermGradeRead, "查看考试分析和学生成绩"},
+	{PermPracticeUse, "使用练习和错题复习"},
+	{PermClassManage, "管理班级"},
+	{PermClassManageAll, "管理所有教师的班级和邀请码，指定班级的负责教师"},
+	{PermInviteManage, "管理注册邀请码"},
+	{PermTenantManage, "导出、导入和删除租户数据"},
+	{PermRetentionManage, "管理数据保留策略"},
+	{PermSecurityManage, "管理登录安全策略、LDAP和单点登录配置"},
+	{PermAuditRead, "查询和导出审计日志"},
+	{PermContentManage, "查看、编辑和删除租户内所有人的题目、试卷和考试"},
+	{PermContentManageDepartment, "查看、编辑和删除本院系成员的题目、试卷和考试"},
+}
+
+// rolePresets 内置角色的权限，管理员拥有全部权限
+var rolePresets = map[models.UserRole][]string{
+	models.RoleTeacher: {
+		PermQuestionWrite, PermPaperWrite, PermExamCreate, PermExamUpdate,
+		PermGradeRead, PermClassManage, PermInviteManage,
+	},
+	models.RoleStudent: {
+		PermExamTake, PermPracticeUse,
+	},
+}
+
+// RolePreset 内置角色及其权限
+type RolePreset struct {
+	Role        models.UserRole `json:"role"`
+	Permissions []string        `json:"permissions"`
+}
+
+// IsValidPermission 判断权限名称是否存在
+func IsValidPermission(name string) bool {
+	for _, p := range PermissionCatalog {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PresetPermissions 内置角色的权限列表
+func PresetPermissions(role models.UserRole) []string {
+	if role == models.RoleAdmin {
+		all := make([]string, 0, len(PermissionCatalog))
+		for _, p := range PermissionCatalog {
+			all = append(all, p.Name)
+		}
+		return all
+	}
+	return append([]string(nil), rolePresets[role]...)
+}
+
+// RolePresets 返回全部内置角色
+func RolePresets() []RolePreset {
+	roles := []models.UserRole{models.RoleAdmin, models.RoleTeacher, models.RoleStudent}
+	presets := make([]RolePreset, 0, len(roles))
+	for _, role := range roles {
+		presets = append(presets, RolePreset{Role: role, Permissions: PresetPermissions(role)})
+	}
+	return presets
+}
+
+// ParseRolePermissions 解析角色中JSON格式存储的权限列表
+func ParseRolePermissions(role *models.TenantRole) []string {
+	var permissions []string
+	if role.Permissions != "" {
+		json.Unmarshal([]byte(role.Permissions), &permissions)
+	}
+	return permissions
+}
+
+// NormalizePermissions 校验、去重并排序权限列表，返回JSON字符串
+func NormalizePermissions(permissions []string) (string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if !IsValidPermission(p) {
+			return "", fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// IsBuiltinRole 判断是否为内置角色
+func IsBuiltinRole(role models.UserRole) bool {
+	return role == models.RoleAdmin || role == models.RoleTeacher || role == models.RoleStudent
+}
+
+// PermissionService 计算用户权限
+type PermissionService struct{}
+
+// NewPermissionService 创建权限服务实例
+func NewPermissionService() *PermissionService {
+	return &PermissionService{}
+}
+
+func rolePermissionsKey(roleID uint) string {
+	return fmt.Sprintf("role_permissions:%d", roleID)
+}
+
+// Permissions 返回用户的权限列表：分配了自定义角色时使用该角色的权限，否则使用内置角色的权限
+func (ps *PermissionService) Permissions(tenantID uint, role models.UserRole, roleID *uint) []string {
+	if roleID == nil {
+		return PresetPermissions(role)
+	}
+
+	key := rolePermissionsKey(*roleID)
+	var permissions []string
+	if storeGet(tenantID, key, &permissions) {
+		return permissions
+	}
+
+	var tenantRole models.TenantRole
+	if err := utils.WithTenant(database.DB, tenantID).First(&tenantRole, *roleID).Error; err != nil {
+		// 角色已不存在时退回内置角色
+		return PresetPermissions(role)
+	}
+	permissions = ParseRolePermissions(&tenantRole)
+	storeSet(tenantID, key, permissions, rolePermissionsCacheTTL)
+	return permissions
+}
+
+// HasPermission 判断用户是否拥有任一指定权限
+func (ps *PermissionService) HasPermission(tenantID uint, role models.UserRole, roleID *uint, required ...string) bool {
+	for _, have := range ps.Permissions(tenantID, role, roleID) {
+		for _, want := range required {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanGrantRole 判断操作者能否授予指定角色：需要角色管理权限，并且已拥有该角色的全部权限，
+// 避免通过分配角色获得自己没有的权限
+func (ps *PermissionService) CanGrantRole(actor Actor, role models.UserRole, roleID *uint) bool {
+	return ps.CanGrantPermissions(actor, ps.Permissions(actor.TenantID, role, roleID))
+}
+
+// CanGrantPermissions 判断操作者能否把这些权限写入自定义角色，规则与 CanGrantRole 相同
+func (ps *PermissionService) CanGrantPermissions(actor Actor, permissions []string) bool {
+	return ps.HasPermission(actor.TenantID, actor.Role, actor.RoleID, PermRoleManage) &&
+		ps.coversPermissions(actor, permissions)
+}
+
+// CanManageUser 判断操作者能否修改、停用目标用户或重置其凭据：操作者的权限必须覆盖目标用户的全部权限，
+// 避免低权限账号接管管理员等高权限账号。与创建用户一致，内置学生角色只需要用户管理权限
+func (ps *PermissionService) CanManageUser(actor Actor, target *models.User) bool {
+	if target.Role == models.RoleStudent && target.RoleID == nil {
+		return true
+	}
+	return ps.coversPermissions(actor, ps.Permissions(actor.TenantID, target.Role, target.RoleID))
+}
+
+func (ps *PermissionService) coversPermissions(actor Actor, permissions []string) bool {
+	have := make(map[string]bool)
+	for _, p := range ps.Permissions(actor.TenantID, actor.Role, actor.RoleID) {
+		have[p] = true
+	}
+	for _, p := range permissions {
+		if !have[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// InvalidateRole 角色修改或删除后清除权限缓存
+func (ps *PermissionService) InvalidateRole(tenantID, roleID uint) {
+	storeDelete(tenantID, rolePermissionsKey(roleID))
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"online-exam-system/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 结构化题型（填空、配对、排序、数值）的答案保存为JSON，学生作答时不返回；
+// 选项字段保存由答案生成的展示数据（QuestionLayout），不包含答案
+
+// 配对题的配对数、排序题的项数上限
+const maxStructuredItems = 20
+
+// 单位缺失或错误时默认扣除的比例
+const defaultUnitPenalty = 0.5
+
+var (
+	// 题干中的空位：连续3个及以上下划线
+	blankMarkerPattern = regexp.MustCompile(`_{3,}`)
+	// 数值题作答：数值后可跟单位
+	numericAnswerPattern = regexp.MustCompile(`^([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)\s*(.*)$`)
+)
+
+// FillBlankAnswer 填空题答案：每个空可接受的答案，题干中用 ___ 标记空位
+type FillBlankAnswer struct {
+	Blanks        [][]string `json:"blanks"`
+	CaseSensitive bool       `json:"case_sensitive,omitempty"`
+}
+
+// MatchingPair 配对题的一组正确配对
+type MatchingPair struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+// MatchingAnswer 配对题答案：正确的配对和右侧的干扰项
+type MatchingAnswer struct {
+	Pairs       []MatchingPair `json:"pairs"`
+	Distractors []string       `json:"distractors,omitempty"`
+}
+
+// OrderingAnswer 排序题答案：按正确顺序排列的各项
+type OrderingAnswer struct {
+	Items []string `json:"items"`
+}
+
+// NumericAnswer 数值题答案：标准值、允许的误差和单位
+type NumericAnswer struct {
+	Value        float64            `json:"value"`
+	Tolerance    float64            `json:"tolerance,omitempty"`     // 允许的绝对误差
+	Unit         string             `json:"unit,omitempty"`          // 标准单位
+	Units        map[string]float64 `json:"units,omitempty"`         // 其他可接受的单位及相对标准单位的倍数，如 {"cm": 100}
+	UnitRequired bool               `json:"unit_required,omitempty"` // 是否必须填写单位
+	UnitPenalty  *float64           `json:"unit_penalty,omitempty"`  // 单位缺失或错误时扣除的比例，默认0.5
+}
+
+// QuestionLayout 结构化题型的展示数据，保存在题目的选项字段中
+type QuestionLayout struct {
+	Blanks  int      `json:"blanks,omitempty"`  // 填空题的空数，作答为字符串数组
+	Prompts []string `json:"prompts,omitempty"` // 配对题左侧各项
+	Choices []string `json:"choices,omitempty"` // 配对题右侧可选项，作答为每个左侧项所选的下标（未作答为-1）
+	Items   []string `json:"items,omitempty"`   // 排序题打乱后的各项，作答为按顺序排列的下标
+	Units   []string `json:"units,omitempty"`   // 数值题可填写的单位，作答为“数值 单位”
+}
+
+// IsStructuredQuestionType 判断是否为答案保存为JSON的题型
+func IsStructuredQuestionType(questionType models.QuestionType) bool {
+	switch questionType {
+	case models.FillBlank, models.Matching, models.Ordering, models.Numeric:
+		return true
+	}
+	return false
+}
+
+// NormalizeStructuredAnswer 校验结构化题型的答案，返回统一格式的答案和展示数据（均为JSON）。
+// 填空题也可以只填写每个空的答案数组，如 ["北京|Beijing", "长江"]，用 | 分隔同一空可接受的答案
+func NormalizeStructuredAnswer(questionType models.QuestionType, content, answer string) (string, string, error) {
+	var normalized, layout interface{}
+	var err error
+	switch questionType {
+	case models.FillBlank:
+		normalized, layout, err = normalizeFillBlank(content, answer)
+	case models.Matching:
+		normalized, layout, err = normalizeMatching(answer)
+	case models.Ordering:
+		normalized, layout, err = normalizeOrdering(answer)
+	case models.Numeric:
+		normalized, layout, err = normalizeNumeric(answer)
+	default:
+		return "", "", fmt.Errorf("不支持的题型：%s", questionType)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	answerJSON, _ := json.Marshal(normalized)
+	layoutJSON, _ := json.Marshal(layout)
+	return string(answerJSON), string(layoutJSON), nil
+}
+
+func normalizeFillBlank(content, answer string) (FillBlankAnswer, QuestionLayout, error) {
+	var key FillBlankAnswer
+	if err := json.Unmarshal([]byte(answer), &key); err != nil || key.Blanks == nil {
+		// 简写：每个空一个字符串（| 分隔可接受的答案）或字符串数组
+		var blanks []json.RawMessage
+		if json.Unmarshal([]byte(answer), &blanks) != nil {
+			return key, QuestionLayout{}, errors.New("填空题答案需为JSON，如 {\"blanks\": [[\"北京\"], [\"长江\", \"长江水\"]]}")
+		}
+		key = FillBlankAnswer{}
+		for _, raw := range blanks {
+			var accepted []string
+			var single string
+			if json.Unmarshal(raw, &single) == nil {
+				accepted = strings.Split(single, "|")
+			} else if json.Unmarshal(raw, &accepted) != nil {
+				return key, QuestionLayout{}, errors.New("填空题每个空的答案需为字符串或字符串数组")
+			}
+			key.Blanks = append(key.Blanks, accepted)
+		}
+	}
+
+	if len(key.Blanks) == 0 {
+		return key, QuestionLayout{}, errors.New("填空题至少需要一个空")
+	}
+	for i, accepted := range key.Blanks {
+		var cleaned []string
+		for _, value := range accepted {
+			if value = strings.TrimSpace(value); value != "" {
+				cleaned = append(cleaned, value)
+			}
+		}
+		if len(cleaned) == 0 {
+			return key, QuestionLayout{}, fmt.Errorf("第%d个空没有填写答案", i+1)
+		}
+		key.Blanks[i] = cleaned
+	}
+	if markers := len(blankMarkerPattern.FindAllString(content, -1)); markers > 0 && markers != len(key.Blanks) {
+		return key, QuestionLayout{}, fmt.Errorf("题干中有%d个空（___），答案有%d个", markers, len(key.Blanks))
+	}
+	return key, QuestionLayout{Blanks: len(key.Blanks)}, nil
+}
+
+func normalizeMatching(answer string) (MatchingAnswer, QuestionLayout, error) {
+	var key MatchingAnswer
+	if err := json.Unmarshal([]byte(answer), &key); err != nil {
+		return key, QuestionLayout{}, errors.New("配对题答案需为JSON，如 {\"pairs\": [{\"left\": \"中国\", \"right\": \"北京\"}], \"distractors\": [\"上海\"]}")
+	}
+	if len(key.Pairs) < 2 || len(key.Pairs) > maxStructuredItems {
+		return key, QuestionLayout{}, fmt.Errorf("配对题需要2-%d组配对", maxStructuredItems)
+	}
+
+	var layout QuestionLayout
+	lefts := make(map[string]bool)
+	rights := make(map[string]bool)
+	for i := range key.Pairs {
+		pair := &key.Pairs[i]
+		pair.Left, pair.Right = strings.TrimSpace(pair.Left), strings.TrimSpace(pair.Right)
+		if pair.Left == "" || pair.Right == "" {
+			return key, layout, fmt.Errorf("第%d组配对不完整", i+1)
+		}
+		if lefts[pair.Left] {
+			return key, layout, fmt.Errorf("左侧项重复：%s", pair.Left)
+		}
+		lefts[pair.Left] = true
+		layout.Prompts = append(layout.Prompts, pair.Left)
+		// 多个左侧项可以对应同一右侧项
+		if !rights[pair.Right] {
+			rights[pair.Right] = true
+			layout.Choices = append(layout.Choices, pair.Right)
+		}
+	}
+	var distractors []string
+	for _, distractor := range key.Distractors {
+		if distractor = strings.TrimSpace(distractor); distractor != "" && !rights[distractor] {
+			rights[distractor] = true
+			distractors = append(distractors, distractor)
+			layout.Choices = append(layout.Choices, distractor)
+		}
+	}
+	key.Distractors = distractors
+	layout.Choices = stableShuffle(layout.Choices)
+	return key, layout, nil
+}
+
+func normalizeOrdering(answer string) (OrderingAnswer, QuestionLayout, error) {
+	var key OrderingAnswer
+	if err := json.Unmarshal([]byte(answer), &key); err != nil {
+		// 简写：按正确顺序排列的字符串数组
+		if json.Unmarshal([]byte(answer), &key.Items) != nil {
+			return key, QuestionLayout{}, errors.New("排序题答案需为JSON，如 {\"items\": [\"第一步\", \"第二步\", \"第三步\"]}")
+		}
+	}
+	if len(key.Items) < 2 || len(key.Items) > maxStructuredItems {
+		return key, QuestionLayout{}, fmt.Errorf("排序题需要2-%d项", maxStructuredItems)
+	}
+	seen := make(map[string]bool)
+	for i, item := range key.Items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return key, QuestionLayout{}, fmt.Errorf("第%d项不能为空", i+1)
+		}
+		if seen[item] {
+			return key, QuestionLayout{}, fmt.Errorf("排序项重复：%s", item)
+		}
+		seen[item] = true
+		key.Items[i] = item
+	}
+
+	items := stableShuffle(key.Items)
+	if strings.Join(items, "\x00") == strings.Join(key.Items, "\x00") {
+		// 打乱后恰好是正确顺序时整体轮转一位
+		items = append(items[1:], items[0])
+	}
+	return key, QuestionLayout{Items: items}, nil
+}
+
+func normalizeNumeric(answer string) (NumericAnswer, QuestionLayout, error) {
+	var key NumericAnswer
+	if err := json.Unmarshal([]byte(answer), &key); err != nil {
+		// 简写：只填写数值
+		value, parseErr := strconv.ParseFloat(strings.TrimSpace(answer), 64)
+		if parseErr != nil {
+			return key, QuestionLayout{}, errors.New("数值题答案需为数值或JSON，如 {\"value\": 9.8, \"tolerance\": 0.1, \"unit\": \"m/s²\"}")
+		}
+		key.Value = value
+	}
+	if math.IsNaN(key.Value) || math.IsInf(key.Value, 0) {
+		return key, QuestionLayout{}, errors.New("数值题答案无效")
+	}
+	if key.Tolerance < 0 {
+		return key, QuestionLayout{}, errors.New("允许误差不能为负数")
+	}
+	if key.UnitPenalty != nil && (*key.UnitPenalty < 0 || *key.UnitPenalty > 1) {
+		return key, QuestionLayout{}, errors.New("单位扣分比例需在0-1之间")
+	}
+
+	key.Unit = strings.TrimSpace(key.Unit)
+	var layout QuestionLayout
+	if key.Unit != "" {
+		layout.Units = append(layout.Units, key.Unit)
+	}
+	units := make(map[string]float64, len(key.Units))
+	for unit, multiplier := range key.Units {
+		unit = strings.TrimSpace(unit)
+		if unit == "" || unit == key.Unit {
+			continue
+		}
+		if multiplier <= 0 {
+			return key, layout, fmt.Errorf("单位 %s 的倍数需大于0", unit)
+		}
+		units[unit] = multiplier
+	}
+	others := make([]string, 0, len(units))
+	for unit := range units {
+		others = append(others, unit)
+	}
+	sort.Strings(others)
+	layout.Units = append(layout.Units, others...)
+	key.Units = units
+	if len(key.Units) == 0 {
+		key.Units = nil
+	}
+	if key.UnitRequired && len(layout.Units) == 0 {
+		return key, layout, errors.New("要求填写单位时需设置标准单位")
+	}
+	return key, layout, nil
+}
+
+// stableShuffle 按内容确定性地打乱顺序，同样的内容每次得到相同的展示顺序
+func stableShuffle(items []string) []string {
+	h := fnv.New64a()
+	for _, item := range items {
+		h.Write([]byte(item))
+		h.Write([]byte{0})
+	}
+	shuffled := append([]string(nil), items...)
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return shuffled
+}
+
+// GradeStructuredAnswer 为结构化题型评分，返回得分比例（0-1）：
+// 填空题按答对的空、配对题按答对的配对、排序题按位置正确的项计算，数值题单位不符时按比例扣分
+func GradeStructuredAnswer(question models.Question, studentAnswer string) float64 {
+	var layout QuestionLayout
+	json.Unmarshal([]byte(question.Options), &layout)
+	switch question.Type {
+	case models.FillBlank:
+		var key FillBlankAnswer
+		var answers []string
+		if json.Unmarshal([]byte(question.Answer), &key) != nil || json.Unmarshal([]byte(studentAnswer), &answers) != nil || len(key.Blanks) == 0 {
+			return 0
+		}
+		correct := 0
+		for i, accepted := range key.Blanks {
+			if i < len(answers) && blankMatches(answers[i], accepted, key.CaseSensitive) {
+				correct++
+			}
+		}
+		return float64(correct) / float64(len(key.Blanks))
+	case models.Matching:
+		var key MatchingAnswer
+		var choices []int
+		if json.Unmarshal([]byte(question.Answer), &key) != nil || json.Unmarshal([]byte(studentAnswer), &choices) != nil || len(key.Pairs) == 0 {
+			return 0
+		}
+		expected := make(map[string]string, len(key.Pairs))
+		for _, pair := range key.Pairs {
+			expected[pair.Left] = pair.Right
+		}
+		correct := 0
+		for i, prompt := range layout.Prompts {
+			if i < len(choices) && choices[i] >= 0 && choices[i] < len(layout.Choices) && layout.Choices[choices[i]] == expected[prompt] {
+				correct++
+			}
+		}
+		return float64(correct) / float64(len(key.Pairs))
+	case models.Ordering:
+		var key OrderingAnswer
+		var order []int
+		if json.Unmarshal([]byte(question.Answer), &key) != nil || json.Unmarshal([]byte(studentAnswer), &order) != nil || len(key.Items) == 0 {
+			return 0
+		}
+		correct := 0
+		for i, item := range key.Items {
+			if i < len(order) && order[i] >= 0 && order[i] < len(layout.Items) && layout.Items[order[i]] == item {
+				correct++
+			}
+		}
+		return float64(correct) / float64(len(key.Items))
+	case models.Numeric:
+		var key NumericAnswer
+		if json.Unmarshal([]byte(question.Answer), &key) != nil {
+			return 0
+		}
+		return gradeNumeric(key, studentAnswer)
+	}
+	return 0
+}
+
+// blankMatches 比较填空答案，忽略首尾和连续空白，默认不区分大小写
+func blankMatches(answer string, accepted []string, caseSensitive bool) bool {
+	answer = strings.Join(strings.Fields(answer), " ")
+	for _, value := range accepted {
+		value = strings.Join(strings.Fields(value), " ")
+		if answer == value || (!caseSensitive && strings.EqualFold(answer, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// gradeNumeric 按换算到标准单位后的数值评分
+func gradeNumeric(key NumericAnswer, studentAnswer string) float64 {
+	m := numericAnswerPattern.FindStringSubmatch(strings.TrimSpace(studentAnswer))
+	if m == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+
+	unit := strings.TrimSpace(m[2])
+	unitOK := true
+	switch {
+	case key.Unit == "" && len(key.Units) == 0:
+		// 未设置单位时忽略作答中的单位
+	case unit == "":
+		unitOK = !key.UnitRequired
+	case unit == key.Unit:
+	default:
+		if multiplier, ok := key.Units[unit]; ok {
+			value /= multiplier
+		} else {
+			unitOK = false
+		}
+	}
+
+	// 允许浮点计算的舍入误差
+	if math.Abs(value-key.Value) > key.Tolerance+1e-9*math.Max(1, math.Abs(key.Value)) {
+		return 0
+	}
+	if unitOK {
+		return 1
+	}
+	penalty := defaultUnitPenalty
+	if key.UnitPenalty != nil {
+		penalty = *key.UnitPenalty
+	}
+	return 1 - penalty
+}
+
+// QuestionScore 按得分比例计算题目得分，四舍五入到整数
+func QuestionScore(fullScore int, fraction float64) int {
+	return int(math.Round(float64(fullScore) * fraction))
+}
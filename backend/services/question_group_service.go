@@ -0,0 +1,169 @@
+package services
+
+import (
+	"errors"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// 材料题（阅读理解等）保存共享的题干，子题通过 parent_id 关联并按 position 排序。
+// 材料题本身不作答、不计分，分值为子题分值之和；组卷时材料题与全部子题作为一个整体
+
+var (
+	ErrInvalidQuestionParent = errors.New("所属材料不存在或不是材料题")
+	ErrQuestionParentSubject = errors.New("子题需与材料题属于同一科目")
+	ErrNestedMaterial        = errors.New("材料题不能属于其他材料题")
+	ErrMaterialHasChildren   = errors.New("材料题包含子题，不能修改题型或科目")
+)
+
+// CheckQuestionParent 校验子题所属的材料题：需存在于同一租户、类型为材料题且科目相同
+func CheckQuestionParent(db *gorm.DB, tenantID, parentID, subjectID uint, questionType models.QuestionType) error {
+	if questionType == models.Material {
+		return ErrNestedMaterial
+	}
+	var parent models.Question
+	if err := utils.WithTenant(db, tenantID).First(&parent, parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidQuestionParent
+		}
+		return err
+	}
+	if parent.Type != models.Material {
+		return ErrInvalidQuestionParent
+	}
+	if parent.SubjectID != subjectID {
+		return ErrQuestionParentSubject
+	}
+	return nil
+}
+
+// CheckMaterialChange 材料题包含子题时不能修改题型和科目
+func CheckMaterialChange(db *gorm.DB, before models.Question, questionType models.QuestionType, subjectID uint) error {
+	if before.Type != models.Material || (questionType == models.Material && subjectID == before.SubjectID) {
+		return nil
+	}
+	var count int64
+	if err := utils.WithTenant(db, before.TenantID).Model(&models.Question{}).Where("parent_id = ?", before.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrMaterialHasChildren
+	}
+	return nil
+}
+
+// RefreshMaterialScore 将材料题的分值更新为子题分值之和
+func RefreshMaterialScore(db *gorm.DB, tenantID, materialID uint) error {
+	var total int64
+	if err := utils.WithTenant(db, tenantID).Model(&models.Question{}).Where("parent_id = ?", materialID).
+		Select("COALESCE(SUM(score), 0)").Scan(&total).Error; err != nil {
+		return err
+	}
+	return utils.WithTenant(db, tenantID).Model(&models.Question{}).
+		Where("id = ? AND type = ?", materialID, models.Material).Update("score", total).Error
+}
+
+// LoadQuestionChildren 按序号读取材料题的子题
+func LoadQuestionChildren(db *gorm.DB, tenantID, materialID uint) ([]models.Question, error) {
+	var children []models.Question
+	err := utils.WithTenant(db, tenantID).Where("parent_id = ?", materialID).Order("position, id").Find(&children).Error
+	return children, err
+}
+
+// ExpandQuestionGroups 按材料组展开试卷题目：选中子题时加入其材料题，选中材料题时加入其全部子题
+func ExpandQuestionGroups(db *gorm.DB, tenantID uint, questions []models.Question) ([]models.Question, error) {
+	var materialIDs []uint
+	for _, question := range questions {
+		if question.ParentID != nil {
+			materialIDs = append(materialIDs, *question.ParentID)
+		} else if question.Type == models.Material {
+			materialIDs = append(materialIDs, question.ID)
+		}
+	}
+	if len(materialIDs) == 0 {
+		return questions, nil
+	}
+
+	var groupQuestions []models.Question
+	if err := utils.WithTenant(db, tenantID).Where("(id IN ? AND type = ?) OR parent_id IN ?", materialIDs, models.Material, materialIDs).
+		Find(&groupQuestions).Error; err != nil {
+		return nil, err
+	}
+	selected := make(map[uint]bool)
+	for _, question := range questions {
+		selected[question.ID] = true
+	}
+	expanded := append([]models.Question{}, questions...)
+	for _, question := range groupQuestions {
+		if !selected[question.ID] {
+			expanded = append(expanded, question)
+		}
+	}
+	return GroupQuestions(expanded), nil
+}
+
+// GroupQuestions 调整题目顺序，使每个材料题后紧跟按序号排列的子题；材料组位于其中任一题目首次出现的位置，
+// 其余题目保持原有顺序
+func GroupQuestions(questions []models.Question) []models.Question {
+	materials := make(map[uint]models.Question)
+	for _, question := range questions {
+		if question.Type == models.Material {
+			materials[question.ID] = question
+		}
+	}
+	if len(materials) == 0 {
+		return questions
+	}
+	children := make(map[uint][]models.Question)
+	for _, question := range questions {
+		if question.ParentID != nil {
+			if _, ok := materials[*question.ParentID]; ok {
+				children[*question.ParentID] = append(children[*question.ParentID], question)
+			}
+		}
+	}
+	for _, group := range children {
+		sort.SliceStable(group, func(i, j int) bool {
+			if group[i].Position != group[j].Position {
+				return group[i].Position < group[j].Position
+			}
+			return group[i].ID < group[j].ID
+		})
+	}
+
+	grouped := make([]models.Question, 0, len(questions))
+	placed := make(map[uint]bool)
+	for _, question := range questions {
+		groupID := question.ID
+		if question.ParentID != nil {
+			if _, ok := materials[*question.ParentID]; ok {
+				groupID = *question.ParentID
+			}
+		}
+		if _, ok := materials[groupID]; !ok {
+			grouped = append(grouped, question)
+			continue
+		}
+		if placed[groupID] {
+			continue
+		}
+		placed[groupID] = true
+		grouped = append(grouped, materials[groupID])
+		grouped = append(grouped, children[groupID]...)
+	}
+	return grouped
+}
+
+// QuestionsTotalScore 题目的总分，材料题本身不计分（其分值已包含在子题中）
+func QuestionsTotalScore(questions []models.Question) int {
+	total := 0
+	for _, question := range questions {
+		if question.Type != models.Material {
+			total += question.Score
+		}
+	}
+	return total
+}
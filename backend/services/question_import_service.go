@@ -0,0 +1,1182 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 单道题目最多的选项数（A-H）
+const maxQuestionOptions = 8
+
+var (
+	ErrUnsupportedImportFormat = errors.New("不支持的文件格式，请上传 .xlsx、.csv、.json、.docx、.txt、Moodle XML(.xml)、GIFT(.gift) 或 QTI 2.1 题目包(.zip)")
+	ErrLegacyOfficeFormat      = errors.New("不支持旧版 .xls/.doc 文件，请另存为 .xlsx/.docx 后上传")
+	ErrImportHeaderMissing     = errors.New("未找到表头，请使用导入模板（至少包含“题干”和“答案”列）")
+	ErrImportEncoding          = errors.New("CSV/文本文件需使用UTF-8编码")
+	ErrNoQuestionsFound        = errors.New("文件中没有找到题目")
+)
+
+// QuestionImportTemplateHeader 表格导入模板的列，导出题目时使用相同的列。
+// ID留空时新建题目，填写时更新该题目；材料ID为子题所属材料题的ID
+var QuestionImportTemplateHeader = []string{
+	"ID", "题型", "科目", "标题", "题干", "选项A", "选项B", "选项C", "选项D", "选项E", "选项F", "选项G", "选项H",
+	"答案", "解析", "难度", "分值", "知识点", "状态", "材料ID", "序号",
+}
+
+// questionImportColumns 表头名称（中文或英文）对应的字段
+var questionImportColumns = map[string]string{
+	"id": "id", "题目id": "id",
+	"题型": "type", "type": "type",
+	"科目": "subject", "subject": "subject",
+	"标题": "title", "title": "title",
+	"题干": "content", "题目内容": "content", "content": "content",
+	"选项": "options", "options": "options",
+	"答案": "answer", "answer": "answer",
+	"解析": "explanation", "explanation": "explanation",
+	"难度": "difficulty", "difficulty": "difficulty",
+	"分值": "score", "score": "score",
+	"知识点": "knowledge_point", "knowledge_point": "knowledge_point",
+	"状态": "status", "status": "status",
+	"材料id": "parent_id", "parent_id": "parent_id",
+	"序号": "position", "position": "position",
+}
+
+// questionTypeAliases 题型的中英文写法
+var questionTypeAliases = map[string]models.QuestionType{
+	"单选": models.SingleChoice, "单选题": models.SingleChoice, "single": models.SingleChoice, "single_choice": models.SingleChoice,
+	"多选": models.MultipleChoice, "多选题": models.MultipleChoice, "multiple": models.MultipleChoice, "multiple_choice": models.MultipleChoice,
+	"判断": models.TrueFalse, "判断题": models.TrueFalse, "judge": models.TrueFalse, "true_false": models.TrueFalse,
+	"简答": models.ShortAnswer, "简答题": models.ShortAnswer, "问答题": models.ShortAnswer, "short": models.ShortAnswer, "short_answer": models.ShortAnswer,
+	"填空": models.FillBlank, "填空题": models.FillBlank, "fill": models.FillBlank, "fill_blank": models.FillBlank,
+	"配对": models.Matching, "配对题": models.Matching, "连线题": models.Matching, "matching": models.Matching,
+	"排序": models.Ordering, "排序题": models.Ordering, "ordering": models.Ordering,
+	"数值": models.Numeric, "数值题": models.Numeric, "numeric": models.Numeric,
+	"材料": models.Material, "材料题": models.Material, "阅读理解": models.Material, "material": models.Material,
+}
+
+// QuestionTypeLabels 导出时使用的题型名称
+var QuestionTypeLabels = map[models.QuestionType]string{
+	models.SingleChoice:   "单选题",
+	models.MultipleChoice: "多选题",
+	models.TrueFalse:      "判断题",
+	models.ShortAnswer:    "简答题",
+	models.FillBlank:      "填空题",
+	models.Matching:       "配对题",
+	models.Ordering:       "排序题",
+	models.Numeric:        "数值题",
+	models.Material:       "材料题",
+}
+
+// questionStatusAliases 题目状态的中英文写法
+var questionStatusAliases = map[string]models.QuestionStatus{
+	"草稿": models.QuestionDraft, "draft": models.QuestionDraft,
+	"待审核": models.QuestionSubmitted, "submitted": models.QuestionSubmitted,
+	"审核通过": models.QuestionApproved, "已通过": models.QuestionApproved, "approved": models.QuestionApproved,
+	"已驳回": models.QuestionRejected, "驳回": models.QuestionRejected, "rejected": models.QuestionRejected,
+	"已发布": models.QuestionPublished, "发布": models.QuestionPublished, "published": models.QuestionPublished,
+	"已归档": models.QuestionArchived, "归档": models.QuestionArchived, "archived": models.QuestionArchived,
+}
+
+// QuestionStatusLabels 导出时使用的题目状态名称
+var QuestionStatusLabels = map[models.QuestionStatus]string{
+	models.QuestionDraft:     "草稿",
+	models.QuestionSubmitted: "待审核",
+	models.QuestionApproved:  "审核通过",
+	models.QuestionRejected:  "已驳回",
+	models.QuestionPublished: "已发布",
+	models.QuestionArchived:  "已归档",
+}
+
+// trueFalseAliases 判断题答案的写法，统一保存为 true/false
+var trueFalseAliases = map[string]string{
+	"true": "true", "t": "true", "yes": "true", "对": "true", "正确": "true", "是": "true", "√": "true", "✓": "true",
+	"false": "false", "f": "false", "no": "false", "错": "false", "错误": "false", "否": "false", "×": "false", "✗": "false",
+}
+
+var (
+	// 文本格式：“1. 题干”开始一道题，“A. 选项”为选项，“答案：B”等为字段
+	textQuestionPattern = regexp.MustCompile(`^(\d+)\s*[.、．)）]\s*(.*)$`)
+	textOptionPattern   = regexp.MustCompile(`^([A-H])\s*[.、．)）]\s*(.*)$`)
+	textFieldPattern    = regexp.MustCompile(`^(?i)(答案|解析|难度|分值|题型|科目|知识点|标题|answer|explanation|difficulty|score|type|subject|knowledge_point)\s*[:：]\s*(.*)$`)
+	optionLabelPattern  = regexp.MustCompile(`^[A-H]\s*[.、．)）]\s*`)
+)
+
+// textFieldNames 文本格式字段名对应的字段
+var textFieldNames = map[string]string{
+	"答案": "answer", "解析": "explanation", "难度": "difficulty", "分值": "score",
+	"题型": "type", "科目": "subject", "知识点": "knowledge_point", "标题": "title",
+}
+
+// ImportedQuestion 从文件解析出的一道题目及其校验结果
+type ImportedQuestion struct {
+	Row            int                   `json:"row"`          // 表格中的行号，文本格式为题目开始的行号
+	ID             uint                  `json:"id,omitempty"` // 非0时更新题库中的该题目
+	Type           models.QuestionType   `json:"type"`
+	Subject        string                `json:"subject"`
+	SubjectID      uint                  `json:"subject_id"`
+	Title          string                `json:"title"`
+	Content        string                `json:"content"`
+	Options        []string              `json:"options"`
+	OptionFeedback []string              `json:"option_feedback,omitempty"` // 选择题各选项的反馈（JSON、Moodle XML导入时可指定）
+	Answer         string                `json:"answer"`
+	Explanation    string                `json:"explanation"`
+	Difficulty     int                   `json:"difficulty"`
+	Score          int                   `json:"score"`
+	KnowledgePoint string                `json:"knowledge_point"`
+	Status         models.QuestionStatus `json:"status,omitempty"`     // JSON导入时可指定，默认与创建题目相同
+	Visibility     models.Visibility     `json:"visibility,omitempty"` // JSON导入时可指定，默认使用导入请求的可见范围
+	ParentID       uint                  `json:"parent_id,omitempty"`  // 所属材料题
+	Position       int                   `json:"position,omitempty"`   // 在材料题中的序号
+	Valid          bool                  `json:"valid"`
+	Errors         []ImportRowError      `json:"errors,omitempty"`
+
+	rawID         string
+	rawType       string
+	rawDifficulty string
+	rawScore      string
+	rawParentID   string
+	rawPosition   string
+	parentSet     bool             // 文件中包含材料ID，更新题目时按其修改所属材料题
+	layout        string           // 结构化题型由答案生成的展示数据
+	parseErrors   []ImportRowError // 解析时发现的错误（如不支持的题型），校验时直接作为该题的错误
+}
+
+// QuestionImportDefaults 文件中未填写时使用的默认值
+type QuestionImportDefaults struct {
+	SubjectID  uint
+	Difficulty int
+	Score      int
+}
+
+// QuestionImportService 题库文件导入
+type QuestionImportService struct{}
+
+// NewQuestionImportService 创建题库导入服务实例
+func NewQuestionImportService() *QuestionImportService {
+	return &QuestionImportService{}
+}
+
+// ParseFile 按扩展名解析XLSX、CSV、JSON、DOCX、文本文件以及Moodle XML、GIFT、QTI 2.1题目包中的题目，不做校验
+func (qs *QuestionImportService) ParseFile(filename string, data []byte) ([]ImportedQuestion, error) {
+	var items []ImportedQuestion
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		rows, err := ReadXLSX(data)
+		if err != nil {
+			return nil, err
+		}
+		if items, err = parseQuestionTable(rows); err != nil {
+			return nil, err
+		}
+	case ".csv":
+		text, err := decodeImportText(data)
+		if err != nil {
+			return nil, err
+		}
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("CSV格式错误: %v", err)
+		}
+		if items, err = parseQuestionTable(rows); err != nil {
+			return nil, err
+		}
+	case ".json":
+		text, err := decodeImportText(data)
+		if err != nil {
+			return nil, err
+		}
+		if items, err = parseQuestionJSON([]byte(text)); err != nil {
+			return nil, err
+		}
+	case ".docx":
+		lines, err := ReadDOCXLines(data)
+		if err != nil {
+			return nil, err
+		}
+		items = parseQuestionText(lines)
+	case ".txt":
+		text, err := decodeImportText(data)
+		if err != nil {
+			return nil, err
+		}
+		items = parseQuestionText(strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"))
+	case ".xml":
+		root, err := parseXMLTree(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		switch root.Name {
+		case "quiz":
+			items = parseMoodleXML(root)
+		case "assessmentItem":
+			items = []ImportedQuestion{parseQTIItem(root, 1)}
+		default:
+			return nil, ErrUnsupportedXMLFormat
+		}
+	case ".gift":
+		text, err := decodeImportText(data)
+		if err != nil {
+			return nil, err
+		}
+		items = parseGIFT(text)
+	case ".zip":
+		var err error
+		if items, err = parseQTIPackage(data); err != nil {
+			return nil, err
+		}
+	case ".xls", ".doc":
+		return nil, ErrLegacyOfficeFormat
+	default:
+		return nil, ErrUnsupportedImportFormat
+	}
+	if len(items) == 0 {
+		return nil, ErrNoQuestionsFound
+	}
+	return items, nil
+}
+
+// decodeImportText 校验UTF-8编码并去掉BOM
+func decodeImportText(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	if !utf8.Valid(data) {
+		return "", ErrImportEncoding
+	}
+	return string(data), nil
+}
+
+// parseQuestionTable 解析表格：第一行非空行为表头，列顺序不限，未知列忽略
+func parseQuestionTable(rows [][]string) ([]ImportedQuestion, error) {
+	headerIndex := -1
+	for i, row := range rows {
+		if !isBlankRow(row) {
+			headerIndex = i
+			break
+		}
+	}
+	if headerIndex < 0 {
+		return nil, ErrNoQuestionsFound
+	}
+
+	fields := make(map[int]string)
+	optionColumns := make(map[int]int) // 列下标 -> 选项下标
+	hasContent, hasAnswer, hasParent := false, false, false
+	for col, name := range rows[headerIndex] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if index, ok := optionColumnIndex(name); ok {
+			optionColumns[col] = index
+			continue
+		}
+		if field, ok := questionImportColumns[name]; ok {
+			fields[col] = field
+			hasContent = hasContent || field == "content" || field == "title"
+			hasAnswer = hasAnswer || field == "answer"
+			hasParent = hasParent || field == "parent_id"
+		}
+	}
+	if !hasContent || !hasAnswer {
+		return nil, ErrImportHeaderMissing
+	}
+
+	var items []ImportedQuestion
+	for i := headerIndex + 1; i < len(rows); i++ {
+		row := rows[i]
+		if isBlankRow(row) {
+			continue
+		}
+		item := ImportedQuestion{Row: i + 1, parentSet: hasParent} // 表格包含材料ID列时，留空表示不属于材料题
+		options := make([]string, maxQuestionOptions)
+		for col, value := range row {
+			value = strings.TrimSpace(value)
+			if index, ok := optionColumns[col]; ok {
+				options[index] = value
+				continue
+			}
+			switch fields[col] {
+			case "options":
+				// 单列填写全部选项时，每行一个或用 | 分隔
+				for j, option := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == '|' }) {
+					if j < maxQuestionOptions {
+						options[j] = strings.TrimSpace(option)
+					}
+				}
+			default:
+				item.SetField(fields[col], value)
+			}
+		}
+		item.Options = trimTrailingEmpty(options)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// optionColumnIndex 识别“选项A”“option_a”“A”形式的选项列
+func optionColumnIndex(name string) (int, bool) {
+	for _, prefix := range []string{"选项", "option_", "option "} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	if len(name) == 1 && name[0] >= 'a' && name[0] < 'a'+maxQuestionOptions {
+		return int(name[0] - 'a'), true
+	}
+	return 0, false
+}
+
+// parseQuestionText 解析文本格式（Word文档与.txt相同）：“1. 题干”开始一道题，题干可以有多行，
+// 其后“A. 选项”为选项，“答案：B”“解析：……”等为字段，可选字段有题型、科目、难度、分值、知识点、标题。
+// 以 # 开头的行为注释，第一道题之前的内容忽略
+func parseQuestionText(lines []string) []ImportedQuestion {
+	var items []ImportedQuestion
+	var current *ImportedQuestion
+	lastField := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if m := textQuestionPattern.FindStringSubmatch(line); m != nil {
+			items = append(items, ImportedQuestion{Row: i + 1, Content: m[2]})
+			current = &items[len(items)-1]
+			lastField = "content"
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if m := textOptionPattern.FindStringSubmatch(line); m != nil && lastField != "explanation" {
+			current.Options = append(current.Options, m[2])
+			lastField = "option"
+			continue
+		}
+		if m := textFieldPattern.FindStringSubmatch(line); m != nil {
+			field := strings.ToLower(m[1])
+			if mapped, ok := textFieldNames[m[1]]; ok {
+				field = mapped
+			}
+			current.SetField(field, m[2])
+			lastField = field
+			continue
+		}
+
+		// 续行：追加到上一个多行字段
+		switch lastField {
+		case "content":
+			current.Content = joinLine(current.Content, line)
+		case "option":
+			current.Options[len(current.Options)-1] = joinLine(current.Options[len(current.Options)-1], line)
+		case "explanation":
+			current.Explanation = joinLine(current.Explanation, line)
+		case "answer":
+			current.Answer = joinLine(current.Answer, line)
+		}
+	}
+	return items
+}
+
+// SetField 按字段名设置原始值（题型、难度、分值在校验时解析）
+func (item *ImportedQuestion) SetField(field, value string) {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "id":
+		item.rawID = value
+	case "type":
+		item.rawType = value
+	case "subject":
+		item.Subject = value
+	case "title":
+		item.Title = value
+	case "content":
+		item.Content = value
+	case "answer":
+		item.Answer = value
+	case "explanation":
+		item.Explanation = value
+	case "difficulty":
+		item.rawDifficulty = value
+	case "score":
+		item.rawScore = value
+	case "knowledge_point":
+		item.KnowledgePoint = value
+	case "parent_id":
+		item.rawParentID = value
+		item.parentSet = true
+	case "position":
+		item.rawPosition = value
+	case "status":
+		if status, ok := questionStatusAliases[strings.ToLower(value)]; ok {
+			item.Status = status
+		} else {
+			item.Status = models.QuestionStatus(value)
+		}
+	}
+}
+
+// Validate 解析科目、题型、答案和默认值，逐题记录校验错误
+func (qs *QuestionImportService) Validate(tenantID uint, items []ImportedQuestion, defaults QuestionImportDefaults) {
+	var subjects []models.Subject
+	utils.WithTenant(database.DB, tenantID).Find(&subjects)
+	subjectsByName := make(map[string]uint, len(subjects))
+	subjectsByID := make(map[uint]string, len(subjects))
+	for _, subject := range subjects {
+		subjectsByName[strings.ToLower(subject.Name)] = subject.ID
+		subjectsByID[subject.ID] = subject.Name
+	}
+
+	seenIDs := make(map[uint]int) // 题目ID -> 首次出现的行号
+	for i := range items {
+		item := &items[i]
+		item.Errors = nil
+		item.layout = ""
+		if len(item.parseErrors) > 0 {
+			if item.Title == "" {
+				item.Title = questionTitleFromContent(item.Content)
+			}
+			item.Errors = append(item.Errors, item.parseErrors...)
+			item.Valid = false
+			continue
+		}
+		addError := func(field, format string, args ...interface{}) {
+			item.Errors = append(item.Errors, ImportRowError{Row: item.Row, Field: field, Reason: fmt.Sprintf(format, args...)})
+		}
+
+		// ID：填写时更新该题目，同一文件中不能重复
+		if item.rawID != "" {
+			id, err := strconv.ParseUint(item.rawID, 10, 32)
+			if err != nil || id == 0 {
+				addError("id", "无效的题目ID：%s", item.rawID)
+			} else if row, ok := seenIDs[uint(id)]; ok {
+				addError("id", "与第%d行的题目ID重复", row)
+			} else {
+				item.ID = uint(id)
+				seenIDs[item.ID] = item.Row
+			}
+		}
+
+		// 材料ID和序号：子题所属的材料题在导入时校验
+		item.ParentID, item.Position = 0, 0
+		if item.rawParentID != "" {
+			id, err := strconv.ParseUint(item.rawParentID, 10, 32)
+			if err != nil || id == 0 {
+				addError("parent_id", "无效的材料ID：%s", item.rawParentID)
+			} else {
+				item.ParentID = uint(id)
+			}
+		}
+		if item.rawPosition != "" {
+			item.Position = parseImportInt(item.rawPosition)
+			if item.Position < 0 {
+				addError("position", "序号需为非负整数")
+			}
+		}
+
+		// 科目：按名称或ID匹配，未填写时使用默认科目
+		switch {
+		case item.Subject != "":
+			if id, ok := subjectsByName[strings.ToLower(item.Subject)]; ok {
+				item.SubjectID = id
+			} else if id, err := strconv.ParseUint(item.Subject, 10, 32); err == nil && subjectsByID[uint(id)] != "" {
+				item.SubjectID = uint(id)
+				item.Subject = subjectsByID[uint(id)]
+			} else {
+				addError("subject", "科目不存在：%s", item.Subject)
+			}
+		case defaults.SubjectID != 0 && subjectsByID[defaults.SubjectID] != "":
+			item.SubjectID = defaults.SubjectID
+			item.Subject = subjectsByID[defaults.SubjectID]
+		default:
+			addError("subject", "未填写科目")
+		}
+
+		if item.Content == "" && item.Title == "" {
+			addError("content", "题干不能为空")
+		}
+		if item.Title == "" {
+			item.Title = questionTitleFromContent(item.Content)
+		}
+
+		// 题型：未填写时按选项和答案推断
+		if item.rawType != "" {
+			questionType, ok := questionTypeAliases[strings.ToLower(item.rawType)]
+			if !ok {
+				addError("type", "无法识别的题型：%s", item.rawType)
+			}
+			item.Type = questionType
+		} else {
+			item.Type = inferQuestionType(item.Options, item.Answer)
+		}
+
+		if field, reason := normalizeImportedAnswer(item); reason != "" {
+			addError(field, "%s", reason)
+		}
+
+		item.Difficulty = defaults.Difficulty
+		if item.rawDifficulty != "" {
+			item.Difficulty = parseImportInt(item.rawDifficulty)
+		}
+		if item.Difficulty < 1 || item.Difficulty > 5 {
+			addError("difficulty", "难度需为1-5的整数")
+		}
+		// 材料题的分值为子题分值之和
+		item.Score = defaults.Score
+		if item.rawScore != "" {
+			item.Score = parseImportInt(item.rawScore)
+		}
+		if item.Type == models.Material {
+			item.Score = 0
+		} else if item.Score < 1 || item.Score > 100 {
+			addError("score", "分值需为1-100的整数")
+		}
+
+		if item.Status != "" && !IsValidQuestionStatus(item.Status) {
+			addError("status", "无效的题目状态：%s", item.Status)
+		}
+		if item.Visibility != "" && !IsValidVisibility(item.Visibility) {
+			addError("visibility", "%s", ErrInvalidVisibility.Error())
+		}
+
+		item.Valid = len(item.Errors) == 0
+	}
+}
+
+// normalizeImportedAnswer 按题型校验选项和答案，并统一选项和答案的写法，返回出错的字段和原因
+func normalizeImportedAnswer(item *ImportedQuestion) (string, string) {
+	if item.Type == models.Material {
+		if len(item.Options) > 0 || item.Answer != "" {
+			return "answer", "材料题不需要填写选项和答案，请在子题中填写"
+		}
+		return "", ""
+	}
+	if item.Answer == "" {
+		return "answer", "答案不能为空"
+	}
+	switch item.Type {
+	case models.SingleChoice, models.MultipleChoice:
+		if len(item.Options) < 2 {
+			return "options", "选择题至少需要2个选项"
+		}
+		for i, option := range item.Options {
+			if option == "" {
+				return "options", fmt.Sprintf("选项%c不能为空", 'A'+i)
+			}
+			// 选项统一保存为“A. 内容”
+			item.Options[i] = fmt.Sprintf("%c. %s", 'A'+i, optionLabelPattern.ReplaceAllString(option, ""))
+		}
+		letters := answerLetters(item.Answer)
+		if len(letters) == 0 {
+			return "answer", "选择题答案需填写选项字母"
+		}
+		for _, letter := range letters {
+			if int(letter-'A') >= len(item.Options) {
+				return "answer", fmt.Sprintf("答案 %c 不在选项中", letter)
+			}
+		}
+		if item.Type == models.SingleChoice && len(letters) != 1 {
+			return "answer", "单选题只能有一个答案"
+		}
+		if len(item.OptionFeedback) > len(item.Options) {
+			return "options", "选项反馈多于选项"
+		}
+		parts := make([]string, len(letters))
+		for i, letter := range letters {
+			parts[i] = string(letter)
+		}
+		item.Answer = strings.Join(parts, ",")
+	case models.TrueFalse:
+		if len(item.Options) > 0 {
+			return "options", "判断题不需要填写选项"
+		}
+		answer, ok := trueFalseAliases[strings.ToLower(item.Answer)]
+		if !ok {
+			return "answer", "判断题答案需为“对/错”或“true/false”"
+		}
+		item.Answer = answer
+	case models.ShortAnswer:
+		if len(item.Options) > 0 {
+			return "options", "简答题不需要填写选项"
+		}
+	case models.FillBlank, models.Matching, models.Ordering, models.Numeric:
+		if len(item.Options) > 0 {
+			return "options", "该题型不需要填写选项，配对项、排序项等写在答案中"
+		}
+		answer, layout, err := NormalizeStructuredAnswer(item.Type, item.Content, item.Answer)
+		if err != nil {
+			return "answer", err.Error()
+		}
+		item.Answer, item.layout = answer, layout
+	}
+	return "", ""
+}
+
+// answerLetters 提取答案中的选项字母（支持“ABC”“A,B,C”“A、C”等写法），去重并排序
+func answerLetters(answer string) []rune {
+	seen := make(map[rune]bool)
+	var letters []rune
+	for _, ch := range strings.ToUpper(answer) {
+		switch {
+		case ch >= 'A' && ch <= 'Z':
+			if !seen[ch] {
+				seen[ch] = true
+				letters = append(letters, ch)
+			}
+		case strings.ContainsRune(",，、;； ()（）", ch):
+		default:
+			return nil
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+	return letters
+}
+
+// inferQuestionType 未填写题型时推断：有选项为单选/多选，答案为对错时为判断题，否则为简答题
+func inferQuestionType(options []string, answer string) models.QuestionType {
+	if len(options) > 0 {
+		if len(answerLetters(answer)) > 1 {
+			return models.MultipleChoice
+		}
+		return models.SingleChoice
+	}
+	if _, ok := trueFalseAliases[strings.ToLower(strings.TrimSpace(answer))]; ok {
+		return models.TrueFalse
+	}
+	return models.ShortAnswer
+}
+
+// questionTitleFromContent 未填写标题时取题干第一行的前50个字符
+func questionTitleFromContent(content string) string {
+	title := strings.TrimSpace(strings.SplitN(content, "\n", 2)[0])
+	if runes := []rune(title); len(runes) > 50 {
+		title = string(runes[:50]) + "…"
+	}
+	return title
+}
+
+// parseImportInt 解析整数，兼容Excel中的“3.0”，无法解析时返回0
+func parseImportInt(value string) int {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f != float64(int(f)) {
+		return 0
+	}
+	return int(f)
+}
+
+// Question 将校验通过的题目转换为题目模型，创建者、状态和可见范围由调用方设置
+func (item ImportedQuestion) Question() models.Question {
+	optionsJSON, _ := json.Marshal(item.Options)
+	if item.layout != "" {
+		optionsJSON = []byte(item.layout)
+	}
+	if item.Type == models.Material {
+		optionsJSON = nil
+	}
+	question := models.Question{
+		SubjectID:      item.SubjectID,
+		Type:           item.Type,
+		Title:          item.Title,
+		Content:        item.Content,
+		Options:        string(optionsJSON),
+		Answer:         item.Answer,
+		Explanation:    item.Explanation,
+		Difficulty:     item.Difficulty,
+		Score:          item.Score,
+		KnowledgePoint: item.KnowledgePoint,
+		Position:       item.Position,
+	}
+	if item.ParentID != 0 {
+		parentID := item.ParentID
+		question.ParentID = &parentID
+	}
+	return question
+}
+
+// Tasks 将校验后的题目转换为导入任务的行：填写了ID的题目更新题库中的该题目（需有编辑权限，内容未变化时跳过），
+// 其余题目新建；skipDuplicates为true时跳过题库中已有的相同题目
+func (qs *QuestionImportService) Tasks(actor Actor, items []ImportedQuestion, visibility models.Visibility, skipDuplicates bool) []ImportRowTask {
+	tasks := make([]ImportRowTask, len(items))
+	for i := range items {
+		item := items[i]
+		tasks[i] = ImportRowTask{
+			Row:    item.Row,
+			Key:    item.Title,
+			Errors: item.Errors,
+			Apply: func(tx *gorm.DB) (ImportOutcome, error) {
+				if item.ID != 0 {
+					return updateImportedQuestion(tx, actor, item)
+				}
+				question := item.Question()
+				if skipDuplicates {
+					var existing models.Question
+					result := utils.WithTenant(tx, actor.TenantID).
+						Where("subject_id = ? AND type = ? AND title = ? AND content = ? AND answer = ? AND options = ?",
+							question.SubjectID, question.Type, question.Title, question.Content, question.Answer, question.Options).
+						Limit(1).Find(&existing)
+					if result.Error != nil {
+						return ImportOutcome{}, result.Error
+					}
+					if result.RowsAffected > 0 {
+						return ImportOutcome{Skipped: true, Reason: "题库中已有相同题目", ResourceID: existing.ID}, nil
+					}
+				}
+
+				// 状态与创建题目相同：新题目为草稿或导入后直接提交审核
+				reviews := NewQuestionReviewService()
+				status, err := InitialQuestionStatus(item.Status)
+				if err != nil {
+					return ImportOutcome{}, NewImportFieldError("status", err.Error())
+				}
+				submit := status == models.QuestionSubmitted
+				if submit {
+					status = models.QuestionDraft
+				}
+				question.Status = status
+				question.Visibility = visibility
+				if item.Visibility != "" {
+					question.Visibility = item.Visibility
+				}
+				question.CreatedBy = actor.UserID
+				question.TenantID = actor.TenantID
+				if err := checkImportedQuestionParent(tx, actor.TenantID, question); err != nil {
+					return ImportOutcome{}, err
+				}
+				if err := checkImportedQuestionAttachments(tx, actor.TenantID, question); err != nil {
+					return ImportOutcome{}, err
+				}
+				options, err := item.questionOptions()
+				if err != nil {
+					return ImportOutcome{}, err
+				}
+				if err := tx.Create(&question).Error; err != nil {
+					return ImportOutcome{}, err
+				}
+				if question.Choices, err = SaveQuestionOptions(tx, actor.TenantID, question.ID, options); err != nil {
+					return ImportOutcome{}, err
+				}
+				if _, _, err := RecordQuestionRevision(tx, &question, actor.UserID); err != nil {
+					return ImportOutcome{}, err
+				}
+				if question.ParentID != nil {
+					if err := reviews.ReviseQuestion(tx, actor, &question); err != nil {
+						return ImportOutcome{}, err
+					}
+				} else if submit {
+					if _, err := reviews.Transition(tx, actor, &question, ReviewSubmit, ""); err != nil {
+						return ImportOutcome{}, err
+					}
+				}
+				if err := SyncQuestionAttachments(tx, actor.TenantID, question); err != nil {
+					return ImportOutcome{}, err
+				}
+				if question.ParentID != nil {
+					if err := RefreshMaterialScore(tx, actor.TenantID, *question.ParentID); err != nil {
+						return ImportOutcome{}, err
+					}
+				}
+				return ImportOutcome{ResourceID: question.ID, Snapshot: question}, nil
+			},
+		}
+	}
+	return tasks
+}
+
+// updateImportedQuestion 按ID更新题目，权限检查与修改题目接口相同
+func updateImportedQuestion(tx *gorm.DB, actor Actor, item ImportedQuestion) (ImportOutcome, error) {
+	var question models.Question
+	if err := utils.WithTenant(tx, actor.TenantID).First(&question, item.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ImportOutcome{}, NewImportFieldError("id", "题目不存在")
+		}
+		return ImportOutcome{}, err
+	}
+	access := NewAccessService()
+	if !access.CanEdit(actor, ResourceQuestion, question.ID, question.CreatedBy) {
+		return ImportOutcome{}, NewImportFieldError("id", "没有权限修改此题目")
+	}
+
+	before := question
+	updated := item.Question()
+	question.SubjectID = updated.SubjectID
+	question.Type = updated.Type
+	question.Title = updated.Title
+	question.Content = updated.Content
+	if !sameQuestionOptions(question.Options, updated.Options) {
+		question.Options = updated.Options
+	}
+	question.Answer = updated.Answer
+	question.Explanation = updated.Explanation
+	question.Difficulty = updated.Difficulty
+	if question.Type != models.Material {
+		question.Score = updated.Score
+	}
+	question.KnowledgePoint = updated.KnowledgePoint
+	if item.parentSet {
+		question.ParentID = updated.ParentID
+		question.Position = updated.Position
+	}
+	if err := CheckMaterialChange(tx, before, question.Type, question.SubjectID); err != nil {
+		if errors.Is(err, ErrMaterialHasChildren) {
+			return ImportOutcome{}, NewImportFieldError("type", err.Error())
+		}
+		return ImportOutcome{}, err
+	}
+	if question.ParentID != nil && *question.ParentID == question.ID {
+		return ImportOutcome{}, NewImportFieldError("parent_id", ErrInvalidQuestionParent.Error())
+	}
+	if err := checkImportedQuestionParent(tx, actor.TenantID, question); err != nil {
+		return ImportOutcome{}, err
+	}
+	if err := checkImportedQuestionAttachments(tx, actor.TenantID, question); err != nil {
+		return ImportOutcome{}, err
+	}
+	options, err := item.questionOptions()
+	if err != nil {
+		return ImportOutcome{}, err
+	}
+	existingOptions, err := LoadQuestionOptions(tx, actor.TenantID, []uint{question.ID})
+	if err != nil {
+		return ImportOutcome{}, err
+	}
+	before.Choices = existingOptions[question.ID]
+	if item.Visibility != "" && item.Visibility != question.Visibility {
+		if !access.CanManage(actor, question.CreatedBy) {
+			return ImportOutcome{}, NewImportFieldError("visibility", "只有创建者可以修改共享设置")
+		}
+		question.Visibility = item.Visibility
+	}
+
+	// 修改状态需符合审核流程，与修改题目接口相同
+	statusAction := ""
+	if item.Status != "" && item.Status != question.Status {
+		action, ok := QuestionStatusAction(question.Status, item.Status)
+		if !ok {
+			return ImportOutcome{}, NewImportFieldError("status", ErrInvalidQuestionTransition.Error())
+		}
+		statusAction = action
+	}
+
+	if question.SubjectID == before.SubjectID && question.Type == before.Type && question.Title == before.Title &&
+		question.Content == before.Content && question.Options == before.Options && question.Answer == before.Answer &&
+		question.Explanation == before.Explanation && question.Difficulty == before.Difficulty && question.Score == before.Score &&
+		question.KnowledgePoint == before.KnowledgePoint && statusAction == "" && question.Visibility == before.Visibility &&
+		sameParentID(question.ParentID, before.ParentID) && question.Position == before.Position &&
+		SameQuestionOptions(options, before.Choices) {
+		return ImportOutcome{Skipped: true, Reason: "题目内容未变化", ResourceID: question.ID}, nil
+	}
+	if err := EnsureQuestionRevisions(tx, actor.TenantID, []uint{question.ID}); err != nil {
+		return ImportOutcome{}, err
+	}
+	if err := tx.Save(&question).Error; err != nil {
+		return ImportOutcome{}, err
+	}
+	if question.Choices, err = SaveQuestionOptions(tx, actor.TenantID, question.ID, options); err != nil {
+		return ImportOutcome{}, err
+	}
+	_, revised, err := RecordQuestionRevision(tx, &question, actor.UserID)
+	if err != nil {
+		return ImportOutcome{}, err
+	}
+	reviews := NewQuestionReviewService()
+	if revised {
+		if err := reviews.ReviseQuestion(tx, actor, &question); err != nil {
+			return ImportOutcome{}, err
+		}
+	}
+	if statusAction != "" {
+		if err := reviews.ChangeStatus(tx, actor, &question, item.Status); err != nil {
+			if errors.Is(err, ErrInvalidQuestionTransition) || errors.Is(err, ErrNotQuestionReviewer) ||
+				errors.Is(err, ErrReviewOwnQuestion) || errors.Is(err, ErrReviewCommentRequired) || errors.Is(err, ErrReviewChildQuestion) {
+				return ImportOutcome{}, NewImportFieldError("status", err.Error())
+			}
+			return ImportOutcome{}, err
+		}
+	}
+	if err := SyncQuestionAttachments(tx, actor.TenantID, question); err != nil {
+		return ImportOutcome{}, err
+	}
+
+	// 重新计算相关材料题的分值
+	for _, materialID := range []*uint{before.ParentID, question.ParentID} {
+		if materialID != nil {
+			if err := RefreshMaterialScore(tx, actor.TenantID, *materialID); err != nil {
+				return ImportOutcome{}, err
+			}
+		}
+	}
+	return ImportOutcome{ResourceID: question.ID, Before: before, Snapshot: question}, nil
+}
+
+// checkImportedQuestionParent 校验导入题目所属的材料题，校验失败时作为材料ID列的错误
+func checkImportedQuestionParent(tx *gorm.DB, tenantID uint, question models.Question) error {
+	if question.ParentID == nil {
+		return nil
+	}
+	err := CheckQuestionParent(tx, tenantID, *question.ParentID, question.SubjectID, question.Type)
+	if errors.Is(err, ErrInvalidQuestionParent) || errors.Is(err, ErrQuestionParentSubject) || errors.Is(err, ErrNestedMaterial) {
+		return NewImportFieldError("parent_id", err.Error())
+	}
+	return err
+}
+
+// questionOptions 由校验后的选项和答案生成选择题的选项，其他题型返回空列表（保存时删除已有选项）
+func (item ImportedQuestion) questionOptions() ([]models.QuestionOption, error) {
+	if !IsChoiceQuestionType(item.Type) {
+		return nil, nil
+	}
+	inputs := NewQuestionOptionInputs(item.Options)
+	for i := range inputs {
+		if i < len(item.OptionFeedback) {
+			inputs[i].Feedback = item.OptionFeedback[i]
+		}
+	}
+	options, _, _, err := BuildQuestionOptions(item.Type, inputs, item.Answer)
+	if err != nil {
+		return nil, NewImportFieldError("answer", err.Error())
+	}
+	return options, nil
+}
+
+// checkImportedQuestionAttachments 校验导入题目引用的附件，校验失败时作为题干列的错误
+func checkImportedQuestionAttachments(tx *gorm.DB, tenantID uint, question models.Question) error {
+	err := CheckQuestionAttachments(tx, tenantID, question)
+	if errors.Is(err, ErrAttachmentNotFound) {
+		return NewImportFieldError("content", err.Error())
+	}
+	return err
+}
+
+// sameParentID 比较两个所属材料题ID
+func sameParentID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// sameQuestionOptions 比较两个JSON格式的选项列表，空列表与null视为相同
+func sameQuestionOptions(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var left, right []string
+	if json.Unmarshal([]byte(a), &left) != nil || json.Unmarshal([]byte(b), &right) != nil {
+		return false
+	}
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// QuestionImportSampleRows 表格模板中的示例题目
+func QuestionImportSampleRows() [][]string {
+	return [][]string{
+		{"", "单选题", "数学", "三角函数值", "sin(π/6) 的值是？", "1/2", "√3/2", "√2/2", "1", "", "", "", "", "A", "sin(30°) = 1/2", "1", "2", "三角函数", "", "", ""},
+		{"", "多选题", "数学", "", "解一元二次方程可以使用哪些方法？", "因式分解法", "配方法", "公式法", "图像法", "", "", "", "", "A,B,C", "", "2", "4", "一元二次方程", "", "", ""},
+		{"", "判断题", "数学", "", "函数 f(x) = x³ 在整个实数域上单调递增。", "", "", "", "", "", "", "", "", "对", "", "2", "2", "", "", "", ""},
+		{"", "简答题", "数学", "", "简述导数的几何意义。", "", "", "", "", "", "", "", "", "函数图像在该点处切线的斜率", "", "3", "10", "导数", "草稿", "", ""},
+	}
+}
+
+// QuestionTableRow 按导入模板的列输出一道题目，重新导入时按ID更新该题目
+func QuestionTableRow(question models.Question, subjectName string) []string {
+	row := []string{strconv.FormatUint(uint64(question.ID), 10), QuestionTypeLabels[question.Type], subjectName, question.Title, question.Content}
+	options := make([]string, maxQuestionOptions)
+	copy(options, questionOptionTexts(question))
+	row = append(row, options...)
+
+	answer := question.Answer
+	if question.Type == models.TrueFalse {
+		answer = map[string]string{"true": "对", "false": "错"}[question.Answer]
+	}
+	parentID := ""
+	if question.ParentID != nil {
+		parentID = strconv.FormatUint(uint64(*question.ParentID), 10)
+	}
+	return append(row, answer, question.Explanation, strconv.Itoa(question.Difficulty), strconv.Itoa(question.Score),
+		question.KnowledgePoint, QuestionStatusLabels[question.Status], parentID, strconv.Itoa(question.Position))
+}
+
+// QuestionJSON 题目的JSON导入导出格式，与批量导入接口中的题目相同
+type QuestionJSON struct {
+	ID             uint                  `json:"id,omitempty"` // 填写时更新该题目
+	SubjectID      uint                  `json:"subject_id"`
+	Type           models.QuestionType   `json:"type"`
+	Title          string                `json:"title"`
+	Content        string                `json:"content"`
+	Options        QuestionOptionInputs  `json:"options"` // 选项内容，选择题也可以是带 is_correct、feedback 的对象
+	Answer         string                `json:"answer"`  // 选择题为选项字母，选项中标记了 is_correct 时以标记为准
+	Explanation    string                `json:"explanation"`
+	Difficulty     int                   `json:"difficulty"`
+	Score          int                   `json:"score"`
+	KnowledgePoint string                `json:"knowledge_point"`
+	Status         models.QuestionStatus `json:"status"`
+	Visibility     models.Visibility     `json:"visibility"`
+	ParentID       *uint                 `json:"parent_id"` // 所属材料题
+	Position       int                   `json:"position"`  // 在材料题中的序号
+}
+
+// NewQuestionJSON 将题目转换为JSON导出格式，已加载选项的选择题导出选项的正确标记和反馈
+func NewQuestionJSON(question models.Question) QuestionJSON {
+	var contents []string
+	json.Unmarshal([]byte(question.Options), &contents)
+	options := NewQuestionOptionInputs(contents)
+	if len(question.Choices) > 0 {
+		options = make(QuestionOptionInputs, len(question.Choices))
+		for i, option := range question.Choices {
+			options[i] = QuestionOptionInput{Content: option.Content, IsCorrect: option.IsCorrect, Feedback: option.Feedback}
+		}
+	}
+	return QuestionJSON{
+		ID:             question.ID,
+		SubjectID:      question.SubjectID,
+		Type:           question.Type,
+		Title:          question.Title,
+		Content:        question.Content,
+		Options:        options,
+		Answer:         question.Answer,
+		Explanation:    question.Explanation,
+		Difficulty:     question.Difficulty,
+		Score:          question.Score,
+		KnowledgePoint: question.KnowledgePoint,
+		Status:         question.Status,
+		Visibility:     question.Visibility,
+		ParentID:       question.ParentID,
+		Position:       question.Position,
+	}
+}
+
+// Imported 将JSON格式的题目转换为待校验的导入题目，row为其在列表中的序号
+func (q QuestionJSON) Imported(row int) ImportedQuestion {
+	item := ImportedQuestion{Row: row, Options: q.Options.Contents(), OptionFeedback: q.Options.Feedbacks(), Status: q.Status, Visibility: q.Visibility}
+	answer := q.Answer
+	if letters := q.Options.AnswerLetters(); letters != "" {
+		answer = letters
+	}
+	if q.ID != 0 {
+		item.SetField("id", strconv.FormatUint(uint64(q.ID), 10))
+	}
+	if q.SubjectID != 0 {
+		item.SetField("subject", strconv.FormatUint(uint64(q.SubjectID), 10))
+	}
+	item.SetField("type", string(q.Type))
+	item.SetField("title", q.Title)
+	item.SetField("content", q.Content)
+	item.SetField("answer", answer)
+	item.SetField("explanation", q.Explanation)
+	item.SetField("knowledge_point", q.KnowledgePoint)
+	if q.Difficulty != 0 {
+		item.SetField("difficulty", strconv.Itoa(q.Difficulty))
+	}
+	if q.Score != 0 {
+		item.SetField("score", strconv.Itoa(q.Score))
+	}
+	if q.ParentID != nil {
+		parentID := ""
+		if *q.ParentID != 0 {
+			parentID = strconv.FormatUint(uint64(*q.ParentID), 10)
+		}
+		item.SetField("parent_id", parentID)
+	}
+	if q.Position != 0 {
+		item.SetField("position", strconv.Itoa(q.Position))
+	}
+	return item
+}
+
+// parseQuestionJSON 解析导出的JSON文件（{"questions": [...]}），也接受题目数组
+func parseQuestionJSON(data []byte) ([]ImportedQuestion, error) {
+	var questions []QuestionJSON
+	var wrapped struct {
+		Questions []QuestionJSON `json:"questions"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil {
+		questions = wrapped.Questions
+	} else if err := json.Unmarshal(data, &questions); err != nil {
+		return nil, fmt.Errorf("JSON格式错误: %v", err)
+	}
+	items := make([]ImportedQuestion, len(questions))
+	for i, q := range questions {
+		items[i] = q.Imported(i + 1)
+	}
+	return items, nil
+}
+
+// QuestionImportTextTemplate Word/文本模板的内容
+func QuestionImportTextTemplate() []string {
+	return []string{
+		"# 每道题以“序号. 题干”开始，选项以“A. ”等开头，答案、解析等字段写作“字段名：内容”",
+		"# 可选字段：题型、科目、难度（1-5）、分值、知识点、标题；未填写题型时按选项和答案自动判断",
+		"# 多选题答案写作“A,C”或“AC”，判断题答案写作“对/错”；以 # 开头的行会被忽略",
+		"1. sin(π/6) 的值是？",
+		"A. 1/2",
+		"B. √3/2",
+		"C. √2/2",
+		"D. 1",
+		"答案：A",
+		"解析：sin(30°) = 1/2",
+		"科目：数学",
+		"难度：1",
+		"分值：2",
+		"",
+		"2. 解一元二次方程可以使用哪些方法？",
+		"A. 因式分解法",
+		"B. 配方法",
+		"C. 公式法",
+		"D. 图像法",
+		"答案：A,B,C",
+		"科目：数学",
+		"",
+		"3. 函数 f(x) = x³ 在整个实数域上单调递增。",
+		"答案：对",
+		"科目：数学",
+		"",
+		"4. 简述导数的几何意义。",
+		"题型：简答题",
+		"答案：函数图像在该点处切线的斜率",
+		"科目：数学",
+		"分值：10",
+	}
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func trimTrailingEmpty(values []string) []string {
+	end := len(values)
+	for end > 0 && values[end-1] == "" {
+		end--
+	}
+	return values[:end]
+}
+
+func joinLine(text, line string) string {
+	if text == "" {
+		return line
+	}
+	return text + "\n" + line
+}
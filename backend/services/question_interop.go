@@ -0,0 +1,1167 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/url"
+	"online-exam-system/models"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 题库互操作格式：IMS QTI 2.1 题目包、Moodle XML 和 GIFT 文本
+const (
+	InteropQTI    = "qti"
+	InteropMoodle = "moodle"
+	InteropGIFT   = "gift"
+)
+
+// QTI 包中单个文件解压后的大小上限
+const maxInteropFileSize = 10 << 20
+
+var (
+	ErrInvalidInteropFile   = errors.New("文件格式错误，无法解析")
+	ErrUnsupportedXMLFormat = errors.New("无法识别的XML文件，仅支持Moodle XML（<quiz>）和QTI 2.1题目（<assessmentItem>）")
+)
+
+var (
+	htmlBreakPattern         = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	htmlTagPattern           = regexp.MustCompile(`<[^>]*>`)
+	giftFormatPattern        = regexp.MustCompile(`^\s*\[(html|plain|markdown|moodle)\]`)
+	giftWeightPattern        = regexp.MustCompile(`^%(-?\d+(?:\.\d+)?)%`)
+	giftMetaPattern          = regexp.MustCompile(`^//\s*(difficulty|score|knowledge_point|answer|难度|分值|知识点|答案)\s*[:：]\s*(.*)$`)
+	interopDifficultyPattern = regexp.MustCompile(`^(?i)(?:difficulty|难度)\s*[:：]\s*([1-5])$`)
+)
+
+// giftMetaFields GIFT 注释中的扩展字段（GIFT 本身没有难度、分值和知识点）
+var giftMetaFields = map[string]string{
+	"difficulty": "difficulty", "难度": "difficulty",
+	"score": "score", "分值": "score",
+	"knowledge_point": "knowledge_point", "知识点": "knowledge_point",
+	"answer": "answer", "答案": "answer",
+}
+
+// lomDifficulties LOM 难度词表，依次对应难度1-5
+var lomDifficulties = []string{"very easy", "easy", "medium", "difficult", "very difficult"}
+
+// xmlBlockElements 提取文本时前后换行的元素
+var xmlBlockElements = map[string]bool{
+	"p": true, "div": true, "li": true, "tr": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"prompt": true, "simpleChoice": true, "modalFeedback": true,
+}
+
+// xmlElement 通用XML元素树，用于解析结构不固定的QTI和Moodle XML，元素名和属性名不含命名空间
+type xmlElement struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*xmlElement
+	nodes    []interface{} // 按文档顺序保存文本（string）和子元素
+}
+
+// parseXMLTree 解析XML为元素树，支持HTML实体（如 &nbsp;）
+func parseXMLTree(r io.Reader) (*xmlElement, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Entity = xml.HTMLEntity
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidInteropFile
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &xmlElement{Name: t.Name.Local, Attrs: make(map[string]string, len(t.Attr))}
+			for _, attr := range t.Attr {
+				element.Attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, element)
+				parent.nodes = append(parent.nodes, element)
+			} else if root == nil {
+				root = element
+			}
+			stack = append(stack, element)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				top.nodes = append(top.nodes, string(t))
+			}
+		}
+	}
+	if root == nil {
+		return nil, ErrInvalidInteropFile
+	}
+	return root, nil
+}
+
+// Attr 返回属性值，不存在时为空
+func (e *xmlElement) Attr(name string) string {
+	if e == nil {
+		return ""
+	}
+	return e.Attrs[name]
+}
+
+// Child 返回第一个指定名称的子元素
+func (e *xmlElement) Child(name string) *xmlElement {
+	if e == nil {
+		return nil
+	}
+	for _, child := range e.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed 返回所有指定名称的子元素
+func (e *xmlElement) ChildrenNamed(name string) []*xmlElement {
+	var children []*xmlElement
+	if e != nil {
+		for _, child := range e.Children {
+			if child.Name == name {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
+
+// FindAll 按文档顺序返回满足条件的后代元素（不再深入已匹配的元素）
+func (e *xmlElement) FindAll(match func(*xmlElement) bool) []*xmlElement {
+	var found []*xmlElement
+	if e == nil {
+		return nil
+	}
+	for _, child := range e.Children {
+		if match(child) {
+			found = append(found, child)
+			continue
+		}
+		found = append(found, child.FindAll(match)...)
+	}
+	return found
+}
+
+// Find 按文档顺序返回指定名称的后代元素
+func (e *xmlElement) Find(name string) []*xmlElement {
+	return e.FindAll(func(child *xmlElement) bool { return child.Name == name })
+}
+
+// chardata 返回元素的直接文本，不做处理
+func (e *xmlElement) chardata() string {
+	var sb strings.Builder
+	if e != nil {
+		for _, node := range e.nodes {
+			if text, ok := node.(string); ok {
+				sb.WriteString(text)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Text 返回元素内的全部文本，块级元素之间换行；skip 返回 true 的子元素不计入
+func (e *xmlElement) Text(skip func(*xmlElement) bool) string {
+	if e == nil {
+		return ""
+	}
+	var sb strings.Builder
+	e.writeText(&sb, skip)
+	return normalizeInteropText(sb.String())
+}
+
+func (e *xmlElement) writeText(sb *strings.Builder, skip func(*xmlElement) bool) {
+	for _, node := range e.nodes {
+		switch n := node.(type) {
+		case string:
+			sb.WriteString(n)
+		case *xmlElement:
+			if skip != nil && skip(n) {
+				continue
+			}
+			if n.Name == "br" {
+				sb.WriteString("\n")
+				continue
+			}
+			block := xmlBlockElements[n.Name]
+			if block {
+				sb.WriteString("\n")
+			}
+			n.writeText(sb, skip)
+			if block {
+				sb.WriteString("\n")
+			}
+		}
+	}
+}
+
+// normalizeInteropText 合并每行内的连续空白，去掉空行
+func normalizeInteropText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// htmlToText 将HTML转换为纯文本，段落和换行保留为换行
+func htmlToText(s string) string {
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	return normalizeInteropText(html.UnescapeString(s))
+}
+
+// unsupportedQuestion 记录无法导入的题型，校验时作为该题的错误
+func unsupportedQuestion(item *ImportedQuestion, format, itemType string) {
+	item.parseErrors = append(item.parseErrors, ImportRowError{
+		Row:    item.Row,
+		Field:  "type",
+		Reason: fmt.Sprintf("不支持的%s题型：%s", format, itemType),
+	})
+}
+
+// applyInteropTags 从标签中识别难度（difficulty:3 或 难度:3），其余作为知识点
+func applyInteropTags(item *ImportedQuestion, tags []string) {
+	var points []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if m := interopDifficultyPattern.FindStringSubmatch(tag); m != nil {
+			item.rawDifficulty = m[1]
+		} else if tag != "" {
+			points = append(points, tag)
+		}
+	}
+	if len(points) > 0 {
+		item.KnowledgePoint = strings.Join(points, ",")
+	}
+}
+
+// interopScore 将小数分值四舍五入为整数，大于0时至少为1分
+func interopScore(value string) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value
+	}
+	score := int(math.Round(f))
+	if f > 0 && score < 1 {
+		score = 1
+	}
+	return strconv.Itoa(score)
+}
+
+// interopExportable 判断题目能否导出为QTI、Moodle XML和GIFT，材料题的子题离开材料后无法作答，不导出
+func interopExportable(question models.Question) bool {
+	if question.ParentID != nil {
+		return false
+	}
+	switch question.Type {
+	case models.SingleChoice, models.MultipleChoice, models.TrueFalse, models.ShortAnswer:
+		return true
+	}
+	return false
+}
+
+// InteropUnsupportedQuestions 返回无法导出为互操作格式的题目ID
+func InteropUnsupportedQuestions(questions []models.Question) []uint {
+	var ids []uint
+	for _, question := range questions {
+		if !interopExportable(question) {
+			ids = append(ids, question.ID)
+		}
+	}
+	return ids
+}
+
+// partialFraction 多选题每个正确选项的得分比例（百分比，保留5位小数，与Moodle的分数选项一致）
+func partialFraction(correctCount int) string {
+	return strconv.FormatFloat(math.Round(100/float64(correctCount)*1e5)/1e5, 'f', -1, 64)
+}
+
+// questionOptionTexts 返回去掉“A. ”标号的选项内容
+func questionOptionTexts(question models.Question) []string {
+	var options []string
+	json.Unmarshal([]byte(question.Options), &options)
+	for i, option := range options {
+		options[i] = optionLabelPattern.ReplaceAllString(option, "")
+	}
+	return options
+}
+
+// questionBody 返回题干，未填写时使用标题
+func questionBody(question models.Question) string {
+	if question.Content != "" {
+		return question.Content
+	}
+	return question.Title
+}
+
+// questionCorrectLetters 返回选择题正确选项的下标
+func questionCorrectLetters(question models.Question) map[int]bool {
+	correct := make(map[int]bool)
+	for _, letter := range answerLetters(question.Answer) {
+		correct[int(letter-'A')] = true
+	}
+	return correct
+}
+
+// ---- Moodle XML ----
+
+// parseMoodleXML 解析Moodle XML题库（<quiz>），分类（category）作为后续题目的科目
+func parseMoodleXML(root *xmlElement) []ImportedQuestion {
+	var items []ImportedQuestion
+	category := ""
+	for _, q := range root.ChildrenNamed("question") {
+		questionType := q.Attr("type")
+		if questionType == "category" {
+			category = moodleCategorySubject(moodleText(q.Child("category"), false))
+			continue
+		}
+
+		item := ImportedQuestion{Row: len(items) + 1, Subject: category}
+		item.Title = moodleText(q.Child("name"), false)
+		item.Content = moodleText(q.Child("questiontext"), true)
+		item.Explanation = moodleText(q.Child("generalfeedback"), true)
+		if grade := q.Child("defaultgrade"); grade != nil {
+			item.rawScore = interopScore(grade.chardata())
+		}
+		var tags []string
+		for _, tag := range q.Child("tags").ChildrenNamed("tag") {
+			tags = append(tags, moodleText(tag, false))
+		}
+		applyInteropTags(&item, tags)
+
+		answers := q.ChildrenNamed("answer")
+		switch questionType {
+		case "multichoice":
+			var letters, feedback []string
+			hasFeedback := false
+			for i, answer := range answers {
+				item.Options = append(item.Options, moodleText(answer, false))
+				if moodleFraction(answer) > 0 {
+					letters = append(letters, string(rune('A'+i)))
+				}
+				text := moodleText(answer.Child("feedback"), true)
+				feedback = append(feedback, text)
+				hasFeedback = hasFeedback || text != ""
+			}
+			item.Answer = strings.Join(letters, ",")
+			if hasFeedback {
+				item.OptionFeedback = feedback
+			}
+			item.rawType = string(models.MultipleChoice)
+			if single := strings.TrimSpace(q.Child("single").chardata()); single == "true" || single == "1" {
+				item.rawType = string(models.SingleChoice)
+			}
+		case "truefalse":
+			for _, answer := range answers {
+				if moodleFraction(answer) > 0 {
+					item.Answer = moodleText(answer, false)
+				}
+			}
+			item.rawType = string(models.TrueFalse)
+		case "shortanswer":
+			best := -1.0
+			for _, answer := range answers {
+				if fraction := moodleFraction(answer); fraction > best {
+					best = fraction
+					item.Answer = moodleText(answer, false)
+				}
+			}
+			item.rawType = string(models.ShortAnswer)
+		case "essay":
+			item.Answer = moodleText(q.Child("graderinfo"), true)
+			item.rawType = string(models.ShortAnswer)
+		default:
+			unsupportedQuestion(&item, "Moodle", questionType)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// moodleText 读取 <text> 子元素，format 为 html（题干和解析默认为 html）时转换为纯文本
+func moodleText(e *xmlElement, defaultHTML bool) string {
+	if e == nil {
+		return ""
+	}
+	text := e.Child("text").chardata()
+	format := e.Attr("format")
+	if format == "html" || (format == "" && defaultHTML) {
+		return htmlToText(text)
+	}
+	return normalizeInteropText(text)
+}
+
+// moodleFraction 答案的得分比例（百分比）
+func moodleFraction(answer *xmlElement) float64 {
+	fraction, _ := strconv.ParseFloat(answer.Attr("fraction"), 64)
+	return fraction
+}
+
+// moodleCategorySubject 取分类路径的最后一级作为科目，忽略 top 和默认分类；“//”为路径中的斜杠
+func moodleCategorySubject(categoryPath string) string {
+	parts := strings.Split(strings.ReplaceAll(categoryPath, "//", "\x00"), "/")
+	name := strings.ReplaceAll(strings.TrimSpace(parts[len(parts)-1]), "\x00", "/")
+	if name == "top" || strings.HasPrefix(name, "$") || strings.HasPrefix(name, "Default for ") || strings.HasPrefix(name, "默认") {
+		return ""
+	}
+	return name
+}
+
+// moodleCategoryPath 科目对应的Moodle分类路径
+func moodleCategoryPath(subject string) string {
+	return "$course$/top/" + strings.ReplaceAll(subject, "/", "//")
+}
+
+// WriteMoodleXML 导出Moodle XML，每个科目一个分类；简答题导出为 essay，参考答案写入评分说明
+func WriteMoodleXML(w io.Writer, questions []models.Question) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header + "<quiz>\n")
+	category := ""
+	for _, question := range questions {
+		if !interopExportable(question) {
+			continue
+		}
+		if question.Subject.Name != category || category == "" {
+			category = question.Subject.Name
+			fmt.Fprintf(bw, "  <question type=\"category\">\n    <category><text>%s</text></category>\n  </question>\n", xmlEscape(moodleCategoryPath(category)))
+		}
+
+		moodleType := map[models.QuestionType]string{
+			models.SingleChoice:   "multichoice",
+			models.MultipleChoice: "multichoice",
+			models.TrueFalse:      "truefalse",
+			models.ShortAnswer:    "essay",
+		}[question.Type]
+		fmt.Fprintf(bw, "  <question type=\"%s\">\n", moodleType)
+		fmt.Fprintf(bw, "    <name><text>%s</text></name>\n", xmlEscape(question.Title))
+		fmt.Fprintf(bw, "    <questiontext format=\"plain_text\"><text>%s</text></questiontext>\n", xmlEscape(questionBody(question)))
+		fmt.Fprintf(bw, "    <generalfeedback format=\"plain_text\"><text>%s</text></generalfeedback>\n", xmlEscape(question.Explanation))
+		fmt.Fprintf(bw, "    <defaultgrade>%d</defaultgrade>\n    <penalty>0</penalty>\n    <hidden>0</hidden>\n", question.Score)
+		fmt.Fprintf(bw, "    <idnumber>%d</idnumber>\n", question.ID)
+
+		switch question.Type {
+		case models.SingleChoice, models.MultipleChoice:
+			correct := questionCorrectLetters(question)
+			single := question.Type == models.SingleChoice
+			fmt.Fprintf(bw, "    <single>%t</single>\n    <shuffleanswers>true</shuffleanswers>\n    <answernumbering>ABCD</answernumbering>\n", single)
+			for i, option := range questionOptionTexts(question) {
+				fraction := "0"
+				switch {
+				case correct[i] && single:
+					fraction = "100"
+				case correct[i]:
+					fraction = partialFraction(len(correct))
+				case !single:
+					fraction = "-100"
+				}
+				feedback := ""
+				if i < len(question.Choices) && question.Choices[i].Feedback != "" {
+					feedback = fmt.Sprintf("<feedback format=\"plain_text\"><text>%s</text></feedback>", xmlEscape(question.Choices[i].Feedback))
+				}
+				fmt.Fprintf(bw, "    <answer fraction=\"%s\" format=\"plain_text\"><text>%s</text>%s</answer>\n", fraction, xmlEscape(option), feedback)
+			}
+		case models.TrueFalse:
+			for _, value := range []string{"true", "false"} {
+				fraction := 0
+				if question.Answer == value {
+					fraction = 100
+				}
+				fmt.Fprintf(bw, "    <answer fraction=\"%d\" format=\"moodle_auto_format\"><text>%s</text></answer>\n", fraction, value)
+			}
+		case models.ShortAnswer:
+			bw.WriteString("    <responseformat>editor</responseformat>\n    <responserequired>1</responserequired>\n    <responsefieldlines>15</responsefieldlines>\n    <attachments>0</attachments>\n")
+			fmt.Fprintf(bw, "    <graderinfo format=\"plain_text\"><text>%s</text></graderinfo>\n", xmlEscape(question.Answer))
+		}
+
+		bw.WriteString("    <tags>\n")
+		fmt.Fprintf(bw, "      <tag><text>difficulty:%d</text></tag>\n", question.Difficulty)
+		for _, point := range strings.Split(question.KnowledgePoint, ",") {
+			if point = strings.TrimSpace(point); point != "" {
+				fmt.Fprintf(bw, "      <tag><text>%s</text></tag>\n", xmlEscape(point))
+			}
+		}
+		bw.WriteString("    </tags>\n  </question>\n")
+	}
+	bw.WriteString("</quiz>\n")
+	return bw.Flush()
+}
+
+// ---- GIFT ----
+
+// giftChoice GIFT 答案块中的一个答案
+type giftChoice struct {
+	text     string
+	correct  bool
+	weighted bool // 使用 %50% 形式的部分得分
+}
+
+// parseGIFT 解析GIFT文本：空行分隔题目，$CATEGORY 设置后续题目的科目，
+// 题目前的“// difficulty: 3”“// score: 2”“// knowledge_point: …”“// answer: …”注释为扩展字段
+func parseGIFT(text string) []ImportedQuestion {
+	var items []ImportedQuestion
+	category := ""
+	meta := make(map[string]string)
+	var block []string
+	startLine := 0
+
+	flush := func() {
+		if len(block) == 0 {
+			return
+		}
+		item := parseGIFTQuestion(strings.Join(block, "\n"))
+		item.Row = startLine
+		item.Subject = category
+		for i := range item.parseErrors {
+			item.parseErrors[i].Row = startLine
+		}
+		if value, ok := meta["difficulty"]; ok {
+			item.rawDifficulty = value
+		}
+		if value, ok := meta["score"]; ok {
+			item.rawScore = value
+		}
+		if value, ok := meta["knowledge_point"]; ok {
+			item.KnowledgePoint = value
+		}
+		if value, ok := meta["answer"]; ok && item.Answer == "" {
+			item.Answer = normalizeInteropText(giftUnescape(value))
+		}
+		items = append(items, item)
+		block = nil
+		meta = make(map[string]string)
+	}
+
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			if m := giftMetaPattern.FindStringSubmatch(trimmed); m != nil && len(block) == 0 {
+				meta[giftMetaFields[strings.ToLower(m[1])]] = strings.TrimSpace(m[2])
+			}
+		case strings.HasPrefix(trimmed, "$CATEGORY:") && len(block) == 0:
+			category = moodleCategorySubject(strings.TrimSpace(strings.TrimPrefix(trimmed, "$CATEGORY:")))
+		default:
+			if len(block) == 0 {
+				startLine = i + 1
+			}
+			block = append(block, line)
+		}
+	}
+	flush()
+	return items
+}
+
+// parseGIFTQuestion 解析一道GIFT题目：“::标题::题干{答案}”
+func parseGIFTQuestion(source string) ImportedQuestion {
+	var item ImportedQuestion
+	s := strings.TrimSpace(source)
+	if strings.HasPrefix(s, "::") {
+		if end := indexUnescaped(s[2:], "::"); end >= 0 {
+			item.Title = normalizeInteropText(giftUnescape(s[2 : 2+end]))
+			s = strings.TrimSpace(s[4+end:])
+		}
+	}
+
+	open := indexUnescaped(s, "{")
+	closeIndex := -1
+	if open >= 0 {
+		closeIndex = indexUnescaped(s[open:], "}")
+	}
+	if open < 0 || closeIndex < 0 {
+		item.Content = giftText(s)
+		unsupportedQuestion(&item, "GIFT", "description")
+		return item
+	}
+	closeIndex += open
+
+	// 答案块在题干中间时为填空形式，用下划线表示空位
+	questionText := s[:open]
+	if after := strings.TrimSpace(s[closeIndex+1:]); after != "" {
+		questionText += "____" + s[closeIndex+1:]
+	}
+	item.Content = giftText(questionText)
+
+	answers := s[open+1 : closeIndex]
+	if feedback := indexUnescaped(answers, "####"); feedback >= 0 {
+		item.Explanation = giftText(answers[feedback+4:])
+		answers = answers[:feedback]
+	}
+	answers = strings.TrimSpace(answers)
+
+	switch {
+	case answers == "":
+		item.rawType = string(models.ShortAnswer)
+	case strings.HasPrefix(answers, "#"):
+		unsupportedQuestion(&item, "GIFT", "numerical")
+	case indexUnescaped(answers, "->") >= 0:
+		unsupportedQuestion(&item, "GIFT", "matching")
+	default:
+		if value := giftTrueFalse(answers); value != "" {
+			item.rawType = string(models.TrueFalse)
+			item.Answer = value
+			break
+		}
+		choices := splitGIFTChoices(answers)
+		var letters []string
+		hasWrong, weighted := false, false
+		for i, choice := range choices {
+			item.Options = append(item.Options, choice.text)
+			if choice.correct {
+				letters = append(letters, string(rune('A'+i)))
+				weighted = weighted || choice.weighted
+			} else {
+				hasWrong = true
+			}
+		}
+		if !hasWrong {
+			// 只有“=”答案时为Moodle填空（shortanswer），取第一个答案
+			item.rawType = string(models.ShortAnswer)
+			item.Options = nil
+			if len(choices) > 0 {
+				item.Answer = choices[0].text
+			}
+			break
+		}
+		item.Answer = strings.Join(letters, ",")
+		item.rawType = string(models.SingleChoice)
+		if len(letters) > 1 || weighted {
+			item.rawType = string(models.MultipleChoice)
+		}
+	}
+	return item
+}
+
+// giftTrueFalse 识别判断题答案 T、TRUE、F、FALSE（可带“#反馈”）
+func giftTrueFalse(answers string) string {
+	if feedback := indexUnescaped(answers, "#"); feedback >= 0 {
+		answers = answers[:feedback]
+	}
+	switch strings.ToUpper(strings.TrimSpace(answers)) {
+	case "T", "TRUE":
+		return "true"
+	case "F", "FALSE":
+		return "false"
+	}
+	return ""
+}
+
+// splitGIFTChoices 按未转义的“=”“~”拆分答案，去掉每个答案的反馈
+func splitGIFTChoices(answers string) []giftChoice {
+	var choices []giftChoice
+	start := -1
+	add := func(end int) {
+		if start < 0 {
+			return
+		}
+		raw := answers[start:end]
+		choice := giftChoice{correct: raw[0] == '='}
+		raw = raw[1:]
+		if m := giftWeightPattern.FindStringSubmatch(raw); m != nil {
+			weight, _ := strconv.ParseFloat(m[1], 64)
+			choice.correct = weight > 0
+			choice.weighted = weight > 0 && weight < 100
+			raw = raw[len(m[0]):]
+		}
+		if feedback := indexUnescaped(raw, "#"); feedback >= 0 {
+			raw = raw[:feedback]
+		}
+		choice.text = normalizeInteropText(giftUnescape(raw))
+		choices = append(choices, choice)
+	}
+	for i := 0; i < len(answers); i++ {
+		switch answers[i] {
+		case '\\':
+			i++
+		case '=', '~':
+			add(i)
+			start = i
+		}
+	}
+	add(len(answers))
+	return choices
+}
+
+// giftText 处理 [html] 等格式标记并反转义
+func giftText(s string) string {
+	if m := giftFormatPattern.FindStringSubmatch(s); m != nil {
+		s = s[len(m[0]):]
+		if m[1] == "html" {
+			return htmlToText(giftUnescape(s))
+		}
+	}
+	return normalizeInteropText(giftUnescape(s))
+}
+
+// indexUnescaped 查找未被反斜杠转义的子串
+func indexUnescaped(s, sub string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// giftUnescape 反转义 \~ \= \# \{ \} \: \\ 和 \n（换行）
+func giftUnescape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				sb.WriteByte('\n')
+			} else {
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// giftEscape 转义GIFT特殊字符，换行写作 \n
+func giftEscape(s string) string {
+	var sb strings.Builder
+	for _, ch := range strings.ReplaceAll(s, "\r\n", "\n") {
+		switch ch {
+		case '\\', '~', '=', '#', '{', '}', ':':
+			sb.WriteByte('\\')
+			sb.WriteRune(ch)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteRune(ch)
+		}
+	}
+	return sb.String()
+}
+
+// WriteGIFT 导出GIFT文本；难度、分值、知识点和简答题参考答案写在题目前的注释中
+func WriteGIFT(w io.Writer, questions []models.Question) error {
+	bw := bufio.NewWriter(w)
+	category := ""
+	for _, question := range questions {
+		if !interopExportable(question) {
+			continue
+		}
+		if question.Subject.Name != category || category == "" {
+			category = question.Subject.Name
+			fmt.Fprintf(bw, "$CATEGORY: %s\n\n", moodleCategoryPath(category))
+		}
+
+		fmt.Fprintf(bw, "// question: %d\n// difficulty: %d\n// score: %d\n", question.ID, question.Difficulty, question.Score)
+		if question.KnowledgePoint != "" {
+			fmt.Fprintf(bw, "// knowledge_point: %s\n", strings.Join(strings.Fields(question.KnowledgePoint), " "))
+		}
+		if question.Type == models.ShortAnswer && question.Answer != "" {
+			fmt.Fprintf(bw, "// answer: %s\n", giftEscape(question.Answer))
+		}
+		fmt.Fprintf(bw, "::%s::%s{", giftEscape(question.Title), giftEscape(questionBody(question)))
+
+		switch question.Type {
+		case models.SingleChoice, models.MultipleChoice:
+			correct := questionCorrectLetters(question)
+			for i, option := range questionOptionTexts(question) {
+				switch {
+				case question.Type == models.SingleChoice && correct[i]:
+					fmt.Fprintf(bw, "\n\t=%s", giftEscape(option))
+				case question.Type == models.SingleChoice:
+					fmt.Fprintf(bw, "\n\t~%s", giftEscape(option))
+				case correct[i]:
+					fmt.Fprintf(bw, "\n\t~%%%s%%%s", partialFraction(len(correct)), giftEscape(option))
+				default:
+					fmt.Fprintf(bw, "\n\t~%%-100%%%s", giftEscape(option))
+				}
+			}
+		case models.TrueFalse:
+			bw.WriteString(strings.ToUpper(question.Answer))
+		}
+		if question.Explanation != "" {
+			fmt.Fprintf(bw, "\n\t####%s", giftEscape(question.Explanation))
+		}
+		if question.Type == models.SingleChoice || question.Type == models.MultipleChoice || question.Explanation != "" {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("}\n\n")
+	}
+	return bw.Flush()
+}
+
+// ---- IMS QTI 2.1 ----
+
+// qtiResource 清单中的一道题目
+type qtiResource struct {
+	href     string
+	metadata *xmlElement
+}
+
+// parseQTIPackage 解析QTI 2.1题目包（zip）：按 imsmanifest.xml 中的题目资源依次读取，
+// 没有清单时读取包内所有 assessmentItem 文件；科目、难度和知识点取自清单中的LOM元数据
+func parseQTIPackage(data []byte) ([]ImportedQuestion, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidInteropFile
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	var names []string
+	for _, f := range zr.File {
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+
+	var resources []qtiResource
+	manifest := files["imsmanifest.xml"]
+	if manifest != nil {
+		root, err := readZipXMLTree(manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range root.Find("resource") {
+			if strings.HasPrefix(resource.Attr("type"), "imsqti_item_xmlv2") {
+				href, _ := url.PathUnescape(resource.Attr("href"))
+				resources = append(resources, qtiResource{href: path.Clean(href), metadata: resource.Child("metadata")})
+			}
+		}
+	} else {
+		sort.Strings(names)
+		for _, name := range names {
+			if strings.HasSuffix(strings.ToLower(name), ".xml") {
+				resources = append(resources, qtiResource{href: name})
+			}
+		}
+	}
+
+	var items []ImportedQuestion
+	for _, resource := range resources {
+		row := len(items) + 1
+		f := files[resource.href]
+		if f == nil {
+			items = append(items, ImportedQuestion{Row: row, Title: resource.href, parseErrors: []ImportRowError{{Row: row, Reason: "题目包中缺少文件 " + resource.href}}})
+			continue
+		}
+		root, err := readZipXMLTree(f)
+		if err != nil || root.Name != "assessmentItem" {
+			if manifest == nil {
+				continue
+			}
+			items = append(items, ImportedQuestion{Row: row, Title: resource.href, parseErrors: []ImportRowError{{Row: row, Reason: "无法解析题目文件 " + resource.href}}})
+			continue
+		}
+		item := parseQTIItem(root, row)
+		applyLOMMetadata(&item, resource.metadata)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// readZipXMLTree 读取包内的XML文件
+func readZipXMLTree(f *zip.File) (*xmlElement, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, ErrInvalidInteropFile
+	}
+	defer rc.Close()
+	return parseXMLTree(io.LimitReader(rc, maxInteropFileSize))
+}
+
+// parseQTIItem 解析一道QTI题目：choiceInteraction 为选择题或判断题，
+// extendedTextInteraction、textEntryInteraction 为简答题，其他交互类型记录为不支持
+func parseQTIItem(root *xmlElement, row int) ImportedQuestion {
+	item := ImportedQuestion{Row: row, Title: strings.TrimSpace(root.Attr("title"))}
+	isInteraction := func(e *xmlElement) bool { return strings.HasSuffix(e.Name, "Interaction") }
+
+	body := root.Child("itemBody")
+	item.Content = body.Text(isInteraction)
+	var feedback []string
+	for _, modal := range root.ChildrenNamed("modalFeedback") {
+		if text := modal.Text(nil); text != "" {
+			feedback = append(feedback, text)
+		}
+	}
+	item.Explanation = strings.Join(feedback, "\n")
+	for _, outcome := range root.ChildrenNamed("outcomeDeclaration") {
+		if outcome.Attr("identifier") == "SCORE" && outcome.Attr("normalMaximum") != "" {
+			item.rawScore = interopScore(outcome.Attr("normalMaximum"))
+		}
+	}
+
+	interactions := body.FindAll(isInteraction)
+	if len(interactions) != 1 {
+		reason := "没有作答交互"
+		if len(interactions) > 1 {
+			reason = "包含多个作答交互"
+		}
+		item.parseErrors = append(item.parseErrors, ImportRowError{Row: row, Field: "type", Reason: "不支持的QTI题目：" + reason})
+		return item
+	}
+	interaction := interactions[0]
+	correct, cardinality := qtiCorrectResponse(root, interaction.Attr("responseIdentifier"))
+
+	switch interaction.Name {
+	case "choiceInteraction":
+		if prompt := interaction.Child("prompt").Text(nil); prompt != "" {
+			item.Content = strings.TrimSpace(item.Content + "\n" + prompt)
+		}
+		choices := interaction.Find("simpleChoice")
+		isCorrect := make(map[string]bool, len(correct))
+		for _, value := range correct {
+			isCorrect[value] = true
+		}
+		if values := qtiTrueFalseChoices(choices); values != nil {
+			item.rawType = string(models.TrueFalse)
+			for i, choice := range choices {
+				if isCorrect[choice.Attr("identifier")] {
+					item.Answer = values[i]
+				}
+			}
+			break
+		}
+		var letters []string
+		for i, choice := range choices {
+			item.Options = append(item.Options, choice.Text(nil))
+			if isCorrect[choice.Attr("identifier")] {
+				letters = append(letters, string(rune('A'+i)))
+			}
+		}
+		item.Answer = strings.Join(letters, ",")
+		item.rawType = string(models.SingleChoice)
+		if maxChoices := interaction.Attr("maxChoices"); (maxChoices != "" && maxChoices != "1") || cardinality == "multiple" {
+			item.rawType = string(models.MultipleChoice)
+		}
+	case "extendedTextInteraction", "textEntryInteraction":
+		item.rawType = string(models.ShortAnswer)
+		if len(correct) > 0 {
+			item.Answer = correct[0]
+		}
+	default:
+		unsupportedQuestion(&item, "QTI", interaction.Name)
+	}
+	return item
+}
+
+// qtiCorrectResponse 返回作答变量的正确答案和基数（single、multiple）
+func qtiCorrectResponse(root *xmlElement, responseID string) ([]string, string) {
+	for _, declaration := range root.ChildrenNamed("responseDeclaration") {
+		if responseID != "" && declaration.Attr("identifier") != responseID {
+			continue
+		}
+		var values []string
+		for _, value := range declaration.Child("correctResponse").ChildrenNamed("value") {
+			values = append(values, strings.TrimSpace(value.chardata()))
+		}
+		return values, declaration.Attr("cardinality")
+	}
+	return nil, ""
+}
+
+// qtiTrueFalseChoices 两个选项分别为“对/错”（标识或文本）时返回对应的 true/false，否则返回nil
+func qtiTrueFalseChoices(choices []*xmlElement) []string {
+	if len(choices) != 2 {
+		return nil
+	}
+	values := make([]string, 2)
+	for i, choice := range choices {
+		value, ok := trueFalseAliases[strings.ToLower(choice.Attr("identifier"))]
+		if !ok {
+			value, ok = trueFalseAliases[strings.ToLower(choice.Text(nil))]
+		}
+		if !ok {
+			return nil
+		}
+		values[i] = value
+	}
+	if values[0] == values[1] {
+		return nil
+	}
+	return values
+}
+
+// applyLOMMetadata 从LOM元数据读取科目（classification）、难度（educational/difficulty）和知识点（keyword）
+func applyLOMMetadata(item *ImportedQuestion, metadata *xmlElement) {
+	if metadata == nil {
+		return
+	}
+	for _, difficulty := range metadata.Find("difficulty") {
+		value := strings.ToLower(difficulty.Child("value").Text(nil))
+		for i, name := range lomDifficulties {
+			if value == name {
+				item.rawDifficulty = strconv.Itoa(i + 1)
+			}
+		}
+	}
+	var keywords []string
+	for _, keyword := range metadata.Find("keyword") {
+		if text := keyword.Text(nil); text != "" {
+			keywords = append(keywords, text)
+		}
+	}
+	applyInteropTags(item, keywords)
+	for _, taxon := range metadata.Find("taxon") {
+		if entry := taxon.Child("entry").Text(nil); entry != "" {
+			item.Subject = entry
+		}
+	}
+}
+
+const qtiManifestTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1" xmlns:imsmd="http://www.imsglobal.org/xsd/imsmd_v1p2" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" identifier="MANIFEST-questions" xsi:schemaLocation="http://www.imsglobal.org/xsd/imscp_v1p1 http://www.imsglobal.org/xsd/imscp_v1p1.xsd http://www.imsglobal.org/xsd/imsmd_v1p2 http://www.imsglobal.org/xsd/imsmd_v1p2p2.xsd">
+  <metadata>
+    <schema>QTIv2.1 Package</schema>
+    <schemaversion>1.0.0</schemaversion>
+  </metadata>
+  <organizations/>
+  <resources>
+%s  </resources>
+</manifest>
+`
+
+const qtiItemHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.imsglobal.org/xsd/imsqti_v2p1 http://www.imsglobal.org/xsd/qti/qtiv2p1/imsqti_v2p1.xsd" identifier="%s" title="%s" adaptive="false" timeDependent="false">
+`
+
+// WriteQTIPackage 导出QTI 2.1题目包，每道题一个 assessmentItem 文件，科目、难度和知识点写入清单的LOM元数据
+func WriteQTIPackage(w io.Writer, questions []models.Question) error {
+	zw := zip.NewWriter(w)
+	var resources strings.Builder
+	for _, question := range questions {
+		if !interopExportable(question) {
+			continue
+		}
+		identifier := fmt.Sprintf("question-%d", question.ID)
+		href := "items/" + identifier + ".xml"
+		if err := writeZipPart(zw, href, qtiItemXML(question, identifier)); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&resources, "    <resource identifier=\"%s\" type=\"imsqti_item_xmlv2p1\" href=\"%s\">\n      <metadata>\n        <imsmd:lom>\n", identifier, href)
+		resources.WriteString("          <imsmd:general>\n")
+		fmt.Fprintf(&resources, "            <imsmd:title><imsmd:langstring xml:lang=\"zh\">%s</imsmd:langstring></imsmd:title>\n", xmlEscape(question.Title))
+		for _, point := range strings.Split(question.KnowledgePoint, ",") {
+			if point = strings.TrimSpace(point); point != "" {
+				fmt.Fprintf(&resources, "            <imsmd:keyword><imsmd:langstring xml:lang=\"zh\">%s</imsmd:langstring></imsmd:keyword>\n", xmlEscape(point))
+			}
+		}
+		resources.WriteString("          </imsmd:general>\n")
+		if question.Difficulty >= 1 && question.Difficulty <= len(lomDifficulties) {
+			fmt.Fprintf(&resources, "          <imsmd:educational>\n            <imsmd:difficulty><imsmd:source><imsmd:langstring xml:lang=\"x-none\">LOMv1.0</imsmd:langstring></imsmd:source><imsmd:value><imsmd:langstring xml:lang=\"x-none\">%s</imsmd:langstring></imsmd:value></imsmd:difficulty>\n          </imsmd:educational>\n", lomDifficulties[question.Difficulty-1])
+		}
+		if question.Subject.Name != "" {
+			fmt.Fprintf(&resources, "          <imsmd:classification>\n            <imsmd:purpose><imsmd:source><imsmd:langstring xml:lang=\"x-none\">LOMv1.0</imsmd:langstring></imsmd:source><imsmd:value><imsmd:langstring xml:lang=\"x-none\">discipline</imsmd:langstring></imsmd:value></imsmd:purpose>\n            <imsmd:taxonpath><imsmd:taxon><imsmd:entry><imsmd:langstring xml:lang=\"zh\">%s</imsmd:langstring></imsmd:entry></imsmd:taxon></imsmd:taxonpath>\n          </imsmd:classification>\n", xmlEscape(question.Subject.Name))
+		}
+		fmt.Fprintf(&resources, "        </imsmd:lom>\n      </metadata>\n      <file href=\"%s\"/>\n    </resource>\n", href)
+	}
+	if err := writeZipPart(zw, "imsmanifest.xml", fmt.Sprintf(qtiManifestTemplate, resources.String())); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// qtiItemXML 生成一道题目的 assessmentItem；判断题为标识 true/false 的单选，简答题为 extendedTextInteraction
+func qtiItemXML(question models.Question, identifier string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, qtiItemHeader, identifier, xmlEscape(question.Title))
+
+	var correct []string
+	cardinality, baseType := "single", "identifier"
+	switch question.Type {
+	case models.SingleChoice, models.MultipleChoice:
+		for _, letter := range answerLetters(question.Answer) {
+			correct = append(correct, string(letter))
+		}
+		if question.Type == models.MultipleChoice {
+			cardinality = "multiple"
+		}
+	case models.TrueFalse:
+		correct = []string{question.Answer}
+	case models.ShortAnswer:
+		baseType = "string"
+		if question.Answer != "" {
+			correct = []string{question.Answer}
+		}
+	}
+	fmt.Fprintf(&sb, "  <responseDeclaration identifier=\"RESPONSE\" cardinality=\"%s\" baseType=\"%s\">\n", cardinality, baseType)
+	if len(correct) > 0 {
+		sb.WriteString("    <correctResponse>\n")
+		for _, value := range correct {
+			fmt.Fprintf(&sb, "      <value>%s</value>\n", xmlEscape(value))
+		}
+		sb.WriteString("    </correctResponse>\n")
+	}
+	sb.WriteString("  </responseDeclaration>\n")
+	fmt.Fprintf(&sb, "  <outcomeDeclaration identifier=\"SCORE\" cardinality=\"single\" baseType=\"float\" normalMaximum=\"%d\">\n    <defaultValue><value>0</value></defaultValue>\n  </outcomeDeclaration>\n", question.Score)
+	if question.Explanation != "" {
+		sb.WriteString("  <outcomeDeclaration identifier=\"FEEDBACK\" cardinality=\"single\" baseType=\"identifier\"/>\n")
+	}
+
+	sb.WriteString("  <itemBody>\n")
+	for _, line := range strings.Split(questionBody(question), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(&sb, "    <p>%s</p>\n", xmlEscape(line))
+		}
+	}
+	switch question.Type {
+	case models.SingleChoice, models.MultipleChoice:
+		maxChoices := 1
+		if question.Type == models.MultipleChoice {
+			maxChoices = 0
+		}
+		fmt.Fprintf(&sb, "    <choiceInteraction responseIdentifier=\"RESPONSE\" shuffle=\"false\" maxChoices=\"%d\">\n", maxChoices)
+		for i, option := range questionOptionTexts(question) {
+			fmt.Fprintf(&sb, "      <simpleChoice identifier=\"%c\">%s</simpleChoice>\n", 'A'+i, xmlEscape(option))
+		}
+		sb.WriteString("    </choiceInteraction>\n")
+	case models.TrueFalse:
+		sb.WriteString("    <choiceInteraction responseIdentifier=\"RESPONSE\" shuffle=\"false\" maxChoices=\"1\">\n")
+		sb.WriteString("      <simpleChoice identifier=\"true\">正确</simpleChoice>\n      <simpleChoice identifier=\"false\">错误</simpleChoice>\n")
+		sb.WriteString("    </choiceInteraction>\n")
+	case models.ShortAnswer:
+		sb.WriteString("    <extendedTextInteraction responseIdentifier=\"RESPONSE\"/>\n")
+	}
+	sb.WriteString("  </itemBody>\n")
+
+	if question.Type != models.ShortAnswer {
+		sb.WriteString("  <responseProcessing template=\"http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct\"/>\n")
+	}
+	if question.Explanation != "" {
+		sb.WriteString("  <modalFeedback outcomeIdentifier=\"FEEDBACK\" identifier=\"EXPLANATION\" showHide=\"show\">\n")
+		for _, line := range strings.Split(question.Explanation, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Fprintf(&sb, "    <p>%s</p>\n", xmlEscape(line))
+			}
+		}
+		sb.WriteString("  </modalFeedback>\n")
+	}
+	sb.WriteString("</assessmentItem>\n")
+	return sb.String()
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"online-exam-system/models"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// QuestionOptionMigrationReport 选择题选项迁移的结果
+type QuestionOptionMigrationReport struct {
+	DryRun             bool                             `json:"dry_run"`
+	Checked            int                              `json:"checked"`             // 尚未迁移到选项表的选择题数
+	Converted          int                              `json:"converted"`           // 已转换（试运行时为可以转换）的题目数
+	Failed             []QuestionOptionMigrationFailure `json:"failed"`              // 无法识别、保持原样的题目
+	AnswersConverted   int                              `json:"answers_converted"`   // 转换为选项ID的学生作答数
+	AnswersUnconverted int                              `json:"answers_unconverted"` // 无法识别、保持原样的学生作答数
+}
+
+// QuestionOptionMigrationFailure 无法迁移的题目及原因，修改题目并保存后即按新格式保存
+type QuestionOptionMigrationFailure struct {
+	QuestionID uint                `json:"question_id"`
+	TenantID   uint                `json:"tenant_id"`
+	Type       models.QuestionType `json:"type"`
+	Options    string              `json:"options"`
+	Answer     string              `json:"answer"`
+	Reason     string              `json:"reason"`
+}
+
+// 每批处理的题目数
+const questionOptionMigrationBatch = 200
+
+// MigrateQuestionOptions 将选项仍保存为JSON字符串的选择题转换为选项表，答案（字母、下标数组等）转换为正确选项标记，
+// 学生作答转换为所选选项的ID。tenantID为0时处理全部租户；dryRun为true时只检查不修改。
+// 已有选项的题目跳过，可以重复执行
+func MigrateQuestionOptions(db *gorm.DB, tenantID uint, dryRun bool) (*QuestionOptionMigrationReport, error) {
+	report := &QuestionOptionMigrationReport{DryRun: dryRun, Failed: []QuestionOptionMigrationFailure{}}
+	var lastID uint
+	for {
+		query := db.Model(&models.Question{}).
+			Where("type IN ?", []models.QuestionType{models.SingleChoice, models.MultipleChoice, "single", "multiple"}).
+			Where("NOT EXISTS (SELECT 1 FROM question_options WHERE question_options.question_id = questions.id)").
+			Where("id > ?", lastID)
+		if tenantID != 0 {
+			query = query.Where("tenant_id = ?", tenantID)
+		}
+		var questions []models.Question
+		if err := query.Order("id").Limit(questionOptionMigrationBatch).Find(&questions).Error; err != nil {
+			return report, err
+		}
+		if len(questions) == 0 {
+			return report, nil
+		}
+		lastID = questions[len(questions)-1].ID
+
+		for _, question := range questions {
+			report.Checked++
+			options, optionsJSON, answer, err := legacyQuestionOptions(question)
+			if err != nil {
+				report.Failed = append(report.Failed, QuestionOptionMigrationFailure{
+					QuestionID: question.ID,
+					TenantID:   question.TenantID,
+					Type:       question.Type,
+					Options:    question.Options,
+					Answer:     question.Answer,
+					Reason:     err.Error(),
+				})
+				continue
+			}
+			report.Converted++
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if !dryRun {
+					var err error
+					if options, err = SaveQuestionOptions(tx, question.TenantID, question.ID, options); err != nil {
+						return err
+					}
+					if err := tx.Model(&models.Question{}).Where("id = ?", question.ID).
+						UpdateColumns(map[string]interface{}{"options": optionsJSON, "answer": answer}).Error; err != nil {
+						return err
+					}
+				}
+				return migrateChoiceAnswers(tx, question.ID, options, dryRun, report)
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+}
+
+// legacyQuestionOptions 解析旧格式的选项（字符串数组，或带 text/content 和 isCorrect/is_correct 的对象数组）和答案
+func legacyQuestionOptions(question models.Question) ([]models.QuestionOption, string, string, error) {
+	var raw []json.RawMessage
+	if strings.TrimSpace(question.Options) == "" || json.Unmarshal([]byte(question.Options), &raw) != nil || len(raw) == 0 {
+		return nil, "", "", errors.New("选项为空或不是JSON数组")
+	}
+	inputs := make(QuestionOptionInputs, len(raw))
+	for i, item := range raw {
+		if json.Unmarshal(item, &inputs[i].Content) == nil {
+			continue
+		}
+		var legacy struct {
+			Text          string `json:"text"`
+			Content       string `json:"content"`
+			IsCorrect     bool   `json:"is_correct"`
+			LegacyCorrect bool   `json:"isCorrect"`
+			Feedback      string `json:"feedback"`
+		}
+		if json.Unmarshal(item, &legacy) != nil {
+			return nil, "", "", errors.New("选项格式无法识别")
+		}
+		inputs[i] = QuestionOptionInput{
+			Content:   legacy.Content,
+			IsCorrect: legacy.IsCorrect || legacy.LegacyCorrect,
+			Feedback:  legacy.Feedback,
+		}
+		if inputs[i].Content == "" {
+			inputs[i].Content = legacy.Text
+		}
+	}
+	return BuildQuestionOptions(question.Type, inputs, question.Answer)
+}
+
+// migrateChoiceAnswers 将题目的考试作答和练习作答转换为所选选项ID，旧作答为选项字母、下标数组或选项内容
+func migrateChoiceAnswers(tx *gorm.DB, questionID uint, options []models.QuestionOption, dryRun bool, report *QuestionOptionMigrationReport) error {
+	contents := make([]string, len(options))
+	for i, option := range options {
+		contents[i] = option.Content
+	}
+	for _, model := range []interface{}{&models.Answer{}, &models.PracticeAnswer{}} {
+		var rows []struct {
+			ID     uint
+			Answer string
+		}
+		if err := tx.Model(model).Select("id", "answer").Where("question_id = ?", questionID).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if strings.TrimSpace(row.Answer) == "" {
+				continue
+			}
+			positions, err := ParseChoiceAnswerKey(row.Answer, contents)
+			if err != nil {
+				report.AnswersUnconverted++
+				continue
+			}
+			report.AnswersConverted++
+			if dryRun {
+				continue
+			}
+			ids := make([]uint, len(positions))
+			for i, position := range positions {
+				ids[i] = options[position].ID
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			data, _ := json.Marshal(ids)
+			if err := tx.Model(model).Where("id = ?", row.ID).UpdateColumn("answer", string(data)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,548 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 选择题（单选、多选）的选项保存在 question_options 表中，IsCorrect 的选项为正确答案；
+// 题目的 Options、Answer 字段保存选项内容（“A. 内容”）和正确选项字母（如 A,C）的副本，供列表、导出等使用。
+// 学生作答保存为所选选项ID的JSON数组，如 [12,15]
+
+// 选择题的选项数上限（对应字母A-Z）
+const maxChoiceOptions = 26
+
+var (
+	ErrChoiceAnswerRequired  = errors.New("请指定正确选项")
+	ErrInvalidQuestionOption = errors.New("选项不属于该题目")
+)
+
+// IsChoiceQuestionType 判断是否为选项保存在选项表中的题型；single、multiple 为前端和示例数据使用的旧题型名称
+func IsChoiceQuestionType(questionType models.QuestionType) bool {
+	switch questionType {
+	case models.SingleChoice, models.MultipleChoice, "single", "multiple":
+		return true
+	}
+	return false
+}
+
+func isSingleChoiceType(questionType models.QuestionType) bool {
+	return questionType == models.SingleChoice || questionType == "single"
+}
+
+// QuestionOptionInput 请求中的一个选项
+type QuestionOptionInput struct {
+	ID        uint   `json:"id,omitempty"` // 修改题目时填写已有选项的ID，选项ID保持不变
+	Content   string `json:"content"`
+	IsCorrect bool   `json:"is_correct,omitempty"`
+	Feedback  string `json:"feedback,omitempty"`
+}
+
+// QuestionOptionInputs 选项列表，每一项可以是选项内容字符串，也可以是 QuestionOptionInput 对象
+type QuestionOptionInputs []QuestionOptionInput
+
+// UnmarshalJSON 同时接受字符串数组和对象数组
+func (o *QuestionOptionInputs) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*o = nil
+		return nil
+	}
+	inputs := make(QuestionOptionInputs, len(raw))
+	for i, item := range raw {
+		if json.Unmarshal(item, &inputs[i].Content) == nil {
+			continue
+		}
+		if err := json.Unmarshal(item, &inputs[i]); err != nil {
+			return fmt.Errorf("第%d个选项格式错误", i+1)
+		}
+	}
+	*o = inputs
+	return nil
+}
+
+// NewQuestionOptionInputs 由选项内容生成选项列表
+func NewQuestionOptionInputs(contents []string) QuestionOptionInputs {
+	if contents == nil {
+		return nil
+	}
+	inputs := make(QuestionOptionInputs, len(contents))
+	for i, content := range contents {
+		inputs[i].Content = content
+	}
+	return inputs
+}
+
+// Contents 选项内容
+func (o QuestionOptionInputs) Contents() []string {
+	if o == nil {
+		return nil
+	}
+	contents := make([]string, len(o))
+	for i, input := range o {
+		contents[i] = input.Content
+	}
+	return contents
+}
+
+// AnswerLetters 由 is_correct 生成的正确选项字母，没有标记正确选项时返回空字符串
+func (o QuestionOptionInputs) AnswerLetters() string {
+	var letters []string
+	for i, input := range o {
+		if input.IsCorrect {
+			letters = append(letters, string(rune('A'+i)))
+		}
+	}
+	return strings.Join(letters, ",")
+}
+
+// Feedbacks 各选项的反馈，都没有反馈时返回nil
+func (o QuestionOptionInputs) Feedbacks() []string {
+	feedbacks := make([]string, len(o))
+	hasFeedback := false
+	for i, input := range o {
+		feedbacks[i] = input.Feedback
+		hasFeedback = hasFeedback || input.Feedback != ""
+	}
+	if !hasFeedback {
+		return nil
+	}
+	return feedbacks
+}
+
+// BuildQuestionOptions 校验选择题的选项和答案，返回待保存的选项以及题目中选项内容和答案的副本。
+// 正确选项由选项的 is_correct 指定，都未指定时按答案确定，答案的写法见 ParseChoiceAnswerKey
+func BuildQuestionOptions(questionType models.QuestionType, inputs QuestionOptionInputs, answer string) ([]models.QuestionOption, string, string, error) {
+	if len(inputs) < 2 {
+		return nil, "", "", errors.New("选择题至少需要2个选项")
+	}
+	if len(inputs) > maxChoiceOptions {
+		return nil, "", "", fmt.Errorf("选择题最多%d个选项", maxChoiceOptions)
+	}
+
+	options := make([]models.QuestionOption, len(inputs))
+	contents := make([]string, len(inputs))
+	flagged := false
+	for i, input := range inputs {
+		content := strings.TrimSpace(optionLabelPattern.ReplaceAllString(strings.TrimSpace(input.Content), ""))
+		if content == "" {
+			return nil, "", "", fmt.Errorf("选项%c不能为空", 'A'+i)
+		}
+		options[i] = models.QuestionOption{
+			ID:        input.ID,
+			Position:  i,
+			Content:   content,
+			IsCorrect: input.IsCorrect,
+			Feedback:  strings.TrimSpace(input.Feedback),
+		}
+		contents[i] = content
+		flagged = flagged || input.IsCorrect
+	}
+	if !flagged {
+		positions, err := ParseChoiceAnswerKey(answer, contents)
+		if err != nil {
+			return nil, "", "", err
+		}
+		for _, position := range positions {
+			options[position].IsCorrect = true
+		}
+	}
+
+	correct := 0
+	for _, option := range options {
+		if option.IsCorrect {
+			correct++
+		}
+	}
+	if correct == 0 {
+		return nil, "", "", ErrChoiceAnswerRequired
+	}
+	if isSingleChoiceType(questionType) && correct > 1 {
+		return nil, "", "", errors.New("单选题只能有一个正确选项")
+	}
+
+	optionsJSON, answerLetters := questionOptionCopies(options)
+	return options, optionsJSON, answerLetters, nil
+}
+
+// questionOptionCopies 生成保存在题目中的选项内容（“A. 内容”的JSON数组）和正确选项字母
+func questionOptionCopies(options []models.QuestionOption) (string, string) {
+	labelled := make([]string, len(options))
+	var letters []string
+	for i, option := range options {
+		labelled[i] = fmt.Sprintf("%c. %s", 'A'+i, option.Content)
+		if option.IsCorrect {
+			letters = append(letters, string(rune('A'+i)))
+		}
+	}
+	optionsJSON, _ := json.Marshal(labelled)
+	return string(optionsJSON), strings.Join(letters, ",")
+}
+
+// ParseChoiceAnswerKey 解析旧格式的选择题答案，返回正确选项的下标（从0开始）。支持的写法：
+// 选项字母（A,C、AC）、从0开始的下标数组（[0,2]）、字母数组（["A","C"]）以及与某个选项内容相同的答案
+func ParseChoiceAnswerKey(answer string, contents []string) ([]int, error) {
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil, ErrChoiceAnswerRequired
+	}
+	unrecognized := fmt.Errorf("无法识别选择题答案“%s”，请填写选项字母（如 A,C）或标记正确选项", answer)
+
+	var positions []int
+	if strings.HasPrefix(answer, "[") {
+		var values []interface{}
+		if err := json.Unmarshal([]byte(answer), &values); err != nil {
+			return nil, unrecognized
+		}
+		for _, value := range values {
+			switch v := value.(type) {
+			case float64:
+				if v != float64(int(v)) {
+					return nil, unrecognized
+				}
+				positions = append(positions, int(v))
+			case string:
+				if index, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+					positions = append(positions, index)
+					continue
+				}
+				letters := answerLetters(v)
+				if len(letters) != 1 {
+					return nil, unrecognized
+				}
+				positions = append(positions, int(letters[0]-'A'))
+			default:
+				return nil, unrecognized
+			}
+		}
+	} else if letters := answerLetters(answer); len(letters) > 0 && int(letters[len(letters)-1]-'A') < len(contents) {
+		for _, letter := range letters {
+			positions = append(positions, int(letter-'A'))
+		}
+	} else {
+		// 英文选项内容也可能被识别为字母，不在选项范围内时按选项内容匹配
+		content := strings.TrimSpace(optionLabelPattern.ReplaceAllString(answer, ""))
+		for i, option := range contents {
+			if strings.TrimSpace(optionLabelPattern.ReplaceAllString(option, "")) == content {
+				positions = append(positions, i)
+				break
+			}
+		}
+		if len(positions) == 0 && len(letters) > 0 {
+			return nil, fmt.Errorf("答案“%s”不在选项中", answer)
+		}
+	}
+	if len(positions) == 0 {
+		return nil, unrecognized
+	}
+
+	seen := make(map[int]bool)
+	unique := positions[:0]
+	for _, position := range positions {
+		if position < 0 || position >= len(contents) {
+			return nil, fmt.Errorf("答案“%s”不在选项中", answer)
+		}
+		if !seen[position] {
+			seen[position] = true
+			unique = append(unique, position)
+		}
+	}
+	sort.Ints(unique)
+	return unique, nil
+}
+
+// selectedOptionIDs 解析学生作答，返回所选选项的ID。作答可以是选项ID（12、[12,15]、12,15），
+// 也可以是选项字母（A,C，兼容旧客户端）
+func selectedOptionIDs(answer string, options []models.QuestionOption) ([]uint, bool) {
+	answer = strings.TrimSpace(answer)
+	if answer == "" || len(options) == 0 {
+		return nil, false
+	}
+	byID := make(map[uint]bool, len(options))
+	for _, option := range options {
+		byID[option.ID] = true
+	}
+
+	var tokens []string
+	if strings.HasPrefix(answer, "[") {
+		var values []json.RawMessage
+		if json.Unmarshal([]byte(answer), &values) != nil {
+			return nil, false
+		}
+		for _, value := range values {
+			tokens = append(tokens, strings.TrimSpace(strings.Trim(string(value), `"`)))
+		}
+	} else {
+		tokens = strings.FieldsFunc(answer, func(r rune) bool { return strings.ContainsRune(",，、;； ", r) })
+	}
+
+	seen := make(map[uint]bool)
+	var ids []uint
+	add := func(id uint) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, token := range tokens {
+		if id, err := strconv.ParseUint(token, 10, 32); err == nil {
+			if !byID[uint(id)] {
+				return nil, false
+			}
+			add(uint(id))
+			continue
+		}
+		letters := answerLetters(token)
+		if len(letters) == 0 {
+			return nil, false
+		}
+		for _, letter := range letters {
+			position := int(letter - 'A')
+			if position >= len(options) {
+				return nil, false
+			}
+			add(options[position].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, false
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, true
+}
+
+// NormalizeChoiceAnswer 将学生作答统一为所选选项ID的JSON数组，无法识别时原样返回（判为错误）
+func NormalizeChoiceAnswer(answer string, options []models.QuestionOption) string {
+	ids, ok := selectedOptionIDs(answer, options)
+	if !ok {
+		return answer
+	}
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
+
+// GradeChoiceAnswer 判断选择题作答是否正确：所选选项恰好为全部正确选项
+func GradeChoiceAnswer(options []models.QuestionOption, answer string) bool {
+	ids, ok := selectedOptionIDs(answer, options)
+	if !ok {
+		return false
+	}
+	selected := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	for _, option := range options {
+		if option.IsCorrect != selected[option.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// ChoiceAnswerLetters 将学生作答转换为选项字母（如 A,C）用于展示，无法识别时原样返回
+func ChoiceAnswerLetters(answer string, options []models.QuestionOption) string {
+	ids, ok := selectedOptionIDs(answer, options)
+	if !ok {
+		return answer
+	}
+	selected := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	var letters []string
+	for i, option := range options {
+		if selected[option.ID] {
+			letters = append(letters, string(rune('A'+i)))
+		}
+	}
+	return strings.Join(letters, ",")
+}
+
+// SelectedOptionFeedback 学生所选选项的反馈
+func SelectedOptionFeedback(answer string, options []models.QuestionOption) []string {
+	ids, _ := selectedOptionIDs(answer, options)
+	selected := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	feedback := []string{}
+	for _, option := range options {
+		if selected[option.ID] && option.Feedback != "" {
+			feedback = append(feedback, option.Feedback)
+		}
+	}
+	return feedback
+}
+
+// LoadQuestionOptions 加载题目的选项，按题目ID分组并按顺序排列
+func LoadQuestionOptions(db *gorm.DB, tenantID uint, questionIDs []uint) (map[uint][]models.QuestionOption, error) {
+	result := make(map[uint][]models.QuestionOption)
+	if len(questionIDs) == 0 {
+		return result, nil
+	}
+	var options []models.QuestionOption
+	if err := utils.WithTenant(db, tenantID).Where("question_id IN ?", questionIDs).
+		Order("question_id, position, id").Find(&options).Error; err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		result[option.QuestionID] = append(result[option.QuestionID], option)
+	}
+	return result, nil
+}
+
+// AttachQuestionOptions 为选择题（包括材料题的子题）加载选项
+func AttachQuestionOptions(db *gorm.DB, tenantID uint, questions []models.Question) error {
+	var ids []uint
+	for _, question := range questions {
+		if IsChoiceQuestionType(question.Type) {
+			ids = append(ids, question.ID)
+		}
+		for _, child := range question.Children {
+			if IsChoiceQuestionType(child.Type) {
+				ids = append(ids, child.ID)
+			}
+		}
+	}
+	options, err := LoadQuestionOptions(db, tenantID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range questions {
+		questions[i].Choices = options[questions[i].ID]
+		for j := range questions[i].Children {
+			questions[i].Children[j].Choices = options[questions[i].Children[j].ID]
+		}
+	}
+	return nil
+}
+
+// HideQuestionOptionAnswers 学生作答时隐藏选项的正确标记和反馈
+func HideQuestionOptionAnswers(questions []models.Question) {
+	for i := range questions {
+		choices := make([]models.QuestionOption, len(questions[i].Choices))
+		for j, option := range questions[i].Choices {
+			option.IsCorrect = false
+			option.Feedback = ""
+			choices[j] = option
+		}
+		if questions[i].Choices != nil {
+			questions[i].Choices = choices
+		}
+		HideQuestionOptionAnswers(questions[i].Children)
+	}
+}
+
+// SaveQuestionOptions 保存题目的选项并返回保存后的选项：填写了ID的选项更新该选项（须属于该题目），
+// 未填写ID时按顺序沿用已有选项的ID，其余已有选项删除
+func SaveQuestionOptions(db *gorm.DB, tenantID, questionID uint, options []models.QuestionOption) ([]models.QuestionOption, error) {
+	var existing []models.QuestionOption
+	if err := utils.WithTenant(db, tenantID).Where("question_id = ?", questionID).Order("position, id").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	owned := make(map[uint]bool, len(existing))
+	for _, option := range existing {
+		owned[option.ID] = true
+	}
+	hasIDs := false
+	used := make(map[uint]bool, len(options))
+	for _, option := range options {
+		if option.ID != 0 {
+			if !owned[option.ID] || used[option.ID] {
+				return nil, fmt.Errorf("%w：%d", ErrInvalidQuestionOption, option.ID)
+			}
+			used[option.ID] = true
+			hasIDs = true
+		}
+	}
+
+	for i, option := range options {
+		option.TenantID = tenantID
+		option.QuestionID = questionID
+		option.Position = i
+		if !hasIDs && i < len(existing) {
+			option.ID = existing[i].ID
+		}
+		if option.ID != 0 {
+			used[option.ID] = true
+			if err := db.Model(&models.QuestionOption{}).Where("id = ?", option.ID).Updates(map[string]interface{}{
+				"position":   option.Position,
+				"content":    option.Content,
+				"is_correct": option.IsCorrect,
+				"feedback":   option.Feedback,
+			}).Error; err != nil {
+				return nil, err
+			}
+		} else if err := db.Create(&option).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var removed []uint
+	for _, option := range existing {
+		if !used[option.ID] {
+			removed = append(removed, option.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := db.Where("id IN ?", removed).Delete(&models.QuestionOption{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	saved, err := LoadQuestionOptions(db, tenantID, []uint{questionID})
+	if err != nil {
+		return nil, err
+	}
+	return saved[questionID], nil
+}
+
+// DeleteQuestionOptions 删除题目的选项；题目改为其他题型时也需删除
+func DeleteQuestionOptions(db *gorm.DB, tenantID uint, questionIDs []uint) error {
+	if len(questionIDs) == 0 {
+		return nil
+	}
+	return utils.WithTenant(db, tenantID).Where("question_id IN ?", questionIDs).Delete(&models.QuestionOption{}).Error
+}
+
+// SameQuestionOptions 比较两组选项的内容、正确标记和反馈
+func SameQuestionOptions(a, b []models.QuestionOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Content != b[i].Content || a[i].IsCorrect != b[i].IsCorrect || a[i].Feedback != b[i].Feedback {
+			return false
+		}
+	}
+	return true
+}
+
+// RemapChoiceAnswer 按新的选项ID改写保存为选项ID数组的作答，用于租户迁移；其他格式的作答原样返回
+func RemapChoiceAnswer(answer string, remap func(uint) (uint, bool)) string {
+	var ids []uint
+	if !strings.HasPrefix(strings.TrimSpace(answer), "[") || json.Unmarshal([]byte(answer), &ids) != nil {
+		return answer
+	}
+	for i, id := range ids {
+		if newID, ok := remap(id); ok {
+			ids[i] = newID
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
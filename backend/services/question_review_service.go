@@ -0,0 +1,410 @@
+package services
+
+import (
+	"errors"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 题目审核动作
+const (
+	ReviewSubmit   = "submit"   // 草稿或被驳回的题目提交审核
+	ReviewWithdraw = "withdraw" // 撤回待审核的题目
+	ReviewApprove  = "approve"  // 审核通过
+	ReviewReject   = "reject"   // 审核驳回，需填写意见
+	ReviewPublish  = "publish"  // 发布审核通过的题目
+	ReviewArchive  = "archive"  // 归档
+	ReviewRestore  = "restore"  // 归档的题目恢复为草稿
+	ReviewRevise   = "revise"   // 修改已提交或已通过审核的题目内容，退回草稿（自动记录）
+	ReviewLegacy   = "legacy"   // 审核流程上线前已发布的题目的迁移处理（自动记录）
+)
+
+// 审核流程上线前已发布或已通过、没有审核记录的题目的处理方式（LEGACY_QUESTION_REVIEW）
+const (
+	LegacyQuestionsReviewed  = "reviewed"  // 保留原状态，视为已审核
+	LegacyQuestionsSubmitted = "submitted" // 改为待审核，审核通过后才能组卷和练习
+)
+
+var (
+	ErrInvalidQuestionStatus     = errors.New("status只能为draft、submitted、approved、rejected、published或archived")
+	ErrInvalidReviewAction       = errors.New("action只能为submit、withdraw、approve、reject、publish、archive或restore")
+	ErrInvalidQuestionTransition = errors.New("题目当前状态不能执行此操作")
+	ErrReviewCommentRequired     = errors.New("驳回题目需要填写审核意见")
+	ErrNotQuestionReviewer       = errors.New("只有该科目的审核人可以审核或发布题目")
+	ErrReviewOwnQuestion         = errors.New("不能审核自己创建或修改的题目")
+	ErrInitialQuestionStatus     = errors.New("新建题目的状态只能为draft或submitted，需经审核后才能通过和发布")
+	ErrReviewChildQuestion       = errors.New("子题随所属材料题一起审核")
+	ErrInvalidReviewer           = errors.New("审核人只能是本租户的教师或管理员")
+	ErrInvalidLegacyReviewMode   = errors.New("LEGACY_QUESTION_REVIEW只能为reviewed或submitted")
+)
+
+// ReviewedQuestionStatuses 已通过审核的题目状态，组卷只能使用这些题目
+var ReviewedQuestionStatuses = []models.QuestionStatus{models.QuestionApproved, models.QuestionPublished}
+
+// questionTransition 审核动作允许的起始状态和结果状态，reviewer 为 true 的动作只有科目审核人可以执行
+type questionTransition struct {
+	from     []models.QuestionStatus
+	to       models.QuestionStatus
+	reviewer bool
+}
+
+var questionTransitions = map[string]questionTransition{
+	ReviewSubmit:   {from: []models.QuestionStatus{models.QuestionDraft, models.QuestionRejected}, to: models.QuestionSubmitted},
+	ReviewWithdraw: {from: []models.QuestionStatus{models.QuestionSubmitted}, to: models.QuestionDraft},
+	ReviewApprove:  {from: []models.QuestionStatus{models.QuestionSubmitted}, to: models.QuestionApproved, reviewer: true},
+	ReviewReject:   {from: []models.QuestionStatus{models.QuestionSubmitted}, to: models.QuestionRejected, reviewer: true},
+	ReviewPublish:  {from: []models.QuestionStatus{models.QuestionApproved}, to: models.QuestionPublished, reviewer: true},
+	ReviewArchive:  {from: []models.QuestionStatus{models.QuestionDraft, models.QuestionRejected, models.QuestionApproved, models.QuestionPublished}, to: models.QuestionArchived},
+	ReviewRestore:  {from: []models.QuestionStatus{models.QuestionArchived}, to: models.QuestionDraft},
+}
+
+// IsReviewedQuestionStatus 判断题目是否已通过审核，只有这些题目可以加入试卷
+func IsReviewedQuestionStatus(status models.QuestionStatus) bool {
+	for _, reviewed := range ReviewedQuestionStatuses {
+		if status == reviewed {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidQuestionStatus 判断题目状态是否合法
+func IsValidQuestionStatus(status models.QuestionStatus) bool {
+	switch status {
+	case models.QuestionDraft, models.QuestionSubmitted, models.QuestionApproved, models.QuestionRejected,
+		models.QuestionPublished, models.QuestionArchived:
+		return true
+	}
+	return false
+}
+
+// IsReviewAction 判断是否为可以手动执行的审核动作
+func IsReviewAction(action string) bool {
+	_, ok := questionTransitions[action]
+	return ok
+}
+
+// QuestionStatusAction 从一个状态变为另一个状态对应的审核动作，没有对应动作时返回 false
+func QuestionStatusAction(from, to models.QuestionStatus) (string, bool) {
+	for action, transition := range questionTransitions {
+		if transition.to != to {
+			continue
+		}
+		for _, status := range transition.from {
+			if status == from {
+				return action, true
+			}
+		}
+	}
+	return "", false
+}
+
+// QuestionReviewService 题目审核流程和科目审核人
+type QuestionReviewService struct {
+	permissionService *PermissionService
+}
+
+// NewQuestionReviewService 创建题目审核服务实例
+func NewQuestionReviewService() *QuestionReviewService {
+	return &QuestionReviewService{permissionService: NewPermissionService()}
+}
+
+// manageAll 内容管理者可以审核所有科目的题目
+func (rs *QuestionReviewService) manageAll(actor Actor) bool {
+	return rs.permissionService.HasPermission(actor.TenantID, actor.Role, actor.RoleID, PermContentManage)
+}
+
+// CanReview 判断操作者能否审核和发布该科目的题目：科目审核人和内容管理者
+func (rs *QuestionReviewService) CanReview(actor Actor, subjectID uint) bool {
+	if rs.manageAll(actor) {
+		return true
+	}
+	var count int64
+	utils.WithTenant(database.DB, actor.TenantID).Model(&models.SubjectReviewer{}).
+		Where("subject_id = ? AND user_id = ?", subjectID, actor.UserID).Count(&count)
+	return count > 0
+}
+
+// InitialQuestionStatus 新建题目（包括导入）的状态：未指定时为草稿，也可以创建后直接提交审核。
+// 任何人新建的题目都要经过其他审核人审核才能通过和发布
+func InitialQuestionStatus(requested models.QuestionStatus) (models.QuestionStatus, error) {
+	switch requested {
+	case "":
+		return models.QuestionDraft, nil
+	case models.QuestionDraft, models.QuestionSubmitted:
+		return requested, nil
+	}
+	if !IsValidQuestionStatus(requested) {
+		return "", ErrInvalidQuestionStatus
+	}
+	return "", ErrInitialQuestionStatus
+}
+
+// Transition 对题目执行审核动作，更新题目和子题的状态并记录审核记录。
+// 非审核动作（提交、撤回、归档、恢复）由调用方检查编辑权限
+func (rs *QuestionReviewService) Transition(db *gorm.DB, actor Actor, question *models.Question, action, comment string) (*models.QuestionReview, error) {
+	transition, ok := questionTransitions[action]
+	if !ok {
+		return nil, ErrInvalidReviewAction
+	}
+	if question.ParentID != nil {
+		return nil, ErrReviewChildQuestion
+	}
+	allowed := false
+	for _, status := range transition.from {
+		if status == question.Status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, ErrInvalidQuestionTransition
+	}
+	if transition.reviewer {
+		if !rs.CanReview(actor, question.SubjectID) {
+			return nil, ErrNotQuestionReviewer
+		}
+		if rs.isOwnQuestion(db, actor, question) {
+			return nil, ErrReviewOwnQuestion
+		}
+	}
+	if action == ReviewReject && comment == "" {
+		return nil, ErrReviewCommentRequired
+	}
+
+	reviewerID := question.ReviewerID
+	switch action {
+	case ReviewSubmit:
+		reviewerID = rs.assignReviewer(db, question.TenantID, question.SubjectID, question.CreatedBy, actor.UserID)
+	case ReviewWithdraw, ReviewRestore:
+		reviewerID = nil
+	}
+	return rs.setStatus(db, actor, question, action, transition.to, reviewerID, comment)
+}
+
+// ChangeStatus 修改题目时按请求的状态执行对应的审核动作。内容修改可能已将题目退回草稿，按题目当前状态确定动作
+func (rs *QuestionReviewService) ChangeStatus(db *gorm.DB, actor Actor, question *models.Question, status models.QuestionStatus) error {
+	if status == "" || status == question.Status {
+		return nil
+	}
+	action, ok := QuestionStatusAction(question.Status, status)
+	if !ok {
+		return ErrInvalidQuestionTransition
+	}
+	_, err := rs.Transition(db, actor, question, action, "")
+	return err
+}
+
+// ReviseQuestion 题目内容修改后调用：待审核、已通过或已发布的题目退回草稿，无论修改者是谁都需重新提交审核。
+// 子题的修改作用于所属材料题；新建子题时同步材料题的状态
+func (rs *QuestionReviewService) ReviseQuestion(db *gorm.DB, actor Actor, question *models.Question) error {
+	root := *question
+	if question.ParentID != nil {
+		root = models.Question{}
+		if err := utils.WithTenant(db, question.TenantID).First(&root, *question.ParentID).Error; err != nil {
+			return err
+		}
+	}
+	switch root.Status {
+	case models.QuestionSubmitted, models.QuestionApproved, models.QuestionPublished:
+		if _, err := rs.setStatus(db, actor, &root, ReviewRevise, models.QuestionDraft, nil, ""); err != nil {
+			return err
+		}
+	}
+	if question.ParentID == nil {
+		question.Status, question.ReviewerID = root.Status, root.ReviewerID
+		return nil
+	}
+	if question.Status != root.Status {
+		if err := db.Model(&models.Question{}).Where("id = ?", question.ID).UpdateColumn("status", root.Status).Error; err != nil {
+			return err
+		}
+		question.Status = root.Status
+	}
+	return nil
+}
+
+// setStatus 更新题目及其子题的状态并记录审核记录
+func (rs *QuestionReviewService) setStatus(db *gorm.DB, actor Actor, question *models.Question, action string, status models.QuestionStatus, reviewerID *uint, comment string) (*models.QuestionReview, error) {
+	review := models.QuestionReview{
+		TenantID:   question.TenantID,
+		QuestionID: question.ID,
+		Version:    question.Version,
+		Action:     action,
+		FromStatus: question.Status,
+		ToStatus:   status,
+		Comment:    comment,
+		UserID:     actor.UserID,
+	}
+	if err := db.Model(&models.Question{}).Where("id = ?", question.ID).
+		UpdateColumns(map[string]interface{}{"status": status, "reviewer_id": reviewerID, "updated_at": time.Now()}).Error; err != nil {
+		return nil, err
+	}
+	if question.Type == models.Material {
+		if err := db.Model(&models.Question{}).Where("parent_id = ?", question.ID).UpdateColumn("status", status).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := db.Create(&review).Error; err != nil {
+		return nil, err
+	}
+	question.Status = status
+	question.ReviewerID = reviewerID
+	return &review, nil
+}
+
+// isOwnQuestion 判断操作者是否为题目（或材料题的子题）的创建者或当前版本的修改者，这些用户不能审核该题目
+func (rs *QuestionReviewService) isOwnQuestion(db *gorm.DB, actor Actor, question *models.Question) bool {
+	if question.CreatedBy == actor.UserID {
+		return true
+	}
+	var count int64
+	utils.WithTenant(db, question.TenantID).Model(&models.Question{}).
+		Where("(questions.id = ? OR questions.parent_id = ?) AND (questions.created_by = ? OR EXISTS "+
+			"(SELECT 1 FROM question_revisions WHERE question_revisions.question_id = questions.id "+
+			"AND question_revisions.version = questions.version AND question_revisions.created_by = ?))",
+			question.ID, question.ID, actor.UserID, actor.UserID).
+		Count(&count)
+	return count > 0
+}
+
+// assignReviewer 为提交的题目分配审核人：该科目审核人中（不含题目作者和提交人）待审核题目最少的一位，没有审核人时返回 nil，由内容管理者审核
+func (rs *QuestionReviewService) assignReviewer(db *gorm.DB, tenantID, subjectID uint, excludedUserIDs ...uint) *uint {
+	var candidates []struct {
+		UserID  uint
+		Pending int64
+	}
+	utils.WithTenant(db, tenantID).Model(&models.SubjectReviewer{}).
+		Select("subject_reviewers.user_id, (SELECT COUNT(*) FROM questions WHERE questions.reviewer_id = subject_reviewers.user_id AND questions.status = ?) AS pending", models.QuestionSubmitted).
+		Where("subject_reviewers.subject_id = ? AND subject_reviewers.user_id NOT IN ?", subjectID, excludedUserIDs).
+		Order("pending ASC, subject_reviewers.user_id ASC").Limit(1).Scan(&candidates)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &candidates[0].UserID
+}
+
+// ScopeReviewable 将题目查询限定为操作者可以审核的科目
+func (rs *QuestionReviewService) ScopeReviewable(query *gorm.DB, actor Actor) *gorm.DB {
+	if rs.manageAll(actor) {
+		return query
+	}
+	return query.Where("questions.subject_id IN (SELECT subject_id FROM subject_reviewers WHERE tenant_id = ? AND user_id = ?)",
+		actor.TenantID, actor.UserID)
+}
+
+// GetQuestionReviews 题目的审核记录，按时间从新到旧
+func (rs *QuestionReviewService) GetQuestionReviews(tenantID, questionID uint) ([]models.QuestionReview, error) {
+	var reviews []models.QuestionReview
+	err := utils.WithTenant(database.DB, tenantID).Preload("User").
+		Where("question_id = ?", questionID).Order("id DESC").Find(&reviews).Error
+	return reviews, err
+}
+
+// GetSubjectReviewers 科目的审核人
+func (rs *QuestionReviewService) GetSubjectReviewers(tenantID, subjectID uint) ([]models.SubjectReviewer, error) {
+	var reviewers []models.SubjectReviewer
+	err := utils.WithTenant(database.DB, tenantID).Preload("User").
+		Where("subject_id = ?", subjectID).Order("id ASC").Find(&reviewers).Error
+	return reviewers, err
+}
+
+// SetSubjectReviewers 设置科目的审核人（整体替换），审核人需为本租户的教师或管理员。
+// 移除的审核人名下待审核的题目改为未分配
+func (rs *QuestionReviewService) SetSubjectReviewers(actor Actor, subjectID uint, userIDs []uint) error {
+	userIDs = uniqueIDs(userIDs)
+	if len(userIDs) > 0 {
+		var count int64
+		utils.WithTenant(database.DB, actor.TenantID).Model(&models.User{}).
+			Where("id IN ? AND role IN ?", userIDs, []models.UserRole{models.RoleTeacher, models.RoleAdmin}).
+			Count(&count)
+		if int(count) != len(userIDs) {
+			return ErrInvalidReviewer
+		}
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		removed := utils.WithTenant(tx, actor.TenantID).Where("subject_id = ?", subjectID)
+		if len(userIDs) > 0 {
+			removed = removed.Where("user_id NOT IN ?", userIDs)
+		}
+		var removedIDs []uint
+		if err := removed.Model(&models.SubjectReviewer{}).Pluck("user_id", &removedIDs).Error; err != nil {
+			return err
+		}
+		if len(removedIDs) > 0 {
+			if err := utils.WithTenant(tx, actor.TenantID).Where("subject_id = ? AND user_id IN ?", subjectID, removedIDs).
+				Delete(&models.SubjectReviewer{}).Error; err != nil {
+				return err
+			}
+			if err := utils.WithTenant(tx, actor.TenantID).Model(&models.Question{}).
+				Where("subject_id = ? AND status = ? AND reviewer_id IN ?", subjectID, models.QuestionSubmitted, removedIDs).
+				UpdateColumn("reviewer_id", nil).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, userID := range userIDs {
+			var count int64
+			utils.WithTenant(tx, actor.TenantID).Model(&models.SubjectReviewer{}).
+				Where("subject_id = ? AND user_id = ?", subjectID, userID).Count(&count)
+			if count > 0 {
+				continue
+			}
+			reviewer := models.SubjectReviewer{TenantID: actor.TenantID, SubjectID: subjectID, UserID: userID, CreatedBy: actor.UserID}
+			if err := tx.Create(&reviewer).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateLegacyQuestions 处理审核流程上线前已发布或已通过、没有任何审核记录的题目（包括从旧归档导入的题目）。
+// mode 为 reviewed 时保留原状态并补一条 legacy 审核记录，明确视为已审核；为 submitted 时改为待审核并分配审核人。
+// tenantID 为 0 时处理全部租户，返回处理的题目数量
+func MigrateLegacyQuestions(db *gorm.DB, tenantID uint, mode string) (int, error) {
+	if mode != LegacyQuestionsReviewed && mode != LegacyQuestionsSubmitted {
+		return 0, ErrInvalidLegacyReviewMode
+	}
+	query := db.Model(&models.Question{}).
+		Where("parent_id IS NULL AND status IN ?", ReviewedQuestionStatuses).
+		Where("NOT EXISTS (SELECT 1 FROM question_reviews WHERE question_reviews.question_id = questions.id)")
+	if tenantID != 0 {
+		query = utils.WithTenant(query, tenantID)
+	}
+	var questions []models.Question
+	if err := query.Find(&questions).Error; err != nil {
+		return 0, err
+	}
+
+	rs := NewQuestionReviewService()
+	for i := range questions {
+		question := &questions[i]
+		actor := Actor{TenantID: question.TenantID, UserID: question.CreatedBy}
+		if mode == LegacyQuestionsSubmitted {
+			reviewerID := rs.assignReviewer(db, question.TenantID, question.SubjectID, question.CreatedBy)
+			if _, err := rs.setStatus(db, actor, question, ReviewLegacy, models.QuestionSubmitted, reviewerID, "审核流程上线前的题目，需重新审核"); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		review := models.QuestionReview{
+			TenantID:   question.TenantID,
+			QuestionID: question.ID,
+			Version:    question.Version,
+			Action:     ReviewLegacy,
+			FromStatus: question.Status,
+			ToStatus:   question.Status,
+			Comment:    "审核流程上线前已发布，视为已审核",
+			UserID:     question.CreatedBy,
+		}
+		if err := db.Create(&review).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(questions), nil
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"encoding/json"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+
+	"gorm.io/gorm"
+)
+
+// revisionChoice 版本中保存的选项，选项ID与学生作答中的ID对应
+type revisionChoice struct {
+	ID        uint   `json:"id"`
+	Content   string `json:"content"`
+	IsCorrect bool   `json:"is_correct,omitempty"`
+	Feedback  string `json:"feedback,omitempty"`
+}
+
+// newQuestionRevision 由题目当前内容（选择题需已加载选项）生成版本
+func newQuestionRevision(question models.Question) models.QuestionRevision {
+	revision := models.QuestionRevision{
+		TenantID:       question.TenantID,
+		QuestionID:     question.ID,
+		Type:           question.Type,
+		Title:          question.Title,
+		Content:        question.Content,
+		Options:        question.Options,
+		Answer:         question.Answer,
+		Explanation:    question.Explanation,
+		Difficulty:     question.Difficulty,
+		Score:          question.Score,
+		KnowledgePoint: question.KnowledgePoint,
+		ParentID:       question.ParentID,
+		Position:       question.Position,
+	}
+	if len(question.Choices) > 0 {
+		choices := make([]revisionChoice, len(question.Choices))
+		for i, option := range question.Choices {
+			choices[i] = revisionChoice{ID: option.ID, Content: option.Content, IsCorrect: option.IsCorrect, Feedback: option.Feedback}
+		}
+		data, _ := json.Marshal(choices)
+		revision.ChoicesJSON = string(data)
+	}
+	return revision
+}
+
+// sameRevisionContent 两个版本的题目内容是否相同
+func sameRevisionContent(a, b models.QuestionRevision) bool {
+	sameParent := (a.ParentID == nil && b.ParentID == nil) || (a.ParentID != nil && b.ParentID != nil && *a.ParentID == *b.ParentID)
+	return a.Type == b.Type && a.Title == b.Title && a.Content == b.Content && a.Options == b.Options &&
+		a.Answer == b.Answer && a.Explanation == b.Explanation && a.Difficulty == b.Difficulty && a.Score == b.Score &&
+		a.KnowledgePoint == b.KnowledgePoint && sameParent && a.Position == b.Position && a.ChoicesJSON == b.ChoicesJSON
+}
+
+// decodeRevisionChoices 解析版本中保存的选项
+func decodeRevisionChoices(revision *models.QuestionRevision) {
+	revision.Choices = nil
+	var choices []revisionChoice
+	if revision.ChoicesJSON == "" || json.Unmarshal([]byte(revision.ChoicesJSON), &choices) != nil {
+		return
+	}
+	revision.Choices = make([]models.QuestionOption, len(choices))
+	for i, choice := range choices {
+		revision.Choices[i] = models.QuestionOption{
+			ID:         choice.ID,
+			TenantID:   revision.TenantID,
+			QuestionID: revision.QuestionID,
+			Position:   i,
+			Content:    choice.Content,
+			IsCorrect:  choice.IsCorrect,
+			Feedback:   choice.Feedback,
+		}
+	}
+}
+
+// RecordQuestionRevision 保存题目当前内容为新版本（选择题需已加载选项），内容与最新版本相同时不保存，
+// 返回最新版本以及是否保存了新版本
+func RecordQuestionRevision(db *gorm.DB, question *models.Question, createdBy uint) (*models.QuestionRevision, bool, error) {
+	revision := newQuestionRevision(*question)
+	var latest models.QuestionRevision
+	err := db.Where("question_id = ?", question.ID).Order("version DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return nil, false, err
+	}
+	created := false
+	if latest.ID == 0 || !sameRevisionContent(latest, revision) {
+		revision.Version = latest.Version + 1
+		revision.CreatedBy = createdBy
+		if err := db.Create(&revision).Error; err != nil {
+			return nil, false, err
+		}
+		latest = revision
+		created = true
+	}
+	if question.Version != latest.Version {
+		if err := db.Model(&models.Question{}).Where("id = ?", question.ID).UpdateColumn("version", latest.Version).Error; err != nil {
+			return nil, false, err
+		}
+		question.Version = latest.Version
+	}
+	return &latest, created, nil
+}
+
+// EnsureQuestionRevisions 为还没有版本的题目（升级前创建的题目）按当前内容保存第一个版本
+func EnsureQuestionRevisions(db *gorm.DB, tenantID uint, questionIDs []uint) error {
+	if len(questionIDs) == 0 {
+		return nil
+	}
+	var questions []models.Question
+	if err := utils.WithTenant(db, tenantID).Where("id IN ?", questionIDs).
+		Where("NOT EXISTS (SELECT 1 FROM question_revisions WHERE question_revisions.question_id = questions.id)").
+		Find(&questions).Error; err != nil {
+		return err
+	}
+	if err := AttachQuestionOptions(db, tenantID, questions); err != nil {
+		return err
+	}
+	for i := range questions {
+		if _, _, err := RecordQuestionRevision(db, &questions[i], questions[i].CreatedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LatestQuestionRevisions 题目的最新版本，按题目ID索引
+func LatestQuestionRevisions(db *gorm.DB, tenantID uint, questionIDs []uint) (map[uint]models.QuestionRevision, error) {
+	result := make(map[uint]models.QuestionRevision)
+	if len(questionIDs) == 0 {
+		return result, nil
+	}
+	var revisions []models.QuestionRevision
+	if err := utils.WithTenant(db, tenantID).Where("question_id IN ?", questionIDs).
+		Where("version = (SELECT MAX(latest.version) FROM question_revisions AS latest WHERE latest.question_id = question_revisions.question_id)").
+		Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		result[revision.QuestionID] = revision
+	}
+	return result, nil
+}
+
+// paperQuestionIDs 试卷中的题目ID（包括已删除的题目）
+func paperQuestionIDs(db *gorm.DB, paperID uint) ([]uint, error) {
+	var questionIDs []uint
+	err := db.Table("paper_questions").Where("paper_id = ?", paperID).Order("question_id").Pluck("question_id", &questionIDs).Error
+	return questionIDs, err
+}
+
+// PinPaperRevisions 将试卷中的题目固定到版本：已固定的题目保持原版本（refresh 为 true 时改为最新版本），
+// 新加入的题目固定到最新版本，移出试卷的题目删除固定记录。组卷和修改试卷题目后调用
+func PinPaperRevisions(db *gorm.DB, tenantID, paperID uint, refresh bool) error {
+	questionIDs, err := paperQuestionIDs(db, paperID)
+	if err != nil {
+		return err
+	}
+	if err := EnsureQuestionRevisions(db, tenantID, questionIDs); err != nil {
+		return err
+	}
+	latest, err := LatestQuestionRevisions(db, tenantID, questionIDs)
+	if err != nil {
+		return err
+	}
+
+	var pins []models.PaperQuestionRevision
+	if err := utils.WithTenant(db, tenantID).Where("paper_id = ?", paperID).Find(&pins).Error; err != nil {
+		return err
+	}
+	pinned := make(map[uint]models.PaperQuestionRevision, len(pins))
+	for _, pin := range pins {
+		pinned[pin.QuestionID] = pin
+	}
+
+	inPaper := make(map[uint]bool, len(questionIDs))
+	for _, questionID := range questionIDs {
+		inPaper[questionID] = true
+		revision, ok := latest[questionID]
+		if !ok {
+			continue // 题目已删除，没有可固定的版本
+		}
+		pin, exists := pinned[questionID]
+		switch {
+		case !exists:
+			pin = models.PaperQuestionRevision{TenantID: tenantID, PaperID: paperID, QuestionID: questionID, RevisionID: revision.ID}
+			if err := db.Create(&pin).Error; err != nil {
+				return err
+			}
+		case refresh && pin.RevisionID != revision.ID:
+			if err := db.Model(&pin).UpdateColumn("revision_id", revision.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var removed []uint
+	for _, pin := range pins {
+		if !inPaper[pin.QuestionID] {
+			removed = append(removed, pin.ID)
+		}
+	}
+	if len(removed) > 0 {
+		return db.Where("id IN ?", removed).Delete(&models.PaperQuestionRevision{}).Error
+	}
+	return nil
+}
+
+// BackfillPaperRevisions 为有题目尚未固定版本的试卷（升级前组的卷）按题目当前内容固定版本，tenantID 为 0 时处理全部租户，
+// 返回处理的试卷数量
+func BackfillPaperRevisions(db *gorm.DB, tenantID uint) (int, error) {
+	query := db.Model(&models.Paper{}).
+		Where("EXISTS (SELECT 1 FROM paper_questions WHERE paper_questions.paper_id = papers.id AND NOT EXISTS " +
+			"(SELECT 1 FROM paper_question_revisions WHERE paper_question_revisions.paper_id = paper_questions.paper_id " +
+			"AND paper_question_revisions.question_id = paper_questions.question_id))")
+	if tenantID != 0 {
+		query = utils.WithTenant(query, tenantID)
+	}
+	var papers []models.Paper
+	if err := query.Select("id", "tenant_id").Find(&papers).Error; err != nil {
+		return 0, err
+	}
+	for _, paper := range papers {
+		if err := PinPaperRevisions(db, paper.TenantID, paper.ID, false); err != nil {
+			return 0, err
+		}
+	}
+	return len(papers), nil
+}
+
+// RemapRevisionChoices 改写版本中保存的选项ID（租户迁移时使用），没有对应关系的选项保持原ID
+func RemapRevisionChoices(choicesJSON string, remap func(uint) (uint, bool)) string {
+	var choices []revisionChoice
+	if choicesJSON == "" || json.Unmarshal([]byte(choicesJSON), &choices) != nil {
+		return choicesJSON
+	}
+	for i := range choices {
+		if id, ok := remap(choices[i].ID); ok {
+			choices[i].ID = id
+		}
+	}
+	data, _ := json.Marshal(choices)
+	return string(data)
+}
+
+// applyQuestionRevision 以版本内容替换题目内容，版本不是当前版本时记录题目的当前版本号
+func applyQuestionRevision(question *models.Question, revision models.QuestionRevision) {
+	decodeRevisionChoices(&revision)
+	question.Type = revision.Type
+	question.Title = revision.Title
+	question.Content = revision.Content
+	question.Options = revision.Options
+	question.Answer = revision.Answer
+	question.Explanation = revision.Explanation
+	question.Difficulty = revision.Difficulty
+	question.Score = revision.Score
+	question.KnowledgePoint = revision.KnowledgePoint
+	question.ParentID = revision.ParentID
+	question.Position = revision.Position
+	question.Choices = revision.Choices
+	if question.Version != revision.Version && question.Version != 0 {
+		question.LatestVersion = question.Version
+	}
+	question.Version = revision.Version
+}
+
+// LoadPaperQuestions 加载试卷的题目，按组卷时固定的版本显示（包括组卷后被删除的题目），材料题后紧跟其子题。
+// 没有固定版本的题目（升级前的试卷）按当前内容显示
+func LoadPaperQuestions(db *gorm.DB, tenantID, paperID uint) ([]models.Question, error) {
+	questionIDs, err := paperQuestionIDs(db, paperID)
+	if err != nil {
+		return nil, err
+	}
+	var current []models.Question
+	if err := utils.WithTenant(db, tenantID).Preload("Subject").Where("id IN ?", questionIDs).Find(&current).Error; err != nil {
+		return nil, err
+	}
+	if err := AttachQuestionOptions(db, tenantID, current); err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Question, len(current))
+	for _, question := range current {
+		byID[question.ID] = question
+	}
+
+	var pins []models.PaperQuestionRevision
+	if err := utils.WithTenant(db, tenantID).Where("paper_id = ?", paperID).Find(&pins).Error; err != nil {
+		return nil, err
+	}
+	revisionIDs := make([]uint, len(pins))
+	for i, pin := range pins {
+		revisionIDs[i] = pin.RevisionID
+	}
+	var revisions []models.QuestionRevision
+	if len(revisionIDs) > 0 {
+		if err := utils.WithTenant(db, tenantID).Where("id IN ?", revisionIDs).Find(&revisions).Error; err != nil {
+			return nil, err
+		}
+	}
+	revisionByQuestion := make(map[uint]models.QuestionRevision, len(revisions))
+	for _, revision := range revisions {
+		revisionByQuestion[revision.QuestionID] = revision
+	}
+
+	questions := make([]models.Question, 0, len(questionIDs))
+	for _, questionID := range questionIDs {
+		question, exists := byID[questionID]
+		revision, pinned := revisionByQuestion[questionID]
+		switch {
+		case pinned:
+			if !exists {
+				question = models.Question{ID: questionID, TenantID: tenantID, CreatedBy: revision.CreatedBy}
+			}
+			applyQuestionRevision(&question, revision)
+		case !exists:
+			continue
+		}
+		questions = append(questions, question)
+	}
+	return GroupQuestions(questions), nil
+}
+
+// GetQuestionRevisions 题目的全部版本，按版本号从新到旧
+func GetQuestionRevisions(db *gorm.DB, tenantID, questionID uint) ([]models.QuestionRevision, error) {
+	var revisions []models.QuestionRevision
+	if err := utils.WithTenant(db, tenantID).Where("question_id = ?", questionID).Order("version DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		decodeRevisionChoices(&revisions[i])
+	}
+	return revisions, nil
+}
+
+// GetQuestionRevision 题目的指定版本
+func GetQuestionRevision(db *gorm.DB, tenantID, questionID uint, version int) (*models.QuestionRevision, error) {
+	var revision models.QuestionRevision
+	if err := utils.WithTenant(db, tenantID).Where("question_id = ? AND version = ?", questionID, version).First(&revision).Error; err != nil {
+		return nil, err
+	}
+	decodeRevisionChoices(&revision)
+	return &revision, nil
+}
+
+// QuestionFieldChange 两个版本之间一个字段的变化
+type QuestionFieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// QuestionOptionChange 两个版本之间一个选项的变化：added、removed 或 changed（内容、正确标记、反馈或顺序）
+type QuestionOptionChange struct {
+	OptionID uint                   `json:"option_id"`
+	Change   string                 `json:"change"`
+	Before   *models.QuestionOption `json:"before,omitempty"`
+	After    *models.QuestionOption `json:"after,omitempty"`
+}
+
+// QuestionRevisionDiff 两个版本的差异
+type QuestionRevisionDiff struct {
+	QuestionID uint                   `json:"question_id"`
+	From       int                    `json:"from"`
+	To         int                    `json:"to"`
+	Fields     []QuestionFieldChange  `json:"fields"`
+	Options    []QuestionOptionChange `json:"options"`
+}
+
+// DiffQuestionRevisions 比较两个版本（选项需已解析），选项按选项ID对应
+func DiffQuestionRevisions(from, to models.QuestionRevision) QuestionRevisionDiff {
+	diff := QuestionRevisionDiff{
+		QuestionID: to.QuestionID,
+		From:       from.Version,
+		To:         to.Version,
+		Fields:     []QuestionFieldChange{},
+		Options:    []QuestionOptionChange{},
+	}
+	field := func(name string, before, after interface{}) {
+		if before != after {
+			diff.Fields = append(diff.Fields, QuestionFieldChange{Field: name, Before: before, After: after})
+		}
+	}
+	parentID := func(id *uint) interface{} {
+		if id == nil {
+			return nil
+		}
+		return *id
+	}
+	field("type", from.Type, to.Type)
+	field("title", from.Title, to.Title)
+	field("content", from.Content, to.Content)
+	if from.ChoicesJSON == "" || to.ChoicesJSON == "" {
+		field("options", from.Options, to.Options) // 选择题的选项差异见 options 列表
+	}
+	field("answer", from.Answer, to.Answer)
+	field("explanation", from.Explanation, to.Explanation)
+	field("difficulty", from.Difficulty, to.Difficulty)
+	field("score", from.Score, to.Score)
+	field("knowledge_point", from.KnowledgePoint, to.KnowledgePoint)
+	field("parent_id", parentID(from.ParentID), parentID(to.ParentID))
+	field("position", from.Position, to.Position)
+
+	after := make(map[uint]*models.QuestionOption, len(to.Choices))
+	for i := range to.Choices {
+		after[to.Choices[i].ID] = &to.Choices[i]
+	}
+	for i := range from.Choices {
+		before := &from.Choices[i]
+		option, ok := after[before.ID]
+		switch {
+		case !ok:
+			diff.Options = append(diff.Options, QuestionOptionChange{OptionID: before.ID, Change: "removed", Before: before})
+		case option.Content != before.Content || option.IsCorrect != before.IsCorrect || option.Feedback != before.Feedback || option.Position != before.Position:
+			diff.Options = append(diff.Options, QuestionOptionChange{OptionID: before.ID, Change: "changed", Before: before, After: option})
+		}
+		delete(after, before.ID)
+	}
+	for i := range to.Choices {
+		if option, ok := after[to.Choices[i].ID]; ok {
+			diff.Options = append(diff.Options, QuestionOptionChange{OptionID: option.ID, Change: "added", After: option})
+		}
+	}
+	return diff
+}
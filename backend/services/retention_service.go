@@ -0,0 +1,455 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 默认每批处理的记录数
+const defaultRetentionBatchSize = 500
+
+// retentionTarget 描述一类可配置保留策略的数据
+type retentionTarget struct {
+	model      interface{}
+	timeColumn string // 用于判断记录是否过期的时间字段
+	userColumn string // 匿名化时清空的用户关联字段，为空表示不支持匿名化
+	children   []retentionChild
+}
+
+// retentionChild 删除父记录前需要先删除的子记录
+type retentionChild struct {
+	model     interface{}
+	parentKey string
+}
+
+// retentionTargets 支持配置保留策略的数据及其规则。审计日志只追加，不能通过保留策略删除
+var retentionTargets = map[string]retentionTarget{
+	"ai_chats": {
+		model:      &models.AIChat{},
+		timeColumn: "created_at",
+		userColumn: "user_id",
+	},
+	"exam_records": {
+		model:      &models.ExamRecord{},
+		timeColumn: "created_at",
+		userColumn: "student_id",
+		children:   []retentionChild{{model: &models.Answer{}, parentKey: "exam_record_id"}},
+	},
+	"practice_records": {
+		model:      &models.PracticeRecord{},
+		timeColumn: "created_at",
+		userColumn: "user_id",
+		children:   []retentionChild{{model: &models.PracticeAnswer{}, parentKey: "practice_record_id"}},
+	},
+	"practice_answers": {
+		model:      &models.PracticeAnswer{},
+		timeColumn: "created_at",
+	},
+	"login_attempts": {
+		model:      &models.LoginAttempt{},
+		timeColumn: "created_at",
+	},
+	"import_jobs": {
+		model:      &models.ImportJob{},
+		timeColumn: "created_at",
+	},
+}
+
+// tenantDeletionOrder 删除租户时的表顺序，被引用的表放在后面
+var tenantDeletionOrder = []struct {
+	name  string
+	model interface{}
+}{
+	{"audit_logs", &models.AuditLog{}},
+	{"import_jobs", &models.ImportJob{}},
+	{"resource_shares", &models.ResourceShare{}},
+	{"ai_chats", &models.AIChat{}},
+	{"practice_recommendations", &models.PracticeRecommendation{}},
+	{"practice_answers", &models.PracticeAnswer{}},
+	{"practice_records", &models.PracticeRecord{}},
+	{"answers", &models.Answer{}},
+	{"exam_records", &models.ExamRecord{}},
+	{"exams", &models.Exam{}},
+	{"invite_codes", &models.InviteCode{}},
+	{"class_members", &models.ClassMember{}},
+	{"classes", &models.Class{}},
+	{"paper_question_revisions", &models.PaperQuestionRevision{}},
+	{"paper_questions", nil}, // 关联表没有租户字段，按试卷ID删除
+	{"papers", &models.Paper{}},
+	{"question_options", &models.QuestionOption{}},
+	{"question_revisions", &models.QuestionRevision{}},
+	{"question_reviews", &models.QuestionReview{}},
+	{"question_attachments", &models.QuestionAttachment{}},
+	{"attachments", &models.Attachment{}},
+	{"questions", &models.Question{}},
+	{"subject_reviewers", &models.SubjectReviewer{}},
+	{"subjects", &models.Subject{}},
+	{"retention_policies", &models.RetentionPolicy{}},
+	{"refresh_tokens", &models.RefreshToken{}},
+	{"password_histories", &models.PasswordHistory{}},
+	{"two_factor_recovery_codes", &models.TwoFactorRecoveryCode{}},
+	{"user_two_factors", &models.UserTwoFactor{}},
+	{"login_attempts", &models.LoginAttempt{}},
+	{"tenant_security_policies", &models.TenantSecurityPolicy{}},
+	{"user_identities", &models.UserIdentity{}},
+	{"oidc_providers", &models.OIDCProvider{}},
+	{"ldap_configs", &models.LDAPConfig{}},
+	{"users", &models.User{}},
+	{"tenant_roles", &models.TenantRole{}},
+}
+
+// RetentionRunResult 单条策略的执行结果
+type RetentionRunResult struct {
+	PolicyID uint                   `json:"policy_id"`
+	Target   string                 `json:"target"`
+	Action   models.RetentionAction `json:"action"`
+	Cutoff   time.Time              `json:"cutoff"`
+	Affected int64                  `json:"affected"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// TenantDeletionTableReport 删除报告中单张表的统计
+type TenantDeletionTableReport struct {
+	Table     string `json:"table"`
+	Before    int64  `json:"before"`
+	Deleted   int64  `json:"deleted"`
+	Remaining int64  `json:"remaining"`
+}
+
+// TenantDeletionReport 租户删除报告
+type TenantDeletionReport struct {
+	JobID      uint                        `json:"job_id"`
+	TenantID   uint                        `json:"tenant_id"`
+	StartedAt  time.Time                   `json:"started_at"`
+	FinishedAt time.Time                   `json:"finished_at"`
+	Tables     []TenantDeletionTableReport `json:"tables"`
+	Complete   bool                        `json:"complete"` // 所有表剩余记录数均为0
+}
+
+// RetentionService 数据保留与租户删除服务
+type RetentionService struct{}
+
+// NewRetentionService 创建数据保留服务实例
+func NewRetentionService() *RetentionService {
+	return &RetentionService{}
+}
+
+// IsValidRetentionRule 检查目标数据是否支持指定的动作
+func IsValidRetentionRule(target string, action models.RetentionAction) bool {
+	t, ok := retentionTargets[target]
+	if !ok {
+		return false
+	}
+	switch action {
+	case models.RetentionDelete:
+		return true
+	case models.RetentionAnonymize:
+		return t.userColumn != ""
+	}
+	return false
+}
+
+// RetentionTargetNames 返回支持的目标数据列表
+func RetentionTargetNames() []string {
+	names := make([]string, 0, len(retentionTargets))
+	for name := range retentionTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartRetentionScheduler 启动数据保留调度器，每天执行一次所有租户的策略
+func (rs *RetentionService) StartRetentionScheduler() {
+	ticker := time.NewTicker(24 * time.Hour)
+	go func() {
+		for range ticker.C {
+			rs.RunAllPolicies()
+		}
+	}()
+
+	log.Println("数据保留调度器已启动")
+}
+
+// RunAllPolicies 执行所有租户的启用策略
+func (rs *RetentionService) RunAllPolicies() {
+	var tenantIDs []uint
+	if err := database.DB.Model(&models.RetentionPolicy{}).Where("is_active = ?", true).Distinct().Pluck("tenant_id", &tenantIDs).Error; err != nil {
+		log.Printf("获取数据保留策略失败: %v", err)
+		return
+	}
+
+	for _, tenantID := range tenantIDs {
+		for _, result := range rs.RunTenantPolicies(tenantID) {
+			if result.Error != "" {
+				log.Printf("租户 %d 执行保留策略 %d (%s) 失败: %s", tenantID, result.PolicyID, result.Target, result.Error)
+			} else if result.Affected > 0 {
+				log.Printf("租户 %d 保留策略 %d (%s %s) 处理了 %d 条记录", tenantID, result.PolicyID, result.Action, result.Target, result.Affected)
+			}
+		}
+	}
+}
+
+// RunTenantPolicies 立即执行指定租户的所有启用策略
+func (rs *RetentionService) RunTenantPolicies(tenantID uint) []RetentionRunResult {
+	var policies []models.RetentionPolicy
+	utils.WithTenant(database.DB, tenantID).Where("is_active = ?", true).Order("id ASC").Find(&policies)
+
+	results := make([]RetentionRunResult, 0, len(policies))
+	for i := range policies {
+		results = append(results, rs.RunPolicy(&policies[i]))
+	}
+	return results
+}
+
+// RunPolicy 执行单条保留策略
+func (rs *RetentionService) RunPolicy(policy *models.RetentionPolicy) RetentionRunResult {
+	now := time.Now()
+	result := RetentionRunResult{
+		PolicyID: policy.ID,
+		Target:   policy.Target,
+		Action:   policy.Action,
+		Cutoff:   now.AddDate(0, 0, -policy.RetainDays),
+	}
+
+	target, ok := retentionTargets[policy.Target]
+	if !ok || !IsValidRetentionRule(policy.Target, policy.Action) {
+		result.Error = "不支持的保留策略"
+		return result
+	}
+
+	var err error
+	switch policy.Action {
+	case models.RetentionDelete:
+		result.Affected, err = purgeExpired(policy.TenantID, target, result.Cutoff, defaultRetentionBatchSize)
+	case models.RetentionAnonymize:
+		result.Affected, err = anonymizeExpired(policy.TenantID, target, result.Cutoff)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	policy.LastRunAt = &now
+	policy.LastAffected = result.Affected
+	database.DB.Model(policy).Updates(map[string]interface{}{
+		"last_run_at":   policy.LastRunAt,
+		"last_affected": policy.LastAffected,
+	})
+
+	return result
+}
+
+// purgeExpired 分批删除过期记录（先删除子记录）
+func purgeExpired(tenantID uint, target retentionTarget, cutoff time.Time, batchSize int) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		if err := utils.WithTenant(database.DB, tenantID).Model(target.model).
+			Where(target.timeColumn+" < ?", cutoff).
+			Order("id ASC").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for _, child := range target.children {
+				if err := utils.WithTenant(tx, tenantID).Where(child.parentKey+" IN ?", ids).Delete(child.model).Error; err != nil {
+					return err
+				}
+			}
+			result := utils.WithTenant(tx, tenantID).Where("id IN ?", ids).Delete(target.model)
+			total += result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// anonymizeExpired 将过期记录的用户关联置为0，保留统计数据
+func anonymizeExpired(tenantID uint, target retentionTarget, cutoff time.Time) (int64, error) {
+	result := utils.WithTenant(database.DB, tenantID).Model(target.model).
+		Where(target.timeColumn+" < ? AND "+target.userColumn+" <> 0", cutoff).
+		Update(target.userColumn, 0)
+	return result.RowsAffected, result.Error
+}
+
+// CreateDeletionJob 创建租户删除任务
+func (rs *RetentionService) CreateDeletionJob(tenantID uint, requestedBy string, batchSize int) (*models.TenantDeletionJob, error) {
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+
+	var running int64
+	database.DB.Model(&models.TenantDeletionJob{}).
+		Where("target_tenant_id = ? AND status IN ?", tenantID, []models.DeletionJobStatus{models.DeletionPending, models.DeletionRunning}).
+		Count(&running)
+	if running > 0 {
+		return nil, fmt.Errorf("租户 %d 已有进行中的删除任务", tenantID)
+	}
+
+	job := &models.TenantDeletionJob{
+		TargetTenantID: tenantID,
+		Status:         models.DeletionPending,
+		BatchSize:      batchSize,
+		RequestedBy:    requestedBy,
+	}
+	if err := database.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RunDeletionJob 执行租户删除任务，按表分批删除该租户的全部数据并生成报告
+func (rs *RetentionService) RunDeletionJob(job *models.TenantDeletionJob) error {
+	startedAt := time.Now()
+	job.Status = models.DeletionRunning
+	job.StartedAt = &startedAt
+	database.DB.Save(job)
+
+	report := TenantDeletionReport{
+		JobID:     job.ID,
+		TenantID:  job.TargetTenantID,
+		StartedAt: startedAt,
+	}
+
+	// 先清理用户缓存，使该租户已签发的token在删除开始后立即失效
+	var users []models.User
+	database.DB.Select("id", "username").Where("tenant_id = ?", job.TargetTenantID).Find(&users)
+	cacheService := NewCacheService()
+	for _, u := range users {
+		cacheService.InvalidateUserCache(job.TargetTenantID, u.ID, u.Username)
+	}
+
+	// 删除附件文件，附件记录随后按表删除
+	if err := NewAttachmentService().DeleteTenantFiles(job.TargetTenantID); err != nil {
+		return rs.failDeletionJob(job, fmt.Errorf("删除附件文件失败: %w", err))
+	}
+
+	for _, table := range tenantDeletionOrder {
+		tableReport, err := deleteTenantTable(job.TargetTenantID, table.name, table.model, job.BatchSize)
+		report.Tables = append(report.Tables, tableReport)
+		if err != nil {
+			return rs.failDeletionJob(job, fmt.Errorf("删除%s失败: %w", table.name, err))
+		}
+	}
+
+	// 删除租户记录本身
+	if database.DB.Migrator().HasTable(&models.Tenant{}) {
+		database.DB.Delete(&models.Tenant{}, job.TargetTenantID)
+	}
+
+	report.FinishedAt = time.Now()
+	report.Complete = true
+	for _, t := range report.Tables {
+		if t.Remaining > 0 {
+			report.Complete = false
+		}
+	}
+
+	reportJSON, digest := signDeletionReport(report)
+	job.Report = reportJSON
+	job.ReportDigest = digest
+	job.FinishedAt = &report.FinishedAt
+	job.Status = models.DeletionCompleted
+	if !report.Complete {
+		job.Status = models.DeletionFailed
+		job.Error = "部分数据未能删除，详见报告"
+	}
+	if err := database.DB.Save(job).Error; err != nil {
+		return err
+	}
+
+	log.Printf("租户 %d 删除任务 %d 完成，报告摘要 %s", job.TargetTenantID, job.ID, digest)
+	return nil
+}
+
+// deleteTenantTable 分批删除单张表中属于该租户的记录
+func deleteTenantTable(tenantID uint, name string, model interface{}, batchSize int) (TenantDeletionTableReport, error) {
+	report := TenantDeletionTableReport{Table: name}
+
+	// 试卷-题目关联表通过试卷ID定位
+	if model == nil {
+		paperIDs := utils.WithTenant(database.DB, tenantID).Model(&models.Paper{}).Select("id")
+		database.DB.Table(name).Where("paper_id IN (?)", paperIDs).Count(&report.Before)
+		result := database.DB.Table(name).Where("paper_id IN (?)", paperIDs).Delete(nil)
+		report.Deleted = result.RowsAffected
+		database.DB.Table(name).Where("paper_id IN (?)", paperIDs).Count(&report.Remaining)
+		return report, result.Error
+	}
+
+	utils.WithTenant(database.DB, tenantID).Model(model).Count(&report.Before)
+	for {
+		var ids []uint
+		if err := utils.WithTenant(database.DB, tenantID).Model(model).Order("id ASC").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+			return report, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		result := utils.WithTenant(database.DB, tenantID).Where("id IN ?", ids).Delete(model)
+		if result.Error != nil {
+			return report, result.Error
+		}
+		report.Deleted += result.RowsAffected
+	}
+	utils.WithTenant(database.DB, tenantID).Model(model).Count(&report.Remaining)
+
+	return report, nil
+}
+
+// failDeletionJob 将任务标记为失败
+func (rs *RetentionService) failDeletionJob(job *models.TenantDeletionJob, err error) error {
+	now := time.Now()
+	job.Status = models.DeletionFailed
+	job.Error = err.Error()
+	job.FinishedAt = &now
+	database.DB.Save(job)
+	return err
+}
+
+// signDeletionReport 序列化删除报告并计算摘要
+func signDeletionReport(report TenantDeletionReport) (string, string) {
+	data, _ := json.Marshal(report)
+	return string(data), fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// VerifyDeletionJob 校验删除报告未被篡改，并重新确认租户在各表中已无残留数据
+func (rs *RetentionService) VerifyDeletionJob(job *models.TenantDeletionJob) (bool, []TenantDeletionTableReport, error) {
+	if job.Report == "" {
+		return false, nil, fmt.Errorf("删除任务尚未生成报告")
+	}
+	if fmt.Sprintf("%x", sha256.Sum256([]byte(job.Report))) != job.ReportDigest {
+		return false, nil, fmt.Errorf("删除报告摘要不匹配")
+	}
+
+	var current []TenantDeletionTableReport
+	clean := true
+	for _, table := range tenantDeletionOrder {
+		t := TenantDeletionTableReport{Table: table.name}
+		if table.model == nil {
+			paperIDs := utils.WithTenant(database.DB, job.TargetTenantID).Model(&models.Paper{}).Select("id")
+			database.DB.Table(table.name).Where("paper_id IN (?)", paperIDs).Count(&t.Remaining)
+		} else {
+			utils.WithTenant(database.DB, job.TargetTenantID).Model(table.model).Count(&t.Remaining)
+		}
+		if t.Remaining > 0 {
+			clean = false
+		}
+		current = append(current, t)
+	}
+
+	return clean, current, nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 访问令牌撤销列表的缓存键前缀
+	RevokedTokenPrefix = "revoked_token"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，会话已撤销")
+)
+
+// AccessTokenIssuer 签发访问令牌，返回令牌及其过期时间（由middleware.IssueAccessToken实现）
+type AccessTokenIssuer func(user *models.User) (string, time.Time, error)
+
+// TokenPair 一次登录或刷新签发的令牌
+type TokenPair struct {
+	AccessToken     string
+	AccessExpiresAt time.Time
+	RefreshToken    string
+	Session         *models.RefreshToken
+}
+
+// SessionService 服务端会话（刷新令牌）与访问令牌撤销
+type SessionService struct {
+	cacheService *CacheService
+}
+
+// NewSessionService 创建会话服务实例
+func NewSessionService() *SessionService {
+	return &SessionService{
+		cacheService: NewCacheService(),
+	}
+}
+
+// HashToken 计算令牌的SHA-256摘要，服务端只保存摘要
+func HashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// newOpaqueToken 生成随机的不透明令牌
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CreateSession 登录成功后签发访问令牌并创建新的会话
+func (ss *SessionService) CreateSession(tenantID uint, user *models.User, issue AccessTokenIssuer, ip, userAgent string) (*TokenPair, error) {
+	familyID, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	return ss.issue(database.DB, tenantID, user, familyID, issue, ip, userAgent)
+}
+
+// issue 在指定会话族中签发一对新令牌
+func (ss *SessionService) issue(db *gorm.DB, tenantID uint, user *models.User, familyID string, issue AccessTokenIssuer, ip, userAgent string) (*TokenPair, error) {
+	accessToken, accessExpiresAt, err := issue(user)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.RefreshToken{
+		TenantID:        tenantID,
+		UserID:          user.ID,
+		TokenHash:       HashToken(refreshToken),
+		FamilyID:        familyID,
+		AccessTokenHash: HashToken(accessToken),
+		AccessExpiresAt: accessExpiresAt,
+		ExpiresAt:       time.Now().Add(config.GetConfig().RefreshTokenTTL),
+		IP:              ip,
+		UserAgent:       userAgent,
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:     accessToken,
+		AccessExpiresAt: accessExpiresAt,
+		RefreshToken:    refreshToken,
+		Session:         session,
+	}, nil
+}
+
+// Rotate 使用刷新令牌换取新的令牌对，旧刷新令牌立即失效。
+// 已失效的刷新令牌被再次使用时视为泄露，整个会话族都会被撤销。
+func (ss *SessionService) Rotate(tenantID uint, refreshToken string, issue AccessTokenIssuer, ip, userAgent string) (*TokenPair, *models.User, error) {
+	var current models.RefreshToken
+	if err := utils.WithTenant(database.DB, tenantID).Where("token_hash = ?", HashToken(refreshToken)).First(&current).Error; err != nil {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+
+	if current.RevokedAt != nil {
+		ss.RevokeFamily(tenantID, current.FamilyID)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, current.UserID).Error; err != nil || !user.IsActive {
+		ss.RevokeFamily(tenantID, current.FamilyID)
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+
+	var pair *TokenPair
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证并发刷新时只有一个请求成功
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", current.ID).Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		pair, err = ss.issue(tx, tenantID, &user, current.FamilyID, issue, ip, userAgent)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).Where("id = ?", current.ID).Update("replaced_by_id", pair.Session.ID).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			ss.RevokeFamily(tenantID, current.FamilyID)
+		}
+		return nil, nil, err
+	}
+
+	return pair, &user, nil
+}
+
+// FindSessionByAccessToken 根据访问令牌查找所属会话
+func (ss *SessionService) FindSessionByAccessToken(tenantID uint, accessTokenHash string) (*models.RefreshToken, error) {
+	var session models.RefreshToken
+	if err := utils.WithTenant(database.DB, tenantID).Where("access_token_hash = ?", accessTokenHash).Order("id DESC").First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindSessionByRefreshToken 根据刷新令牌查找会话
+func (ss *SessionService) FindSessionByRefreshToken(tenantID uint, refreshToken string) (*models.RefreshToken, error) {
+	var session models.RefreshToken
+	if err := utils.WithTenant(database.DB, tenantID).Where("token_hash = ?", HashToken(refreshToken)).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeFamily 撤销会话族中的所有刷新令牌及其仍有效的访问令牌
+func (ss *SessionService) RevokeFamily(tenantID uint, familyID string) {
+	var sessions []models.RefreshToken
+	utils.WithTenant(database.DB, tenantID).Where("family_id = ?", familyID).Find(&sessions)
+	ss.revokeSessions(tenantID, sessions)
+}
+
+// EndUserSessions 递增用户会话版本并撤销其全部会话，使已签发的所有token立即失效。
+// 角色变更、停用、删除账号及修改密码时调用。
+func (ss *SessionService) EndUserSessions(tenantID uint, user *models.User) error {
+	if err := utils.WithTenant(database.DB.Model(&models.User{}), tenantID).Where("id = ?", user.ID).
+		UpdateColumn("session_version", gorm.Expr("session_version + 1")).Error; err != nil {
+		return err
+	}
+	user.SessionVersion++
+
+	ss.cacheService.InvalidateUserCache(tenantID, user.ID, user.Username)
+	ss.RevokeUserSessions(tenantID, user.ID)
+	return nil
+}
+
+// RevokeUserSessions 撤销用户的全部会话
+func (ss *SessionService) RevokeUserSessions(tenantID uint, userID uint) int {
+	var sessions []models.RefreshToken
+	utils.WithTenant(database.DB, tenantID).Where("user_id = ? AND (revoked_at IS NULL OR access_expires_at > ?)", userID, time.Now()).Find(&sessions)
+	ss.revokeSessions(tenantID, sessions)
+	return len(sessions)
+}
+
+func (ss *SessionService) revokeSessions(tenantID uint, sessions []models.RefreshToken) {
+	now := time.Now()
+	var ids []uint
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+		if s.AccessTokenHash != "" && s.AccessExpiresAt.After(now) {
+			ss.RevokeAccessToken(tenantID, s.AccessTokenHash, s.AccessExpiresAt)
+		}
+	}
+	if len(ids) > 0 {
+		database.DB.Model(&models.RefreshToken{}).Where("id IN ? AND revoked_at IS NULL", ids).Update("revoked_at", now)
+	}
+}
+
+// RevokeAccessToken 将访问令牌加入撤销列表，直到其自然过期
+func (ss *SessionService) RevokeAccessToken(tenantID uint, accessTokenHash string, expiresAt time.Time) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return
+	}
+	storeSet(tenantID, fmt.Sprintf("%s:%s", RevokedTokenPrefix, accessTokenHash), true, ttl)
+	ss.cacheService.InvalidateTokenCache(tenantID, accessTokenHash)
+}
+
+// IsAccessTokenRevoked 检查访问令牌是否已被撤销
+func (ss *SessionService) IsAccessTokenRevoked(tenantID uint, accessTokenHash string) bool {
+	var revoked bool
+	return storeGet(tenantID, fmt.Sprintf("%s:%s", RevokedTokenPrefix, accessTokenHash), &revoked) && revoked
+}
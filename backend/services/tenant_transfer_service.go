@@ -0,0 +1,1054 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// 租户归档格式版本，结构不兼容变更时递增
+	TenantArchiveFormatVersion = 1
+	TenantArchiveManifestFile  = "manifest.json"
+
+	// 导出时每批读取的记录数
+	tenantExportBatchSize = 500
+)
+
+// 导入时用户名/邮箱冲突的处理策略
+const (
+	ConflictFail   = "fail"   // 存在冲突则整体失败
+	ConflictRename = "rename" // 为冲突的用户名和邮箱追加后缀
+	ConflictMerge  = "merge"  // 复用目标租户中的同名用户
+)
+
+// TenantArchiveEntry 归档中单个数据文件的描述
+type TenantArchiveEntry struct {
+	Model  string `json:"model"`
+	File   string `json:"file"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// TenantManifest 归档清单
+type TenantManifest struct {
+	FormatVersion  int                  `json:"format_version"`
+	ExportedAt     time.Time            `json:"exported_at"`
+	SourceTenantID uint                 `json:"source_tenant_id"`
+	Tenant         *models.Tenant       `json:"tenant,omitempty"`
+	Entries        []TenantArchiveEntry `json:"entries"`
+}
+
+// TenantImportOptions 导入选项
+type TenantImportOptions struct {
+	OnConflict   string // fail / rename / merge
+	RenameSuffix string // rename策略下追加的后缀，为空时使用 "_t<目标租户ID>"
+}
+
+// TenantImportReport 导入结果
+type TenantImportReport struct {
+	SourceTenantID uint              `json:"source_tenant_id"`
+	TargetTenantID uint              `json:"target_tenant_id"`
+	Imported       map[string]int    `json:"imported"`
+	RenamedUsers   map[string]string `json:"renamed_users,omitempty"`
+	MergedUsers    []string          `json:"merged_users,omitempty"`
+	Skipped        []string          `json:"skipped,omitempty"`
+}
+
+// UsernameConflictError 用户名或邮箱与目标实例中已有用户冲突
+type UsernameConflictError struct {
+	Conflicts []string
+}
+
+func (e *UsernameConflictError) Error() string {
+	return fmt.Sprintf("%d 个用户与现有账号冲突: %v", len(e.Conflicts), e.Conflicts)
+}
+
+// exportedUser 导出用户时保留密码哈希（models.User 的 Password 字段默认不序列化）
+type exportedUser struct {
+	models.User
+	Password string `json:"password"`
+}
+
+// exportedQuestionRevision 导出题目版本时保留保存的选项（models.QuestionRevision 的 ChoicesJSON 字段默认不序列化）
+type exportedQuestionRevision struct {
+	models.QuestionRevision
+	ChoicesJSON string `json:"choices"`
+}
+
+// exportedOIDCProvider 导出单点登录配置时保留客户端密钥（models.OIDCProvider 的 ClientSecret 字段默认不序列化）
+type exportedOIDCProvider struct {
+	models.OIDCProvider
+	ClientSecret string `json:"client_secret"`
+}
+
+// exportedLDAPConfig 导出LDAP配置时保留服务账号密码（models.LDAPConfig 的 BindPassword 字段默认不序列化）
+type exportedLDAPConfig struct {
+	models.LDAPConfig
+	BindPassword string `json:"bind_password"`
+}
+
+// paperQuestionRow 试卷-题目关联表记录
+type paperQuestionRow struct {
+	PaperID    uint `json:"paper_id"`
+	QuestionID uint `json:"question_id"`
+}
+
+// TenantTransferService 租户数据导出/导入服务
+type TenantTransferService struct{}
+
+// NewTenantTransferService 创建租户迁移服务实例
+func NewTenantTransferService() *TenantTransferService {
+	return &TenantTransferService{}
+}
+
+// Export 将租户全部数据导出为zip归档（manifest.json + 每个模型一个JSON Lines文件）
+func (ts *TenantTransferService) Export(tenantID uint, w io.Writer) (*TenantManifest, error) {
+	zw := zip.NewWriter(w)
+	db := database.DB
+
+	manifest := &TenantManifest{
+		FormatVersion:  TenantArchiveFormatVersion,
+		ExportedAt:     time.Now(),
+		SourceTenantID: tenantID,
+	}
+
+	var tenant models.Tenant
+	if db.Migrator().HasTable(&models.Tenant{}) && db.First(&tenant, tenantID).Error == nil {
+		manifest.Tenant = &tenant
+	}
+
+	for _, export := range tenantExporters {
+		entry, err := export(zw, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	files, err := exportAttachmentFiles(zw, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Entries = append(manifest.Entries, files...)
+
+	mw, err := zw.Create(TenantArchiveManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// tenantExporter 将租户下某一类数据写入归档
+type tenantExporter func(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error)
+
+// tenantExporters 按导入依赖顺序排列的导出器
+var tenantExporters = []tenantExporter{
+	tenantRows[models.TenantRole]("tenant_roles"),
+	exportUsers,
+	exportOIDCProviders,
+	tenantRows[models.UserIdentity]("user_identities"),
+	exportLDAPConfigs,
+	tenantRows[models.Subject]("subjects"),
+	tenantRows[models.SubjectReviewer]("subject_reviewers"),
+	tenantRows[models.Attachment]("attachments"),
+	tenantRows[models.Question]("questions"),
+	tenantRows[models.QuestionAttachment]("question_attachments"),
+	tenantRows[models.QuestionOption]("question_options"),
+	exportQuestionRevisions,
+	tenantRows[models.QuestionReview]("question_reviews"),
+	tenantRows[models.Paper]("papers"),
+	exportPaperQuestions,
+	tenantRows[models.PaperQuestionRevision]("paper_question_revisions"),
+	tenantRows[models.Exam]("exams"),
+	tenantRows[models.ExamRecord]("exam_records"),
+	tenantRows[models.Answer]("answers"),
+	tenantRows[models.PracticeRecord]("practice_records"),
+	tenantRows[models.PracticeAnswer]("practice_answers"),
+	tenantRows[models.PracticeRecommendation]("practice_recommendations"),
+	tenantRows[models.AIChat]("ai_chats"),
+	tenantRows[models.TenantSecurityPolicy]("tenant_security_policies"),
+	tenantRows[models.Class]("classes"),
+	tenantRows[models.ClassMember]("class_members"),
+	tenantRows[models.ResourceShare]("resource_shares"),
+	tenantRows[models.RetentionPolicy]("retention_policies"),
+}
+
+// tenantTransferExcluded 不随租户迁移的数据，导入报告的 Skipped 中列出以便管理员处理
+var tenantTransferExcluded = []string{
+	"invite_codes：邀请码是全局唯一的注册凭证，需在目标租户重新生成",
+	"user_two_factors、two_factor_recovery_codes：两步验证需要用户重新绑定",
+	"refresh_tokens：登录会话不迁移，用户需要重新登录",
+	"password_histories：密码历史不迁移",
+	"login_attempts、audit_logs、import_jobs：登录记录、审计日志和导入任务保留在源租户",
+}
+
+// tenantRows 返回按原样导出某模型记录的导出器
+func tenantRows[T any](name string) tenantExporter {
+	return func(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error) {
+		return exportTenantRows[T](zw, name, tenantID, nil)
+	}
+}
+
+// exportUsers 导出用户（包含密码哈希，导入后用户可以继续使用原密码登录）
+func exportUsers(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error) {
+	return exportTenantRows(zw, "users", tenantID, func(u *models.User) interface{} {
+		return exportedUser{User: *u, Password: u.Password}
+	})
+}
+
+// exportOIDCProviders 导出单点登录配置（包含客户端密钥，导入后无需重新配置）
+func exportOIDCProviders(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error) {
+	return exportTenantRows(zw, "oidc_providers", tenantID, func(p *models.OIDCProvider) interface{} {
+		return exportedOIDCProvider{OIDCProvider: *p, ClientSecret: p.ClientSecret}
+	})
+}
+
+// exportLDAPConfigs 导出LDAP配置（包含服务账号密码）
+func exportLDAPConfigs(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error) {
+	return exportTenantRows(zw, "ldap_configs", tenantID, func(c *models.LDAPConfig) interface{} {
+		return exportedLDAPConfig{LDAPConfig: *c, BindPassword: c.BindPassword}
+	})
+}
+
+// exportQuestionRevisions 导出题目版本
+func exportQuestionRevisions(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error) {
+	return exportTenantRows(zw, "question_revisions", tenantID, func(r *models.QuestionRevision) interface{} {
+		return exportedQuestionRevision{QuestionRevision: *r, ChoicesJSON: r.ChoicesJSON}
+	})
+}
+
+// exportTenantRows 分批读取租户下某模型的全部记录并写入 <name>.jsonl
+func exportTenantRows[T any](zw *zip.Writer, name string, tenantID uint, transform func(*T) interface{}) (TenantArchiveEntry, error) {
+	entry := TenantArchiveEntry{Model: name, File: name + ".jsonl"}
+
+	fw, err := zw.Create(entry.File)
+	if err != nil {
+		return entry, err
+	}
+	hash := sha256.New()
+	enc := json.NewEncoder(io.MultiWriter(fw, hash))
+
+	var batch []T
+	result := utils.WithTenant(database.DB, tenantID).Order("id ASC").FindInBatches(&batch, tenantExportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			var row interface{} = &batch[i]
+			if transform != nil {
+				row = transform(&batch[i])
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			entry.Count++
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return entry, fmt.Errorf("导出%s失败: %w", name, result.Error)
+	}
+
+	entry.SHA256 = fmt.Sprintf("%x", hash.Sum(nil))
+	return entry, nil
+}
+
+// exportPaperQuestions 导出试卷-题目关联表（该表本身没有租户字段）
+func exportPaperQuestions(zw *zip.Writer, tenantID uint) (TenantArchiveEntry, error) {
+	entry := TenantArchiveEntry{Model: "paper_questions", File: "paper_questions.jsonl"}
+
+	var rows []paperQuestionRow
+	paperIDs := utils.WithTenant(database.DB, tenantID).Model(&models.Paper{}).Select("id")
+	if err := database.DB.Table("paper_questions").Where("paper_id IN (?)", paperIDs).Order("paper_id, question_id").Find(&rows).Error; err != nil {
+		return entry, fmt.Errorf("导出paper_questions失败: %w", err)
+	}
+
+	fw, err := zw.Create(entry.File)
+	if err != nil {
+		return entry, err
+	}
+	hash := sha256.New()
+	enc := json.NewEncoder(io.MultiWriter(fw, hash))
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return entry, err
+		}
+		entry.Count++
+	}
+
+	entry.SHA256 = fmt.Sprintf("%x", hash.Sum(nil))
+	return entry, nil
+}
+
+// attachmentArchiveFile 附件文件在归档中的路径，按内容哈希命名
+func attachmentArchiveFile(hash string) string {
+	return "attachment_files/" + hash
+}
+
+// exportAttachmentFiles 将附件文件写入归档，每个文件作为清单中的一项参与校验；存储中已缺失的文件跳过，导入时按缺失处理
+func exportAttachmentFiles(zw *zip.Writer, tenantID uint) ([]TenantArchiveEntry, error) {
+	var attachments []models.Attachment
+	if err := utils.WithTenant(database.DB, tenantID).Order("id ASC").Find(&attachments).Error; err != nil {
+		return nil, fmt.Errorf("导出附件文件失败: %w", err)
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+
+	storage := NewAttachmentStorage()
+	entries := make([]TenantArchiveEntry, 0, len(attachments))
+	for _, attachment := range attachments {
+		rc, err := storage.Open(attachment.StorageKey)
+		if errors.Is(err, ErrAttachmentObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取附件 %d 失败: %w", attachment.ID, err)
+		}
+		entry := TenantArchiveEntry{Model: "attachment_files", File: attachmentArchiveFile(attachment.Hash), Count: 1}
+		fw, err := zw.Create(entry.File)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(io.MultiWriter(fw, hash), rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取附件 %d 失败: %w", attachment.ID, err)
+		}
+		entry.SHA256 = fmt.Sprintf("%x", hash.Sum(nil))
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ReadManifest 读取并校验归档清单
+func (ts *TenantTransferService) ReadManifest(zr *zip.Reader) (*TenantManifest, error) {
+	f, err := zr.Open(TenantArchiveManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("归档缺少%s", TenantArchiveManifestFile)
+	}
+	defer f.Close()
+
+	var manifest TenantManifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("解析归档清单失败: %w", err)
+	}
+	if manifest.FormatVersion > TenantArchiveFormatVersion {
+		return nil, fmt.Errorf("不支持的归档版本 %d（当前支持 %d）", manifest.FormatVersion, TenantArchiveFormatVersion)
+	}
+
+	// 校验每个数据文件的哈希
+	for _, entry := range manifest.Entries {
+		df, err := zr.Open(entry.File)
+		if err != nil {
+			return nil, fmt.Errorf("归档缺少数据文件 %s", entry.File)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, df)
+		df.Close()
+		if err != nil {
+			return nil, err
+		}
+		if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != entry.SHA256 {
+			return nil, fmt.Errorf("数据文件 %s 校验失败", entry.File)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// tenantIDMap 记录导入过程中旧ID到新ID的映射
+type tenantIDMap map[string]map[uint]uint
+
+func (m tenantIDMap) set(model string, oldID, newID uint) {
+	if m[model] == nil {
+		m[model] = make(map[uint]uint)
+	}
+	m[model][oldID] = newID
+}
+
+// get 返回映射后的ID，找不到时返回0和false
+func (m tenantIDMap) get(model string, oldID uint) (uint, bool) {
+	id, ok := m[model][oldID]
+	return id, ok
+}
+
+// remapIDList 重映射JSON格式存储的ID列表（如 Exam.StudentIDs、PracticeRecord.QuestionIDs）
+func (m tenantIDMap) remapIDList(model string, raw string) string {
+	if raw == "" {
+		return raw
+	}
+	var ids []uint
+	if err := json.Unmarshal([]byte(raw), &ids); err != nil {
+		return raw
+	}
+	mapped := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if newID, ok := m.get(model, id); ok {
+			mapped = append(mapped, newID)
+		}
+	}
+	out, _ := json.Marshal(mapped)
+	return string(out)
+}
+
+// Import 将归档导入到目标租户，所有主键和外键都会重新分配
+func (ts *TenantTransferService) Import(zr *zip.Reader, targetTenantID uint, opts TenantImportOptions) (*TenantImportReport, error) {
+	manifest, err := ts.ReadManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictFail
+	}
+	if opts.RenameSuffix == "" {
+		opts.RenameSuffix = fmt.Sprintf("_t%d", targetTenantID)
+	}
+
+	report := &TenantImportReport{
+		SourceTenantID: manifest.SourceTenantID,
+		TargetTenantID: targetTenantID,
+		Imported:       make(map[string]int),
+		RenamedUsers:   make(map[string]string),
+		Skipped:        append([]string(nil), tenantTransferExcluded...),
+	}
+	ids := make(tenantIDMap)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		create := func(model string, value interface{}) error {
+			if err := tx.Omit(clause.Associations).Create(value).Error; err != nil {
+				return fmt.Errorf("导入%s失败: %w", model, err)
+			}
+			report.Imported[model]++
+			return nil
+		}
+
+		// 自定义角色：目标租户已有同名角色时直接使用
+		if err := readArchiveRows(zr, "tenant_roles", func(r *models.TenantRole) error {
+			oldID := r.ID
+			var existing models.TenantRole
+			if utils.WithTenant(tx, targetTenantID).Where("name = ?", r.Name).First(&existing).Error == nil {
+				ids.set("tenant_roles", oldID, existing.ID)
+				return nil
+			}
+			r.ID = 0
+			r.TenantID = targetTenantID
+			if err := create("tenant_roles", r); err != nil {
+				return err
+			}
+			ids.set("tenant_roles", oldID, r.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// 用户：先处理用户名/邮箱冲突
+		var conflicts []string
+		err := readArchiveRows(zr, "users", func(u *exportedUser) error {
+			oldID := u.ID
+			user := u.User
+			user.ID = 0
+			user.TenantID = targetTenantID
+			user.Password = u.Password
+			user.TwoFactorEnabled = false // 两步验证密钥不随租户导出，导入后需重新绑定
+			if user.RoleID != nil {
+				if roleID, ok := ids.get("tenant_roles", *user.RoleID); ok {
+					user.RoleID = &roleID
+				} else {
+					user.RoleID = nil
+				}
+			}
+
+			var existing models.User
+			if tx.Where("username = ? OR email = ?", user.Username, user.Email).First(&existing).Error == nil {
+				switch {
+				case opts.OnConflict == ConflictMerge && existing.TenantID == targetTenantID:
+					ids.set("users", oldID, existing.ID)
+					report.MergedUsers = append(report.MergedUsers, user.Username)
+					return nil
+				case opts.OnConflict == ConflictRename:
+					renamed := user.Username + opts.RenameSuffix
+					report.RenamedUsers[user.Username] = renamed
+					user.Username = renamed
+					user.Email = appendEmailSuffix(user.Email, opts.RenameSuffix)
+				default:
+					conflicts = append(conflicts, user.Username)
+					return nil
+				}
+			}
+
+			if err := create("users", &user); err != nil {
+				return err
+			}
+			ids.set("users", oldID, user.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return &UsernameConflictError{Conflicts: conflicts}
+		}
+
+		// 单点登录配置：目标租户已有同名配置时直接使用
+		if err := readArchiveRows(zr, "oidc_providers", func(row *exportedOIDCProvider) error {
+			p := &row.OIDCProvider
+			oldID := p.ID
+			var existing models.OIDCProvider
+			if utils.WithTenant(tx, targetTenantID).Where("name = ?", p.Name).First(&existing).Error == nil {
+				ids.set("oidc_providers", oldID, existing.ID)
+				return nil
+			}
+			p.ID = 0
+			p.TenantID = targetTenantID
+			p.ClientSecret = row.ClientSecret
+			if err := create("oidc_providers", p); err != nil {
+				return err
+			}
+			ids.set("oidc_providers", oldID, p.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// 外部身份：单点登录创建的账号只能通过身份关联登录；合并到已有配置时该身份可能已经存在
+		if err := readArchiveRows(zr, "user_identities", func(identity *models.UserIdentity) error {
+			userID, ok1 := ids.get("users", identity.UserID)
+			providerID, ok2 := ids.get("oidc_providers", identity.ProviderID)
+			if !ok1 || !ok2 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("user_identities %d", identity.ID))
+				return nil
+			}
+			var count int64
+			tx.Model(&models.UserIdentity{}).Where("provider_id = ? AND subject = ?", providerID, identity.Subject).Count(&count)
+			if count > 0 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("user_identities %d（目标租户已存在）", identity.ID))
+				return nil
+			}
+			identity.ID = 0
+			identity.TenantID = targetTenantID
+			identity.UserID, identity.ProviderID = userID, providerID
+			identity.Provider = nil
+			return create("user_identities", identity)
+		}); err != nil {
+			return err
+		}
+
+		// LDAP配置每个租户只有一条，目标租户已配置时保留目标租户的配置
+		if err := readArchiveRows(zr, "ldap_configs", func(row *exportedLDAPConfig) error {
+			var count int64
+			utils.WithTenant(tx.Model(&models.LDAPConfig{}), targetTenantID).Count(&count)
+			if count > 0 {
+				report.Skipped = append(report.Skipped, "ldap_configs（目标租户已配置）")
+				return nil
+			}
+			cfg := &row.LDAPConfig
+			cfg.ID = 0
+			cfg.TenantID = targetTenantID
+			cfg.BindPassword = row.BindPassword
+			return create("ldap_configs", cfg)
+		}); err != nil {
+			return err
+		}
+
+		// 科目：先创建，再回填父科目
+		var subjectParents = make(map[uint]uint)
+		if err := readArchiveRows(zr, "subjects", func(s *models.Subject) error {
+			oldID := s.ID
+			if s.ParentID != nil {
+				subjectParents[oldID] = *s.ParentID
+			}
+			s.ID = 0
+			s.TenantID = targetTenantID
+			s.ParentID = nil
+			if err := create("subjects", s); err != nil {
+				return err
+			}
+			ids.set("subjects", oldID, s.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for oldID, oldParentID := range subjectParents {
+			newID, _ := ids.get("subjects", oldID)
+			if newParentID, ok := ids.get("subjects", oldParentID); ok {
+				if err := tx.Model(&models.Subject{}).Where("id = ?", newID).Update("parent_id", newParentID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// 科目审核人：用户不在归档中的记录跳过
+		if err := readArchiveRows(zr, "subject_reviewers", func(r *models.SubjectReviewer) error {
+			subjectID, ok1 := ids.get("subjects", r.SubjectID)
+			userID, ok2 := ids.get("users", r.UserID)
+			if !ok1 || !ok2 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("subject_reviewers %d", r.ID))
+				return nil
+			}
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.SubjectID, r.UserID = subjectID, userID
+			r.CreatedBy, _ = ids.get("users", r.CreatedBy)
+			return create("subject_reviewers", r)
+		}); err != nil {
+			return err
+		}
+
+		// 附件：文件写入目标租户的存储（事务回滚时已写入的文件不会删除），目标租户已有相同内容的附件时直接使用。
+		// 归档中缺少文件的附件跳过，题目中对它的引用改为 attachment://missing
+		var storage AttachmentStorage
+		if err := readArchiveRows(zr, "attachments", func(a *models.Attachment) error {
+			oldID := a.ID
+			var existing models.Attachment
+			if utils.WithTenant(tx, targetTenantID).Where("hash = ?", a.Hash).First(&existing).Error == nil {
+				ids.set("attachments", oldID, existing.ID)
+				return nil
+			}
+			data, err := readArchiveFile(zr, attachmentArchiveFile(a.Hash))
+			if err != nil || fmt.Sprintf("%x", sha256.Sum256(data)) != a.Hash {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("attachments %d（归档中缺少文件）", oldID))
+				return nil
+			}
+			if storage == nil {
+				storage = NewAttachmentStorage()
+			}
+			a.ID = 0
+			a.TenantID = targetTenantID
+			a.StorageKey = attachmentStorageKey(targetTenantID, a.Hash)
+			a.CreatedBy, _ = ids.get("users", a.CreatedBy)
+			if err := storage.Put(a.StorageKey, data, a.ContentType); err != nil {
+				return fmt.Errorf("保存附件 %d 失败: %w", oldID, err)
+			}
+			if err := create("attachments", a); err != nil {
+				return err
+			}
+			ids.set("attachments", oldID, a.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+		remapAttachment := func(id uint) (uint, bool) { return ids.get("attachments", id) }
+
+		// 题目：先创建，再回填所属材料题
+		var questionParents = make(map[uint]uint)
+		if err := readArchiveRows(zr, "questions", func(q *models.Question) error {
+			oldID := q.ID
+			if q.ParentID != nil {
+				questionParents[oldID] = *q.ParentID
+			}
+			q.ID = 0
+			q.TenantID = targetTenantID
+			q.ParentID = nil
+			q.Content = RemapAttachmentRefs(q.Content, remapAttachment)
+			q.Options = RemapAttachmentRefs(q.Options, remapAttachment)
+			q.Explanation = RemapAttachmentRefs(q.Explanation, remapAttachment)
+			q.SubjectID, _ = ids.get("subjects", q.SubjectID)
+			q.CreatedBy, _ = ids.get("users", q.CreatedBy)
+			if q.ReviewerID != nil {
+				if reviewerID, ok := ids.get("users", *q.ReviewerID); ok {
+					q.ReviewerID = &reviewerID
+				} else {
+					q.ReviewerID = nil
+				}
+			}
+			if err := create("questions", q); err != nil {
+				return err
+			}
+			ids.set("questions", oldID, q.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for oldID, oldParentID := range questionParents {
+			newID, _ := ids.get("questions", oldID)
+			if newParentID, ok := ids.get("questions", oldParentID); ok {
+				if err := tx.Model(&models.Question{}).Where("id = ?", newID).Update("parent_id", newParentID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := readArchiveRows(zr, "question_attachments", func(r *models.QuestionAttachment) error {
+			questionID, ok1 := ids.get("questions", r.QuestionID)
+			attachmentID, ok2 := ids.get("attachments", r.AttachmentID)
+			if !ok1 || !ok2 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("question_attachments %d", r.ID))
+				return nil
+			}
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.QuestionID, r.AttachmentID = questionID, attachmentID
+			return create("question_attachments", r)
+		}); err != nil {
+			return err
+		}
+
+		// 选择题选项：作答中保存的选项ID随之改写
+		choiceQuestions := make(map[uint]bool)
+		if err := readArchiveRows(zr, "question_options", func(o *models.QuestionOption) error {
+			questionID, ok := ids.get("questions", o.QuestionID)
+			if !ok {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("question_options %d", o.ID))
+				return nil
+			}
+			oldID := o.ID
+			o.ID = 0
+			o.TenantID = targetTenantID
+			o.QuestionID = questionID
+			o.Content = RemapAttachmentRefs(o.Content, remapAttachment)
+			o.Feedback = RemapAttachmentRefs(o.Feedback, remapAttachment)
+			if err := create("question_options", o); err != nil {
+				return err
+			}
+			ids.set("question_options", oldID, o.ID)
+			choiceQuestions[questionID] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+		remapOption := func(id uint) (uint, bool) { return ids.get("question_options", id) }
+
+		// 题目版本：选项ID随之改写，题目不在归档中的版本跳过
+		if err := readArchiveRows(zr, "question_revisions", func(row *exportedQuestionRevision) error {
+			r := &row.QuestionRevision
+			questionID, ok := ids.get("questions", r.QuestionID)
+			if !ok {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("question_revisions %d", r.ID))
+				return nil
+			}
+			oldID := r.ID
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.QuestionID = questionID
+			if r.ParentID != nil {
+				if parentID, ok := ids.get("questions", *r.ParentID); ok {
+					r.ParentID = &parentID
+				}
+			}
+			r.CreatedBy, _ = ids.get("users", r.CreatedBy)
+			r.Content = RemapAttachmentRefs(r.Content, remapAttachment)
+			r.Options = RemapAttachmentRefs(r.Options, remapAttachment)
+			r.Explanation = RemapAttachmentRefs(r.Explanation, remapAttachment)
+			r.ChoicesJSON = RemapAttachmentRefs(RemapRevisionChoices(row.ChoicesJSON, remapOption), remapAttachment)
+			if err := create("question_revisions", r); err != nil {
+				return err
+			}
+			ids.set("question_revisions", oldID, r.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "question_reviews", func(r *models.QuestionReview) error {
+			questionID, ok := ids.get("questions", r.QuestionID)
+			if !ok {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("question_reviews %d", r.ID))
+				return nil
+			}
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.QuestionID = questionID
+			r.UserID, _ = ids.get("users", r.UserID)
+			return create("question_reviews", r)
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "papers", func(p *models.Paper) error {
+			oldID := p.ID
+			p.ID = 0
+			p.TenantID = targetTenantID
+			p.SubjectID, _ = ids.get("subjects", p.SubjectID)
+			p.CreatedBy, _ = ids.get("users", p.CreatedBy)
+			if err := create("papers", p); err != nil {
+				return err
+			}
+			ids.set("papers", oldID, p.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "paper_questions", func(row *paperQuestionRow) error {
+			paperID, ok1 := ids.get("papers", row.PaperID)
+			questionID, ok2 := ids.get("questions", row.QuestionID)
+			if !ok1 || !ok2 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("paper_questions %d-%d", row.PaperID, row.QuestionID))
+				return nil
+			}
+			if err := tx.Table("paper_questions").Create(map[string]interface{}{"paper_id": paperID, "question_id": questionID}).Error; err != nil {
+				return fmt.Errorf("导入paper_questions失败: %w", err)
+			}
+			report.Imported["paper_questions"]++
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "paper_question_revisions", func(p *models.PaperQuestionRevision) error {
+			paperID, ok1 := ids.get("papers", p.PaperID)
+			questionID, ok2 := ids.get("questions", p.QuestionID)
+			revisionID, ok3 := ids.get("question_revisions", p.RevisionID)
+			if !ok1 || !ok2 || !ok3 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("paper_question_revisions %d", p.ID))
+				return nil
+			}
+			p.ID = 0
+			p.TenantID = targetTenantID
+			p.PaperID, p.QuestionID, p.RevisionID = paperID, questionID, revisionID
+			return create("paper_question_revisions", p)
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "exams", func(e *models.Exam) error {
+			oldID := e.ID
+			e.ID = 0
+			e.TenantID = targetTenantID
+			e.PaperID, _ = ids.get("papers", e.PaperID)
+			e.CreatedBy, _ = ids.get("users", e.CreatedBy)
+			e.StudentIDs = ids.remapIDList("users", e.StudentIDs)
+			if err := create("exams", e); err != nil {
+				return err
+			}
+			ids.set("exams", oldID, e.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "exam_records", func(r *models.ExamRecord) error {
+			oldID := r.ID
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.ExamID, _ = ids.get("exams", r.ExamID)
+			r.StudentID, _ = ids.get("users", r.StudentID)
+			if err := create("exam_records", r); err != nil {
+				return err
+			}
+			ids.set("exam_records", oldID, r.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "answers", func(a *models.Answer) error {
+			a.ID = 0
+			a.TenantID = targetTenantID
+			a.ExamRecordID, _ = ids.get("exam_records", a.ExamRecordID)
+			a.QuestionID, _ = ids.get("questions", a.QuestionID)
+			if choiceQuestions[a.QuestionID] {
+				a.Answer = RemapChoiceAnswer(a.Answer, remapOption)
+			}
+			return create("answers", a)
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "practice_records", func(r *models.PracticeRecord) error {
+			oldID := r.ID
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.UserID, _ = ids.get("users", r.UserID)
+			r.SubjectID, _ = ids.get("subjects", r.SubjectID)
+			r.QuestionIDs = ids.remapIDList("questions", r.QuestionIDs)
+			if err := create("practice_records", r); err != nil {
+				return err
+			}
+			ids.set("practice_records", oldID, r.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "practice_answers", func(a *models.PracticeAnswer) error {
+			a.ID = 0
+			a.TenantID = targetTenantID
+			a.PracticeRecordID, _ = ids.get("practice_records", a.PracticeRecordID)
+			a.QuestionID, _ = ids.get("questions", a.QuestionID)
+			if choiceQuestions[a.QuestionID] {
+				a.Answer = RemapChoiceAnswer(a.Answer, remapOption)
+			}
+			return create("practice_answers", a)
+		}); err != nil {
+			return err
+		}
+
+		// 旧版本的归档没有选项表，导入后按旧格式转换
+		if _, err := MigrateQuestionOptions(tx, targetTenantID, false); err != nil {
+			return fmt.Errorf("转换选择题选项失败: %w", err)
+		}
+		// 旧版本的归档没有题目版本，导入的试卷按题目内容固定版本
+		if _, err := BackfillPaperRevisions(tx, targetTenantID); err != nil {
+			return fmt.Errorf("固定试卷题目版本失败: %w", err)
+		}
+		// 旧版本的归档没有审核记录，已发布的题目按 LEGACY_QUESTION_REVIEW 处理
+		if _, err := MigrateLegacyQuestions(tx, targetTenantID, config.GetConfig().LegacyQuestionReview); err != nil {
+			return fmt.Errorf("处理题目审核状态失败: %w", err)
+		}
+
+		if err := readArchiveRows(zr, "practice_recommendations", func(r *models.PracticeRecommendation) error {
+			r.ID = 0
+			r.TenantID = targetTenantID
+			r.SubjectID, _ = ids.get("subjects", r.SubjectID)
+			return create("practice_recommendations", r)
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "ai_chats", func(chat *models.AIChat) error {
+			chat.ID = 0
+			chat.TenantID = targetTenantID
+			chat.UserID, _ = ids.get("users", chat.UserID)
+			return create("ai_chats", chat)
+		}); err != nil {
+			return err
+		}
+
+		// 安全策略每个租户只有一条，目标租户已配置时保留目标租户的策略
+		if err := readArchiveRows(zr, "tenant_security_policies", func(p *models.TenantSecurityPolicy) error {
+			var count int64
+			utils.WithTenant(tx.Model(&models.TenantSecurityPolicy{}), targetTenantID).Count(&count)
+			if count > 0 {
+				return nil
+			}
+			p.ID = 0
+			p.TenantID = targetTenantID
+			return create("tenant_security_policies", p)
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "classes", func(cl *models.Class) error {
+			oldID := cl.ID
+			cl.ID = 0
+			cl.TenantID = targetTenantID
+			cl.TeacherID, _ = ids.get("users", cl.TeacherID)
+			if err := create("classes", cl); err != nil {
+				return err
+			}
+			ids.set("classes", oldID, cl.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "class_members", func(m *models.ClassMember) error {
+			m.ID = 0
+			m.TenantID = targetTenantID
+			m.ClassID, _ = ids.get("classes", m.ClassID)
+			m.UserID, _ = ids.get("users", m.UserID)
+			return create("class_members", m)
+		}); err != nil {
+			return err
+		}
+
+		if err := readArchiveRows(zr, "resource_shares", func(s *models.ResourceShare) error {
+			resourceID, ok := ids.get(ResourceTable(s.ResourceType), s.ResourceID)
+			if !ok {
+				return nil
+			}
+			s.ID = 0
+			s.TenantID = targetTenantID
+			s.ResourceID = resourceID
+			s.UserID, _ = ids.get("users", s.UserID)
+			s.CreatedBy, _ = ids.get("users", s.CreatedBy)
+			return create("resource_shares", s)
+		}); err != nil {
+			return err
+		}
+
+		// 保留策略：目标租户已有同一数据的策略时保留目标租户的策略，不再支持的策略跳过
+		return readArchiveRows(zr, "retention_policies", func(p *models.RetentionPolicy) error {
+			if !IsValidRetentionRule(p.Target, p.Action) {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("retention_policies %d（不支持的保留策略 %s）", p.ID, p.Target))
+				return nil
+			}
+			var count int64
+			utils.WithTenant(tx.Model(&models.RetentionPolicy{}), targetTenantID).Where("target = ?", p.Target).Count(&count)
+			if count > 0 {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("retention_policies %d（目标租户已有 %s 策略）", p.ID, p.Target))
+				return nil
+			}
+			p.ID = 0
+			p.TenantID = targetTenantID
+			p.LastRunAt = nil
+			p.LastAffected = 0
+			return create("retention_policies", p)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// readArchiveRows 逐行读取归档中的 <name>.jsonl，文件不存在时视为空
+func readArchiveRows[T any](zr *zip.Reader, name string, fn func(*T) error) error {
+	f, err := zr.Open(name + ".jsonl")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var row T
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return fmt.Errorf("%s.jsonl 第%d行解析失败: %w", name, line, err)
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readArchiveFile 读取归档中的单个文件
+func readArchiveFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// appendEmailSuffix 在邮箱本地部分追加后缀，保证重命名后的邮箱仍然唯一
+func appendEmailSuffix(email, suffix string) string {
+	for i := len(email) - 1; i >= 0; i-- {
+		if email[i] == '@' {
+			return email[:i] + suffix + email[i:]
+		}
+	}
+	return email + suffix
+}
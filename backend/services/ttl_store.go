@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"online-exam-system/cache"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ttlEntry 进程内存中的带过期时间的值
+type ttlEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// memoryTTLStore Redis不可用时使用的进程内存存储，仅在单实例部署下可靠
+type memoryTTLStore struct {
+	mu    sync.Mutex
+	items map[string]ttlEntry
+}
+
+var localStore = &memoryTTLStore{items: make(map[string]ttlEntry)}
+
+func (ms *memoryTTLStore) set(key string, data []byte, ttl time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	// 写入时顺带清理过期数据，避免内存无限增长
+	if len(ms.items) > 10000 {
+		for k, v := range ms.items {
+			if now.After(v.expiresAt) {
+				delete(ms.items, k)
+			}
+		}
+	}
+	ms.items[key] = ttlEntry{data: data, expiresAt: now.Add(ttl)}
+}
+
+func (ms *memoryTTLStore) get(key string) ([]byte, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.items[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(ms.items, key)
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// incr 在锁内读取、加一并写回计数，不存在或已过期时从1开始并设置过期时间
+func (ms *memoryTTLStore) incr(key string, ttl time.Duration) int64 {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := ms.items[key]
+	var count int64
+	if ok && now.Before(entry.expiresAt) {
+		count, _ = strconv.ParseInt(string(entry.data), 10, 64)
+	} else {
+		entry.expiresAt = now.Add(ttl)
+	}
+	count++
+	ms.items[key] = ttlEntry{data: []byte(strconv.FormatInt(count, 10)), expiresAt: entry.expiresAt}
+	return count
+}
+
+func (ms *memoryTTLStore) delete(key string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.items, key)
+}
+
+// storeSet 写入带过期时间的值：Redis可用时写入Redis（多实例共享），否则写入进程内存
+func storeSet(tenantID uint, key string, value interface{}, ttl time.Duration) {
+	if cache.RedisClient != nil {
+		cache.SetWithTenant(tenantID, key, value, ttl)
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	localStore.set(fmt.Sprintf("%d:%s", tenantID, key), data, ttl)
+}
+
+// storeGet 读取storeSet写入的值
+func storeGet(tenantID uint, key string, dest interface{}) bool {
+	if cache.RedisClient != nil {
+		return cache.GetWithTenant(tenantID, key, dest) == nil
+	}
+	data, ok := localStore.get(fmt.Sprintf("%d:%s", tenantID, key))
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(data, dest) == nil
+}
+
+// storeDelete 删除storeSet写入的值
+func storeDelete(tenantID uint, key string) {
+	if cache.RedisClient != nil {
+		cache.DeleteWithTenant(tenantID, key)
+		return
+	}
+	localStore.delete(fmt.Sprintf("%d:%s", tenantID, key))
+}
+
+// storeIncr 原子地将计数加一并返回新值，首次计数时设置过期时间；并发请求得到的计数各不相同，可用于限制尝试次数
+func storeIncr(tenantID uint, key string, ttl time.Duration) (int64, error) {
+	if cache.RedisClient != nil {
+		ctx := context.Background()
+		redisKey := fmt.Sprintf("counter:%d:%s", tenantID, key)
+		count, err := cache.RedisClient.Incr(ctx, redisKey).Result()
+		if err != nil {
+			return 0, err
+		}
+		if count == 1 {
+			cache.RedisClient.Expire(ctx, redisKey, ttl)
+		}
+		return count, nil
+	}
+	return localStore.incr(fmt.Sprintf("%d:%s", tenantID, key), ttl), nil
+}
+
+// storeDeleteCounter 删除storeIncr写入的计数
+func storeDeleteCounter(tenantID uint, key string) {
+	if cache.RedisClient != nil {
+		cache.RedisClient.Del(context.Background(), fmt.Sprintf("counter:%d:%s", tenantID, key))
+		return
+	}
+	localStore.delete(fmt.Sprintf("%d:%s", tenantID, key))
+}
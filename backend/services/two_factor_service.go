@@ -0,0 +1,432 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"online-exam-system/config"
+	"online-exam-system/database"
+	"online-exam-system/models"
+	"online-exam-system/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	totpPeriod = 30 // 时间步长（秒）
+	totpDigits = 6
+	totpSkew   = 1 // 允许前后各一个时间步的时钟误差
+
+	RecoveryCodeCount     = 10
+	TwoFactorChallengeTTL = 5 * time.Minute
+
+	// 同一个登录挑战最多允许输错的次数
+	twoFactorChallengeMaxAttempts = 5
+	twoFactorChallengePrefix      = "2fa_challenge"
+)
+
+var (
+	ErrTwoFactorNotEnrolled      = errors.New("尚未绑定两步验证")
+	ErrTwoFactorAlreadyEnabled   = errors.New("两步验证已开启")
+	ErrTwoFactorCodeInvalid      = errors.New("验证码错误")
+	ErrTwoFactorChallengeInvalid = errors.New("登录验证已失效，请重新登录")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorSetup 绑定时返回给用户的密钥信息，otpauth_url 可直接生成二维码
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorStatus 当前用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+	Required               bool       `json:"required"` // 租户策略要求该用户开启
+}
+
+// twoFactorChallenge 密码验证通过后等待输入验证码的登录挑战
+type twoFactorChallenge struct {
+	UserID    uint      `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TwoFactorService TOTP两步验证
+type TwoFactorService struct {
+	cacheService *CacheService
+}
+
+// NewTwoFactorService 创建两步验证服务实例
+func NewTwoFactorService() *TwoFactorService {
+	return &TwoFactorService{cacheService: NewCacheService()}
+}
+
+// TwoFactorSetupRequired 租户要求管理员和教师开启两步验证而该用户尚未开启
+func TwoFactorSetupRequired(policy models.TenantSecurityPolicy, user *models.User) bool {
+	if !policy.RequireTwoFactorForStaff || user.TwoFactorEnabled {
+		return false
+	}
+	return user.Role == models.RoleAdmin || user.Role == models.RoleTeacher
+}
+
+// totpCode 按RFC 6238计算指定时间步的验证码
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP 在允许的时钟误差内查找与验证码匹配的时间步
+func matchTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// secretCipher 由JWT密钥派生用于加密TOTP密钥的AES-GCM
+func secretCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("totp-secret:" + config.GetConfig().JWTSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptTOTPSecret(secret []byte) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, secret, nil)), nil
+}
+
+func decryptTOTPSecret(encrypted string) ([]byte, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return nil, errors.New("两步验证密钥损坏")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// normalizeRecoveryCode 忽略大小写、空白和分隔符
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return fmt.Sprintf("%x", sum)
+}
+
+// generateRecoveryCode 生成 XXXXX-XXXXX 格式的恢复码
+func generateRecoveryCode() (string, error) {
+	code, err := GenerateInviteCode()
+	if err != nil {
+		return "", err
+	}
+	return code[:5] + "-" + code[5:], nil
+}
+
+func (ts *TwoFactorService) load(user *models.User) (*models.UserTwoFactor, error) {
+	var tf models.UserTwoFactor
+	if err := utils.WithTenant(database.DB, user.TenantID).Where("user_id = ?", user.ID).First(&tf).Error; err != nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	return &tf, nil
+}
+
+// Status 查询用户的两步验证状态
+func (ts *TwoFactorService) Status(user *models.User) TwoFactorStatus {
+	status := TwoFactorStatus{Required: TwoFactorSetupRequired(GetSecurityPolicy(user.TenantID), user)}
+	if tf, err := ts.load(user); err == nil && tf.Enabled {
+		status.Enabled = true
+		status.EnabledAt = tf.EnabledAt
+		database.DB.Model(&models.TwoFactorRecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&status.RecoveryCodesRemaining)
+	}
+	return status
+}
+
+// Setup 生成新的TOTP密钥，需调用Enable验证一次验证码后才生效
+func (ts *TwoFactorService) Setup(user *models.User) (*TwoFactorSetup, error) {
+	tf, err := ts.load(user)
+	if err == nil && tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptTOTPSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if tf == nil {
+		tf = &models.UserTwoFactor{TenantID: user.TenantID, UserID: user.ID}
+	}
+	tf.Secret = encrypted
+	tf.LastUsedStep = 0
+	if err := database.DB.Save(tf).Error; err != nil {
+		return nil, err
+	}
+
+	encoded := totpEncoding.EncodeToString(secret)
+	issuer := config.GetConfig().TOTPIssuer
+	params := url.Values{}
+	params.Set("secret", encoded)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	return &TwoFactorSetup{
+		Secret:     encoded,
+		OTPAuthURL: fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(issuer), url.PathEscape(user.Username), params.Encode()),
+	}, nil
+}
+
+// verifyTOTP 校验验证码，同一时间步的验证码只能使用一次
+func (ts *TwoFactorService) verifyTOTP(tf *models.UserTwoFactor, code string) error {
+	secret, err := decryptTOTPSecret(tf.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := matchTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	// 条件更新保证并发请求中同一验证码只有一个能通过
+	result := database.DB.Model(&models.UserTwoFactor{}).
+		Where("id = ? AND last_used_step < ?", tf.ID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	tf.LastUsedStep = step
+	return nil
+}
+
+// Enable 验证首个验证码后开启两步验证，返回新生成的恢复码（只显示这一次）
+func (ts *TwoFactorService) Enable(user *models.User, code string) ([]string, error) {
+	tf, err := ts.load(user)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if err := ts.verifyTOTP(tf, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(tf).Updates(map[string]interface{}{"enabled": true, "enabled_at": now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("two_factor_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.TwoFactorEnabled = true
+	ts.cacheService.InvalidateUserCache(user.TenantID, user.ID, user.Username)
+	return codes, nil
+}
+
+// replaceRecoveryCodes 删除旧的恢复码并生成一组新的
+func replaceRecoveryCodes(tx *gorm.DB, user *models.User) ([]string, error) {
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, RecoveryCodeCount)
+	rows := make([]models.TwoFactorRecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, models.TwoFactorRecoveryCode{
+			TenantID: user.TenantID,
+			UserID:   user.ID,
+			CodeHash: hashRecoveryCode(code),
+		})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (ts *TwoFactorService) RegenerateRecoveryCodes(user *models.User) ([]string, error) {
+	if tf, err := ts.load(user); err != nil || !tf.Enabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user)
+		return err
+	})
+	return codes, err
+}
+
+// Verify 校验验证码或恢复码，恢复码使用后立即失效
+func (ts *TwoFactorService) Verify(user *models.User, code string) error {
+	tf, err := ts.load(user)
+	if err != nil || !tf.Enabled {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if len(strings.TrimSpace(code)) == totpDigits {
+		return ts.verifyTOTP(tf, code)
+	}
+
+	result := database.DB.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	return nil
+}
+
+// Disable 关闭两步验证并删除密钥和恢复码（也用于管理员为丢失设备的用户重置）
+func (ts *TwoFactorService) Disable(user *models.User) error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserTwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("two_factor_enabled", false).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	user.TwoFactorEnabled = false
+	ts.cacheService.InvalidateUserCache(user.TenantID, user.ID, user.Username)
+	return nil
+}
+
+// CreateChallenge 密码验证通过后创建登录挑战，返回挑战令牌
+func (ts *TwoFactorService) CreateChallenge(user *models.User) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	storeSet(user.TenantID, twoFactorChallengeKey(token), twoFactorChallenge{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(TwoFactorChallengeTTL),
+	}, TwoFactorChallengeTTL)
+	return token, nil
+}
+
+func twoFactorChallengeKey(token string) string {
+	return twoFactorChallengePrefix + ":" + HashToken(token)
+}
+
+func twoFactorChallengeAttemptsKey(token string) string {
+	return twoFactorChallengePrefix + "_attempts:" + HashToken(token)
+}
+
+// ChallengeUser 返回登录挑战对应的用户但不消耗尝试次数，用于校验验证码前按用户和IP检查登录限制
+func (ts *TwoFactorService) ChallengeUser(tenantID uint, token string) (*models.User, error) {
+	var challenge twoFactorChallenge
+	if !storeGet(tenantID, twoFactorChallengeKey(token), &challenge) || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrTwoFactorChallengeInvalid
+	}
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, challenge.UserID).Error; err != nil || !user.IsActive {
+		return nil, ErrTwoFactorChallengeInvalid
+	}
+	return &user, nil
+}
+
+// CompleteChallenge 校验登录挑战的验证码，成功后挑战失效并返回对应用户。
+// 校验前先原子地增加尝试次数，并发请求也不能超过次数上限
+func (ts *TwoFactorService) CompleteChallenge(tenantID uint, token, code string) (*models.User, error) {
+	key := twoFactorChallengeKey(token)
+	attemptsKey := twoFactorChallengeAttemptsKey(token)
+	var challenge twoFactorChallenge
+	if !storeGet(tenantID, key, &challenge) || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrTwoFactorChallengeInvalid
+	}
+
+	var user models.User
+	if err := utils.WithTenant(database.DB, tenantID).First(&user, challenge.UserID).Error; err != nil || !user.IsActive {
+		storeDelete(tenantID, key)
+		storeDeleteCounter(tenantID, attemptsKey)
+		return &user, ErrTwoFactorChallengeInvalid
+	}
+
+	attempts, err := storeIncr(tenantID, attemptsKey, time.Until(challenge.ExpiresAt))
+	if err != nil || attempts > twoFactorChallengeMaxAttempts {
+		storeDelete(tenantID, key)
+		return &user, ErrTwoFactorChallengeInvalid
+	}
+
+	if err := ts.Verify(&user, code); err != nil {
+		if attempts >= twoFactorChallengeMaxAttempts {
+			storeDelete(tenantID, key)
+		}
+		return &user, err
+	}
+
+	storeDelete(tenantID, key)
+	storeDeleteCounter(tenantID, attemptsKey)
+	return &user, nil
+}
@@ -53,7 +53,7 @@ func main() {
 	// 测试Token缓存
 	fmt.Println("\n2. 测试Token缓存")
 	tokenHash := "test_token_hash_123"
-	cacheService.SetTokenCache(tenantID, tokenHash, testUser.ID, testUser.Username, testUser.Role)
+	cacheService.SetTokenCache(tenantID, tokenHash, testUser.ID, testUser.Username, testUser.Role, testUser.SessionVersion, time.Now().Add(time.Hour))
 	fmt.Printf("✓ Token缓存已设置: %s\n", tokenHash)
 
 	// 从缓存获取Token信息
@@ -0,0 +1,77 @@
+import api, { get, post, del } from './index'
+
+// 附件相关API接口（题目中引用的图片、音频、视频和PDF）
+export interface Attachment {
+  id: number
+  hash: string
+  filename: string
+  content_type: string
+  size: number
+  created_by: number
+  created_at: string
+  url: string // 临时访问地址，有效期约1至2小时
+  reference: string // 在题干、选项和解析中引用附件的写法，如 ![图](attachment://12)
+}
+
+export interface AttachmentListResponse {
+  attachments: Attachment[]
+  total: number
+  page: number
+  size: number
+}
+
+export interface AttachmentUsage {
+  used: number // 已使用空间（字节）
+  quota: number // 租户配额（字节）
+  max_size: number // 单个文件大小上限（字节）
+}
+
+// 上传附件，租户内已有相同内容的文件时直接返回该附件（deduplicated 为 true）
+export const uploadAttachment = async (file: File) => {
+  const form = new FormData()
+  form.append('file', file)
+  const response = await api.post<{ attachment: Attachment; deduplicated: boolean }>('/teacher/attachments/', form, {
+    headers: { 'Content-Type': 'multipart/form-data' },
+    timeout: 60000
+  })
+  return response.data
+}
+
+// 获取附件列表，unused 为 true 时只返回未被题目引用的附件
+export const getAttachments = (params?: { page?: number; size?: number; unused?: boolean }) => {
+  return get<AttachmentListResponse>('/teacher/attachments/', params)
+}
+
+// 获取附件空间使用情况
+export const getAttachmentUsage = () => {
+  return get<AttachmentUsage>('/teacher/attachments/usage')
+}
+
+// 删除附件（被题目引用的附件不能删除）
+export const deleteAttachment = (id: number) => {
+  return del(`/teacher/attachments/${id}`)
+}
+
+// 批量获取附件的临时访问地址
+export const resolveAttachments = (ids: number[]) => {
+  return post<{ attachments: Attachment[] }>('/attachments/resolve', { ids })
+}
+
+const attachmentRefPattern = /attachment:\/\/(\d+)/g
+
+// 提取文本中引用的附件ID
+export const attachmentRefs = (...texts: (string | undefined)[]) => {
+  const ids = new Set<number>()
+  texts.forEach((text) => {
+    for (const match of (text || '').matchAll(attachmentRefPattern)) {
+      ids.add(Number(match[1]))
+    }
+  })
+  return [...ids]
+}
+
+// 将文本中的 attachment://ID 替换为可直接用于 <img>、<audio> 的地址；公式以 $...$ 保存在文本中，由页面渲染
+export const replaceAttachmentRefs = (text: string, attachments: Attachment[]) => {
+  const urls = new Map(attachments.map((attachment) => [attachment.id, new URL(attachment.url, api.defaults.baseURL).toString()]))
+  return text.replace(attachmentRefPattern, (ref, id) => urls.get(Number(id)) ?? ref)
+}
@@ -63,7 +63,7 @@ export interface StartPracticeResponse {
 
 export interface SubmitAnswerRequest {
   question_id: number
-  answer: string
+  answer: string // 选择题为所选选项ID，如 "12" 或 "12,15"
   time_spent?: number
 }
 
@@ -71,6 +71,7 @@ export interface SubmitAnswerResponse {
   is_correct: boolean
   score: number
   explanation: string
+  feedback: string[] // 所选选项的反馈
 }
 
 export interface CompletePracticeResponse {
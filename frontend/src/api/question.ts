@@ -1,4 +1,4 @@
-import { get, post, put, del } from './index'
+import api, { get, post, put, del } from './index'
 
 // 题目相关API接口
 export interface Question {
@@ -7,13 +7,20 @@ export interface Question {
   type: string
   title: string
   content: string
-  options?: string
-  answer: string
+  options?: string // 选择题为选项内容的副本（如 ["A. 内容"]），以 choices 为准
+  answer: string // 选择题为正确选项字母的副本（如 A,C）
+  choices?: QuestionOption[] // 选择题的选项
   explanation?: string
   difficulty: number
   score: number
-  status?: string
+  status?: QuestionStatus
+  reviewer_id?: number | null // 提交审核时分配的审核人
   knowledge_point?: string
+  parent_id?: number | null // 所属材料题
+  position?: number // 在材料题中的序号
+  children?: Question[] // 材料题的子题（获取单个材料题时返回）
+  version?: number // 题目内容的版本号；试卷和考试结果中为组卷时固定的版本
+  latest_version?: number // 固定的版本不是最新版本时返回题目的当前版本号
   usage_count?: number
   correct_rate?: number
   created_by?: number
@@ -29,12 +36,54 @@ export interface Question {
   }
 }
 
+// 题目状态：草稿 → 待审核 → 审核通过/已驳回 → 已发布 → 已归档
+export type QuestionStatus = 'draft' | 'submitted' | 'approved' | 'rejected' | 'published' | 'archived'
+
+// 选择题的选项，学生作答为所选选项ID的数组（如 [12,15]）；学生作答时不返回 is_correct 和 feedback
+export interface QuestionOption {
+  id: number
+  question_id: number
+  position: number
+  content: string
+  is_correct?: boolean
+  feedback?: string // 选择该选项时的反馈，提交练习答案后返回
+}
+
+// 填空、配对、排序、数值题的展示数据，保存在 options 中（JSON 对象），答案另存且不返回给学生
+export interface QuestionLayout {
+  blanks?: number // 填空题的空数，作答为字符串数组
+  prompts?: string[] // 配对题左侧各项
+  choices?: string[] // 配对题右侧可选项，作答为每个左侧项所选的下标（未作答为 -1）
+  items?: string[] // 排序题的各项，作答为按顺序排列的下标
+  units?: string[] // 数值题可填写的单位，作答为“数值 单位”
+}
+
+export const structuredQuestionTypes = ['fill_blank', 'matching', 'ordering', 'numeric']
+
+// 材料题只保存共享的材料内容，不作答、不计分，分值为子题分值之和
+export const materialQuestionType = 'material'
+
+// 解析结构化题型的展示数据
+export const parseQuestionLayout = (question: Pick<Question, 'type' | 'options'>): QuestionLayout | null => {
+  if (!structuredQuestionTypes.includes(question.type) || !question.options) {
+    return null
+  }
+  try {
+    return JSON.parse(question.options) as QuestionLayout
+  } catch {
+    return null
+  }
+}
+
 export interface QuestionListParams {
   page?: number
   size?: number
   subject_id?: number
   type?: string
   difficulty?: string
+  status?: string
+  knowledge_point?: string
+  parent_id?: number // 列表默认只返回顶层题目，指定时返回该材料题的子题
   search?: string
 }
 
@@ -70,9 +119,235 @@ export const deleteQuestion = (id: number) => {
   return del(`/teacher/questions/${id}`)
 }
 
-// 批量导入题目
-export const batchImportQuestions = (data: Question[]) => {
-  return post('/teacher/questions/import', { questions: data })
+// 批量导入题目，返回后台执行的导入任务
+export const batchImportQuestions = (data: Question[], mode: ImportMode = 'all_or_nothing') => {
+  return post<{ job: ImportJob }>(`/teacher/questions/import?mode=${mode}`, { questions: data })
+}
+
+// 文件导入的解析结果（每行一道题）
+export interface ImportedQuestion {
+  row: number
+  type: string
+  subject: string
+  subject_id: number
+  title: string
+  content: string
+  options: string[] | null
+  answer: string
+  explanation: string
+  difficulty: number
+  score: number
+  knowledge_point: string
+  parent_id?: number
+  position?: number
+  valid: boolean
+  errors?: ImportRowError[]
+}
+
+export interface QuestionImportResult {
+  dry_run: boolean
+  total: number
+  valid_count: number
+  invalid_count: number
+  questions: ImportedQuestion[]
+}
+
+export interface QuestionImportOptions {
+  dry_run: boolean
+  mode?: ImportMode
+  duplicate?: 'skip' | 'create'
+  idempotency_key?: string
+  subject_id?: number
+  difficulty?: number
+  score?: number
+  visibility?: string
+}
+
+// 从Excel、CSV、Word或文本文件导入题目，dry_run 为 true 时只预览校验结果，否则返回导入任务
+export const importQuestionFile = async (file: File, options: QuestionImportOptions) => {
+  const form = new FormData()
+  form.append('file', file)
+  Object.entries(options).forEach(([key, value]) => {
+    if (value !== undefined && value !== null && value !== '') {
+      form.append(key, String(value))
+    }
+  })
+  const response = await api.post<QuestionImportResult & { job?: ImportJob }>('/teacher/questions/import/file', form, {
+    headers: { 'Content-Type': 'multipart/form-data' },
+    timeout: 60000
+  })
+  return response.data
+}
+
+// 导入模式：all_or_nothing 有错误时全部不导入，best_effort 跳过出错的行
+export type ImportMode = 'all_or_nothing' | 'best_effort'
+
+// 单行的错误（field 为出错的字段）
+export interface ImportRowError {
+  row: number
+  field?: string
+  reason: string
+}
+
+export interface ImportJob {
+  id: number
+  kind: string
+  mode: ImportMode
+  status: 'pending' | 'running' | 'completed' | 'failed'
+  source: string
+  total: number
+  created_count: number
+  updated_count: number
+  skipped_count: number
+  failed_count: number
+  error: string
+  created_at: string
+  finished_at: string | null
+}
+
+export interface ImportReport {
+  job_id: number
+  status: string
+  total: number
+  created: number
+  updated: number
+  skipped: number
+  failed: number
+  rows: {
+    row: number
+    key: string
+    status: 'created' | 'updated' | 'skipped' | 'failed' | 'not_imported'
+    resource_id?: number
+    errors?: ImportRowError[]
+  }[]
+}
+
+// 获取导入任务，完成后包含逐行报告
+export const getImportJob = (id: number) => {
+  return get<{ job: ImportJob; report?: ImportReport }>(`/import-jobs/${id}`)
+}
+
+// 下载导入报告（csv、json）
+export const downloadImportReport = async (id: number, format = 'csv') => {
+  const response = await api.get(`/import-jobs/${id}/report`, {
+    params: { format },
+    responseType: 'blob'
+  })
+  return response.data as Blob
+}
+
+// 下载导入模板（xlsx、csv、docx、txt）
+export const downloadQuestionImportTemplate = async (format: string) => {
+  const response = await api.get('/teacher/questions/import/template', {
+    params: { format },
+    responseType: 'blob'
+  })
+  return response.data as Blob
+}
+
+// 导出格式：qti（QTI 2.1题目包）、moodle（Moodle XML）、gift
+export type QuestionExportFormat = 'xlsx' | 'csv' | 'json' | 'qti' | 'moodle' | 'gift'
+
+// 导出文件的扩展名
+export const questionExportExtensions: Record<QuestionExportFormat, string> = {
+  xlsx: 'xlsx',
+  csv: 'csv',
+  json: 'json',
+  qti: 'zip',
+  moodle: 'xml',
+  gift: 'gift'
+}
+
+// 按题目列表的筛选条件导出题目，unsupported 为无法用该格式表示而未导出的题目ID
+export const exportQuestions = async (format: QuestionExportFormat, params: Omit<QuestionListParams, 'page' | 'size'>) => {
+  const response = await api.get('/teacher/questions/export', {
+    params: { ...params, format },
+    responseType: 'blob',
+    timeout: 120000
+  })
+  const unsupported = String(response.headers['x-unsupported-questions'] || '')
+  return {
+    blob: response.data as Blob,
+    unsupported: unsupported ? unsupported.split(',').map(Number) : []
+  }
+}
+
+// 题目的一个版本，每次修改题目内容保存一个新版本
+export interface QuestionRevision {
+  id: number
+  question_id: number
+  version: number
+  type: string
+  title: string
+  content: string
+  options?: string
+  answer: string
+  choices?: QuestionOption[]
+  explanation?: string
+  difficulty: number
+  score: number
+  knowledge_point?: string
+  parent_id?: number | null
+  position?: number
+  created_by?: number
+  created_at?: string
+  changed_fields?: string[] // 相对上一版本改动的字段（版本历史中返回）
+}
+
+// 两个版本的差异，选项按选项ID对应
+export interface QuestionRevisionDiff {
+  question_id: number
+  from: number
+  to: number
+  fields: { field: string; before: unknown; after: unknown }[]
+  options: { option_id: number; change: 'added' | 'removed' | 'changed'; before?: QuestionOption; after?: QuestionOption }[]
+}
+
+// 获取题目的版本历史（从新到旧）
+export const getQuestionRevisions = (id: number) => {
+  return get(`/teacher/questions/${id}/revisions`)
+}
+
+// 获取题目指定版本的内容
+export const getQuestionRevision = (id: number, version: number) => {
+  return get(`/teacher/questions/${id}/revisions/${version}`)
+}
+
+// 比较题目的两个版本，不传版本号时比较最新版本和上一版本
+export const diffQuestionRevisions = (id: number, params?: { from?: number; to?: number }) => {
+  return get(`/teacher/questions/${id}/revisions/diff`, params)
+}
+
+// 审核动作：提交、撤回、归档和恢复需要编辑权限，通过、驳回和发布需要科目审核人
+export type QuestionReviewAction = 'submit' | 'withdraw' | 'approve' | 'reject' | 'publish' | 'archive' | 'restore'
+
+// 题目的一条审核记录
+export interface QuestionReview {
+  id: number
+  question_id: number
+  version: number
+  action: QuestionReviewAction | 'revise' | 'legacy' // revise：修改已提交或已通过审核的题目后自动退回草稿；legacy：审核流程上线前题目的迁移记录
+  from_status: QuestionStatus
+  to_status: QuestionStatus
+  comment: string
+  user_id: number
+  user?: { id: number; name: string; username: string }
+  created_at: string
+}
+
+// 审核队列：可以审核的科目中待审核（或 status=approved 待发布）的题目
+export const getQuestionReviewQueue = (params?: { status?: 'submitted' | 'approved'; subject_id?: number; mine?: boolean; page?: number; size?: number }) => {
+  return get('/teacher/questions/reviews', params)
+}
+
+// 对题目执行审核动作，驳回时需填写意见
+export const reviewQuestion = (id: number, action: QuestionReviewAction, comment = '') => {
+  return post(`/teacher/questions/${id}/review`, { action, comment })
+}
+
+// 获取题目的审核记录
+export const getQuestionReviews = (id: number) => {
+  return get(`/teacher/questions/${id}/reviews`)
 }
 
 // 获取题目统计
@@ -49,4 +49,23 @@ export const updateSubject = (id: number, data: {
 // 删除科目
 export const deleteSubject = (id: number): Promise<void> => {
   return del(`/api/subjects/${id}`)
-}
\ No newline at end of file
+}
+
+// 科目审核人，负责审核该科目下提交的题目
+export interface SubjectReviewer {
+  id: number
+  subject_id: number
+  user_id: number
+  user?: { id: number; name: string; username: string }
+  created_at?: string
+}
+
+// 获取科目的审核人
+export const getSubjectReviewers = (id: number): Promise<{ subject_id: number; reviewers: SubjectReviewer[] }> => {
+  return get(`/admin/subjects/${id}/reviewers`)
+}
+
+// 设置科目的审核人（整体替换），需为本租户的教师或管理员
+export const updateSubjectReviewers = (id: number, userIds: number[]): Promise<{ subject_id: number; reviewers: SubjectReviewer[] }> => {
+  return put(`/admin/subjects/${id}/reviewers`, { user_ids: userIds })
+}